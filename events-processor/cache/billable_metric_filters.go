@@ -21,7 +21,9 @@ func (c *Cache) buildBillableMetricFilterKey(organizationID, billableMetricID, i
 
 func (c *Cache) SetBillableMetricFilter(bmf *models.BillableMetricFilter) utils.Result[bool] {
 	key := c.buildBillableMetricFilterKey(bmf.OrganizationID, bmf.BillableMetricID, bmf.ID)
-	return setJSON(c, key, bmf)
+	res := setJSON(c, key, bmf)
+	c.bumpFiltersVersion(bmf.OrganizationID)
+	return res
 }
 
 func (c *Cache) GetBillableMetricFilter(organizationID, billableMetricID, id string) utils.Result[*models.BillableMetricFilter] {
@@ -37,7 +39,9 @@ func (c *Cache) SearchBillableMetricFilters(organizationID, billableMetricID str
 
 func (c *Cache) DeleteBillableMetricFilter(bmf *models.BillableMetricFilter) utils.Result[bool] {
 	key := c.buildBillableMetricFilterKey(bmf.OrganizationID, bmf.BillableMetricID, bmf.ID)
-	return delete(c, key)
+	res := delete(c, key)
+	c.bumpFiltersVersion(bmf.OrganizationID)
+	return res
 }
 
 func (c *Cache) LoadBillableMetricFiltersSnapshot(db *gorm.DB) utils.Result[int] {
@@ -49,7 +53,9 @@ func (c *Cache) LoadBillableMetricFiltersSnapshot(db *gorm.DB) utils.Result[int]
 			if res.Failure() {
 				return nil, res.Error()
 			}
-			return res.Value(), nil
+			return selectOrganizations(c, res.Value(), func(bmf *models.BillableMetricFilter) string {
+				return bmf.OrganizationID
+			}), nil
 		},
 		func(bmf *models.BillableMetricFilter) string {
 			return c.buildBillableMetricFilterKey(bmf.OrganizationID, bmf.BillableMetricID, bmf.ID)
@@ -82,5 +88,8 @@ func (c *Cache) StartBillableMetricFiltersConsumer(ctx context.Context) error {
 		Delete: func(bmf *models.BillableMetricFilter) utils.Result[bool] {
 			return c.DeleteBillableMetricFilter(bmf)
 		},
+		GetOrganizationID: func(bmf *models.BillableMetricFilter) string {
+			return bmf.OrganizationID
+		},
 	})
 }
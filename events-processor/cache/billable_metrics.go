@@ -21,7 +21,9 @@ func (c *Cache) buildBillableMetricKey(organizationID, code string) string {
 
 func (c *Cache) SetBillableMetric(bm *models.BillableMetric) utils.Result[bool] {
 	key := c.buildBillableMetricKey(bm.OrganizationID, bm.Code)
-	return setJSON(c, key, bm)
+	res := setJSON(c, key, bm)
+	c.bumpFiltersVersion(bm.OrganizationID)
+	return res
 }
 
 func (c *Cache) GetBillableMetric(organizationID, code string) utils.Result[*models.BillableMetric] {
@@ -31,7 +33,9 @@ func (c *Cache) GetBillableMetric(organizationID, code string) utils.Result[*mod
 
 func (c *Cache) DeleteBillableMetric(bm *models.BillableMetric) utils.Result[bool] {
 	key := c.buildBillableMetricKey(bm.OrganizationID, bm.Code)
-	return delete(c, key)
+	res := delete(c, key)
+	c.bumpFiltersVersion(bm.OrganizationID)
+	return res
 }
 
 func (c *Cache) LoadBillableMetricsSnapshot(db *gorm.DB) utils.Result[int] {
@@ -43,7 +47,9 @@ func (c *Cache) LoadBillableMetricsSnapshot(db *gorm.DB) utils.Result[int] {
 			if res.Failure() {
 				return nil, res.Error()
 			}
-			return res.Value(), nil
+			return selectOrganizations(c, res.Value(), func(bm *models.BillableMetric) string {
+				return bm.OrganizationID
+			}), nil
 		},
 		func(bm *models.BillableMetric) string {
 			return c.buildBillableMetricKey(bm.OrganizationID, bm.Code)
@@ -76,5 +82,8 @@ func (c *Cache) StartBillableMetricsConsumer(ctx context.Context) error {
 		Delete: func(bm *models.BillableMetric) utils.Result[bool] {
 			return c.DeleteBillableMetric(bm)
 		},
+		GetOrganizationID: func(bm *models.BillableMetric) string {
+			return bm.OrganizationID
+		},
 	})
 }
@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	billingEntityPrefix    = "be"
+	billingEntityModelName = "billing_entities"
+	billingEntityTopic     = ".public.billing_entities"
+)
+
+func (c *Cache) buildBillingEntityKey(organizationID, ID string) string {
+	return fmt.Sprintf("%s:%s:%s", billingEntityPrefix, organizationID, ID)
+}
+
+func (c *Cache) SetBillingEntity(billingEntity *models.BillingEntity) utils.Result[bool] {
+	key := c.buildBillingEntityKey(billingEntity.OrganizationID, billingEntity.ID)
+	return setJSON(c, key, billingEntity)
+}
+
+func (c *Cache) GetBillingEntity(organizationID, ID string) utils.Result[*models.BillingEntity] {
+	key := c.buildBillingEntityKey(organizationID, ID)
+	return getJSON[models.BillingEntity](c, key)
+}
+
+// Deleted billing entities are kept as long as the terminated subscriptions of their customers,
+// so we update the cache entry with a 1 month TTL
+func (c *Cache) DeleteBillingEntity(billingEntity *models.BillingEntity) utils.Result[bool] {
+	key := c.buildBillingEntityKey(billingEntity.OrganizationID, billingEntity.ID)
+	ttl := 30 * 24 * time.Hour
+	return deleteWithTTL(c, key, billingEntity, ttl)
+}
+
+func (c *Cache) LoadBillingEntitiesSnapshot(db *gorm.DB) utils.Result[int] {
+	return LoadSnapshot(
+		c,
+		billingEntityModelName,
+		func() ([]models.BillingEntity, error) {
+			res := models.GetAllBillingEntities(db)
+			if res.Failure() {
+				return nil, res.Error()
+			}
+			return selectOrganizations(c, res.Value(), func(billingEntity *models.BillingEntity) string {
+				return billingEntity.OrganizationID
+			}), nil
+		},
+		func(billingEntity *models.BillingEntity) string {
+			return c.buildBillingEntityKey(billingEntity.OrganizationID, billingEntity.ID)
+		},
+	)
+}
+
+func (c *Cache) StartBillingEntitiesConsumer(ctx context.Context) error {
+	return startGenericConsumer(ctx, c, ConsumerConfig[models.BillingEntity]{
+		Topic:     c.debeziumTopicPrefix + billingEntityTopic,
+		ModelName: billingEntityModelName,
+		IsDeleted: func(billingEntity *models.BillingEntity) bool {
+			return billingEntity.DeletedAt.Valid
+		},
+		GetKey: func(billingEntity *models.BillingEntity) string {
+			return c.buildBillingEntityKey(billingEntity.OrganizationID, billingEntity.ID)
+		},
+		GetID: func(billingEntity *models.BillingEntity) string {
+			return billingEntity.ID
+		},
+		GetUpdatedAt: func(billingEntity *models.BillingEntity) int64 {
+			return billingEntity.UpdatedAt.Time.UnixMilli()
+		},
+		GetCached: func(billingEntity *models.BillingEntity) utils.Result[*models.BillingEntity] {
+			return c.GetBillingEntity(billingEntity.OrganizationID, billingEntity.ID)
+		},
+		SetCache: func(billingEntity *models.BillingEntity) utils.Result[bool] {
+			return c.SetBillingEntity(billingEntity)
+		},
+		Delete: func(billingEntity *models.BillingEntity) utils.Result[bool] {
+			return c.DeleteBillingEntity(billingEntity)
+		},
+		GetOrganizationID: func(billingEntity *models.BillingEntity) string {
+			return billingEntity.OrganizationID
+		},
+	})
+}
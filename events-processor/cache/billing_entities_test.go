@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildBillingEntityKey(t *testing.T) {
+	cache := setupTestCache(t)
+
+	key := cache.buildBillingEntityKey("org-123", "be-123")
+	assert.Equal(t, "be:org-123:be-123", key)
+}
+
+func TestGetBillingEntity_Success(t *testing.T) {
+	cache := setupTestCache(t)
+
+	billingEntity := &models.BillingEntity{
+		ID:             "be-123",
+		OrganizationID: "org-123",
+		Timezone:       utils.StringPtr("Europe/Paris"),
+		UpdatedAt:      utils.NowNullTime(),
+	}
+
+	result := cache.SetBillingEntity(billingEntity)
+	require.True(t, result.Success())
+
+	getResult := cache.GetBillingEntity("org-123", "be-123")
+
+	require.True(t, getResult.Success())
+	assert.Equal(t, "Europe/Paris", *getResult.Value().Timezone)
+}
+
+func TestGetBillingEntity_NotFound(t *testing.T) {
+	cache := setupTestCache(t)
+
+	result := cache.GetBillingEntity("org-123", "nonexistent")
+
+	assert.True(t, result.Failure())
+	assert.False(t, result.IsRetryable())
+}
+
+func TestDeleteBillingEntity_KeepsEntryWithTTL(t *testing.T) {
+	cache := setupTestCache(t)
+
+	billingEntity := &models.BillingEntity{
+		ID:             "be-123",
+		OrganizationID: "org-123",
+		Timezone:       utils.StringPtr("Europe/Paris"),
+		DeletedAt:      utils.NowNullTime(),
+	}
+
+	result := cache.DeleteBillingEntity(billingEntity)
+	require.True(t, result.Success())
+
+	getResult := cache.GetBillingEntity("org-123", "be-123")
+	require.True(t, getResult.Success())
+
+	cache.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(cache.buildBillingEntityKey("org-123", "be-123")))
+		require.NoError(t, err)
+		assert.NotZero(t, item.ExpiresAt())
+		return nil
+	})
+}
@@ -6,11 +6,14 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dgraph-io/badger/v4"
 	"github.com/getlago/lago/events-processor/config/database"
+	"github.com/getlago/lago/events-processor/models"
 	"github.com/getlago/lago/events-processor/utils"
 	"golang.org/x/sync/errgroup"
 )
@@ -22,13 +25,19 @@ type Cache struct {
 	db                  *badger.DB
 	logger              *slog.Logger
 	debeziumTopicPrefix string
+	organizations       *models.OrganizationSelector
 	wg                  sync.WaitGroup
+
+	// organization ID -> *atomic.Uint64, bumped when a model used to build the flat filters changes
+	filtersVersions sync.Map
 }
 
 // CacheConfig holds the configuration needed to initialize a new Cache instance.
 type CacheConfig struct {
 	Context             context.Context
 	DebeziumTopicPrefix string
+	// Optional, only the models of the selected organizations are cached
+	OrganizationSelector *models.OrganizationSelector
 }
 
 // NewCache creates and initializes a new in-memory cache instance.
@@ -48,6 +57,7 @@ func NewCache(config CacheConfig) (*Cache, error) {
 		db:                  db,
 		logger:              logger,
 		debeziumTopicPrefix: config.DebeziumTopicPrefix,
+		organizations:       config.OrganizationSelector,
 		ctx:                 config.Context,
 	}, nil
 }
@@ -60,6 +70,22 @@ func (c *Cache) Wait() {
 	c.wg.Wait()
 }
 
+// FiltersVersion returns the version of the flat filters of an organization.
+// It changes whenever a billable metric, a billable metric filter, a charge, a charge filter
+// or a charge filter value of the organization is updated or deleted.
+func (c *Cache) FiltersVersion(organizationID string) uint64 {
+	version, ok := c.filtersVersions.Load(organizationID)
+	if !ok {
+		return 0
+	}
+	return version.(*atomic.Uint64).Load()
+}
+
+func (c *Cache) bumpFiltersVersion(organizationID string) {
+	version, _ := c.filtersVersions.LoadOrStore(organizationID, &atomic.Uint64{})
+	version.(*atomic.Uint64).Add(1)
+}
+
 func (c *Cache) LoadInitialSnapshot() {
 	dbConfig := database.DBConfig{
 		Url:      os.Getenv("DATABASE_URL"),
@@ -85,6 +111,26 @@ func (c *Cache) LoadInitialSnapshot() {
 		return nil
 	})
 
+	errGroup.Go(func() error {
+		c.LoadCustomersSnapshot(db.Connection)
+		return nil
+	})
+
+	errGroup.Go(func() error {
+		c.LoadPlansSnapshot(db.Connection)
+		return nil
+	})
+
+	errGroup.Go(func() error {
+		c.LoadBillingEntitiesSnapshot(db.Connection)
+		return nil
+	})
+
+	errGroup.Go(func() error {
+		c.LoadOrganizationsSnapshot(db.Connection)
+		return nil
+	})
+
 	errGroup.Go(func() error {
 		c.LoadChargesSnapshot(db.Connection)
 		return nil
@@ -104,6 +150,26 @@ func (c *Cache) LoadInitialSnapshot() {
 		c.LoadChargeFilterValuesSnapshot(db.Connection)
 		return nil
 	})
+
+	errGroup.Go(func() error {
+		c.LoadUsageThresholdsSnapshot(db.Connection)
+		return nil
+	})
+
+	errGroup.Go(func() error {
+		c.LoadUsageAlertsSnapshot(db.Connection)
+		return nil
+	})
+
+	errGroup.Go(func() error {
+		c.LoadUsageAlertThresholdsSnapshot(db.Connection)
+		return nil
+	})
+
+	errGroup.Go(func() error {
+		c.LoadWalletsSnapshot(db.Connection)
+		return nil
+	})
 }
 
 func (c *Cache) ConsumeChanges() error {
@@ -113,10 +179,18 @@ func (c *Cache) ConsumeChanges() error {
 	}{
 		{"billable metrics", c.StartBillableMetricsConsumer},
 		{"subscriptions", c.StartSubscriptionsConsumer},
+		{"customers", c.StartCustomersConsumer},
+		{"plans", c.StartPlansConsumer},
+		{"billing entities", c.StartBillingEntitiesConsumer},
+		{"organizations", c.StartOrganizationsConsumer},
 		{"charges", c.StartChargesConsumer},
 		{"billable metric filters", c.StartBillableMetricFiltersConsumer},
 		{"charge filters", c.StartChargeFiltersConsumer},
 		{"charge filter values", c.StartChargeFilterValuesConsumer},
+		{"usage thresholds", c.StartUsageThresholdsConsumer},
+		{"usage alerts", c.StartUsageAlertsConsumer},
+		{"usage alert thresholds", c.StartUsageAlertThresholdsConsumer},
+		{"wallets", c.StartWalletsConsumer},
 	}
 
 	for _, consumer := range consumers {
@@ -144,6 +218,39 @@ func setJSON[T any](cache *Cache, key string, value *T) utils.Result[bool] {
 	return utils.SuccessResult(true)
 }
 
+// setIndexedJSON stores the same value under several keys (eg: a primary key and secondary indexes) in a single transaction
+func setIndexedJSON[T any](cache *Cache, keys []string, value *T) utils.Result[bool] {
+	return setReindexedJSON(cache, keys, value, nil)
+}
+
+// setReindexedJSON stores the value like setIndexedJSON. When keysOf is set, the index keys of the value
+// cached under the primary key (the first key) are removed in the same transaction when they changed,
+// eg: the index of a previous code.
+func setReindexedJSON[T any](cache *Cache, keys []string, value *T, keysOf func(*T) []string) utils.Result[bool] {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return utils.FailedBoolResult(err)
+	}
+
+	err = cache.db.Update(func(txn *badger.Txn) error {
+		if err := deleteStaleKeys(txn, keys, keysOf); err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			if err := txn.Set([]byte(key), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return utils.FailedBoolResult(err)
+	}
+
+	return utils.SuccessResult(true)
+}
+
 func delete(cache *Cache, key string) utils.Result[bool] {
 	err := cache.db.Update(func(txn *badger.Txn) error {
 		return txn.Delete([]byte(key))
@@ -155,17 +262,63 @@ func delete(cache *Cache, key string) utils.Result[bool] {
 	return utils.SuccessResult(true)
 }
 
+// deleteIndexed removes a value stored under several keys in a single transaction
+func deleteIndexed(cache *Cache, keys []string) utils.Result[bool] {
+	return deleteReindexed[any](cache, keys, nil)
+}
+
+// deleteReindexed removes the value like deleteIndexed, with the index keys of the cached value when keysOf is set
+func deleteReindexed[T any](cache *Cache, keys []string, keysOf func(*T) []string) utils.Result[bool] {
+	err := cache.db.Update(func(txn *badger.Txn) error {
+		if err := deleteStaleKeys(txn, keys, keysOf); err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			if err := txn.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return utils.FailedBoolResult(err)
+	}
+
+	return utils.SuccessResult(true)
+}
+
 // deleteWithTTL schedules a delayed deletion by setting the key with a TTL
 // The key will remain accessible with its current value until the TTL expires.
 func deleteWithTTL[T any](cache *Cache, key string, value *T, ttl time.Duration) utils.Result[bool] {
+	return deleteIndexedWithTTL(cache, []string{key}, value, ttl)
+}
+
+// deleteIndexedWithTTL schedules a delayed deletion of a value stored under several keys
+func deleteIndexedWithTTL[T any](cache *Cache, keys []string, value *T, ttl time.Duration) utils.Result[bool] {
+	return deleteReindexedWithTTL(cache, keys, value, ttl, nil)
+}
+
+// deleteReindexedWithTTL schedules the deletion like deleteIndexedWithTTL,
+// the changed index keys of the cached value are removed right away when keysOf is set
+func deleteReindexedWithTTL[T any](cache *Cache, keys []string, value *T, ttl time.Duration, keysOf func(*T) []string) utils.Result[bool] {
 	data, err := json.Marshal(value)
 	if err != nil {
 		return utils.FailedBoolResult(err)
 	}
 
 	err = cache.db.Update(func(txn *badger.Txn) error {
-		entry := badger.NewEntry([]byte(key), data).WithTTL(ttl)
-		return txn.SetEntry(entry)
+		if err := deleteStaleKeys(txn, keys, keysOf); err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			entry := badger.NewEntry([]byte(key), data).WithTTL(ttl)
+			if err := txn.SetEntry(entry); err != nil {
+				return err
+			}
+		}
+		return nil
 	})
 	if err != nil {
 		return utils.FailedBoolResult(err)
@@ -174,6 +327,37 @@ func deleteWithTTL[T any](cache *Cache, key string, value *T, ttl time.Duration)
 	return utils.SuccessResult(true)
 }
 
+// deleteStaleKeys removes the keys of the value cached under the primary key (the first key) that are not in keys
+func deleteStaleKeys[T any](txn *badger.Txn, keys []string, keysOf func(*T) []string) error {
+	if keysOf == nil {
+		return nil
+	}
+
+	item, err := txn.Get([]byte(keys[0]))
+	if err == badger.ErrKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var cached T
+	if err := item.Value(func(val []byte) error { return json.Unmarshal(val, &cached) }); err != nil {
+		return err
+	}
+
+	for _, key := range keysOf(&cached) {
+		if slices.Contains(keys, key) {
+			continue
+		}
+		if err := txn.Delete([]byte(key)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func getJSON[T any](cache *Cache, key string) utils.Result[*T] {
 	var out T
 	err := cache.db.View(func(txn *badger.Txn) error {
@@ -228,11 +412,43 @@ func searchJSON[T any](cache *Cache, prefix string) utils.Result[[]*T] {
 	return utils.SuccessResult(results)
 }
 
+// selectOrganizations keeps the models of the organizations selected by the instance
+func selectOrganizations[T any](cache *Cache, list []T, organizationIDFn func(*T) string) []T {
+	if cache.organizations == nil {
+		return list
+	}
+
+	selected := make([]T, 0, len(list))
+	for i := range list {
+		if cache.organizations.Selects(organizationIDFn(&list[i])) {
+			selected = append(selected, list[i])
+		}
+	}
+
+	return selected
+}
+
 func LoadSnapshot[T any](
 	cache *Cache,
 	name string,
 	fetchFn func() ([]T, error),
 	keyFn func(*T) string,
+) utils.Result[int] {
+	return LoadIndexedSnapshot(cache, name, fetchFn, func(item *T) []string {
+		key := keyFn(item)
+		if key == "" {
+			return nil
+		}
+		return []string{key}
+	})
+}
+
+// LoadIndexedSnapshot loads a snapshot of models stored under several keys (eg: a primary key and secondary indexes)
+func LoadIndexedSnapshot[T any](
+	cache *Cache,
+	name string,
+	fetchFn func() ([]T, error),
+	keysFn func(*T) []string,
 ) utils.Result[int] {
 	cache.logger.Info("Starting snapshot load", slog.String("model", name))
 	start := time.Now()
@@ -245,15 +461,15 @@ func LoadSnapshot[T any](
 	count := 0
 	for i := range list {
 		item := &list[i]
-		key := keyFn(item)
-		if key == "" {
+		keys := keysFn(item)
+		if len(keys) == 0 {
 			continue
 		}
-		if res := setJSON(cache, key, item); res.Failure() {
+		if res := setIndexedJSON(cache, keys, item); res.Failure() {
 			cache.logger.Error(
 				"Failed to cache item",
 				slog.String("model", name),
-				slog.String("key", key),
+				slog.String("key", keys[0]),
 				slog.String("error", res.ErrorMsg()),
 			)
 			utils.CaptureErrorResult(res)
@@ -9,6 +9,8 @@ import (
 	"github.com/dgraph-io/badger/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/getlago/lago/events-processor/models"
 )
 
 func TestNewCache(t *testing.T) {
@@ -545,3 +547,40 @@ func TestSearchJSON_NestedPrefixes(t *testing.T) {
 	assert.Len(t, adminResult.Value(), 1)
 	assert.Equal(t, "admin", adminResult.Value()[0].Type)
 }
+
+func TestLoadSnapshot_SelectedOrganizations(t *testing.T) {
+	selector, err := models.NewOrganizationSelector(nil, []string{"org_2"}, "")
+	require.NoError(t, err)
+
+	cache, err := NewCache(CacheConfig{
+		Context:              context.Background(),
+		OrganizationSelector: selector,
+	})
+	require.NoError(t, err)
+	defer cache.Close()
+
+	type testItem struct {
+		ID             string
+		OrganizationID string
+	}
+
+	fetchFn := func() ([]testItem, error) {
+		items := []testItem{
+			{ID: "1", OrganizationID: "org_1"},
+			{ID: "2", OrganizationID: "org_2"},
+			{ID: "3", OrganizationID: "org_1"},
+		}
+		return selectOrganizations(cache, items, func(item *testItem) string { return item.OrganizationID }), nil
+	}
+
+	keyFn := func(item *testItem) string {
+		return "item:" + item.ID
+	}
+
+	result := LoadSnapshot(cache, "test_item", fetchFn, keyFn)
+
+	require.True(t, result.Success())
+	assert.Equal(t, 2, result.Value())
+	assert.True(t, getJSON[testItem](cache, "item:1").Success())
+	assert.True(t, getJSON[testItem](cache, "item:2").Failure())
+}
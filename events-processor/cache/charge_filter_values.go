@@ -21,7 +21,9 @@ func (c *Cache) buildChargeFilterValueKey(organizationID, chargeFilterID, billab
 
 func (c *Cache) SetChargeFilterValue(cfv *models.ChargeFilterValue) utils.Result[bool] {
 	key := c.buildChargeFilterValueKey(cfv.OrganizationID, cfv.ChargeFilterID, cfv.BillableMetricFilterID, cfv.ID)
-	return setJSON(c, key, cfv)
+	res := setJSON(c, key, cfv)
+	c.bumpFiltersVersion(cfv.OrganizationID)
+	return res
 }
 
 func (c *Cache) GetChargeFilterValue(organizationID, chargeFilterID, billableMetricFilterID, id string) utils.Result[*models.ChargeFilterValue] {
@@ -36,7 +38,9 @@ func (c *Cache) SearchChargeFilterValue(organizationID, chargeFilterID string) u
 
 func (c *Cache) DeleteChargeFilterValue(cfv *models.ChargeFilterValue) utils.Result[bool] {
 	key := c.buildChargeFilterValueKey(cfv.OrganizationID, cfv.ChargeFilterID, cfv.BillableMetricFilterID, cfv.ID)
-	return delete(c, key)
+	res := delete(c, key)
+	c.bumpFiltersVersion(cfv.OrganizationID)
+	return res
 }
 
 func (c *Cache) LoadChargeFilterValuesSnapshot(db *gorm.DB) utils.Result[int] {
@@ -48,7 +52,9 @@ func (c *Cache) LoadChargeFilterValuesSnapshot(db *gorm.DB) utils.Result[int] {
 			if res.Failure() {
 				return nil, res.Error()
 			}
-			return res.Value(), nil
+			return selectOrganizations(c, res.Value(), func(cfv *models.ChargeFilterValue) string {
+				return cfv.OrganizationID
+			}), nil
 		},
 		func(cfv *models.ChargeFilterValue) string {
 			return c.buildChargeFilterValueKey(cfv.OrganizationID, cfv.ChargeFilterID, cfv.BillableMetricFilterID, cfv.ID)
@@ -81,5 +87,8 @@ func (c *Cache) StartChargeFilterValuesConsumer(ctx context.Context) error {
 		Delete: func(cfv *models.ChargeFilterValue) utils.Result[bool] {
 			return c.DeleteChargeFilterValue(cfv)
 		},
+		GetOrganizationID: func(cfv *models.ChargeFilterValue) string {
+			return cfv.OrganizationID
+		},
 	})
 }
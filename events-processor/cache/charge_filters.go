@@ -21,7 +21,9 @@ func (c *Cache) buildChargeFilterKey(organizationID, chargeID, id string) string
 
 func (c *Cache) SetChargeFilter(cf *models.ChargeFilter) utils.Result[bool] {
 	key := c.buildChargeFilterKey(cf.OrganizationID, cf.ChargeID, cf.ID)
-	return setJSON(c, key, cf)
+	res := setJSON(c, key, cf)
+	c.bumpFiltersVersion(cf.OrganizationID)
+	return res
 }
 
 func (c *Cache) GetChargeFilter(organizationID, chargeID, id string) utils.Result[*models.ChargeFilter] {
@@ -36,7 +38,9 @@ func (c *Cache) SearchChargeFilter(organizationID, chargeID string) utils.Result
 
 func (c *Cache) DeleteChargeFilter(cf *models.ChargeFilter) utils.Result[bool] {
 	key := c.buildChargeFilterKey(cf.OrganizationID, cf.ChargeID, cf.ID)
-	return delete(c, key)
+	res := delete(c, key)
+	c.bumpFiltersVersion(cf.OrganizationID)
+	return res
 }
 
 func (c *Cache) LoadChargeFiltersSnapshot(db *gorm.DB) utils.Result[int] {
@@ -48,7 +52,9 @@ func (c *Cache) LoadChargeFiltersSnapshot(db *gorm.DB) utils.Result[int] {
 			if res.Failure() {
 				return nil, res.Error()
 			}
-			return res.Value(), nil
+			return selectOrganizations(c, res.Value(), func(cf *models.ChargeFilter) string {
+				return cf.OrganizationID
+			}), nil
 		},
 		func(cf *models.ChargeFilter) string {
 			return c.buildChargeFilterKey(cf.OrganizationID, cf.ChargeID, cf.ID)
@@ -81,5 +87,8 @@ func (c *Cache) StartChargeFiltersConsumer(ctx context.Context) error {
 		Delete: func(cf *models.ChargeFilter) utils.Result[bool] {
 			return c.DeleteChargeFilter(cf)
 		},
+		GetOrganizationID: func(cf *models.ChargeFilter) string {
+			return cf.OrganizationID
+		},
 	})
 }
@@ -21,7 +21,9 @@ func (c *Cache) buildChargeKey(organizationID, planID, billableMetricID, id stri
 
 func (c *Cache) SetCharge(ch *models.Charge) utils.Result[bool] {
 	key := c.buildChargeKey(ch.OrganizationID, ch.PlanID, ch.BillableMetricID, ch.ID)
-	return setJSON(c, key, ch)
+	res := setJSON(c, key, ch)
+	c.bumpFiltersVersion(ch.OrganizationID)
+	return res
 }
 
 func (c *Cache) GetCharge(organizationID, planID, billableMetricID, id string) utils.Result[*models.Charge] {
@@ -36,7 +38,9 @@ func (c *Cache) SearchCharge(organizationID, planID, billableMetricID string) ut
 
 func (c *Cache) DeleteCharge(ch *models.Charge) utils.Result[bool] {
 	key := c.buildChargeKey(ch.OrganizationID, ch.PlanID, ch.BillableMetricID, ch.ID)
-	return delete(c, key)
+	res := delete(c, key)
+	c.bumpFiltersVersion(ch.OrganizationID)
+	return res
 }
 
 func (c *Cache) LoadChargesSnapshot(db *gorm.DB) utils.Result[int] {
@@ -48,7 +52,9 @@ func (c *Cache) LoadChargesSnapshot(db *gorm.DB) utils.Result[int] {
 			if res.Failure() {
 				return nil, res.Error()
 			}
-			return res.Value(), nil
+			return selectOrganizations(c, res.Value(), func(ch *models.Charge) string {
+				return ch.OrganizationID
+			}), nil
 		},
 		func(ch *models.Charge) string {
 			return c.buildChargeKey(ch.OrganizationID, ch.PlanID, ch.BillableMetricID, ch.ID)
@@ -81,5 +87,8 @@ func (c *Cache) StartChargesConsumer(ctx context.Context) error {
 		Delete: func(ch *models.Charge) utils.Result[bool] {
 			return c.DeleteCharge(ch)
 		},
+		GetOrganizationID: func(ch *models.Charge) string {
+			return ch.OrganizationID
+		},
 	})
 }
@@ -21,6 +21,9 @@ type ConsumerConfig[T any] struct {
 	GetCached    func(*T) utils.Result[*T]
 	SetCache     func(*T) utils.Result[bool]
 	Delete       func(*T) utils.Result[bool]
+
+	// Optional, the records of the organizations not selected by the instance are skipped
+	GetOrganizationID func(*T) string
 }
 
 func startGenericConsumer[T any](ctx context.Context, cache *Cache, config ConsumerConfig[T]) error {
@@ -102,6 +105,10 @@ func processRecord[T any](cache *Cache, record *kgo.Record, config ConsumerConfi
 		return
 	}
 
+	if config.GetOrganizationID != nil && !cache.organizations.Selects(config.GetOrganizationID(&model)) {
+		return
+	}
+
 	key := config.GetKey(&model)
 
 	if config.IsDeleted(&model) {
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/dgraph-io/badger/v4"
+	"github.com/getlago/lago/events-processor/models"
 	"github.com/getlago/lago/events-processor/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -319,3 +320,38 @@ func TestProcessRecord_InvalidJSON(t *testing.T) {
 
 	assert.False(t, setCalled, "SetCache should not be called for invalid JSON")
 }
+
+func TestProcessRecord_OrganizationNotSelected(t *testing.T) {
+	selector, err := models.NewOrganizationSelector([]string{"org_1"}, nil, "")
+	require.NoError(t, err)
+
+	cache, err := NewCache(CacheConfig{
+		Context:              context.Background(),
+		OrganizationSelector: selector,
+	})
+	require.NoError(t, err)
+	defer cache.Close()
+
+	var setCalls []string
+	config := ConsumerConfig[testModel]{
+		ModelName:    "test_model",
+		IsDeleted:    func(m *testModel) bool { return m.DeletedAt },
+		GetKey:       func(m *testModel) string { return "test:" + m.ID },
+		GetID:        func(m *testModel) string { return m.ID },
+		GetUpdatedAt: func(m *testModel) int64 { return m.UpdatedAt },
+		GetCached: func(m *testModel) utils.Result[*testModel] {
+			return utils.FailedResult[*testModel](errors.New("not found")).NonRetryable()
+		},
+		SetCache: func(m *testModel) utils.Result[bool] {
+			setCalls = append(setCalls, m.ID)
+			return utils.SuccessResult(true)
+		},
+		// The name of the test model holds its organization
+		GetOrganizationID: func(m *testModel) string { return m.Name },
+	}
+
+	processRecord(cache, createTestRecord(t, testModel{ID: "1", Name: "org_1", UpdatedAt: 1}), config)
+	processRecord(cache, createTestRecord(t, testModel{ID: "2", Name: "org_2", UpdatedAt: 1}), config)
+
+	assert.Equal(t, []string{"1"}, setCalls)
+}
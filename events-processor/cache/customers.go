@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	customerPrefix = "cus"
+	// Secondary index to find the customers by external ID
+	customerExternalIDPrefix = "cus_ext"
+	customerModelName        = "customers"
+	customerTopic            = ".public.customers"
+)
+
+func (c *Cache) buildCustomerKey(organizationID, ID string) string {
+	return fmt.Sprintf("%s:%s:%s", customerPrefix, organizationID, ID)
+}
+
+func (c *Cache) buildCustomerExternalIDKey(organizationID, externalID, ID string) string {
+	return fmt.Sprintf("%s:%s:%s:%s", customerExternalIDPrefix, organizationID, externalID, ID)
+}
+
+func (c *Cache) customerKeys(customer *models.Customer) []string {
+	return []string{
+		c.buildCustomerKey(customer.OrganizationID, customer.ID),
+		c.buildCustomerExternalIDKey(customer.OrganizationID, customer.ExternalID, customer.ID),
+	}
+}
+
+// SetCustomer caches the customer, the index of its previous external ID is removed when the external ID changed
+func (c *Cache) SetCustomer(customer *models.Customer) utils.Result[bool] {
+	return setReindexedJSON(c, c.customerKeys(customer), customer, c.customerKeys)
+}
+
+func (c *Cache) GetCustomer(organizationID, ID string) utils.Result[*models.Customer] {
+	key := c.buildCustomerKey(organizationID, ID)
+	return getJSON[models.Customer](c, key)
+}
+
+// SearchCustomer returns the customer with the given external ID.
+// As an external ID can be reused after a deletion, active customers are preferred over deleted ones.
+func (c *Cache) SearchCustomer(organizationID, externalID string) utils.Result[*models.Customer] {
+	prefix := fmt.Sprintf("%s:%s:%s:", customerExternalIDPrefix, organizationID, externalID)
+	result := searchJSON[models.Customer](c, prefix)
+	if result.Failure() {
+		return utils.FailedResult[*models.Customer](result.Error())
+	}
+
+	var bestMatch *models.Customer
+	for _, customer := range result.Value() {
+		switch {
+		case bestMatch == nil:
+			bestMatch = customer
+		case !customer.DeletedAt.Valid && bestMatch.DeletedAt.Valid:
+			bestMatch = customer
+		case customer.DeletedAt.Valid && bestMatch.DeletedAt.Valid && customer.DeletedAt.Time.After(bestMatch.DeletedAt.Time):
+			bestMatch = customer
+		}
+	}
+
+	if bestMatch == nil {
+		return utils.FailedResult[*models.Customer](badger.ErrKeyNotFound).NonCapturable().NonRetryable()
+	}
+
+	return utils.SuccessResult(bestMatch)
+}
+
+// Deleted customers are kept as long as their terminated subscriptions,
+// so we update the cache entry with a 1 month TTL
+func (c *Cache) DeleteCustomer(customer *models.Customer) utils.Result[bool] {
+	ttl := 30 * 24 * time.Hour
+	return deleteReindexedWithTTL(c, c.customerKeys(customer), customer, ttl, c.customerKeys)
+}
+
+func (c *Cache) LoadCustomersSnapshot(db *gorm.DB) utils.Result[int] {
+	return LoadIndexedSnapshot(
+		c,
+		customerModelName,
+		func() ([]models.Customer, error) {
+			res := models.GetAllCustomers(db)
+			if res.Failure() {
+				return nil, res.Error()
+			}
+			return selectOrganizations(c, res.Value(), func(customer *models.Customer) string {
+				return customer.OrganizationID
+			}), nil
+		},
+		func(customer *models.Customer) []string {
+			return c.customerKeys(customer)
+		},
+	)
+}
+
+func (c *Cache) StartCustomersConsumer(ctx context.Context) error {
+	return startGenericConsumer(ctx, c, ConsumerConfig[models.Customer]{
+		Topic:     c.debeziumTopicPrefix + customerTopic,
+		ModelName: customerModelName,
+		IsDeleted: func(customer *models.Customer) bool {
+			return customer.DeletedAt.Valid
+		},
+		GetKey: func(customer *models.Customer) string {
+			return c.buildCustomerKey(customer.OrganizationID, customer.ID)
+		},
+		GetID: func(customer *models.Customer) string {
+			return customer.ID
+		},
+		GetUpdatedAt: func(customer *models.Customer) int64 {
+			return customer.UpdatedAt.Time.UnixMilli()
+		},
+		GetCached: func(customer *models.Customer) utils.Result[*models.Customer] {
+			return c.GetCustomer(customer.OrganizationID, customer.ID)
+		},
+		SetCache: func(customer *models.Customer) utils.Result[bool] {
+			return c.SetCustomer(customer)
+		},
+		Delete: func(customer *models.Customer) utils.Result[bool] {
+			return c.DeleteCustomer(customer)
+		},
+		GetOrganizationID: func(customer *models.Customer) string {
+			return customer.OrganizationID
+		},
+	})
+}
@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildCustomerKey(t *testing.T) {
+	cache := setupTestCache(t)
+
+	key := cache.buildCustomerKey("org-123", "cus-123")
+	assert.Equal(t, "cus:org-123:cus-123", key)
+}
+
+func TestGetCustomer_Success(t *testing.T) {
+	cache := setupTestCache(t)
+
+	customer := &models.Customer{
+		ID:              "cus-123",
+		OrganizationID:  "org-123",
+		ExternalID:      "customer_1",
+		BillingEntityID: utils.StringPtr("be-123"),
+		CreatedAt:       utils.NowNullTime(),
+		UpdatedAt:       utils.NowNullTime(),
+	}
+
+	result := cache.SetCustomer(customer)
+	require.True(t, result.Success())
+
+	getResult := cache.GetCustomer("org-123", "cus-123")
+
+	require.True(t, getResult.Success())
+	retrieved := getResult.Value()
+	assert.Equal(t, customer.ID, retrieved.ID)
+	assert.Equal(t, customer.ExternalID, retrieved.ExternalID)
+	assert.Equal(t, "be-123", *retrieved.BillingEntityID)
+}
+
+func TestGetCustomer_NotFound(t *testing.T) {
+	cache := setupTestCache(t)
+
+	result := cache.GetCustomer("org-123", "nonexistent")
+
+	assert.True(t, result.Failure())
+	assert.False(t, result.IsRetryable())
+}
+
+func TestDeleteCustomer_KeepsEntryWithTTL(t *testing.T) {
+	cache := setupTestCache(t)
+
+	customer := &models.Customer{
+		ID:             "cus-123",
+		OrganizationID: "org-123",
+		ExternalID:     "customer_1",
+		DeletedAt:      utils.NowNullTime(),
+	}
+
+	result := cache.DeleteCustomer(customer)
+	require.True(t, result.Success())
+
+	getResult := cache.GetCustomer("org-123", "cus-123")
+	require.True(t, getResult.Success())
+	assert.Equal(t, "customer_1", getResult.Value().ExternalID)
+
+	cache.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(cache.buildCustomerKey("org-123", "cus-123")))
+		require.NoError(t, err)
+		assert.NotZero(t, item.ExpiresAt())
+		return nil
+	})
+}
+
+func TestSearchCustomer(t *testing.T) {
+	cache := setupTestCache(t)
+
+	deletedCustomer := &models.Customer{
+		ID:             "cus-old",
+		OrganizationID: "org-123",
+		ExternalID:     "customer_1",
+		DeletedAt:      utils.NowNullTime(),
+	}
+	activeCustomer := &models.Customer{
+		ID:             "cus-new",
+		OrganizationID: "org-123",
+		ExternalID:     "customer_1",
+	}
+	require.True(t, cache.DeleteCustomer(deletedCustomer).Success())
+	require.True(t, cache.SetCustomer(activeCustomer).Success())
+
+	result := cache.SearchCustomer("org-123", "customer_1")
+	require.True(t, result.Success())
+	assert.Equal(t, "cus-new", result.Value().ID)
+
+	result = cache.SearchCustomer("org-123", "customer")
+	assert.True(t, result.Failure())
+	assert.False(t, result.IsCapturable())
+}
+
+func TestSetCustomer_ExternalIDChanged(t *testing.T) {
+	cache := setupTestCache(t)
+
+	customer := &models.Customer{ID: "cus-123", OrganizationID: "org-123", ExternalID: "customer_1"}
+	require.True(t, cache.SetCustomer(customer).Success())
+
+	customer.ExternalID = "customer_2"
+	require.True(t, cache.SetCustomer(customer).Success())
+
+	assert.True(t, cache.SearchCustomer("org-123", "customer_1").Failure())
+	result := cache.SearchCustomer("org-123", "customer_2")
+	require.True(t, result.Success())
+	assert.Equal(t, "cus-123", result.Value().ID)
+
+	// The previous external ID is removed right away when the customer is deleted
+	customer.ExternalID = "customer_3"
+	customer.DeletedAt = utils.NowNullTime()
+	require.True(t, cache.DeleteCustomer(customer).Success())
+
+	assert.True(t, cache.SearchCustomer("org-123", "customer_2").Failure())
+	assert.True(t, cache.SearchCustomer("org-123", "customer_3").Success())
+}
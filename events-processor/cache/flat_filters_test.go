@@ -294,3 +294,45 @@ func TestBuildFlatFilters_MultipleCharges(t *testing.T) {
 	assert.Contains(t, chargeIDS, chargeID1)
 	assert.Contains(t, chargeIDS, chargeID2)
 }
+
+func TestFiltersVersion(t *testing.T) {
+	cache := setupTestCache(t)
+
+	orgID := uuid.New().String()
+	otherOrgID := uuid.New().String()
+	assert.Equal(t, uint64(0), cache.FiltersVersion(orgID))
+
+	version := cache.FiltersVersion(orgID)
+	bumped := func() bool {
+		current := cache.FiltersVersion(orgID)
+		changed := current != version
+		version = current
+		return changed
+	}
+
+	cache.SetBillableMetric(&models.BillableMetric{ID: "bm", OrganizationID: orgID, Code: "code"})
+	assert.True(t, bumped())
+
+	cache.SetBillableMetricFilter(&models.BillableMetricFilter{ID: "bmf", OrganizationID: orgID, BillableMetricID: "bm"})
+	assert.True(t, bumped())
+
+	cache.SetCharge(&models.Charge{ID: "ch", OrganizationID: orgID, PlanID: "plan", BillableMetricID: "bm"})
+	assert.True(t, bumped())
+
+	cache.SetChargeFilter(&models.ChargeFilter{ID: "cf", OrganizationID: orgID, ChargeID: "ch"})
+	assert.True(t, bumped())
+
+	cfv := &models.ChargeFilterValue{ID: "cfv", OrganizationID: orgID, ChargeFilterID: "cf", BillableMetricFilterID: "bmf"}
+	cache.SetChargeFilterValue(cfv)
+	assert.True(t, bumped())
+
+	cache.DeleteChargeFilterValue(cfv)
+	assert.True(t, bumped())
+
+	cache.SetCustomer(&models.Customer{ID: "cus", OrganizationID: orgID})
+	assert.False(t, bumped())
+
+	cache.SetCharge(&models.Charge{ID: "ch", OrganizationID: otherOrgID, PlanID: "plan", BillableMetricID: "bm"})
+	assert.False(t, bumped())
+	assert.Equal(t, uint64(1), cache.FiltersVersion(otherOrgID))
+}
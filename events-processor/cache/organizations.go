@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	organizationPrefix    = "org"
+	organizationModelName = "organizations"
+	organizationTopic     = ".public.organizations"
+)
+
+func (c *Cache) buildOrganizationKey(ID string) string {
+	return fmt.Sprintf("%s:%s", organizationPrefix, ID)
+}
+
+func (c *Cache) SetOrganization(organization *models.Organization) utils.Result[bool] {
+	key := c.buildOrganizationKey(organization.ID)
+	return setJSON(c, key, organization)
+}
+
+func (c *Cache) GetOrganization(ID string) utils.Result[*models.Organization] {
+	key := c.buildOrganizationKey(ID)
+	return getJSON[models.Organization](c, key)
+}
+
+func (c *Cache) DeleteOrganization(organization *models.Organization) utils.Result[bool] {
+	return delete(c, c.buildOrganizationKey(organization.ID))
+}
+
+func (c *Cache) LoadOrganizationsSnapshot(db *gorm.DB) utils.Result[int] {
+	return LoadSnapshot(
+		c,
+		organizationModelName,
+		func() ([]models.Organization, error) {
+			res := models.GetAllOrganizations(db)
+			if res.Failure() {
+				return nil, res.Error()
+			}
+			return selectOrganizations(c, res.Value(), func(organization *models.Organization) string {
+				return organization.ID
+			}), nil
+		},
+		func(organization *models.Organization) string {
+			return c.buildOrganizationKey(organization.ID)
+		},
+	)
+}
+
+// Organizations are never deleted, only their updates are consumed
+func (c *Cache) StartOrganizationsConsumer(ctx context.Context) error {
+	return startGenericConsumer(ctx, c, ConsumerConfig[models.Organization]{
+		Topic:     c.debeziumTopicPrefix + organizationTopic,
+		ModelName: organizationModelName,
+		IsDeleted: func(organization *models.Organization) bool {
+			return false
+		},
+		GetKey: func(organization *models.Organization) string {
+			return c.buildOrganizationKey(organization.ID)
+		},
+		GetID: func(organization *models.Organization) string {
+			return organization.ID
+		},
+		GetUpdatedAt: func(organization *models.Organization) int64 {
+			return organization.UpdatedAt.Time.UnixMilli()
+		},
+		GetCached: func(organization *models.Organization) utils.Result[*models.Organization] {
+			return c.GetOrganization(organization.ID)
+		},
+		SetCache: func(organization *models.Organization) utils.Result[bool] {
+			return c.SetOrganization(organization)
+		},
+		Delete: func(organization *models.Organization) utils.Result[bool] {
+			return c.DeleteOrganization(organization)
+		},
+		GetOrganizationID: func(organization *models.Organization) string {
+			return organization.ID
+		},
+	})
+}
@@ -0,0 +1,30 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildOrganizationKey(t *testing.T) {
+	cache := setupTestCache(t)
+
+	assert.Equal(t, "org:org-123", cache.buildOrganizationKey("org-123"))
+}
+
+func TestGetOrganization(t *testing.T) {
+	cache := setupTestCache(t)
+
+	organization := &models.Organization{ID: "org-123", Timezone: utils.StringPtr("Asia/Tokyo")}
+	require.True(t, cache.SetOrganization(organization).Success())
+
+	result := cache.GetOrganization("org-123")
+	require.True(t, result.Success())
+	assert.Equal(t, "Asia/Tokyo", *result.Value().Timezone)
+
+	require.True(t, cache.DeleteOrganization(organization).Success())
+	assert.True(t, cache.GetOrganization("org-123").Failure())
+}
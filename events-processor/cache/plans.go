@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	planPrefix    = "plan"
+	planModelName = "plans"
+	planTopic     = ".public.plans"
+)
+
+func (c *Cache) buildPlanKey(organizationID, ID string) string {
+	return fmt.Sprintf("%s:%s:%s", planPrefix, organizationID, ID)
+}
+
+func (c *Cache) SetPlan(plan *models.Plan) utils.Result[bool] {
+	key := c.buildPlanKey(plan.OrganizationID, plan.ID)
+	return setJSON(c, key, plan)
+}
+
+func (c *Cache) GetPlan(organizationID, ID string) utils.Result[*models.Plan] {
+	key := c.buildPlanKey(organizationID, ID)
+	return getJSON[models.Plan](c, key)
+}
+
+// Deleted plans are kept as long as their terminated subscriptions,
+// so we update the cache entry with a 1 month TTL
+func (c *Cache) DeletePlan(plan *models.Plan) utils.Result[bool] {
+	key := c.buildPlanKey(plan.OrganizationID, plan.ID)
+	ttl := 30 * 24 * time.Hour
+	return deleteWithTTL(c, key, plan, ttl)
+}
+
+func (c *Cache) LoadPlansSnapshot(db *gorm.DB) utils.Result[int] {
+	return LoadSnapshot(
+		c,
+		planModelName,
+		func() ([]models.Plan, error) {
+			res := models.GetAllPlans(db)
+			if res.Failure() {
+				return nil, res.Error()
+			}
+			return selectOrganizations(c, res.Value(), func(plan *models.Plan) string {
+				return plan.OrganizationID
+			}), nil
+		},
+		func(plan *models.Plan) string {
+			return c.buildPlanKey(plan.OrganizationID, plan.ID)
+		},
+	)
+}
+
+func (c *Cache) StartPlansConsumer(ctx context.Context) error {
+	return startGenericConsumer(ctx, c, ConsumerConfig[models.Plan]{
+		Topic:     c.debeziumTopicPrefix + planTopic,
+		ModelName: planModelName,
+		IsDeleted: func(plan *models.Plan) bool {
+			return plan.DeletedAt.Valid
+		},
+		GetKey: func(plan *models.Plan) string {
+			return c.buildPlanKey(plan.OrganizationID, plan.ID)
+		},
+		GetID: func(plan *models.Plan) string {
+			return plan.ID
+		},
+		GetUpdatedAt: func(plan *models.Plan) int64 {
+			return plan.UpdatedAt.Time.UnixMilli()
+		},
+		GetCached: func(plan *models.Plan) utils.Result[*models.Plan] {
+			return c.GetPlan(plan.OrganizationID, plan.ID)
+		},
+		SetCache: func(plan *models.Plan) utils.Result[bool] {
+			return c.SetPlan(plan)
+		},
+		Delete: func(plan *models.Plan) utils.Result[bool] {
+			return c.DeletePlan(plan)
+		},
+		GetOrganizationID: func(plan *models.Plan) string {
+			return plan.OrganizationID
+		},
+	})
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildPlanKey(t *testing.T) {
+	cache := setupTestCache(t)
+
+	key := cache.buildPlanKey("org-123", "plan-123")
+	assert.Equal(t, "plan:org-123:plan-123", key)
+}
+
+func TestGetPlan_Success(t *testing.T) {
+	cache := setupTestCache(t)
+
+	plan := &models.Plan{
+		ID:             "plan-123",
+		OrganizationID: "org-123",
+		Code:           "premium",
+		AmountCurrency: "USD",
+		CreatedAt:      utils.NowNullTime(),
+		UpdatedAt:      utils.NowNullTime(),
+	}
+
+	result := cache.SetPlan(plan)
+	require.True(t, result.Success())
+
+	getResult := cache.GetPlan("org-123", "plan-123")
+
+	require.True(t, getResult.Success())
+	retrieved := getResult.Value()
+	assert.Equal(t, plan.ID, retrieved.ID)
+	assert.Equal(t, plan.Code, retrieved.Code)
+	assert.Equal(t, plan.AmountCurrency, retrieved.AmountCurrency)
+}
+
+func TestGetPlan_NotFound(t *testing.T) {
+	cache := setupTestCache(t)
+
+	result := cache.GetPlan("org-123", "nonexistent")
+
+	assert.True(t, result.Failure())
+	assert.False(t, result.IsRetryable())
+}
+
+func TestDeletePlan_KeepsEntryWithTTL(t *testing.T) {
+	cache := setupTestCache(t)
+
+	plan := &models.Plan{
+		ID:             "plan-123",
+		OrganizationID: "org-123",
+		Code:           "premium",
+		DeletedAt:      utils.NowNullTime(),
+	}
+
+	result := cache.DeletePlan(plan)
+	require.True(t, result.Success())
+
+	getResult := cache.GetPlan("org-123", "plan-123")
+	require.True(t, getResult.Success())
+	assert.Equal(t, "premium", getResult.Value().Code)
+
+	cache.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(cache.buildPlanKey("org-123", "plan-123")))
+		require.NoError(t, err)
+		assert.NotZero(t, item.ExpiresAt())
+		return nil
+	})
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
 	"time"
 
 	"github.com/dgraph-io/badger/v4"
@@ -13,9 +15,11 @@ import (
 )
 
 const (
-	subscriptionPrefix    = "sub"
-	subscriptionModelName = "subscriptions"
-	subscriptionTopic     = ".public.subscriptions"
+	subscriptionPrefix = "sub"
+	// Secondary index to find the subscriptions of a customer
+	subscriptionCustomerPrefix = "sub_cus"
+	subscriptionModelName      = "subscriptions"
+	subscriptionTopic          = ".public.subscriptions"
 )
 
 func (c *Cache) buildSubscriptionKey(organizationID, externalID, ID string) string {
@@ -29,12 +33,37 @@ func (c *Cache) subscriptionKey(sub *models.Subscription) (string, error) {
 	return c.buildSubscriptionKey(*sub.OrganizationID, sub.ExternalID, sub.ID), nil
 }
 
-func (c *Cache) SetSubscription(sub *models.Subscription) utils.Result[bool] {
+func subscriptionOrganizationID(sub *models.Subscription) string {
+	if sub.OrganizationID == nil {
+		return ""
+	}
+	return *sub.OrganizationID
+}
+
+func (c *Cache) buildSubscriptionCustomerKey(organizationID, customerID, ID string) string {
+	return fmt.Sprintf("%s:%s:%s:%s", subscriptionCustomerPrefix, organizationID, customerID, ID)
+}
+
+// subscriptionKeys returns the primary key of the subscription, followed by the customer index key when the customer is known
+func (c *Cache) subscriptionKeys(sub *models.Subscription) ([]string, error) {
 	key, err := c.subscriptionKey(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{key}
+	if sub.CustomerID != "" {
+		keys = append(keys, c.buildSubscriptionCustomerKey(*sub.OrganizationID, sub.CustomerID, sub.ID))
+	}
+	return keys, nil
+}
+
+func (c *Cache) SetSubscription(sub *models.Subscription) utils.Result[bool] {
+	keys, err := c.subscriptionKeys(sub)
 	if err != nil {
 		return utils.FailedBoolResult(err)
 	}
-	return setJSON(c, key, sub)
+	return setIndexedJSON(c, keys, sub)
 }
 
 func (c *Cache) GetSubscription(organizationID, externalID, ID string) utils.Result[*models.Subscription] {
@@ -50,7 +79,48 @@ func (c *Cache) SearchSubscriptions(organizationID string, externalID string, ti
 		return utils.FailedResult[*models.Subscription](result.Error())
 	}
 
-	subscriptions := result.Value()
+	bestMatch := selectSubscription(result.Value(), timestamp)
+	if bestMatch == nil {
+		err := badger.ErrKeyNotFound
+		return utils.FailedResult[*models.Subscription](err).
+			NonCapturable().NonRetryable()
+	} else {
+		c.logger.Debug(
+			"search subscription result",
+			slog.String("subscription external id: ", bestMatch.ExternalID),
+		)
+	}
+
+	return utils.SuccessResult(bestMatch)
+}
+
+// SearchCustomerSubscriptions returns the subscriptions of a customer active at the given timestamp,
+// at most one per subscription external ID, ordered by external ID
+func (c *Cache) SearchCustomerSubscriptions(organizationID string, customerID string, timestamp time.Time) utils.Result[[]*models.Subscription] {
+	prefix := fmt.Sprintf("%s:%s:%s:", subscriptionCustomerPrefix, organizationID, customerID)
+	result := searchJSON[models.Subscription](c, prefix)
+	if result.Failure() {
+		return utils.FailedResult[[]*models.Subscription](result.Error())
+	}
+
+	byExternalID := make(map[string][]*models.Subscription)
+	for _, sub := range result.Value() {
+		byExternalID[sub.ExternalID] = append(byExternalID[sub.ExternalID], sub)
+	}
+
+	subscriptions := make([]*models.Subscription, 0, len(byExternalID))
+	for _, externalID := range slices.Sorted(maps.Keys(byExternalID)) {
+		if sub := selectSubscription(byExternalID[externalID], timestamp); sub != nil {
+			subscriptions = append(subscriptions, sub)
+		}
+	}
+
+	return utils.SuccessResult(subscriptions)
+}
+
+// selectSubscription returns the subscription active at the given timestamp,
+// using the same ordering as the database: terminated_at DESC NULLS FIRST, started_at DESC
+func selectSubscription(subscriptions []*models.Subscription, timestamp time.Time) *models.Subscription {
 	var validSubs []*models.Subscription
 	for _, sub := range subscriptions {
 		if !sub.StartedAt.Valid {
@@ -102,33 +172,22 @@ func (c *Cache) SearchSubscriptions(organizationID string, externalID string, ti
 		}
 	}
 
-	if bestMatch == nil {
-		err := badger.ErrKeyNotFound
-		return utils.FailedResult[*models.Subscription](err).
-			NonCapturable().NonRetryable()
-	} else {
-		c.logger.Debug(
-			"search subscription result",
-			slog.String("subscription external id: ", bestMatch.ExternalID),
-		)
-	}
-
-	return utils.SuccessResult(bestMatch)
+	return bestMatch
 }
 
 // Since we want to keep terminated subscriptions to permit grace period events backfill
 // we update the cache entry with a 1 month TTL
 func (c *Cache) DeleteSubscription(sub *models.Subscription) utils.Result[bool] {
-	key, err := c.subscriptionKey(sub)
+	keys, err := c.subscriptionKeys(sub)
 	if err != nil {
 		return utils.FailedBoolResult(err)
 	}
 	ttl := 30 * 24 * time.Hour
-	return deleteWithTTL(c, key, sub, ttl)
+	return deleteIndexedWithTTL(c, keys, sub, ttl)
 }
 
 func (c *Cache) LoadSubscriptionsSnapshot(db *gorm.DB) utils.Result[int] {
-	return LoadSnapshot(
+	return LoadIndexedSnapshot(
 		c,
 		subscriptionModelName,
 		func() ([]models.Subscription, error) {
@@ -136,15 +195,17 @@ func (c *Cache) LoadSubscriptionsSnapshot(db *gorm.DB) utils.Result[int] {
 			if res.Failure() {
 				return nil, res.Error()
 			}
-			return res.Value(), nil
+			return selectOrganizations(c, res.Value(), func(sub *models.Subscription) string {
+				return subscriptionOrganizationID(sub)
+			}), nil
 		},
-		func(sub *models.Subscription) string {
-			key, err := c.subscriptionKey(sub)
+		func(sub *models.Subscription) []string {
+			keys, err := c.subscriptionKeys(sub)
 			if err != nil {
 				c.logger.Error("Skipping subscription in snapshot", slog.String("error", err.Error()))
-				return ""
+				return nil
 			}
-			return key
+			return keys
 		},
 	)
 }
@@ -179,5 +240,8 @@ func (c *Cache) StartSubscriptionsConsumer(ctx context.Context) error {
 		Delete: func(sub *models.Subscription) utils.Result[bool] {
 			return c.DeleteSubscription(sub)
 		},
+		GetOrganizationID: func(sub *models.Subscription) string {
+			return subscriptionOrganizationID(sub)
+		},
 	})
 }
@@ -3,6 +3,7 @@ package cache
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/getlago/lago/events-processor/models"
 	"github.com/getlago/lago/events-processor/utils"
@@ -155,3 +156,67 @@ func TestGetSubscription_NotFound(t *testing.T) {
 
 	assert.True(t, result.Failure())
 }
+
+func TestSearchCustomerSubscriptions(t *testing.T) {
+	cache := setupTestCache(t)
+
+	orgID := "org-123"
+	timestamp := time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	subscriptions := []*models.Subscription{
+		{
+			ID:             "sub-b",
+			OrganizationID: &orgID,
+			ExternalID:     "sub_external_b",
+			CustomerID:     "cus-123",
+			StartedAt:      utils.NewNullTime(timestamp.AddDate(0, -2, 0)),
+		},
+		// Terminated, replaced by sub-a2
+		{
+			ID:             "sub-a1",
+			OrganizationID: &orgID,
+			ExternalID:     "sub_external_a",
+			CustomerID:     "cus-123",
+			StartedAt:      utils.NewNullTime(timestamp.AddDate(0, -2, 0)),
+			TerminatedAt:   utils.NewNullTime(timestamp.AddDate(0, -1, 0)),
+		},
+		{
+			ID:             "sub-a2",
+			OrganizationID: &orgID,
+			ExternalID:     "sub_external_a",
+			CustomerID:     "cus-123",
+			StartedAt:      utils.NewNullTime(timestamp.AddDate(0, -1, 0)),
+		},
+		// Not started yet
+		{
+			ID:             "sub-c",
+			OrganizationID: &orgID,
+			ExternalID:     "sub_external_c",
+			CustomerID:     "cus-123",
+			StartedAt:      utils.NewNullTime(timestamp.AddDate(0, 1, 0)),
+		},
+		// Other customer
+		{
+			ID:             "sub-d",
+			OrganizationID: &orgID,
+			ExternalID:     "sub_external_d",
+			CustomerID:     "cus-456",
+			StartedAt:      utils.NewNullTime(timestamp.AddDate(0, -2, 0)),
+		},
+	}
+	for _, sub := range subscriptions {
+		require.True(t, cache.SetSubscription(sub).Success())
+	}
+
+	result := cache.SearchCustomerSubscriptions(orgID, "cus-123", timestamp)
+
+	require.True(t, result.Success())
+	require.Equal(t, 2, len(result.Value()))
+	assert.Equal(t, "sub-a2", result.Value()[0].ID)
+	assert.Equal(t, "sub-b", result.Value()[1].ID)
+
+	// The primary key is still used to search by external subscription ID
+	subResult := cache.SearchSubscriptions(orgID, "sub_external_a", timestamp)
+	require.True(t, subResult.Success())
+	assert.Equal(t, "sub-a2", subResult.Value().ID)
+}
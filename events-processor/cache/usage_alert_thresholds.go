@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	usageAlertThresholdPrefix = "uat"
+	// Secondary index to find the thresholds of an alert
+	usageAlertThresholdAlertPrefix = "uat_alert"
+	usageAlertThresholdModelName   = "usage_monitoring_alert_thresholds"
+	usageAlertThresholdTopic       = ".public.usage_monitoring_alert_thresholds"
+)
+
+// Alert thresholds are hard deleted: the deletion messages only carry the ID,
+// so the primary key only relies on it
+func (c *Cache) buildUsageAlertThresholdKey(ID string) string {
+	return fmt.Sprintf("%s:%s", usageAlertThresholdPrefix, ID)
+}
+
+func (c *Cache) buildUsageAlertThresholdAlertKey(organizationID, alertID, ID string) string {
+	return fmt.Sprintf("%s:%s:%s:%s", usageAlertThresholdAlertPrefix, organizationID, alertID, ID)
+}
+
+func (c *Cache) usageAlertThresholdKeys(threshold *models.UsageAlertThreshold) []string {
+	return []string{
+		c.buildUsageAlertThresholdKey(threshold.ID),
+		c.buildUsageAlertThresholdAlertKey(threshold.OrganizationID, threshold.UsageAlertID, threshold.ID),
+	}
+}
+
+func (c *Cache) SetUsageAlertThreshold(threshold *models.UsageAlertThreshold) utils.Result[bool] {
+	return setIndexedJSON(c, c.usageAlertThresholdKeys(threshold), threshold)
+}
+
+func (c *Cache) GetUsageAlertThreshold(ID string) utils.Result[*models.UsageAlertThreshold] {
+	return getJSON[models.UsageAlertThreshold](c, c.buildUsageAlertThresholdKey(ID))
+}
+
+func (c *Cache) SearchUsageAlertThresholds(organizationID, alertID string) utils.Result[[]*models.UsageAlertThreshold] {
+	prefix := fmt.Sprintf("%s:%s:%s:", usageAlertThresholdAlertPrefix, organizationID, alertID)
+	return searchJSON[models.UsageAlertThreshold](c, prefix)
+}
+
+// DeleteUsageAlertThreshold removes the threshold and its index, from the cached version of the threshold
+func (c *Cache) DeleteUsageAlertThreshold(threshold *models.UsageAlertThreshold) utils.Result[bool] {
+	cachedResult := c.GetUsageAlertThreshold(threshold.ID)
+	if cachedResult.Failure() {
+		return utils.FailedBoolResult(cachedResult.Error())
+	}
+
+	return deleteIndexed(c, c.usageAlertThresholdKeys(cachedResult.Value()))
+}
+
+func (c *Cache) LoadUsageAlertThresholdsSnapshot(db *gorm.DB) utils.Result[int] {
+	return LoadIndexedSnapshot(
+		c,
+		usageAlertThresholdModelName,
+		func() ([]models.UsageAlertThreshold, error) {
+			res := models.GetAllUsageAlertThresholds(db)
+			if res.Failure() {
+				return nil, res.Error()
+			}
+			return selectOrganizations(c, res.Value(), func(threshold *models.UsageAlertThreshold) string {
+				return threshold.OrganizationID
+			}), nil
+		},
+		func(threshold *models.UsageAlertThreshold) []string {
+			return c.usageAlertThresholdKeys(threshold)
+		},
+	)
+}
+
+func (c *Cache) StartUsageAlertThresholdsConsumer(ctx context.Context) error {
+	return startGenericConsumer(ctx, c, ConsumerConfig[models.UsageAlertThreshold]{
+		Topic:     c.debeziumTopicPrefix + usageAlertThresholdTopic,
+		ModelName: usageAlertThresholdModelName,
+		IsDeleted: func(threshold *models.UsageAlertThreshold) bool {
+			return threshold.IsDeleted()
+		},
+		GetKey: func(threshold *models.UsageAlertThreshold) string {
+			return c.buildUsageAlertThresholdKey(threshold.ID)
+		},
+		GetID: func(threshold *models.UsageAlertThreshold) string {
+			return threshold.ID
+		},
+		GetUpdatedAt: func(threshold *models.UsageAlertThreshold) int64 {
+			return threshold.UpdatedAt.Time.UnixMilli()
+		},
+		GetCached: func(threshold *models.UsageAlertThreshold) utils.Result[*models.UsageAlertThreshold] {
+			return c.GetUsageAlertThreshold(threshold.ID)
+		},
+		SetCache: func(threshold *models.UsageAlertThreshold) utils.Result[bool] {
+			return c.SetUsageAlertThreshold(threshold)
+		},
+		Delete: func(threshold *models.UsageAlertThreshold) utils.Result[bool] {
+			return c.DeleteUsageAlertThreshold(threshold)
+		},
+		GetOrganizationID: func(threshold *models.UsageAlertThreshold) string {
+			return threshold.OrganizationID
+		},
+	})
+}
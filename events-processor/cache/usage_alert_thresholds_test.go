@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageAlertThresholdKeys(t *testing.T) {
+	cache := setupTestCache(t)
+
+	threshold := &models.UsageAlertThreshold{ID: "123", OrganizationID: "org-123", UsageAlertID: "alert-123"}
+
+	assert.Equal(t, []string{"uat:123", "uat_alert:org-123:alert-123:123"}, cache.usageAlertThresholdKeys(threshold))
+}
+
+func TestSearchUsageAlertThresholds(t *testing.T) {
+	cache := setupTestCache(t)
+
+	cache.SetUsageAlertThreshold(&models.UsageAlertThreshold{ID: "1", OrganizationID: "org-123", UsageAlertID: "alert-123", Value: "10.5"})
+	cache.SetUsageAlertThreshold(&models.UsageAlertThreshold{ID: "2", OrganizationID: "org-123", UsageAlertID: "alert-123", Value: "20"})
+	cache.SetUsageAlertThreshold(&models.UsageAlertThreshold{ID: "3", OrganizationID: "org-123", UsageAlertID: "alert-456", Value: "30"})
+
+	result := cache.SearchUsageAlertThresholds("org-123", "alert-123")
+
+	require.True(t, result.Success())
+	assert.Len(t, result.Value(), 2)
+}
+
+func TestDeleteUsageAlertThreshold(t *testing.T) {
+	cache := setupTestCache(t)
+
+	cache.SetUsageAlertThreshold(&models.UsageAlertThreshold{ID: "123", OrganizationID: "org-123", UsageAlertID: "alert-123"})
+
+	// Deletion messages only carry the ID of the threshold
+	result := cache.DeleteUsageAlertThreshold(&models.UsageAlertThreshold{ID: "123", Deleted: "true"})
+	require.True(t, result.Success())
+
+	assert.True(t, cache.GetUsageAlertThreshold("123").Failure())
+
+	searchResult := cache.SearchUsageAlertThresholds("org-123", "alert-123")
+	require.True(t, searchResult.Success())
+	assert.Empty(t, searchResult.Value())
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	usageAlertPrefix    = "ua"
+	usageAlertModelName = "usage_monitoring_alerts"
+	usageAlertTopic     = ".public.usage_monitoring_alerts"
+)
+
+func (c *Cache) buildUsageAlertKey(organizationID, subscriptionExternalID, ID string) string {
+	return fmt.Sprintf("%s:%s:%s:%s", usageAlertPrefix, organizationID, subscriptionExternalID, ID)
+}
+
+func (c *Cache) SetUsageAlert(alert *models.UsageAlert) utils.Result[bool] {
+	key := c.buildUsageAlertKey(alert.OrganizationID, alert.SubscriptionExternalID, alert.ID)
+	return setJSON(c, key, alert)
+}
+
+func (c *Cache) GetUsageAlert(organizationID, subscriptionExternalID, ID string) utils.Result[*models.UsageAlert] {
+	key := c.buildUsageAlertKey(organizationID, subscriptionExternalID, ID)
+	return getJSON[models.UsageAlert](c, key)
+}
+
+func (c *Cache) SearchUsageAlerts(organizationID, subscriptionExternalID string) utils.Result[[]*models.UsageAlert] {
+	prefix := fmt.Sprintf("%s:%s:%s:", usageAlertPrefix, organizationID, subscriptionExternalID)
+	return searchJSON[models.UsageAlert](c, prefix)
+}
+
+func (c *Cache) DeleteUsageAlert(alert *models.UsageAlert) utils.Result[bool] {
+	key := c.buildUsageAlertKey(alert.OrganizationID, alert.SubscriptionExternalID, alert.ID)
+	return delete(c, key)
+}
+
+func (c *Cache) LoadUsageAlertsSnapshot(db *gorm.DB) utils.Result[int] {
+	return LoadSnapshot(
+		c,
+		usageAlertModelName,
+		func() ([]models.UsageAlert, error) {
+			res := models.GetAllUsageAlerts(db)
+			if res.Failure() {
+				return nil, res.Error()
+			}
+			return selectOrganizations(c, res.Value(), func(alert *models.UsageAlert) string {
+				return alert.OrganizationID
+			}), nil
+		},
+		func(alert *models.UsageAlert) string {
+			return c.buildUsageAlertKey(alert.OrganizationID, alert.SubscriptionExternalID, alert.ID)
+		},
+	)
+}
+
+func (c *Cache) StartUsageAlertsConsumer(ctx context.Context) error {
+	return startGenericConsumer(ctx, c, ConsumerConfig[models.UsageAlert]{
+		Topic:     c.debeziumTopicPrefix + usageAlertTopic,
+		ModelName: usageAlertModelName,
+		IsDeleted: func(alert *models.UsageAlert) bool {
+			return alert.DeletedAt.Valid
+		},
+		GetKey: func(alert *models.UsageAlert) string {
+			return c.buildUsageAlertKey(alert.OrganizationID, alert.SubscriptionExternalID, alert.ID)
+		},
+		GetID: func(alert *models.UsageAlert) string {
+			return alert.ID
+		},
+		GetUpdatedAt: func(alert *models.UsageAlert) int64 {
+			return alert.UpdatedAt.Time.UnixMilli()
+		},
+		GetCached: func(alert *models.UsageAlert) utils.Result[*models.UsageAlert] {
+			return c.GetUsageAlert(alert.OrganizationID, alert.SubscriptionExternalID, alert.ID)
+		},
+		SetCache: func(alert *models.UsageAlert) utils.Result[bool] {
+			return c.SetUsageAlert(alert)
+		},
+		Delete: func(alert *models.UsageAlert) utils.Result[bool] {
+			return c.DeleteUsageAlert(alert)
+		},
+		GetOrganizationID: func(alert *models.UsageAlert) string {
+			return alert.OrganizationID
+		},
+	})
+}
@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildUsageAlertKey(t *testing.T) {
+	cache := setupTestCache(t)
+
+	key := cache.buildUsageAlertKey("org-123", "ext-sub-123", "123")
+	assert.Equal(t, "ua:org-123:ext-sub-123:123", key)
+}
+
+func TestGetUsageAlert_Success(t *testing.T) {
+	cache := setupTestCache(t)
+
+	alert := &models.UsageAlert{
+		ID:                     "123",
+		OrganizationID:         "org-123",
+		SubscriptionExternalID: "ext-sub-123",
+		AlertType:              models.UsageAlertTypeCurrentUsageAmount,
+	}
+	cache.SetUsageAlert(alert)
+
+	result := cache.GetUsageAlert("org-123", "ext-sub-123", "123")
+
+	require.True(t, result.Success())
+	assert.Equal(t, models.UsageAlertTypeCurrentUsageAmount, result.Value().AlertType)
+}
+
+func TestSearchUsageAlerts(t *testing.T) {
+	cache := setupTestCache(t)
+
+	cache.SetUsageAlert(&models.UsageAlert{ID: "1", OrganizationID: "org-123", SubscriptionExternalID: "ext-sub-123"})
+	cache.SetUsageAlert(&models.UsageAlert{ID: "2", OrganizationID: "org-123", SubscriptionExternalID: "ext-sub-123"})
+	cache.SetUsageAlert(&models.UsageAlert{ID: "3", OrganizationID: "org-123", SubscriptionExternalID: "ext-sub-1234"})
+
+	result := cache.SearchUsageAlerts("org-123", "ext-sub-123")
+
+	require.True(t, result.Success())
+	assert.Len(t, result.Value(), 2)
+}
+
+func TestDeleteUsageAlert(t *testing.T) {
+	cache := setupTestCache(t)
+
+	alert := &models.UsageAlert{ID: "123", OrganizationID: "org-123", SubscriptionExternalID: "ext-sub-123"}
+	cache.SetUsageAlert(alert)
+
+	result := cache.DeleteUsageAlert(alert)
+	require.True(t, result.Success())
+
+	assert.True(t, cache.GetUsageAlert("org-123", "ext-sub-123", "123").Failure())
+}
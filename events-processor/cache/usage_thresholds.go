@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	usageThresholdPrefix    = "ut"
+	usageThresholdModelName = "usage_thresholds"
+	usageThresholdTopic     = ".public.usage_thresholds"
+)
+
+// Usage thresholds are indexed by their owner, a plan or a subscription
+func (c *Cache) buildUsageThresholdKey(ut *models.UsageThreshold) string {
+	if ut.SubscriptionID != nil {
+		return fmt.Sprintf("%s:%s:sub:%s:%s", usageThresholdPrefix, ut.OrganizationID, *ut.SubscriptionID, ut.ID)
+	}
+	if ut.PlanID != nil {
+		return fmt.Sprintf("%s:%s:plan:%s:%s", usageThresholdPrefix, ut.OrganizationID, *ut.PlanID, ut.ID)
+	}
+
+	return ""
+}
+
+// Thresholds without plan nor subscription are ignored
+func (c *Cache) SetUsageThreshold(ut *models.UsageThreshold) utils.Result[bool] {
+	key := c.buildUsageThresholdKey(ut)
+	if key == "" {
+		return utils.SuccessResult(false)
+	}
+
+	return setJSON(c, key, ut)
+}
+
+func (c *Cache) GetUsageThreshold(ut *models.UsageThreshold) utils.Result[*models.UsageThreshold] {
+	return getJSON[models.UsageThreshold](c, c.buildUsageThresholdKey(ut))
+}
+
+func (c *Cache) SearchPlanUsageThresholds(organizationID, planID string) utils.Result[[]*models.UsageThreshold] {
+	prefix := fmt.Sprintf("%s:%s:plan:%s:", usageThresholdPrefix, organizationID, planID)
+	return searchJSON[models.UsageThreshold](c, prefix)
+}
+
+func (c *Cache) SearchSubscriptionUsageThresholds(organizationID, subscriptionID string) utils.Result[[]*models.UsageThreshold] {
+	prefix := fmt.Sprintf("%s:%s:sub:%s:", usageThresholdPrefix, organizationID, subscriptionID)
+	return searchJSON[models.UsageThreshold](c, prefix)
+}
+
+func (c *Cache) DeleteUsageThreshold(ut *models.UsageThreshold) utils.Result[bool] {
+	return delete(c, c.buildUsageThresholdKey(ut))
+}
+
+func (c *Cache) LoadUsageThresholdsSnapshot(db *gorm.DB) utils.Result[int] {
+	return LoadSnapshot(
+		c,
+		usageThresholdModelName,
+		func() ([]models.UsageThreshold, error) {
+			res := models.GetAllUsageThresholds(db)
+			if res.Failure() {
+				return nil, res.Error()
+			}
+			return selectOrganizations(c, res.Value(), func(ut *models.UsageThreshold) string {
+				return ut.OrganizationID
+			}), nil
+		},
+		func(ut *models.UsageThreshold) string {
+			return c.buildUsageThresholdKey(ut)
+		},
+	)
+}
+
+func (c *Cache) StartUsageThresholdsConsumer(ctx context.Context) error {
+	return startGenericConsumer(ctx, c, ConsumerConfig[models.UsageThreshold]{
+		Topic:     c.debeziumTopicPrefix + usageThresholdTopic,
+		ModelName: usageThresholdModelName,
+		IsDeleted: func(ut *models.UsageThreshold) bool {
+			return ut.DeletedAt.Valid
+		},
+		GetKey: func(ut *models.UsageThreshold) string {
+			return c.buildUsageThresholdKey(ut)
+		},
+		GetID: func(ut *models.UsageThreshold) string {
+			return ut.ID
+		},
+		GetUpdatedAt: func(ut *models.UsageThreshold) int64 {
+			return ut.UpdatedAt.Time.UnixMilli()
+		},
+		GetCached: func(ut *models.UsageThreshold) utils.Result[*models.UsageThreshold] {
+			return c.GetUsageThreshold(ut)
+		},
+		SetCache: func(ut *models.UsageThreshold) utils.Result[bool] {
+			return c.SetUsageThreshold(ut)
+		},
+		Delete: func(ut *models.UsageThreshold) utils.Result[bool] {
+			return c.DeleteUsageThreshold(ut)
+		},
+		GetOrganizationID: func(ut *models.UsageThreshold) string {
+			return ut.OrganizationID
+		},
+	})
+}
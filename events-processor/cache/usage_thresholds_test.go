@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildUsageThresholdKey(t *testing.T) {
+	cache := setupTestCache(t)
+
+	planThreshold := &models.UsageThreshold{ID: "123", OrganizationID: "org-123", PlanID: utils.StringPtr("plan-123")}
+	assert.Equal(t, "ut:org-123:plan:plan-123:123", cache.buildUsageThresholdKey(planThreshold))
+
+	subscriptionThreshold := &models.UsageThreshold{ID: "123", OrganizationID: "org-123", SubscriptionID: utils.StringPtr("sub-123")}
+	assert.Equal(t, "ut:org-123:sub:sub-123:123", cache.buildUsageThresholdKey(subscriptionThreshold))
+}
+
+func TestSetUsageThreshold_WithoutOwner(t *testing.T) {
+	cache := setupTestCache(t)
+
+	result := cache.SetUsageThreshold(&models.UsageThreshold{ID: "123", OrganizationID: "org-123"})
+
+	assert.True(t, result.Success())
+	assert.False(t, result.Value())
+}
+
+func TestSearchUsageThresholds(t *testing.T) {
+	cache := setupTestCache(t)
+
+	cache.SetUsageThreshold(&models.UsageThreshold{ID: "1", OrganizationID: "org-123", PlanID: utils.StringPtr("plan-123"), AmountCents: 100})
+	cache.SetUsageThreshold(&models.UsageThreshold{ID: "2", OrganizationID: "org-123", PlanID: utils.StringPtr("plan-123"), AmountCents: 200})
+	cache.SetUsageThreshold(&models.UsageThreshold{ID: "3", OrganizationID: "org-123", PlanID: utils.StringPtr("plan-456"), AmountCents: 300})
+	cache.SetUsageThreshold(&models.UsageThreshold{ID: "4", OrganizationID: "org-123", SubscriptionID: utils.StringPtr("sub-123"), AmountCents: 400})
+
+	planResult := cache.SearchPlanUsageThresholds("org-123", "plan-123")
+	require.True(t, planResult.Success())
+	assert.Len(t, planResult.Value(), 2)
+
+	subscriptionResult := cache.SearchSubscriptionUsageThresholds("org-123", "sub-123")
+	require.True(t, subscriptionResult.Success())
+	require.Len(t, subscriptionResult.Value(), 1)
+	assert.Equal(t, int64(400), subscriptionResult.Value()[0].AmountCents)
+}
+
+func TestDeleteUsageThreshold(t *testing.T) {
+	cache := setupTestCache(t)
+
+	ut := &models.UsageThreshold{ID: "123", OrganizationID: "org-123", PlanID: utils.StringPtr("plan-123")}
+	cache.SetUsageThreshold(ut)
+
+	result := cache.DeleteUsageThreshold(ut)
+	require.True(t, result.Success())
+
+	assert.True(t, cache.GetUsageThreshold(ut).Failure())
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	walletPrefix = "wal"
+	// Secondary index to find the wallets of a customer by code
+	walletCodePrefix = "wal_code"
+	walletModelName  = "wallets"
+	walletTopic      = ".public.wallets"
+)
+
+func (c *Cache) buildWalletKey(organizationID, ID string) string {
+	return fmt.Sprintf("%s:%s:%s", walletPrefix, organizationID, ID)
+}
+
+func (c *Cache) buildWalletCodeKey(organizationID, customerID, code, ID string) string {
+	return fmt.Sprintf("%s:%s:%s:%s:%s", walletCodePrefix, organizationID, customerID, code, ID)
+}
+
+// Wallets without code can't be targeted, they are only stored under their primary key
+func (c *Cache) walletKeys(wallet *models.Wallet) []string {
+	keys := []string{c.buildWalletKey(wallet.OrganizationID, wallet.ID)}
+	if wallet.Code != nil {
+		keys = append(keys, c.buildWalletCodeKey(wallet.OrganizationID, wallet.CustomerID, *wallet.Code, wallet.ID))
+	}
+
+	return keys
+}
+
+// SetWallet caches the wallet, the index of its previous code is removed when the code changed
+func (c *Cache) SetWallet(wallet *models.Wallet) utils.Result[bool] {
+	return setReindexedJSON(c, c.walletKeys(wallet), wallet, c.walletKeys)
+}
+
+func (c *Cache) GetWallet(organizationID, ID string) utils.Result[*models.Wallet] {
+	key := c.buildWalletKey(organizationID, ID)
+	return getJSON[models.Wallet](c, key)
+}
+
+// SearchActiveWallet returns the active wallet of the customer with the given code
+func (c *Cache) SearchActiveWallet(organizationID, customerID, code string) utils.Result[*models.Wallet] {
+	prefix := fmt.Sprintf("%s:%s:%s:%s:", walletCodePrefix, organizationID, customerID, code)
+	result := searchJSON[models.Wallet](c, prefix)
+	if result.Failure() {
+		return utils.FailedResult[*models.Wallet](result.Error())
+	}
+
+	for _, wallet := range result.Value() {
+		if wallet.IsActive() {
+			return utils.SuccessResult(wallet)
+		}
+	}
+
+	return utils.FailedResult[*models.Wallet](badger.ErrKeyNotFound).NonCapturable().NonRetryable()
+}
+
+// Terminated wallets can't be targeted anymore, they are removed from the cache
+func (c *Cache) DeleteWallet(wallet *models.Wallet) utils.Result[bool] {
+	return deleteReindexed(c, c.walletKeys(wallet), c.walletKeys)
+}
+
+func (c *Cache) LoadWalletsSnapshot(db *gorm.DB) utils.Result[int] {
+	return LoadIndexedSnapshot(
+		c,
+		walletModelName,
+		func() ([]models.Wallet, error) {
+			res := models.GetAllWallets(db)
+			if res.Failure() {
+				return nil, res.Error()
+			}
+			return selectOrganizations(c, res.Value(), func(wallet *models.Wallet) string {
+				return wallet.OrganizationID
+			}), nil
+		},
+		func(wallet *models.Wallet) []string {
+			return c.walletKeys(wallet)
+		},
+	)
+}
+
+func (c *Cache) StartWalletsConsumer(ctx context.Context) error {
+	return startGenericConsumer(ctx, c, ConsumerConfig[models.Wallet]{
+		Topic:     c.debeziumTopicPrefix + walletTopic,
+		ModelName: walletModelName,
+		IsDeleted: func(wallet *models.Wallet) bool {
+			return !wallet.IsActive()
+		},
+		GetKey: func(wallet *models.Wallet) string {
+			return c.buildWalletKey(wallet.OrganizationID, wallet.ID)
+		},
+		GetID: func(wallet *models.Wallet) string {
+			return wallet.ID
+		},
+		GetUpdatedAt: func(wallet *models.Wallet) int64 {
+			return wallet.UpdatedAt.Time.UnixMilli()
+		},
+		GetCached: func(wallet *models.Wallet) utils.Result[*models.Wallet] {
+			return c.GetWallet(wallet.OrganizationID, wallet.ID)
+		},
+		SetCache: func(wallet *models.Wallet) utils.Result[bool] {
+			return c.SetWallet(wallet)
+		},
+		Delete: func(wallet *models.Wallet) utils.Result[bool] {
+			return c.DeleteWallet(wallet)
+		},
+		GetOrganizationID: func(wallet *models.Wallet) string {
+			return wallet.OrganizationID
+		},
+	})
+}
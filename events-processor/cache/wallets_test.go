@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalletKeys(t *testing.T) {
+	cache := setupTestCache(t)
+
+	wallet := &models.Wallet{ID: "123", OrganizationID: "org-123", CustomerID: "cus-123", Code: utils.StringPtr("prepaid")}
+	assert.Equal(t, []string{"wal:org-123:123", "wal_code:org-123:cus-123:prepaid:123"}, cache.walletKeys(wallet))
+
+	wallet.Code = nil
+	assert.Equal(t, []string{"wal:org-123:123"}, cache.walletKeys(wallet))
+}
+
+func TestSearchActiveWallet_Success(t *testing.T) {
+	cache := setupTestCache(t)
+
+	cache.SetWallet(&models.Wallet{ID: "1", OrganizationID: "org-123", CustomerID: "cus-123", Code: utils.StringPtr("prepaid"), Currency: "EUR"})
+	cache.SetWallet(&models.Wallet{ID: "2", OrganizationID: "org-123", CustomerID: "cus-456", Code: utils.StringPtr("prepaid")})
+
+	result := cache.SearchActiveWallet("org-123", "cus-123", "prepaid")
+
+	require.True(t, result.Success())
+	assert.Equal(t, "1", result.Value().ID)
+	assert.Equal(t, "EUR", result.Value().Currency)
+}
+
+func TestSearchActiveWallet_NotFound(t *testing.T) {
+	cache := setupTestCache(t)
+
+	cache.SetWallet(&models.Wallet{ID: "1", OrganizationID: "org-123", CustomerID: "cus-123", Code: utils.StringPtr("prepaid")})
+
+	result := cache.SearchActiveWallet("org-123", "cus-123", "prepaid_typo")
+
+	assert.True(t, result.Failure())
+	assert.False(t, result.IsCapturable())
+	assert.False(t, result.IsRetryable())
+}
+
+func TestDeleteWallet(t *testing.T) {
+	cache := setupTestCache(t)
+
+	wallet := &models.Wallet{ID: "1", OrganizationID: "org-123", CustomerID: "cus-123", Code: utils.StringPtr("prepaid")}
+	cache.SetWallet(wallet)
+
+	wallet.Status = models.WalletStatusTerminated
+	result := cache.DeleteWallet(wallet)
+	require.True(t, result.Success())
+
+	assert.True(t, cache.GetWallet("org-123", "1").Failure())
+	assert.True(t, cache.SearchActiveWallet("org-123", "cus-123", "prepaid").Failure())
+}
+
+func TestSetWallet_CodeChanged(t *testing.T) {
+	cache := setupTestCache(t)
+
+	wallet := &models.Wallet{ID: "1", OrganizationID: "org-123", CustomerID: "cus-123", Code: utils.StringPtr("prepaid")}
+	require.True(t, cache.SetWallet(wallet).Success())
+
+	wallet.Code = utils.StringPtr("credits")
+	require.True(t, cache.SetWallet(wallet).Success())
+
+	assert.True(t, cache.SearchActiveWallet("org-123", "cus-123", "prepaid").Failure())
+	assert.True(t, cache.SearchActiveWallet("org-123", "cus-123", "credits").Success())
+
+	// A wallet terminated along with a code change doesn't leave its previous index either
+	wallet.Code = utils.StringPtr("renamed")
+	wallet.Status = models.WalletStatusTerminated
+	require.True(t, cache.DeleteWallet(wallet).Success())
+
+	assert.True(t, cache.SearchActiveWallet("org-123", "cus-123", "credits").Failure())
+	assert.True(t, cache.GetWallet("org-123", "1").Failure())
+}
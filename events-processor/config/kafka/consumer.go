@@ -1,14 +1,20 @@
 package kafka
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"math"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/twmb/franz-go/pkg/kgo"
+	"go.opentelemetry.io/otel/metric"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/getlago/lago/events-processor/config/tracing"
@@ -19,8 +25,45 @@ type ConsumerGroupConfig struct {
 	Topic          string
 	ConsumerGroup  string
 	ProcessRecords func(context.Context, []*kgo.Record) []*kgo.Record
+	// Optional, receives the records skipped through the admin API instead of processing them
+	SkipRecord func(context.Context, *kgo.Record)
+	// Duration after which transient fetch errors become fatal, 0 to retry them forever
+	FetchErrorTimeout time.Duration
+	// Maximum number of records returned by a poll, defaults to DEFAULT_MAX_POLL_RECORDS
+	MaxPollRecords int
+	// Number of records queued per partition above which its fetch is paused, defaults to DEFAULT_PARTITION_QUEUE_SIZE
+	PartitionQueueSize int
+	// Processing duration of a batch the batch size adapts to, defaults to DEFAULT_TARGET_BATCH_LATENCY
+	TargetBatchLatency time.Duration
+	// Deadline of the context processing a batch, 0 for no deadline
+	BatchTimeout time.Duration
+	// Processing duration after which the watchdog reports a batch as stuck, 0 to disable the watchdog
+	StuckBatchThreshold time.Duration
 }
 
+const (
+	DEFAULT_MAX_POLL_RECORDS     = 10000
+	DEFAULT_PARTITION_QUEUE_SIZE = 20000
+	DEFAULT_TARGET_BATCH_LATENCY = time.Second
+
+	// The batch size is never reduced below this number of records
+	MIN_BATCH_SIZE = 10
+)
+
+// PauseReason tells why the fetch of a partition is paused, a partition is only resumed once all its reasons are cleared
+type PauseReason string
+
+const (
+	// The partition queue is full, cleared once the queue is half empty
+	PauseReasonBackpressure PauseReason = "backpressure"
+	// The partition failed with a partition specific fetch error, cleared after a backoff
+	PauseReasonFetchError PauseReason = "fetch_error"
+	// Paused through the admin API
+	PauseReasonAdmin PauseReason = "admin"
+	// Stopped after too many panics, cleared through the admin API
+	PauseReasonStopped PauseReason = "stopped"
+)
+
 type TopicPartition struct {
 	topic     string
 	partition int32
@@ -34,18 +77,72 @@ type PartitionConsumer struct {
 
 	quit           chan struct{}
 	done           chan struct{}
-	records        chan []*kgo.Record
+	queue          *partitionQueue
+	queueSize      int
+	batchSize      *adaptiveBatchSize
+	batchTimeout   time.Duration
 	processRecords func(context.Context, []*kgo.Record) []*kgo.Record
+	skipRecord     func(context.Context, *kgo.Record)
 
 	// Ensure quit channel is only closed once
 	atomicQuitClosing sync.Once
+
+	// Admin operations moving the partition, applied by the consumer goroutine between two batches
+	requests chan partitionRequest
+
+	// Highest offsets received and processed by the consumer, -1 before the first batch
+	lastFetchedOffset   atomic.Int64
+	lastProcessedOffset atomic.Int64
+
+	// Offsets to push to the dead letter queue instead of processing them
+	skipMutex      sync.Mutex
+	skippedOffsets map[int64]bool
+
+	// Set while processing a batch to pause the partition once the batch is done
+	stopRequested atomic.Bool
+	// After a rewind, the batches starting after this offset and before staleBeforeOffset
+	// were fetched before the rewind and are dropped, -1 otherwise
+	staleAfterOffset  atomic.Int64
+	staleBeforeOffset atomic.Int64
+
+	pauseMutex   sync.Mutex
+	pauseReasons map[PauseReason]bool
+
+	// Batch in progress, watched by the watchdog. The start time is 0 between two batches.
+	batchStartedAt   atomic.Int64
+	batchFirstOffset atomic.Int64
+	batchRecords     atomic.Int64
+	// Set once the watchdog reported the batch in progress
+	stuckReported atomic.Bool
+
+	// Consecutive batches rewound to a record not processed, only used by the consumer goroutine
+	consecutiveRetries int
+}
+
+// partitionRequest is an operation applied by the consumer goroutine, done is closed once it is applied
+type partitionRequest struct {
+	apply func()
+	done  chan struct{}
 }
 
 type ConsumerGroup struct {
-	consumers      map[TopicPartition]*PartitionConsumer
-	client         *kgo.Client
-	processRecords func(context.Context, []*kgo.Record) []*kgo.Record
-	logger         *slog.Logger
+	topic               string
+	consumers           map[TopicPartition]*PartitionConsumer
+	client              *kgo.Client
+	processRecords      func(context.Context, []*kgo.Record) []*kgo.Record
+	skipRecord          func(context.Context, *kgo.Record)
+	logger              *slog.Logger
+	fetchErrors         *fetchErrorTracker
+	cancel              context.CancelFunc
+	maxPollRecords      int
+	partitionQueueSize  int
+	targetBatchLatency  time.Duration
+	batchTimeout        time.Duration
+	stuckBatchThreshold time.Duration
+	stuckBatches        metric.Int64Counter
+
+	// Guards the consumers map, read by the admin API
+	mu sync.RWMutex
 }
 
 func (pc *PartitionConsumer) consume(ctx context.Context) {
@@ -66,10 +163,130 @@ func (pc *PartitionConsumer) consume(ctx context.Context) {
 			pc.logger.Info("partition consumer context canceled")
 			return
 
-		case records := <-pc.records:
-			pc.processRecordsAndCommit(records)
+		case request := <-pc.requests:
+			pc.applyRequest(request)
+
+		case <-pc.queue.ready:
+			pc.processQueue()
+		}
+	}
+}
+
+// request runs the operation on the consumer goroutine between two batches and waits until it is applied
+func (pc *PartitionConsumer) request(ctx context.Context, apply func()) error {
+	request := partitionRequest{apply: apply, done: make(chan struct{})}
+
+	select {
+	case pc.requests <- request:
+	case <-pc.done:
+		return fmt.Errorf("%w: %s partition %d", ErrPartitionNotAssigned, pc.topic, pc.partition)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	<-request.done
+	return nil
+}
+
+func (pc *PartitionConsumer) applyRequest(request partitionRequest) {
+	defer close(request.done)
+	request.apply()
+}
+
+// processQueue processes the queued records batch by batch, until the queue is empty,
+// the partition is halted or the consumer quits
+func (pc *PartitionConsumer) processQueue() {
+	for !pc.isHalted() {
+		select {
+		case <-pc.quit:
+			return
+		case request := <-pc.requests:
+			pc.applyRequest(request)
+		default:
+		}
+
+		records, queued := pc.queue.pop(pc.batchSize.size())
+		if len(records) == 0 {
+			return
+		}
+		if queued <= pc.queueSize/2 {
+			pc.resume(PauseReasonBackpressure)
+		}
+
+		start := time.Now()
+		pc.processRecordsAndCommit(records)
+		pc.batchSize.observe(len(records), time.Since(start))
+	}
+}
+
+// enqueue queues the fetched records for the consumer, the partition is paused while its queue is full
+func (pc *PartitionConsumer) enqueue(records []*kgo.Record) {
+	if staleAfter := pc.staleAfterOffset.Load(); staleAfter >= 0 {
+		if records[0].Offset > staleAfter && records[0].Offset < pc.staleBeforeOffset.Load() {
+			pc.logger.Info(fmt.Sprintf("Dropping records fetched before a rewind. topic: %s partition: %d offset: %d\n", pc.topic, pc.partition, records[0].Offset))
+			return
+		}
+		pc.staleAfterOffset.Store(-1)
+	}
+
+	if queued := pc.queue.push(records); queued >= pc.queueSize {
+		pc.pause(PauseReasonBackpressure)
+	}
+}
+
+// pause stops fetching the partition for the reason, the fetch is paused with the first reason
+func (pc *PartitionConsumer) pause(reason PauseReason) {
+	pc.pauseMutex.Lock()
+	defer pc.pauseMutex.Unlock()
+
+	if len(pc.pauseReasons) == 0 {
+		pc.client.PauseFetchPartitions(map[string][]int32{pc.topic: {pc.partition}})
+	}
+	pc.pauseReasons[reason] = true
+}
+
+// resume clears the reasons, the fetch is resumed once no reason is left
+func (pc *PartitionConsumer) resume(reasons ...PauseReason) {
+	pc.pauseMutex.Lock()
+	defer pc.pauseMutex.Unlock()
+
+	cleared := false
+	for _, reason := range reasons {
+		if pc.pauseReasons[reason] {
+			delete(pc.pauseReasons, reason)
+			cleared = true
 		}
 	}
+	if !cleared {
+		return
+	}
+
+	if len(pc.pauseReasons) == 0 {
+		pc.client.ResumeFetchPartitions(map[string][]int32{pc.topic: {pc.partition}})
+	}
+	// The queue may have been left while the partition was halted
+	pc.queue.signal()
+}
+
+// isHalted returns true while the queued records must not be processed
+func (pc *PartitionConsumer) isHalted() bool {
+	pc.pauseMutex.Lock()
+	defer pc.pauseMutex.Unlock()
+
+	return pc.pauseReasons[PauseReasonAdmin] || pc.pauseReasons[PauseReasonStopped]
+}
+
+func (pc *PartitionConsumer) pausedFor() []PauseReason {
+	pc.pauseMutex.Lock()
+	defer pc.pauseMutex.Unlock()
+
+	reasons := make([]PauseReason, 0, len(pc.pauseReasons))
+	for reason := range pc.pauseReasons {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool { return reasons[i] < reasons[j] })
+
+	return reasons
 }
 
 // safely closes the quit channel only once
@@ -81,34 +298,150 @@ func (pc *PartitionConsumer) closeQuitChannel() {
 
 func (pc *PartitionConsumer) processRecordsAndCommit(records []*kgo.Record) {
 	ctx := context.Background()
+	if pc.batchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, pc.batchTimeout, ErrBatchDeadlineExceeded)
+		defer cancel()
+	}
+
 	span := tracing.StartSpan(ctx, "Consumer.Consume")
 	defer span.End()
 
+	pc.startBatch(records)
+	defer pc.batchStartedAt.Store(0)
+
 	span.SetAttribute("records.length", len(records))
 
-	processedRecords := pc.processRecords(ctx, records)
+	pc.lastFetchedOffset.Store(max(pc.lastFetchedOffset.Load(), records[len(records)-1].Offset))
+
+	pendingRecords, skippedRecords := pc.takeSkippedRecords(records)
+	for _, record := range skippedRecords {
+		pc.logger.Warn(fmt.Sprintf("Skipping record topic: %s partition: %d offset: %d\n", pc.topic, pc.partition, record.Offset))
+		if pc.skipRecord != nil {
+			pc.skipRecord(ctx, record)
+		}
+	}
+
+	processedRecords := skippedRecords
+	if len(pendingRecords) > 0 {
+		processedRecords = append(processedRecords, pc.processRecords(ctx, pendingRecords)...)
+	}
+	for _, record := range processedRecords {
+		pc.lastProcessedOffset.Store(max(pc.lastProcessedOffset.Load(), record.Offset))
+	}
 	commitableRecords := records
+	nextOffset := records[len(records)-1].Offset + 1
 
 	if len(processedRecords) != len(records) {
 		// Ensure we are not committing records that were not processed and can be re-consumed
-		record, ok := findMaxCommitableRecord(processedRecords, records)
-		if !ok {
-			// No record in the batch is safe to commit (e.g. the first record failed).
-			// Skip the commit; records will be re-polled after the next rebalance.
+		nextOffset, _ = firstUnprocessedOffset(processedRecords, records)
+		commitableRecords = nil
+		if record, ok := findMaxCommitableRecord(processedRecords, records); ok {
+			commitableRecords = []*kgo.Record{record}
+		} else {
+			// No record in the batch is safe to commit (e.g. the first record failed)
 			pc.logger.Warn(fmt.Sprintf("No commitable record in batch, skipping commit. topic: %s partition: %d batch_size: %d processed: %d\n", pc.topic, pc.partition, len(records), len(processedRecords)))
-			return
 		}
-		commitableRecords = []*kgo.Record{record}
+	}
+	stopped := pc.stopIfRequested(nextOffset)
+
+	if len(commitableRecords) > 0 {
+		// The processed records are committed even when the batch deadline is exceeded
+		err := pc.client.CommitRecords(context.WithoutCancel(ctx), commitableRecords...)
+		if err != nil {
+			pc.logger.Error(fmt.Sprintf("Error when committing offets to kafka. Error: %v topic: %s partition: %d offset: %d\n", err, pc.topic, pc.partition, records[len(records)-1].Offset+1))
+			utils.CaptureError(err)
+		}
 	}
 
-	err := pc.client.CommitRecords(ctx, commitableRecords...)
-	if err != nil {
-		pc.logger.Error(fmt.Sprintf("Error when committing offets to kafka. Error: %v topic: %s partition: %d offset: %d\n", err, pc.topic, pc.partition, records[len(records)-1].Offset+1))
-		utils.CaptureError(err)
+	if len(processedRecords) == len(records) {
+		pc.consecutiveRetries = 0
+		return
+	}
+	if !stopped {
+		pc.retryFrom(nextOffset)
+	}
+}
+
+// retryFrom rewinds the partition to its first record not processed, so the records after it
+// are not committed before it is processed. The retries are delayed with an exponential backoff.
+func (pc *PartitionConsumer) retryFrom(offset int64) {
+	pc.rewind(offset)
+	pc.consecutiveRetries++
+
+	backoff := fetchBackoff(pc.consecutiveRetries)
+	pc.logger.Warn(fmt.Sprintf("Records not processed, retrying the partition. topic: %s partition: %d offset: %d backoff: %s\n", pc.topic, pc.partition, offset, backoff))
+
+	select {
+	case <-time.After(backoff):
+	case <-pc.quit:
 	}
 }
 
+// stopIfRequested pauses the partition when a stop was requested while processing the batch,
+// the partition is rewound to the given offset so the records not committed are consumed again once resumed.
+// It returns true when the partition is stopped.
+func (pc *PartitionConsumer) stopIfRequested(nextOffset int64) bool {
+	if !pc.stopRequested.Swap(false) {
+		return false
+	}
+
+	pc.pause(PauseReasonStopped)
+	if nextOffset <= pc.lastFetchedOffset.Load() {
+		pc.rewind(nextOffset)
+	}
+
+	pc.logger.Error(fmt.Sprintf("Partition stopped, it must be resumed through the admin API. topic: %s partition: %d offset: %d\n", pc.topic, pc.partition, nextOffset))
+	return true
+}
+
+// rewind moves the partition to an offset, the queued records and the records fetched before the rewind are dropped.
+// Moving backward drops every batch continuing after the last fetched record,
+// moving forward only drops the batches starting before the new offset.
+func (pc *PartitionConsumer) rewind(offset int64) {
+	lastFetched := pc.lastFetchedOffset.Load()
+	staleBefore := int64(math.MaxInt64)
+	if offset > lastFetched {
+		staleBefore = offset
+	}
+
+	// Stored first, enqueue reads it after staleAfterOffset
+	pc.staleBeforeOffset.Store(staleBefore)
+	pc.staleAfterOffset.Store(lastFetched)
+	pc.queue.clear()
+	pc.resume(PauseReasonBackpressure)
+	pc.client.SetOffsets(map[string]map[int32]kgo.EpochOffset{
+		pc.topic: {pc.partition: {Epoch: -1, Offset: offset}},
+	})
+}
+
+// takeSkippedRecords splits the records to process from the records skipped through the admin API
+func (pc *PartitionConsumer) takeSkippedRecords(records []*kgo.Record) ([]*kgo.Record, []*kgo.Record) {
+	pc.skipMutex.Lock()
+	defer pc.skipMutex.Unlock()
+
+	if len(pc.skippedOffsets) == 0 {
+		return records, nil
+	}
+
+	pendingRecords := make([]*kgo.Record, 0, len(records))
+	var skippedRecords []*kgo.Record
+	for _, record := range records {
+		if pc.skippedOffsets[record.Offset] {
+			delete(pc.skippedOffsets, record.Offset)
+			skippedRecords = append(skippedRecords, record)
+			continue
+		}
+		pendingRecords = append(pendingRecords, record)
+	}
+
+	return pendingRecords, skippedRecords
+}
+
 func (cg *ConsumerGroup) assigned(ctx context.Context, cl *kgo.Client, assigned map[string][]int32) {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+
 	for topic, partitions := range assigned {
 		for _, partition := range partitions {
 			pc := &PartitionConsumer{
@@ -119,27 +452,46 @@ func (cg *ConsumerGroup) assigned(ctx context.Context, cl *kgo.Client, assigned
 
 				quit:              make(chan struct{}),
 				done:              make(chan struct{}),
-				records:           make(chan []*kgo.Record),
+				queue:             newPartitionQueue(),
+				queueSize:         cg.partitionQueueSize,
+				batchSize:         newAdaptiveBatchSize(min(MIN_BATCH_SIZE, cg.maxPollRecords), cg.maxPollRecords, cg.targetBatchLatency),
+				batchTimeout:      cg.batchTimeout,
 				processRecords:    cg.processRecords,
+				skipRecord:        cg.skipRecord,
 				atomicQuitClosing: sync.Once{},
+				requests:          make(chan partitionRequest),
+				skippedOffsets:    make(map[int64]bool),
+				pauseReasons:      make(map[PauseReason]bool),
 			}
+			pc.lastFetchedOffset.Store(-1)
+			pc.lastProcessedOffset.Store(-1)
+			pc.staleAfterOffset.Store(-1)
 			cg.consumers[TopicPartition{topic: topic, partition: partition}] = pc
 			go pc.consume(ctx)
 		}
 	}
 }
 
-func (cg *ConsumerGroup) lost(_ context.Context, _ *kgo.Client, lost map[string][]int32) {
+func (cg *ConsumerGroup) lost(_ context.Context, cl *kgo.Client, lost map[string][]int32) {
 	errgroup := errgroup.Group{}
 	defer errgroup.Wait()
 
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+
 	for topic, partitions := range lost {
 		for _, partition := range partitions {
 			tp := TopicPartition{topic: topic, partition: partition}
-			pc := cg.consumers[tp]
+			pc, exists := cg.consumers[tp]
+			if !exists {
+				continue
+			}
 			delete(cg.consumers, tp)
 			pc.closeQuitChannel()
 
+			// The pause of the client outlives the assignment, it would block the partition if it is assigned again
+			cl.ResumeFetchPartitions(map[string][]int32{topic: {partition}})
+
 			pc.logger.Info(fmt.Sprintf("waiting for work to finish topic %s partition %d\n", topic, partition))
 			errgroup.Go(func() error {
 				<-pc.done
@@ -165,49 +517,153 @@ func (cg *ConsumerGroup) poll(ctx context.Context) {
 }
 
 func (cg *ConsumerGroup) pollRecords(ctx context.Context) bool {
-	fetches := cg.client.PollRecords(ctx, 10000)
+	cg.resumeIsolatedPartitions()
+
+	// Isolated partitions are resumed between two polls, which must not wait for records indefinitely
+	pollCtx := ctx
+	if cg.fetchErrors.hasPausedPartitions() {
+		var cancel context.CancelFunc
+		pollCtx, cancel = context.WithTimeout(ctx, ISOLATED_PARTITIONS_POLL_TIMEOUT)
+		defer cancel()
+	}
+
+	fetches := cg.client.PollRecords(pollCtx, cg.maxPollRecords)
 	if fetches.IsClientClosed() {
 		cg.logger.Info("client closed")
 		return false
 	}
 
-	hasContextError := false
-	fetches.EachError(func(_ string, _ int32, err error) {
+	var transientErr, fatalErr error
+	fetches.EachError(func(topic string, partition int32, err error) {
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-			hasContextError = true
 			return
 		}
 
-		cg.logger.Error("Fetch error", slog.String("error", err.Error()))
-		panic(err)
+		class := ClassifyFetchError(err)
+		cg.fetchErrors.recordMetric(ctx, class)
+		cg.logger.Error(
+			"Fetch error",
+			slog.String("error", err.Error()),
+			slog.String("class", string(class)),
+			slog.Int("partition", int(partition)),
+		)
+
+		switch class {
+		case FetchErrorPartition:
+			cg.isolatePartition(topic, partition, err)
+		case FetchErrorFatal:
+			fatalErr = err
+		default:
+			transientErr = err
+		}
 	})
 
-	if hasContextError || ctx.Err() != nil {
+	if ctx.Err() != nil {
 		// Context was canceled before fetching records of while checking for errors
 		return false
 	}
 
+	if fatalErr != nil {
+		cg.fail(fatalErr)
+		return false
+	}
+
 	fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+		if p.Err != nil || len(p.Records) == 0 {
+			return
+		}
+		cg.fetchErrors.recordPartitionSuccess(p.Partition)
+
 		tp := TopicPartition{p.Topic, p.Partition}
-		if consumer, exists := cg.consumers[tp]; exists {
-			// Only send records if the consumer channel is still open
-			select {
-			case consumer.records <- p.Records:
-			case <-ctx.Done():
-				cg.logger.Info("Context canceled while sending records to partition consumer")
-				return
-			}
+		cg.mu.RLock()
+		consumer, exists := cg.consumers[tp]
+		cg.mu.RUnlock()
+
+		if exists {
+			consumer.enqueue(p.Records)
 		}
 	})
 
 	cg.client.AllowRebalance()
-	return true
+
+	if transientErr == nil {
+		cg.fetchErrors.recordSuccess()
+		return true
+	}
+
+	backoff, retry := cg.fetchErrors.recordTransient(transientErr)
+	if !retry {
+		cg.fail(fmt.Errorf("fetch errors for more than %s: %w", cg.fetchErrors.timeout, transientErr))
+		return false
+	}
+
+	select {
+	case <-time.After(backoff):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// isolatePartition pauses a partition failing with a partition specific error, it is retried after a backoff
+func (cg *ConsumerGroup) isolatePartition(topic string, partition int32, err error) {
+	resumeAt := cg.fetchErrors.isolate(partition, err)
+	if pc, lookupErr := cg.partitionConsumer(partition); lookupErr == nil {
+		pc.pause(PauseReasonFetchError)
+	}
+
+	utils.CaptureError(err)
+	cg.logger.Warn("Partition isolated", slog.Int("partition", int(partition)), slog.Time("resume_at", resumeAt))
+}
+
+func (cg *ConsumerGroup) resumeIsolatedPartitions() {
+	partitions := cg.fetchErrors.partitionsToResume()
+	if len(partitions) == 0 {
+		return
+	}
+
+	for _, partition := range partitions {
+		if pc, err := cg.partitionConsumer(partition); err == nil {
+			pc.resume(PauseReasonFetchError)
+		}
+	}
+	cg.logger.Info("Isolated partitions resumed", slog.Any("partitions", partitions))
+}
+
+// fail stops the consumer group on an unrecoverable fetch error, it is returned by Err once the group is stopped
+func (cg *ConsumerGroup) fail(err error) {
+	cg.fetchErrors.fail(err)
+	utils.CaptureError(err)
+	cg.logger.Error("Unrecoverable fetch error, stopping the consumer group", slog.String("error", err.Error()))
+
+	cg.cancel()
+}
+
+// Health reports the fetch errors and the stuck partitions of the consumer group
+func (cg *ConsumerGroup) Health() ConsumerHealth {
+	health := cg.fetchErrors.health()
+
+	health.StuckPartitions = cg.stuckPartitions(time.Now())
+	if len(health.StuckPartitions) > 0 && health.Status == HealthStatusHealthy {
+		health.Status = HealthStatusDegraded
+	}
+
+	return health
+}
+
+// Err returns the fatal fetch error that stopped the consumer group, if any
+func (cg *ConsumerGroup) Err() error {
+	return cg.fetchErrors.fatal()
 }
 
 func (cg *ConsumerGroup) gracefulShutdown() {
 	errgroup := errgroup.Group{}
 
-	for topicPartition, partitionConsumer := range cg.consumers {
+	cg.mu.RLock()
+	consumers := maps.Clone(cg.consumers)
+	cg.mu.RUnlock()
+
+	for topicPartition, partitionConsumer := range consumers {
 		errgroup.Go(func() error {
 			cg.logger.Info("Shuting down partion consumer",
 				slog.String("topic", topicPartition.topic),
@@ -229,9 +685,20 @@ func NewConsumerGroup(serverConfig ServerConfig, cfg *ConsumerGroupConfig) (*Con
 		With("kafka-topic-consumer", cfg.Topic)
 
 	cg := &ConsumerGroup{
+		topic:          cfg.Topic,
 		consumers:      make(map[TopicPartition]*PartitionConsumer),
 		processRecords: cfg.ProcessRecords,
+		skipRecord:     cfg.SkipRecord,
 		logger:         logger,
+		fetchErrors:    newFetchErrorTracker(cfg.Topic, cfg.FetchErrorTimeout),
+		cancel:         func() {},
+
+		maxPollRecords:      cmp.Or(cfg.MaxPollRecords, DEFAULT_MAX_POLL_RECORDS),
+		partitionQueueSize:  cmp.Or(cfg.PartitionQueueSize, DEFAULT_PARTITION_QUEUE_SIZE),
+		targetBatchLatency:  cmp.Or(cfg.TargetBatchLatency, DEFAULT_TARGET_BATCH_LATENCY),
+		batchTimeout:        cfg.BatchTimeout,
+		stuckBatchThreshold: cfg.StuckBatchThreshold,
+		stuckBatches:        newStuckBatchesCounter(),
 	}
 
 	cgName := fmt.Sprintf("%s_%s", cfg.ConsumerGroup, cfg.Topic)
@@ -258,11 +725,19 @@ func NewConsumerGroup(serverConfig ServerConfig, cfg *ConsumerGroupConfig) (*Con
 	return cg, nil
 }
 
+// Start consumes the topic until the context is canceled or a fatal fetch error happens, see Err
 func (cg *ConsumerGroup) Start(ctx context.Context) {
+	ctx, cg.cancel = context.WithCancel(ctx)
+	defer cg.cancel()
+
 	go func() {
 		cg.poll(ctx)
 	}()
 
+	if cg.stuckBatchThreshold > 0 {
+		go cg.watch(ctx)
+	}
+
 	<-ctx.Done()
 	cg.logger.Info("Gracefully shutting down consumer group")
 
@@ -276,6 +751,23 @@ func (cg *ConsumerGroup) Start(ctx context.Context) {
 // commitable prefix of the batch. ok is false when no such record exists
 // (typically because the first record of the batch was not processed).
 func findMaxCommitableRecord(processedRecords []*kgo.Record, records []*kgo.Record) (*kgo.Record, bool) {
+	// Find the minimum offset of the unprocessed records
+	minUnprocessedOffset, _ := firstUnprocessedOffset(processedRecords, records)
+
+	// Find the record with the offset just before the minimum unprocessed offset
+	var maxRecord *kgo.Record
+	for _, record := range processedRecords {
+		if record.Offset < minUnprocessedOffset && (maxRecord == nil || record.Offset > maxRecord.Offset) {
+			maxRecord = record
+		}
+	}
+
+	return maxRecord, maxRecord != nil
+}
+
+// firstUnprocessedOffset returns the lowest offset of the records that were not processed,
+// ok is false when all the records were processed
+func firstUnprocessedOffset(processedRecords []*kgo.Record, records []*kgo.Record) (int64, bool) {
 	// Keep track of processed records
 	processedMap := make(map[string]bool)
 	for _, record := range processedRecords {
@@ -283,26 +775,15 @@ func findMaxCommitableRecord(processedRecords []*kgo.Record, records []*kgo.Reco
 		processedMap[key] = true
 	}
 
-	// Find the minimum offset of the unprocessed records
 	minUnprocessedOffset := int64(math.MaxInt64)
 	foundUnprocessed := false
 	for _, record := range records {
 		key := fmt.Sprintf("%s-%d", string(record.Key), record.Offset)
-		if !processedMap[key] {
-			if !foundUnprocessed || record.Offset < minUnprocessedOffset {
-				minUnprocessedOffset = record.Offset
-				foundUnprocessed = true
-			}
+		if !processedMap[key] && record.Offset < minUnprocessedOffset {
+			minUnprocessedOffset = record.Offset
+			foundUnprocessed = true
 		}
 	}
 
-	// Find the record with the offset just before the minimum unprocessed offset
-	var maxRecord *kgo.Record
-	for _, record := range processedRecords {
-		if record.Offset < minUnprocessedOffset && (maxRecord == nil || record.Offset > maxRecord.Offset) {
-			maxRecord = record
-		}
-	}
-
-	return maxRecord, maxRecord != nil
+	return minUnprocessedOffset, foundUnprocessed
 }
@@ -0,0 +1,213 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+var (
+	ErrPartitionNotAssigned = errors.New("partition is not assigned to this consumer")
+	ErrOffsetCommitted      = errors.New("offset is already committed")
+)
+
+// PartitionAssignment describes a partition consumed by this instance, offsets are -1 when unknown
+type PartitionAssignment struct {
+	Topic               string `json:"topic"`
+	Partition           int32  `json:"partition"`
+	LastProcessedOffset int64  `json:"last_processed_offset"`
+	CommittedOffset     int64  `json:"committed_offset"`
+	Paused              bool   `json:"paused"`
+	// Why the fetch of the partition is paused, empty when it is fetched
+	PauseReasons  []PauseReason `json:"pause_reasons"`
+	QueuedRecords int           `json:"queued_records"`
+	BatchSize     int           `json:"batch_size"`
+}
+
+// Assignments returns the partitions assigned to this instance, sorted by partition
+func (cg *ConsumerGroup) Assignments() []PartitionAssignment {
+	committed := cg.client.CommittedOffsets()[cg.topic]
+
+	cg.mu.RLock()
+	defer cg.mu.RUnlock()
+
+	assignments := make([]PartitionAssignment, 0, len(cg.consumers))
+	for tp, pc := range cg.consumers {
+		committedOffset := int64(-1)
+		if offset, found := committed[tp.partition]; found {
+			committedOffset = offset.Offset
+		}
+
+		pauseReasons := pc.pausedFor()
+		assignments = append(assignments, PartitionAssignment{
+			Topic:               tp.topic,
+			Partition:           tp.partition,
+			LastProcessedOffset: pc.lastProcessedOffset.Load(),
+			CommittedOffset:     committedOffset,
+			Paused:              len(pauseReasons) > 0,
+			PauseReasons:        pauseReasons,
+			QueuedRecords:       pc.queue.len(),
+			BatchSize:           pc.batchSize.size(),
+		})
+	}
+	sort.Slice(assignments, func(i, j int) bool {
+		return assignments[i].Partition < assignments[j].Partition
+	})
+
+	return assignments
+}
+
+// PausePartition stops fetching and processing the partition until it is resumed, the batch in progress is still processed
+func (cg *ConsumerGroup) PausePartition(partition int32) error {
+	pc, err := cg.partitionConsumer(partition)
+	if err != nil {
+		return err
+	}
+
+	pc.pause(PauseReasonAdmin)
+	cg.logger.Info("Partition paused", slog.Int("partition", int(partition)))
+	return nil
+}
+
+// ResumePartition resumes a partition paused through the admin API or stopped after too many panics,
+// it stays paused while its queue is full or while it is isolated after a fetch error
+func (cg *ConsumerGroup) ResumePartition(partition int32) error {
+	pc, err := cg.partitionConsumer(partition)
+	if err != nil {
+		return err
+	}
+
+	pc.resume(PauseReasonAdmin, PauseReasonStopped)
+	cg.logger.Info("Partition resumed", slog.Int("partition", int(partition)))
+	return nil
+}
+
+// SkipOffset pushes the record at the given offset to the skip hook instead of processing it.
+// When the record was already fetched, the partition is rewound to it so it is consumed again:
+// the records fetched after it are then processed again.
+// The skip is applied between two batches, it waits for the batch in progress.
+func (cg *ConsumerGroup) SkipOffset(ctx context.Context, partition int32, offset int64) error {
+	pc, err := cg.partitionConsumer(partition)
+	if err != nil {
+		return err
+	}
+
+	if committed, found := cg.client.CommittedOffsets()[cg.topic][partition]; found && offset < committed.Offset {
+		return fmt.Errorf("%w: partition %d is committed up to offset %d", ErrOffsetCommitted, partition, committed.Offset)
+	}
+
+	err = pc.request(ctx, func() {
+		pc.skipMutex.Lock()
+		pc.skippedOffsets[offset] = true
+		pc.skipMutex.Unlock()
+
+		if offset <= pc.lastFetchedOffset.Load() {
+			pc.rewind(offset)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	cg.logger.Warn("Offset skipped", slog.Int("partition", int(partition)), slog.Int64("offset", offset))
+	return nil
+}
+
+// SeekToTimestamp moves the partition to the first record produced at or after the timestamp,
+// or to the end of the partition when there is none. It returns the new offset.
+// The partition is moved between two batches, it waits for the batch in progress.
+func (cg *ConsumerGroup) SeekToTimestamp(ctx context.Context, partition int32, timestamp time.Time) (int64, error) {
+	pc, err := cg.partitionConsumer(partition)
+	if err != nil {
+		return 0, err
+	}
+
+	offset, err := cg.listOffset(ctx, partition, timestamp.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	if offset.Offset < 0 {
+		// No record after the timestamp, -1 lists the end offset
+		offset, err = cg.listOffset(ctx, partition, -1)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// The records already fetched or queued are not processed
+	err = pc.request(ctx, func() {
+		pc.rewind(offset.Offset)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	cg.logger.Warn("Partition moved", slog.Int("partition", int(partition)), slog.Int64("offset", offset.Offset), slog.Time("timestamp", timestamp))
+	return offset.Offset, nil
+}
+
+// StopPartition pauses the partition once its batch in progress is done, it stays paused until resumed
+func (cg *ConsumerGroup) StopPartition(topic string, partition int32) error {
+	if topic != cg.topic {
+		return fmt.Errorf("%w: %s partition %d", ErrPartitionNotAssigned, topic, partition)
+	}
+
+	pc, err := cg.partitionConsumer(partition)
+	if err != nil {
+		return err
+	}
+
+	pc.stopRequested.Store(true)
+	return nil
+}
+
+func (cg *ConsumerGroup) partitionConsumer(partition int32) (*PartitionConsumer, error) {
+	cg.mu.RLock()
+	defer cg.mu.RUnlock()
+
+	pc, exists := cg.consumers[TopicPartition{topic: cg.topic, partition: partition}]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s partition %d", ErrPartitionNotAssigned, cg.topic, partition)
+	}
+
+	return pc, nil
+}
+
+func (cg *ConsumerGroup) listOffset(ctx context.Context, partition int32, timestamp int64) (kgo.EpochOffset, error) {
+	requestPartition := kmsg.NewListOffsetsRequestTopicPartition()
+	requestPartition.Partition = partition
+	requestPartition.Timestamp = timestamp
+
+	requestTopic := kmsg.NewListOffsetsRequestTopic()
+	requestTopic.Topic = cg.topic
+	requestTopic.Partitions = append(requestTopic.Partitions, requestPartition)
+
+	request := kmsg.NewPtrListOffsetsRequest()
+	request.Topics = append(request.Topics, requestTopic)
+
+	response, err := request.RequestWith(ctx, cg.client)
+	if err != nil {
+		return kgo.EpochOffset{}, err
+	}
+
+	for _, topic := range response.Topics {
+		for _, p := range topic.Partitions {
+			if p.Partition != partition {
+				continue
+			}
+			if err := kerr.ErrorForCode(p.ErrorCode); err != nil {
+				return kgo.EpochOffset{}, err
+			}
+			return kgo.EpochOffset{Epoch: p.LeaderEpoch, Offset: p.Offset}, nil
+		}
+	}
+
+	return kgo.EpochOffset{}, fmt.Errorf("no offset listed for %s partition %d", cg.topic, partition)
+}
@@ -1,9 +1,13 @@
 package kafka
 
 import (
+	"context"
+	"log/slog"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
@@ -123,3 +127,174 @@ func TestFindMaxCommitableRecord(t *testing.T) {
 		}
 	}
 }
+
+func TestTakeSkippedRecords(t *testing.T) {
+	records := []*kgo.Record{
+		createRecord("key1", 1),
+		createRecord("key2", 2),
+		createRecord("key3", 3),
+	}
+
+	t.Run("Without skipped offsets", func(t *testing.T) {
+		pc := &PartitionConsumer{skippedOffsets: make(map[int64]bool)}
+
+		pending, skipped := pc.takeSkippedRecords(records)
+		assert.Equal(t, records, pending)
+		assert.Empty(t, skipped)
+	})
+
+	t.Run("With a skipped offset", func(t *testing.T) {
+		pc := &PartitionConsumer{skippedOffsets: map[int64]bool{2: true, 10: true}}
+
+		pending, skipped := pc.takeSkippedRecords(records)
+		assert.Equal(t, []*kgo.Record{records[0], records[2]}, pending)
+		assert.Equal(t, []*kgo.Record{records[1]}, skipped)
+
+		// An offset is only skipped once, the offsets not fetched yet are kept
+		assert.Equal(t, map[int64]bool{10: true}, pc.skippedOffsets)
+	})
+}
+
+func TestProcessRecordsWithUnprocessedRecord(t *testing.T) {
+	client, err := kgo.NewClient(kgo.SeedBrokers("localhost:9092"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	var batches [][]int64
+	timedOut := map[int64]bool{2: true}
+	pc := &PartitionConsumer{
+		client:       client,
+		logger:       slog.Default(),
+		topic:        "events_raw",
+		partition:    1,
+		quit:         make(chan struct{}),
+		queue:        newPartitionQueue(),
+		queueSize:    100,
+		batchSize:    newAdaptiveBatchSize(1, 3, time.Minute),
+		pauseReasons: make(map[PauseReason]bool),
+		processRecords: func(ctx context.Context, records []*kgo.Record) []*kgo.Record {
+			offsets := make([]int64, 0, len(records))
+			processed := make([]*kgo.Record, 0, len(records))
+			for _, record := range records {
+				offsets = append(offsets, record.Offset)
+				// The record times out the first time it is processed
+				if timedOut[record.Offset] {
+					delete(timedOut, record.Offset)
+					continue
+				}
+				processed = append(processed, record)
+			}
+			batches = append(batches, offsets)
+			return processed
+		},
+	}
+	pc.lastFetchedOffset.Store(-1)
+	pc.lastProcessedOffset.Store(-1)
+	pc.staleAfterOffset.Store(-1)
+
+	pc.enqueue(createRecords(1, 2, 3))
+	pc.enqueue(createRecords(4, 5, 6))
+	pc.processQueue()
+
+	// The queued batch is dropped, it would commit past the timed out record
+	assert.Equal(t, [][]int64{{1, 2, 3}}, batches)
+	assert.Equal(t, 0, pc.queue.len())
+	assert.Equal(t, 1, pc.consecutiveRetries)
+
+	// Batches fetched before the rewind are dropped, the partition is consumed again from the timed out record
+	pc.enqueue(createRecords(7, 8))
+	pc.enqueue(createRecords(2, 3, 4))
+	pc.processQueue()
+
+	assert.Equal(t, [][]int64{{1, 2, 3}, {2, 3, 4}}, batches)
+	assert.Equal(t, 0, pc.consecutiveRetries)
+	assert.Equal(t, int64(4), pc.lastProcessedOffset.Load())
+}
+
+func TestSkipOffsetDuringBatch(t *testing.T) {
+	client, err := kgo.NewClient(kgo.SeedBrokers("localhost:9092"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	batches := make(chan []int64, 10)
+	skipped := make(chan int64, 10)
+	release := make(chan struct{})
+	pc := &PartitionConsumer{
+		client:         client,
+		logger:         slog.Default(),
+		topic:          "events_raw",
+		partition:      1,
+		quit:           make(chan struct{}),
+		done:           make(chan struct{}),
+		requests:       make(chan partitionRequest),
+		queue:          newPartitionQueue(),
+		queueSize:      100,
+		batchSize:      newAdaptiveBatchSize(3, 3, time.Minute),
+		skippedOffsets: make(map[int64]bool),
+		pauseReasons:   make(map[PauseReason]bool),
+		processRecords: func(ctx context.Context, records []*kgo.Record) []*kgo.Record {
+			offsets := make([]int64, 0, len(records))
+			for _, record := range records {
+				offsets = append(offsets, record.Offset)
+			}
+			batches <- offsets
+			<-release
+			return records
+		},
+		skipRecord: func(ctx context.Context, record *kgo.Record) {
+			skipped <- record.Offset
+		},
+	}
+	pc.lastFetchedOffset.Store(-1)
+	pc.lastProcessedOffset.Store(-1)
+	pc.staleAfterOffset.Store(-1)
+
+	cg := &ConsumerGroup{
+		topic:     "events_raw",
+		client:    client,
+		logger:    slog.Default(),
+		consumers: map[TopicPartition]*PartitionConsumer{{topic: "events_raw", partition: 1}: pc},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go pc.consume(ctx)
+	defer func() {
+		pc.closeQuitChannel()
+		<-pc.done
+	}()
+
+	pc.enqueue(createRecords(1, 2, 3))
+	assert.Equal(t, []int64{1, 2, 3}, <-batches)
+
+	skipResult := make(chan error, 1)
+	go func() {
+		skipResult <- cg.SkipOffset(ctx, 1, 2)
+	}()
+
+	// The skip waits for the batch in progress
+	select {
+	case err := <-skipResult:
+		t.Fatalf("skip applied during the batch: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	require.NoError(t, <-skipResult)
+
+	// The batch was committed before the partition is rewound to the skipped record
+	assert.Equal(t, int64(3), pc.lastProcessedOffset.Load())
+	assert.Equal(t, 0, pc.queue.len())
+
+	pc.enqueue(createRecords(2, 3))
+	assert.Equal(t, int64(2), <-skipped)
+	assert.Equal(t, []int64{3}, <-batches)
+
+	t.Run("With a partition consumer that quit", func(t *testing.T) {
+		pc.closeQuitChannel()
+		<-pc.done
+
+		err := cg.SkipOffset(ctx, 1, 5)
+		assert.ErrorIs(t, err, ErrPartitionNotAssigned)
+	})
+}
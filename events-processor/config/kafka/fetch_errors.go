@@ -0,0 +1,296 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+const (
+	METER_NAME = "github.com/getlago/lago/events-processor/config/kafka"
+
+	// Backoff between two polls failing with a transient error, and before retrying an isolated partition
+	MIN_FETCH_BACKOFF = 100 * time.Millisecond
+	MAX_FETCH_BACKOFF = 30 * time.Second
+
+	// Maximum duration of a poll while partitions are isolated, so they are resumed on time
+	ISOLATED_PARTITIONS_POLL_TIMEOUT = time.Second
+)
+
+type FetchErrorClass string
+
+const (
+	// Retried with a backoff, they become fatal when they last longer than the fetch error timeout
+	FetchErrorTransient FetchErrorClass = "transient"
+	// Only the partition is paused, it is retried with a backoff while the other partitions are consumed
+	FetchErrorPartition FetchErrorClass = "partition"
+	// The consumer group stops
+	FetchErrorFatal FetchErrorClass = "fatal"
+)
+
+type HealthStatus string
+
+const (
+	HealthStatusHealthy  HealthStatus = "healthy"
+	HealthStatusDegraded HealthStatus = "degraded"
+	HealthStatusFailed   HealthStatus = "failed"
+)
+
+var (
+	partitionFetchErrors = []error{
+		kerr.OffsetOutOfRange,
+		kerr.CorruptMessage,
+		kerr.UnsupportedCompressionType,
+		kerr.InvalidRecord,
+	}
+
+	fatalFetchErrors = []error{
+		kerr.InvalidTopicException,
+		kerr.UnsupportedVersion,
+	}
+)
+
+// ClassifyFetchError tells how to handle an error returned by a poll.
+// Unknown errors are transient, authorization errors as well as they can be fixed without a restart.
+func ClassifyFetchError(err error) FetchErrorClass {
+	var dataLoss *kgo.ErrDataLoss
+	if errors.As(err, &dataLoss) {
+		return FetchErrorPartition
+	}
+
+	for _, partitionErr := range partitionFetchErrors {
+		if errors.Is(err, partitionErr) {
+			return FetchErrorPartition
+		}
+	}
+
+	for _, fatalErr := range fatalFetchErrors {
+		if errors.Is(err, fatalErr) {
+			return FetchErrorFatal
+		}
+	}
+
+	return FetchErrorTransient
+}
+
+// fetchBackoff doubles the backoff for each consecutive error, up to MAX_FETCH_BACKOFF
+func fetchBackoff(consecutiveErrors int) time.Duration {
+	backoff := MIN_FETCH_BACKOFF
+	for i := 1; i < consecutiveErrors && backoff < MAX_FETCH_BACKOFF; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, MAX_FETCH_BACKOFF)
+}
+
+// IsolatedPartition is a partition paused after a partition specific fetch error
+type IsolatedPartition struct {
+	Partition         int32     `json:"partition"`
+	Error             string    `json:"error"`
+	ConsecutiveErrors int       `json:"consecutive_errors"`
+	ResumeAt          time.Time `json:"resume_at"`
+}
+
+// ConsumerHealth reports the fetch errors of the consumer group
+type ConsumerHealth struct {
+	Status                 HealthStatus        `json:"status"`
+	ConsecutiveFetchErrors int                 `json:"consecutive_fetch_errors"`
+	LastFetchError         string              `json:"last_fetch_error,omitempty"`
+	LastFetchErrorAt       *time.Time          `json:"last_fetch_error_at,omitempty"`
+	IsolatedPartitions     []IsolatedPartition `json:"isolated_partitions"`
+	StuckPartitions        []StuckPartition    `json:"stuck_partitions"`
+}
+
+// fetchErrorTracker tracks the fetch errors of a consumer group, it is updated by the poll loop and read by the health checks
+type fetchErrorTracker struct {
+	topic   string
+	timeout time.Duration
+	now     func() time.Time
+	errors  metric.Int64Counter
+
+	mu                sync.Mutex
+	consecutiveErrors int
+	failingSince      time.Time
+	lastError         error
+	lastErrorAt       time.Time
+	isolated          map[int32]*IsolatedPartition
+	fatalError        error
+}
+
+func newFetchErrorTracker(topic string, timeout time.Duration) *fetchErrorTracker {
+	counter, err := otel.Meter(METER_NAME).Int64Counter(
+		"lago.events_processor.fetch_errors",
+		metric.WithDescription("Errors returned by the polls of the consumer group, by topic and class"),
+		metric.WithUnit("{error}"),
+	)
+	if err != nil {
+		slog.Error("Error creating the fetch errors counter", slog.String("error", err.Error()))
+		counter = noop.Int64Counter{}
+	}
+
+	return &fetchErrorTracker{
+		topic:    topic,
+		timeout:  timeout,
+		now:      time.Now,
+		errors:   counter,
+		isolated: make(map[int32]*IsolatedPartition),
+	}
+}
+
+func (t *fetchErrorTracker) recordMetric(ctx context.Context, class FetchErrorClass) {
+	t.errors.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("topic", t.topic),
+		attribute.String("class", string(class)),
+	))
+}
+
+// recordTransient tracks a poll failing with a transient error. It returns the backoff before the next poll,
+// and false when the errors have lasted longer than the timeout.
+func (t *fetchErrorTracker) recordTransient(err error) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if t.consecutiveErrors == 0 {
+		t.failingSince = now
+	}
+	t.consecutiveErrors++
+	t.lastError = err
+	t.lastErrorAt = now
+
+	if t.timeout > 0 && now.Sub(t.failingSince) >= t.timeout {
+		return 0, false
+	}
+
+	return fetchBackoff(t.consecutiveErrors), true
+}
+
+// recordSuccess resets the transient errors after a poll without error
+func (t *fetchErrorTracker) recordSuccess() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.consecutiveErrors = 0
+}
+
+// isolate tracks a partition specific error, and returns the time after which the partition is retried
+func (t *fetchErrorTracker) isolate(partition int32, err error) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.lastError = err
+	t.lastErrorAt = now
+
+	isolated, exists := t.isolated[partition]
+	if !exists {
+		isolated = &IsolatedPartition{Partition: partition}
+		t.isolated[partition] = isolated
+	}
+	isolated.Error = err.Error()
+	isolated.ConsecutiveErrors++
+	isolated.ResumeAt = now.Add(fetchBackoff(isolated.ConsecutiveErrors))
+
+	return isolated.ResumeAt
+}
+
+// partitionsToResume returns the isolated partitions whose backoff is over,
+// they are tracked until they are fetched without error, to grow the backoff of a partition failing again
+func (t *fetchErrorTracker) partitionsToResume() []int32 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	var partitions []int32
+	for partition, isolated := range t.isolated {
+		if !isolated.ResumeAt.IsZero() && !now.Before(isolated.ResumeAt) {
+			partitions = append(partitions, partition)
+			isolated.ResumeAt = time.Time{}
+		}
+	}
+
+	return partitions
+}
+
+// hasPausedPartitions returns true while an isolated partition waits for its backoff
+func (t *fetchErrorTracker) hasPausedPartitions() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, isolated := range t.isolated {
+		if !isolated.ResumeAt.IsZero() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// recordPartitionSuccess forgets an isolated partition once it is fetched again
+func (t *fetchErrorTracker) recordPartitionSuccess(partition int32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.isolated, partition)
+}
+
+func (t *fetchErrorTracker) fail(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.fatalError = err
+	t.lastError = err
+	t.lastErrorAt = t.now()
+}
+
+func (t *fetchErrorTracker) fatal() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.fatalError
+}
+
+func (t *fetchErrorTracker) health() ConsumerHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	health := ConsumerHealth{
+		Status:                 HealthStatusHealthy,
+		ConsecutiveFetchErrors: t.consecutiveErrors,
+		IsolatedPartitions:     make([]IsolatedPartition, 0, len(t.isolated)),
+	}
+
+	if t.lastError != nil {
+		lastErrorAt := t.lastErrorAt
+		health.LastFetchError = t.lastError.Error()
+		health.LastFetchErrorAt = &lastErrorAt
+	}
+
+	for _, isolated := range t.isolated {
+		if !isolated.ResumeAt.IsZero() {
+			health.IsolatedPartitions = append(health.IsolatedPartitions, *isolated)
+		}
+	}
+	sort.Slice(health.IsolatedPartitions, func(i, j int) bool {
+		return health.IsolatedPartitions[i].Partition < health.IsolatedPartitions[j].Partition
+	})
+
+	switch {
+	case t.fatalError != nil:
+		health.Status = HealthStatusFailed
+	case t.consecutiveErrors > 0 || len(health.IsolatedPartitions) > 0:
+		health.Status = HealthStatusDegraded
+	}
+
+	return health
+}
@@ -0,0 +1,112 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestClassifyFetchError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected FetchErrorClass
+	}{
+		{"With a leadership change", kerr.NotLeaderForPartition, FetchErrorTransient},
+		{"With an authorization error", kerr.TopicAuthorizationFailed, FetchErrorTransient},
+		{"With a network error", errors.New("connection reset by peer"), FetchErrorTransient},
+		{"With a corrupt message", fmt.Errorf("fetch: %w", kerr.CorruptMessage), FetchErrorPartition},
+		{"With an offset out of range", kerr.OffsetOutOfRange, FetchErrorPartition},
+		{"With a data loss", &kgo.ErrDataLoss{Topic: "events_raw", Partition: 1}, FetchErrorPartition},
+		{"With an invalid topic", kerr.InvalidTopicException, FetchErrorFatal},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, ClassifyFetchError(test.err))
+		})
+	}
+}
+
+func TestFetchBackoff(t *testing.T) {
+	assert.Equal(t, MIN_FETCH_BACKOFF, fetchBackoff(1))
+	assert.Equal(t, 4*MIN_FETCH_BACKOFF, fetchBackoff(3))
+	assert.Equal(t, MAX_FETCH_BACKOFF, fetchBackoff(100))
+}
+
+func setupFetchErrorTracker(timeout time.Duration) (*fetchErrorTracker, *time.Time) {
+	now := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	tracker := newFetchErrorTracker("events_raw", timeout)
+	tracker.now = func() time.Time { return now }
+
+	return tracker, &now
+}
+
+func TestFetchErrorTracker(t *testing.T) {
+	t.Run("With transient errors", func(t *testing.T) {
+		tracker, now := setupFetchErrorTracker(time.Minute)
+		assert.Equal(t, HealthStatusHealthy, tracker.health().Status)
+
+		backoff, retry := tracker.recordTransient(kerr.NotLeaderForPartition)
+		assert.True(t, retry)
+		assert.Equal(t, MIN_FETCH_BACKOFF, backoff)
+
+		backoff, retry = tracker.recordTransient(kerr.NotLeaderForPartition)
+		assert.True(t, retry)
+		assert.Equal(t, 2*MIN_FETCH_BACKOFF, backoff)
+
+		health := tracker.health()
+		assert.Equal(t, HealthStatusDegraded, health.Status)
+		assert.Equal(t, 2, health.ConsecutiveFetchErrors)
+		assert.Equal(t, kerr.NotLeaderForPartition.Error(), health.LastFetchError)
+
+		tracker.recordSuccess()
+		assert.Equal(t, HealthStatusHealthy, tracker.health().Status)
+
+		// Errors lasting longer than the timeout are not retried anymore
+		_, retry = tracker.recordTransient(kerr.TopicAuthorizationFailed)
+		assert.True(t, retry)
+
+		*now = now.Add(time.Minute)
+		_, retry = tracker.recordTransient(kerr.TopicAuthorizationFailed)
+		assert.False(t, retry)
+	})
+
+	t.Run("With a partition error", func(t *testing.T) {
+		tracker, now := setupFetchErrorTracker(time.Minute)
+
+		resumeAt := tracker.isolate(2, kerr.CorruptMessage)
+		assert.Equal(t, now.Add(MIN_FETCH_BACKOFF), resumeAt)
+		assert.True(t, tracker.hasPausedPartitions())
+		assert.Empty(t, tracker.partitionsToResume())
+
+		health := tracker.health()
+		assert.Equal(t, HealthStatusDegraded, health.Status)
+		assert.Len(t, health.IsolatedPartitions, 1)
+		assert.Equal(t, int32(2), health.IsolatedPartitions[0].Partition)
+
+		*now = now.Add(MIN_FETCH_BACKOFF)
+		assert.Equal(t, []int32{2}, tracker.partitionsToResume())
+		assert.False(t, tracker.hasPausedPartitions())
+
+		// The backoff grows when the partition fails again
+		resumeAt = tracker.isolate(2, kerr.CorruptMessage)
+		assert.Equal(t, now.Add(2*MIN_FETCH_BACKOFF), resumeAt)
+
+		tracker.recordPartitionSuccess(2)
+		assert.Equal(t, HealthStatusHealthy, tracker.health().Status)
+	})
+
+	t.Run("With a fatal error", func(t *testing.T) {
+		tracker, _ := setupFetchErrorTracker(0)
+
+		tracker.fail(kerr.InvalidTopicException)
+		assert.Equal(t, kerr.InvalidTopicException, tracker.fatal())
+		assert.Equal(t, HealthStatusFailed, tracker.health().Status)
+	})
+}
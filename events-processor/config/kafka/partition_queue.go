@@ -0,0 +1,116 @@
+package kafka
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// partitionQueue buffers the records fetched for a partition until its consumer processes them,
+// so the poll loop never waits for a slow partition
+type partitionQueue struct {
+	mu      sync.Mutex
+	batches [][]*kgo.Record
+	size    int
+
+	// Signals the consumer that records are queued, or that it may process them again
+	ready chan struct{}
+}
+
+func newPartitionQueue() *partitionQueue {
+	return &partitionQueue{ready: make(chan struct{}, 1)}
+}
+
+// push queues the records and returns the number of queued records
+func (q *partitionQueue) push(records []*kgo.Record) int {
+	q.mu.Lock()
+	q.batches = append(q.batches, records)
+	q.size += len(records)
+	size := q.size
+	q.mu.Unlock()
+
+	q.signal()
+	return size
+}
+
+// pop takes up to maxRecords queued records in order, and returns the number of records left
+func (q *partitionQueue) pop(maxRecords int) ([]*kgo.Record, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var records []*kgo.Record
+	for len(q.batches) > 0 && len(records) < maxRecords {
+		batch := q.batches[0]
+		taken := min(len(batch), maxRecords-len(records))
+
+		records = append(records, batch[:taken]...)
+		if taken == len(batch) {
+			q.batches = q.batches[1:]
+		} else {
+			q.batches[0] = batch[taken:]
+		}
+	}
+	q.size -= len(records)
+
+	return records, q.size
+}
+
+func (q *partitionQueue) clear() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.batches = nil
+	q.size = 0
+}
+
+func (q *partitionQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.size
+}
+
+func (q *partitionQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// adaptiveBatchSize adjusts the number of records processed at once to the observed processing latency:
+// it is halved when a batch is slower than the target latency, and doubled when a full batch is twice as fast
+type adaptiveBatchSize struct {
+	min           int
+	max           int
+	targetLatency time.Duration
+
+	current atomic.Int64
+}
+
+func newAdaptiveBatchSize(minSize int, maxSize int, targetLatency time.Duration) *adaptiveBatchSize {
+	batchSize := &adaptiveBatchSize{
+		min:           minSize,
+		max:           maxSize,
+		targetLatency: targetLatency,
+	}
+	batchSize.current.Store(int64(maxSize))
+
+	return batchSize
+}
+
+func (b *adaptiveBatchSize) size() int {
+	return int(b.current.Load())
+}
+
+func (b *adaptiveBatchSize) observe(records int, latency time.Duration) {
+	current := b.size()
+
+	switch {
+	case latency > b.targetLatency && current > b.min:
+		b.current.Store(int64(max(b.min, current/2)))
+	case latency < b.targetLatency/2 && records >= current && current < b.max:
+		b.current.Store(int64(min(b.max, current*2)))
+	}
+}
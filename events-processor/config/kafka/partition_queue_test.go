@@ -0,0 +1,161 @@
+package kafka
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func createRecords(offsets ...int64) []*kgo.Record {
+	records := make([]*kgo.Record, 0, len(offsets))
+	for _, offset := range offsets {
+		records = append(records, createRecord("key", offset))
+	}
+
+	return records
+}
+
+func TestPartitionQueue(t *testing.T) {
+	t.Run("With batches merged and split", func(t *testing.T) {
+		queue := newPartitionQueue()
+		assert.Equal(t, 2, queue.push(createRecords(1, 2)))
+		assert.Equal(t, 5, queue.push(createRecords(3, 4, 5)))
+
+		records, queued := queue.pop(4)
+		assert.Equal(t, createRecords(1, 2, 3, 4), records)
+		assert.Equal(t, 1, queued)
+
+		records, queued = queue.pop(4)
+		assert.Equal(t, createRecords(5), records)
+		assert.Equal(t, 0, queued)
+
+		records, _ = queue.pop(4)
+		assert.Empty(t, records)
+	})
+
+	t.Run("With a cleared queue", func(t *testing.T) {
+		queue := newPartitionQueue()
+		queue.push(createRecords(1, 2))
+		queue.clear()
+
+		assert.Equal(t, 0, queue.len())
+		records, _ := queue.pop(10)
+		assert.Empty(t, records)
+	})
+
+	t.Run("With a pending signal", func(t *testing.T) {
+		queue := newPartitionQueue()
+		queue.push(createRecords(1))
+		queue.push(createRecords(2))
+
+		// Signals are merged, the consumer drains the whole queue on a signal
+		assert.Len(t, queue.ready, 1)
+	})
+}
+
+func TestAdaptiveBatchSize(t *testing.T) {
+	batchSize := newAdaptiveBatchSize(10, 100, time.Second)
+	assert.Equal(t, 100, batchSize.size())
+
+	// Slow batches halve the size down to the minimum
+	batchSize.observe(100, 2*time.Second)
+	assert.Equal(t, 50, batchSize.size())
+	for range 5 {
+		batchSize.observe(batchSize.size(), 2*time.Second)
+	}
+	assert.Equal(t, 10, batchSize.size())
+
+	// Fast batches only grow the size when they were full
+	batchSize.observe(5, 10*time.Millisecond)
+	assert.Equal(t, 10, batchSize.size())
+	batchSize.observe(10, 10*time.Millisecond)
+	assert.Equal(t, 20, batchSize.size())
+
+	// Batches close to the target keep the size
+	batchSize.observe(20, 800*time.Millisecond)
+	assert.Equal(t, 20, batchSize.size())
+
+	for range 5 {
+		batchSize.observe(batchSize.size(), 10*time.Millisecond)
+	}
+	assert.Equal(t, 100, batchSize.size())
+}
+
+func TestPartitionConsumerPauseReasons(t *testing.T) {
+	client, err := kgo.NewClient(kgo.SeedBrokers("localhost:9092"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	newPartitionConsumer := func() *PartitionConsumer {
+		pc := &PartitionConsumer{
+			client:       client,
+			logger:       slog.Default(),
+			topic:        "events_raw",
+			partition:    1,
+			queue:        newPartitionQueue(),
+			queueSize:    4,
+			batchSize:    newAdaptiveBatchSize(1, 10, time.Second),
+			pauseReasons: make(map[PauseReason]bool),
+		}
+		pc.staleAfterOffset.Store(-1)
+		return pc
+	}
+	isPaused := func() bool {
+		return len(client.PauseFetchPartitions(nil)["events_raw"]) > 0
+	}
+
+	t.Run("With backpressure", func(t *testing.T) {
+		pc := newPartitionConsumer()
+
+		pc.enqueue(createRecords(1, 2))
+		assert.False(t, isPaused())
+
+		pc.enqueue(createRecords(3, 4))
+		assert.True(t, isPaused())
+		assert.Equal(t, []PauseReason{PauseReasonBackpressure}, pc.pausedFor())
+
+		// The partition is only resumed when all the reasons are cleared
+		pc.pause(PauseReasonAdmin)
+		pc.resume(PauseReasonBackpressure)
+		assert.True(t, isPaused())
+		assert.True(t, pc.isHalted())
+
+		pc.resume(PauseReasonAdmin)
+		assert.False(t, isPaused())
+		assert.False(t, pc.isHalted())
+		assert.Empty(t, pc.pausedFor())
+	})
+
+	t.Run("With stale records after a rewind", func(t *testing.T) {
+		pc := newPartitionConsumer()
+		pc.lastFetchedOffset.Store(5)
+		pc.enqueue(createRecords(4, 5))
+		pc.rewind(3)
+		assert.Equal(t, 0, pc.queue.len())
+
+		pc.enqueue(createRecords(6, 7))
+		assert.Equal(t, 0, pc.queue.len())
+		assert.Equal(t, int64(5), pc.staleAfterOffset.Load())
+
+		pc.enqueue(createRecords(3, 4))
+		assert.Equal(t, 2, pc.queue.len())
+		assert.Equal(t, int64(-1), pc.staleAfterOffset.Load())
+	})
+
+	t.Run("With stale records after a seek forward", func(t *testing.T) {
+		pc := newPartitionConsumer()
+		pc.lastFetchedOffset.Store(5)
+		pc.rewind(100)
+
+		pc.enqueue(createRecords(6, 7))
+		assert.Equal(t, 0, pc.queue.len())
+
+		pc.enqueue(createRecords(100, 101))
+		assert.Equal(t, 2, pc.queue.len())
+		assert.Equal(t, int64(-1), pc.staleAfterOffset.Load())
+	})
+}
@@ -21,8 +21,9 @@ type Producer struct {
 }
 
 type ProducerMessage struct {
-	Key   []byte
-	Value []byte
+	Key     []byte
+	Value   []byte
+	Headers []kgo.RecordHeader
 }
 
 type MessageProducer interface {
@@ -54,9 +55,10 @@ func (p *Producer) Produce(ctx context.Context, msg *ProducerMessage) bool {
 	defer span.End()
 
 	record := &kgo.Record{
-		Topic: p.config.Topic,
-		Key:   msg.Key,
-		Value: msg.Value,
+		Topic:   p.config.Topic,
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: msg.Headers,
 	}
 
 	pr := p.client.ProduceSync(ctx, record)
@@ -0,0 +1,129 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+// Maximum interval between two checks of the watchdog
+const WATCHDOG_INTERVAL = 5 * time.Second
+
+// ErrBatchDeadlineExceeded is the cause of the cancellation of a batch processed for longer than the batch timeout
+var ErrBatchDeadlineExceeded = errors.New("batch processing deadline exceeded")
+
+// StuckPartition is a partition whose batch in progress exceeds the stuck batch threshold
+type StuckPartition struct {
+	Partition   int32     `json:"partition"`
+	FirstOffset int64     `json:"first_offset"`
+	Records     int       `json:"records"`
+	Since       time.Time `json:"since"`
+}
+
+func newStuckBatchesCounter() metric.Int64Counter {
+	counter, err := otel.Meter(METER_NAME).Int64Counter(
+		"lago.events_processor.stuck_batches",
+		metric.WithDescription("Batches processed for longer than the stuck batch threshold, by topic and partition"),
+		metric.WithUnit("{batch}"),
+	)
+	if err != nil {
+		slog.Error("Error creating the stuck batches counter", slog.String("error", err.Error()))
+		return noop.Int64Counter{}
+	}
+
+	return counter
+}
+
+func (pc *PartitionConsumer) startBatch(records []*kgo.Record) {
+	pc.batchFirstOffset.Store(records[0].Offset)
+	pc.batchRecords.Store(int64(len(records)))
+	pc.stuckReported.Store(false)
+	pc.batchStartedAt.Store(time.Now().UnixNano())
+}
+
+// watch reports the partitions making no progress until the context is canceled,
+// each stuck batch is reported once
+func (cg *ConsumerGroup) watch(ctx context.Context) {
+	ticker := time.NewTicker(min(WATCHDOG_INTERVAL, cg.stuckBatchThreshold))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case now := <-ticker.C:
+			cg.reportStuckPartitions(ctx, now)
+		}
+	}
+}
+
+func (cg *ConsumerGroup) reportStuckPartitions(ctx context.Context, now time.Time) {
+	for _, stuck := range cg.stuckPartitions(now) {
+		pc, err := cg.partitionConsumer(stuck.Partition)
+		if err != nil || pc.stuckReported.Swap(true) {
+			continue
+		}
+
+		cg.stuckBatches.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("topic", cg.topic),
+			attribute.Int("partition", int(stuck.Partition)),
+		))
+
+		err = fmt.Errorf("partition %d of %s stuck on the batch starting at offset %d for %s", stuck.Partition, cg.topic, stuck.FirstOffset, now.Sub(stuck.Since).Round(time.Second))
+		utils.CaptureError(err)
+		cg.logger.Error(
+			"Partition stuck",
+			slog.Int("partition", int(stuck.Partition)),
+			slog.Int64("first_offset", stuck.FirstOffset),
+			slog.Int("records", stuck.Records),
+			slog.Time("since", stuck.Since),
+		)
+	}
+}
+
+// stuckPartitions returns the partitions whose batch in progress started more than the stuck batch threshold ago
+func (cg *ConsumerGroup) stuckPartitions(now time.Time) []StuckPartition {
+	stuck := make([]StuckPartition, 0)
+	if cg.stuckBatchThreshold <= 0 {
+		return stuck
+	}
+
+	cg.mu.RLock()
+	defer cg.mu.RUnlock()
+
+	for tp, pc := range cg.consumers {
+		startedAt := pc.batchStartedAt.Load()
+		if startedAt == 0 {
+			continue
+		}
+
+		since := time.Unix(0, startedAt)
+		if now.Sub(since) < cg.stuckBatchThreshold {
+			continue
+		}
+
+		stuck = append(stuck, StuckPartition{
+			Partition:   tp.partition,
+			FirstOffset: pc.batchFirstOffset.Load(),
+			Records:     int(pc.batchRecords.Load()),
+			Since:       since,
+		})
+	}
+	sort.Slice(stuck, func(i, j int) bool {
+		return stuck[i].Partition < stuck[j].Partition
+	})
+
+	return stuck
+}
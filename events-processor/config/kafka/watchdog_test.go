@@ -0,0 +1,62 @@
+package kafka
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+func TestStuckPartitions(t *testing.T) {
+	now := time.Now()
+
+	idle := &PartitionConsumer{}
+	processing := &PartitionConsumer{}
+	processing.startBatch(createRecords(10, 11))
+	stuck := &PartitionConsumer{}
+	stuck.startBatch(createRecords(42, 43, 44))
+	stuck.batchStartedAt.Store(now.Add(-2 * time.Minute).UnixNano())
+
+	cg := &ConsumerGroup{
+		topic: "events_raw",
+		consumers: map[TopicPartition]*PartitionConsumer{
+			{topic: "events_raw", partition: 0}: idle,
+			{topic: "events_raw", partition: 1}: processing,
+			{topic: "events_raw", partition: 2}: stuck,
+		},
+		logger:              slog.Default(),
+		fetchErrors:         newFetchErrorTracker("events_raw", 0),
+		stuckBatchThreshold: time.Minute,
+		stuckBatches:        noop.Int64Counter{},
+	}
+
+	t.Run("With a batch over the threshold", func(t *testing.T) {
+		assert.Equal(t, []StuckPartition{
+			{Partition: 2, FirstOffset: 42, Records: 3, Since: time.Unix(0, stuck.batchStartedAt.Load())},
+		}, cg.stuckPartitions(now))
+
+		health := cg.Health()
+		assert.Equal(t, HealthStatusDegraded, health.Status)
+		assert.Len(t, health.StuckPartitions, 1)
+	})
+
+	t.Run("With a reported batch", func(t *testing.T) {
+		cg.reportStuckPartitions(context.Background(), now)
+		assert.True(t, stuck.stuckReported.Load())
+		assert.False(t, processing.stuckReported.Load())
+
+		// A new batch can be reported again
+		stuck.startBatch([]*kgo.Record{createRecord("key", 45)})
+		assert.False(t, stuck.stuckReported.Load())
+	})
+
+	t.Run("With a disabled watchdog", func(t *testing.T) {
+		cg.stuckBatchThreshold = 0
+		assert.Empty(t, cg.stuckPartitions(now))
+		assert.Equal(t, HealthStatusHealthy, cg.Health().Status)
+	})
+}
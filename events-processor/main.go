@@ -13,15 +13,19 @@ import (
 
 	"github.com/getlago/lago/events-processor/cache"
 	"github.com/getlago/lago/events-processor/config/tracing"
+	"github.com/getlago/lago/events-processor/models"
 	"github.com/getlago/lago/events-processor/processors"
 	"github.com/getlago/lago/events-processor/utils"
 )
 
 const (
-	envEnv                 = "ENV"
-	envSentryDsn           = "SENTRY_DSN"
-	envUseMemoryCache      = "LAGO_USE_MEMORY_CACHE"
-	envDebeziumTopicPrefix = "LAGO_DEBEZIUM_TOPIC_PREFIX"
+	envEnv                    = "ENV"
+	envSentryDsn              = "SENTRY_DSN"
+	envUseMemoryCache         = "LAGO_USE_MEMORY_CACHE"
+	envDebeziumTopicPrefix    = "LAGO_DEBEZIUM_TOPIC_PREFIX"
+	envAllowedOrganizationIDs = "LAGO_EVENTS_PROCESSOR_ALLOWED_ORGANIZATION_IDS"
+	envDeniedOrganizationIDs  = "LAGO_EVENTS_PROCESSOR_DENIED_ORGANIZATION_IDS"
+	envOrganizationShard      = "LAGO_EVENTS_PROCESSOR_ORGANIZATION_SHARD"
 )
 
 func main() {
@@ -63,11 +67,21 @@ func main() {
 
 	defer sentry.Flush(2 * time.Second)
 
+	organizationSelector, err := models.NewOrganizationSelector(
+		utils.GetEnvAsList(envAllowedOrganizationIDs),
+		utils.GetEnvAsList(envDeniedOrganizationIDs),
+		os.Getenv(envOrganizationShard),
+	)
+	if err != nil {
+		utils.LogAndPanic(err, "Error parsing the organization selector")
+	}
+
 	var memCache *cache.Cache
 	if os.Getenv(envUseMemoryCache) == "true" {
 		memCache, err = cache.NewCache(cache.CacheConfig{
-			Context:             ctx,
-			DebeziumTopicPrefix: os.Getenv(envDebeziumTopicPrefix),
+			Context:              ctx,
+			DebeziumTopicPrefix:  os.Getenv(envDebeziumTopicPrefix),
+			OrganizationSelector: organizationSelector,
 		})
 		if err != nil {
 			utils.LogAndPanic(err, "Error creating the cache")
@@ -82,8 +96,9 @@ func main() {
 
 	// start processing events & loop forever
 	processors.StartProcessingEvents(ctx, &processors.Config{
-		TracerProvider: tracerProvider,
-		Cache:          memCache,
+		TracerProvider:       tracerProvider,
+		Cache:                memCache,
+		OrganizationSelector: organizationSelector,
 	})
 }
 
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+type BillingEntity struct {
+	ID             string         `gorm:"primaryKey;->" json:"id"`
+	OrganizationID string         `gorm:"->" json:"organization_id"`
+	Timezone       *string        `gorm:"->" json:"timezone"`
+	CreatedAt      utils.NullTime `gorm:"->" json:"created_at"`
+	UpdatedAt      utils.NullTime `gorm:"->" json:"updated_at"`
+	DeletedAt      utils.NullTime `gorm:"->" json:"deleted_at"`
+}
+
+// Deleted billing entities are still fetched to compute the billing periods of their customers' terminated subscriptions
+func (store *ApiStore) FetchBillingEntity(organizationID string, ID string) utils.Result[*BillingEntity] {
+	var billingEntity BillingEntity
+	result := store.db.Connection.
+		Unscoped().
+		First(&billingEntity, "organization_id = ? AND id = ?", organizationID, ID)
+
+	if result.Error != nil {
+		return failedBillingEntityResult(result.Error)
+	}
+
+	return utils.SuccessResult(&billingEntity)
+}
+
+// We select all active billing entities and billing entities deleted less than one month ago,
+// to match the subscriptions kept for the grace period events backfill
+func GetAllBillingEntities(db *gorm.DB) utils.Result[[]BillingEntity] {
+	oneMonthAgo := time.Now().AddDate(0, -1, 0)
+
+	config := StreamQueryConfig{
+		TableName: "billing_entities",
+		SelectFields: []string{
+			"id",
+			"organization_id",
+			"timezone",
+			"created_at",
+			"updated_at",
+			"deleted_at",
+		},
+		WhereCondition: "deleted_at IS NULL OR deleted_at >= ?",
+		WhereArgs:      []any{oneMonthAgo},
+		LogInterval:    50000,
+	}
+
+	return GetAllWithStreaming[BillingEntity](db, config)
+}
+
+func failedBillingEntityResult(err error) utils.Result[*BillingEntity] {
+	result := utils.FailedResult[*BillingEntity](err)
+
+	if err.Error() == gorm.ErrRecordNotFound.Error() {
+		result = result.NonCapturable().NonRetryable()
+	}
+
+	return result
+}
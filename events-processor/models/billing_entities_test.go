@@ -0,0 +1,82 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+var fetchBillingEntityQuery = regexp.QuoteMeta(`
+	SELECT * FROM "billing_entities"
+	WHERE organization_id = $1 AND id = $2
+	ORDER BY "billing_entities"."id"
+	LIMIT $3`,
+)
+
+func TestFetchBillingEntity(t *testing.T) {
+	orgID := "1a901a90-1a90-1a90-1a90-1a901a901a90"
+	billingEntityID := "1a901a90-1a90-1a90-1a90-1a901a901a91"
+
+	t.Run("should return billing entity when found", func(t *testing.T) {
+		store, mock, cleanup := setupApiStore(t)
+		defer cleanup()
+
+		now := time.Now()
+
+		columns := []string{"id", "organization_id", "timezone", "created_at", "updated_at", "deleted_at"}
+		rows := sqlmock.NewRows(columns).
+			AddRow(billingEntityID, orgID, "Europe/Paris", now, now, nil)
+
+		mock.ExpectQuery(fetchBillingEntityQuery).
+			WithArgs(orgID, billingEntityID, 1).
+			WillReturnRows(rows)
+
+		result := store.FetchBillingEntity(orgID, billingEntityID)
+
+		assert.True(t, result.Success())
+
+		billingEntity := result.Value()
+		assert.Equal(t, billingEntityID, billingEntity.ID)
+		assert.Equal(t, "Europe/Paris", *billingEntity.Timezone)
+		assert.False(t, billingEntity.DeletedAt.Valid)
+	})
+
+	t.Run("should return error when billing entity not found", func(t *testing.T) {
+		store, mock, cleanup := setupApiStore(t)
+		defer cleanup()
+
+		mock.ExpectQuery(fetchBillingEntityQuery).
+			WithArgs(orgID, billingEntityID, 1).
+			WillReturnError(gorm.ErrRecordNotFound)
+
+		result := store.FetchBillingEntity(orgID, billingEntityID)
+
+		assert.False(t, result.Success())
+		assert.Equal(t, gorm.ErrRecordNotFound, result.Error())
+		assert.False(t, result.IsCapturable())
+		assert.False(t, result.IsRetryable())
+	})
+
+	t.Run("should handle database connection error", func(t *testing.T) {
+		store, mock, cleanup := setupApiStore(t)
+		defer cleanup()
+
+		dbError := errors.New("database connection failed")
+
+		mock.ExpectQuery(fetchBillingEntityQuery).
+			WithArgs(orgID, billingEntityID, 1).
+			WillReturnError(dbError)
+
+		result := store.FetchBillingEntity(orgID, billingEntityID)
+
+		assert.False(t, result.Success())
+		assert.Equal(t, dbError, result.Error())
+		assert.True(t, result.IsCapturable())
+		assert.True(t, result.IsRetryable())
+	})
+}
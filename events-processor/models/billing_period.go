@@ -0,0 +1,182 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	// Embeds the timezone database, the runtime image doesn't ship it
+	_ "time/tzdata"
+)
+
+type BillingTime int
+
+const (
+	BillingTimeCalendar BillingTime = iota
+	BillingTimeAnniversary
+)
+
+type PlanInterval int
+
+const (
+	PlanIntervalWeekly PlanInterval = iota
+	PlanIntervalMonthly
+	PlanIntervalYearly
+	PlanIntervalQuarterly
+	PlanIntervalSemiannual
+)
+
+func (i PlanInterval) String() string {
+	interval := ""
+
+	switch i {
+	case PlanIntervalWeekly:
+		interval = "weekly"
+	case PlanIntervalMonthly:
+		interval = "monthly"
+	case PlanIntervalYearly:
+		interval = "yearly"
+	case PlanIntervalQuarterly:
+		interval = "quarterly"
+	case PlanIntervalSemiannual:
+		interval = "semiannual"
+	}
+
+	return interval
+}
+
+// Number of months in a billing period, 0 for the intervals not based on months
+func (i PlanInterval) months() int {
+	switch i {
+	case PlanIntervalMonthly:
+		return 1
+	case PlanIntervalQuarterly:
+		return 3
+	case PlanIntervalSemiannual:
+		return 6
+	case PlanIntervalYearly:
+		return 12
+	}
+
+	return 0
+}
+
+// BillingPeriod is the half-open interval [Start, End) of a subscription billing period, in UTC
+type BillingPeriod struct {
+	Start time.Time
+	End   time.Time
+}
+
+var locations sync.Map
+
+// loadLocation returns the location of an IANA timezone, UTC when the timezone is empty or unknown
+func loadLocation(timezone string) *time.Location {
+	if timezone == "" || timezone == "UTC" {
+		return time.UTC
+	}
+
+	if cached, ok := locations.Load(timezone); ok {
+		return cached.(*time.Location)
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	locations.Store(timezone, location)
+
+	return location
+}
+
+// ComputeBillingPeriod returns the billing period of the subscription including the given time.
+//
+// Periods start at midnight in the timezone of the customer:
+//   - calendar billing: on mondays, first days of the month, quarter, semester or year
+//   - anniversary billing: on the weekday or the day of the month of the subscription date.
+//     When the day does not exist in a month (eg: the 31st), the period starts on the last day of the month.
+//
+// It returns nil when the plan interval is not supported.
+func ComputeBillingPeriod(sub *Subscription, plan *Plan, timezone string, at time.Time) *BillingPeriod {
+	location := loadLocation(timezone)
+	localTime := at.In(location)
+
+	anchor := sub.SubscriptionAt
+	if !anchor.Valid {
+		anchor = sub.StartedAt
+	}
+	localAnchor := anchor.Time.In(location)
+	anniversary := sub.BillingTime == BillingTimeAnniversary && anchor.Valid
+
+	var start, end time.Time
+
+	if plan.Interval == PlanIntervalWeekly {
+		weekday := time.Monday
+		if anniversary {
+			weekday = localAnchor.Weekday()
+		}
+
+		offset := (int(localTime.Weekday()) - int(weekday) + 7) % 7
+		start = startOfDay(localTime.Year(), localTime.Month(), localTime.Day()-offset, location)
+		end = startOfDay(localTime.Year(), localTime.Month(), localTime.Day()-offset+7, location)
+
+		return &BillingPeriod{Start: start.UTC(), End: end.UTC()}
+	}
+
+	step := plan.Interval.months()
+	if step == 0 {
+		return nil
+	}
+
+	// Months are counted from January of year 0 so that calendar periods are aligned on the year
+	anchorMonth := 0
+	anchorDay := 1
+	if anniversary {
+		anchorMonth = monthIndex(localAnchor)
+		anchorDay = localAnchor.Day()
+	}
+
+	startMonth := anchorMonth + floorDiv(monthIndex(localTime)-anchorMonth, step)*step
+	start = anchoredDate(startMonth, anchorDay, location)
+	if start.After(localTime) {
+		startMonth -= step
+		start = anchoredDate(startMonth, anchorDay, location)
+	}
+	end = anchoredDate(startMonth+step, anchorDay, location)
+
+	return &BillingPeriod{Start: start.UTC(), End: end.UTC()}
+}
+
+func monthIndex(t time.Time) int {
+	return t.Year()*12 + int(t.Month()) - 1
+}
+
+// anchoredDate returns midnight of the anchor day in the given month, clamped to the last day of the month
+func anchoredDate(month int, day int, location *time.Location) time.Time {
+	year := floorDiv(month, 12)
+	monthOfYear := time.Month(month - year*12 + 1)
+
+	lastDay := time.Date(year, monthOfYear+1, 0, 12, 0, 0, 0, location).Day()
+	return startOfDay(year, monthOfYear, min(day, lastDay), location)
+}
+
+// startOfDay returns the first instant of a day, which is not midnight when midnight is skipped by a DST change
+func startOfDay(year int, month time.Month, day int, location *time.Location) time.Time {
+	t := time.Date(year, month, day, 0, 0, 0, 0, location)
+	if t.Hour() == 0 {
+		return t
+	}
+
+	zoneStart, zoneEnd := t.ZoneBounds()
+	if t.Hour() > 12 {
+		// Normalized before the gap, on the previous day
+		return zoneEnd
+	}
+	return zoneStart
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
@@ -0,0 +1,371 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+func mustParseTime(t *testing.T, value string) time.Time {
+	parsed, err := time.Parse(time.RFC3339, value)
+	require.NoError(t, err)
+	return parsed
+}
+
+func TestComputeBillingPeriod(t *testing.T) {
+	tests := []struct {
+		name           string
+		billingTime    BillingTime
+		interval       PlanInterval
+		subscriptionAt string
+		timezone       string
+		at             string
+		expectedStart  string
+		expectedEnd    string
+	}{
+		// Calendar billing
+		{
+			name:          "calendar weekly",
+			billingTime:   BillingTimeCalendar,
+			interval:      PlanIntervalWeekly,
+			at:            "2025-03-06T12:00:00Z",
+			expectedStart: "2025-03-03T00:00:00Z",
+			expectedEnd:   "2025-03-10T00:00:00Z",
+		},
+		{
+			name:          "calendar weekly on a sunday",
+			billingTime:   BillingTimeCalendar,
+			interval:      PlanIntervalWeekly,
+			at:            "2025-03-09T23:59:59Z",
+			expectedStart: "2025-03-03T00:00:00Z",
+			expectedEnd:   "2025-03-10T00:00:00Z",
+		},
+		{
+			name:          "calendar monthly",
+			billingTime:   BillingTimeCalendar,
+			interval:      PlanIntervalMonthly,
+			at:            "2025-02-15T08:00:00Z",
+			expectedStart: "2025-02-01T00:00:00Z",
+			expectedEnd:   "2025-03-01T00:00:00Z",
+		},
+		{
+			name:          "calendar monthly at the period start",
+			billingTime:   BillingTimeCalendar,
+			interval:      PlanIntervalMonthly,
+			at:            "2025-03-01T00:00:00Z",
+			expectedStart: "2025-03-01T00:00:00Z",
+			expectedEnd:   "2025-04-01T00:00:00Z",
+		},
+		{
+			name:          "calendar monthly in december",
+			billingTime:   BillingTimeCalendar,
+			interval:      PlanIntervalMonthly,
+			at:            "2024-12-31T23:59:59Z",
+			expectedStart: "2024-12-01T00:00:00Z",
+			expectedEnd:   "2025-01-01T00:00:00Z",
+		},
+		{
+			name:          "calendar quarterly",
+			billingTime:   BillingTimeCalendar,
+			interval:      PlanIntervalQuarterly,
+			at:            "2025-05-20T10:00:00Z",
+			expectedStart: "2025-04-01T00:00:00Z",
+			expectedEnd:   "2025-07-01T00:00:00Z",
+		},
+		{
+			name:          "calendar quarterly in the last quarter",
+			billingTime:   BillingTimeCalendar,
+			interval:      PlanIntervalQuarterly,
+			at:            "2025-11-20T10:00:00Z",
+			expectedStart: "2025-10-01T00:00:00Z",
+			expectedEnd:   "2026-01-01T00:00:00Z",
+		},
+		{
+			name:          "calendar semiannual",
+			billingTime:   BillingTimeCalendar,
+			interval:      PlanIntervalSemiannual,
+			at:            "2025-08-20T10:00:00Z",
+			expectedStart: "2025-07-01T00:00:00Z",
+			expectedEnd:   "2026-01-01T00:00:00Z",
+		},
+		{
+			name:          "calendar yearly",
+			billingTime:   BillingTimeCalendar,
+			interval:      PlanIntervalYearly,
+			at:            "2024-02-29T10:00:00Z",
+			expectedStart: "2024-01-01T00:00:00Z",
+			expectedEnd:   "2025-01-01T00:00:00Z",
+		},
+
+		// Anniversary billing
+		{
+			name:           "anniversary weekly",
+			billingTime:    BillingTimeAnniversary,
+			interval:       PlanIntervalWeekly,
+			subscriptionAt: "2025-01-01T15:30:00Z", // Wednesday
+			at:             "2025-03-04T12:00:00Z", // Tuesday
+			expectedStart:  "2025-02-26T00:00:00Z",
+			expectedEnd:    "2025-03-05T00:00:00Z",
+		},
+		{
+			name:           "anniversary monthly",
+			billingTime:    BillingTimeAnniversary,
+			interval:       PlanIntervalMonthly,
+			subscriptionAt: "2025-01-15T10:00:00Z",
+			at:             "2025-03-10T12:00:00Z",
+			expectedStart:  "2025-02-15T00:00:00Z",
+			expectedEnd:    "2025-03-15T00:00:00Z",
+		},
+		{
+			name:           "anniversary monthly on the 31st in february",
+			billingTime:    BillingTimeAnniversary,
+			interval:       PlanIntervalMonthly,
+			subscriptionAt: "2025-01-31T10:00:00Z",
+			at:             "2025-02-15T12:00:00Z",
+			expectedStart:  "2025-01-31T00:00:00Z",
+			expectedEnd:    "2025-02-28T00:00:00Z",
+		},
+		{
+			name:           "anniversary monthly on the 31st at the end of february",
+			billingTime:    BillingTimeAnniversary,
+			interval:       PlanIntervalMonthly,
+			subscriptionAt: "2025-01-31T10:00:00Z",
+			at:             "2025-02-28T12:00:00Z",
+			expectedStart:  "2025-02-28T00:00:00Z",
+			expectedEnd:    "2025-03-31T00:00:00Z",
+		},
+		{
+			name:           "anniversary monthly on the 31st in a leap year",
+			billingTime:    BillingTimeAnniversary,
+			interval:       PlanIntervalMonthly,
+			subscriptionAt: "2023-12-31T10:00:00Z",
+			at:             "2024-03-01T12:00:00Z",
+			expectedStart:  "2024-02-29T00:00:00Z",
+			expectedEnd:    "2024-03-31T00:00:00Z",
+		},
+		{
+			name:           "anniversary monthly on the 30th in april",
+			billingTime:    BillingTimeAnniversary,
+			interval:       PlanIntervalMonthly,
+			subscriptionAt: "2025-01-31T10:00:00Z",
+			at:             "2025-04-30T12:00:00Z",
+			expectedStart:  "2025-04-30T00:00:00Z",
+			expectedEnd:    "2025-05-31T00:00:00Z",
+		},
+		{
+			name:           "anniversary monthly over the year end",
+			billingTime:    BillingTimeAnniversary,
+			interval:       PlanIntervalMonthly,
+			subscriptionAt: "2024-03-20T10:00:00Z",
+			at:             "2025-01-05T12:00:00Z",
+			expectedStart:  "2024-12-20T00:00:00Z",
+			expectedEnd:    "2025-01-20T00:00:00Z",
+		},
+		{
+			name:           "anniversary monthly before the subscription date",
+			billingTime:    BillingTimeAnniversary,
+			interval:       PlanIntervalMonthly,
+			subscriptionAt: "2025-03-20T10:00:00Z",
+			at:             "2025-03-10T12:00:00Z",
+			expectedStart:  "2025-02-20T00:00:00Z",
+			expectedEnd:    "2025-03-20T00:00:00Z",
+		},
+		{
+			name:           "anniversary quarterly on the 30th of november",
+			billingTime:    BillingTimeAnniversary,
+			interval:       PlanIntervalQuarterly,
+			subscriptionAt: "2024-11-30T10:00:00Z",
+			at:             "2025-03-15T12:00:00Z",
+			expectedStart:  "2025-02-28T00:00:00Z",
+			expectedEnd:    "2025-05-30T00:00:00Z",
+		},
+		{
+			name:           "anniversary yearly from the 29th of february",
+			billingTime:    BillingTimeAnniversary,
+			interval:       PlanIntervalYearly,
+			subscriptionAt: "2024-02-29T10:00:00Z",
+			at:             "2025-06-01T12:00:00Z",
+			expectedStart:  "2025-02-28T00:00:00Z",
+			expectedEnd:    "2026-02-28T00:00:00Z",
+		},
+		{
+			name:           "anniversary yearly back on the 29th of february",
+			billingTime:    BillingTimeAnniversary,
+			interval:       PlanIntervalYearly,
+			subscriptionAt: "2024-02-29T10:00:00Z",
+			at:             "2028-02-29T12:00:00Z",
+			expectedStart:  "2028-02-29T00:00:00Z",
+			expectedEnd:    "2029-02-28T00:00:00Z",
+		},
+
+		// Timezones
+		{
+			name:          "calendar monthly in a negative offset timezone",
+			billingTime:   BillingTimeCalendar,
+			interval:      PlanIntervalMonthly,
+			timezone:      "America/New_York",
+			at:            "2025-02-01T03:00:00Z", // January 31st, 22:00 in New York
+			expectedStart: "2025-01-01T05:00:00Z",
+			expectedEnd:   "2025-02-01T05:00:00Z",
+		},
+		{
+			name:          "calendar monthly in a positive offset timezone",
+			billingTime:   BillingTimeCalendar,
+			interval:      PlanIntervalMonthly,
+			timezone:      "Asia/Tokyo",
+			at:            "2025-01-31T16:00:00Z", // February 1st, 01:00 in Tokyo
+			expectedStart: "2025-01-31T15:00:00Z",
+			expectedEnd:   "2025-02-28T15:00:00Z",
+		},
+		{
+			name:           "anniversary monthly uses the subscription day in the customer timezone",
+			billingTime:    BillingTimeAnniversary,
+			interval:       PlanIntervalMonthly,
+			subscriptionAt: "2025-01-14T23:30:00Z", // January 15th in Paris
+			timezone:       "Europe/Paris",
+			at:             "2025-02-14T23:30:00Z", // February 15th in Paris
+			expectedStart:  "2025-02-14T23:00:00Z",
+			expectedEnd:    "2025-03-14T23:00:00Z",
+		},
+		{
+			name:          "unknown timezone falls back to UTC",
+			billingTime:   BillingTimeCalendar,
+			interval:      PlanIntervalMonthly,
+			timezone:      "Mars/Olympus_Mons",
+			at:            "2025-02-15T08:00:00Z",
+			expectedStart: "2025-02-01T00:00:00Z",
+			expectedEnd:   "2025-03-01T00:00:00Z",
+		},
+
+		// Daylight saving time
+		{
+			name:          "calendar monthly over the spring DST change",
+			billingTime:   BillingTimeCalendar,
+			interval:      PlanIntervalMonthly,
+			timezone:      "Europe/Paris",
+			at:            "2025-03-30T12:00:00Z",
+			expectedStart: "2025-02-28T23:00:00Z", // UTC+1
+			expectedEnd:   "2025-03-31T22:00:00Z", // UTC+2
+		},
+		{
+			name:          "calendar monthly over the fall DST change",
+			billingTime:   BillingTimeCalendar,
+			interval:      PlanIntervalMonthly,
+			timezone:      "America/New_York",
+			at:            "2025-11-15T12:00:00Z",
+			expectedStart: "2025-11-01T04:00:00Z", // UTC-4
+			expectedEnd:   "2025-12-01T05:00:00Z", // UTC-5
+		},
+		{
+			name:          "calendar weekly over the spring DST change",
+			billingTime:   BillingTimeCalendar,
+			interval:      PlanIntervalWeekly,
+			timezone:      "Europe/Paris",
+			at:            "2025-03-30T01:30:00Z", // 03:30 in Paris, right after the change
+			expectedStart: "2025-03-23T23:00:00Z",
+			expectedEnd:   "2025-03-30T22:00:00Z",
+		},
+		{
+			name:          "calendar weekly during the DST gap hour",
+			billingTime:   BillingTimeCalendar,
+			interval:      PlanIntervalWeekly,
+			timezone:      "Europe/Paris",
+			at:            "2025-03-30T00:59:59Z", // 01:59:59 in Paris, right before the change
+			expectedStart: "2025-03-23T23:00:00Z",
+			expectedEnd:   "2025-03-30T22:00:00Z",
+		},
+		{
+			name:          "calendar weekly on the new period right after the fall DST change",
+			billingTime:   BillingTimeCalendar,
+			interval:      PlanIntervalWeekly,
+			timezone:      "Europe/Paris",
+			at:            "2025-10-26T23:00:00Z", // Monday midnight in Paris, UTC+1
+			expectedStart: "2025-10-26T23:00:00Z",
+			expectedEnd:   "2025-11-02T23:00:00Z",
+		},
+		{
+			name:          "calendar weekly on the last second before the fall DST period end",
+			billingTime:   BillingTimeCalendar,
+			interval:      PlanIntervalWeekly,
+			timezone:      "Europe/Paris",
+			at:            "2025-10-26T22:59:59Z",
+			expectedStart: "2025-10-19T22:00:00Z",
+			expectedEnd:   "2025-10-26T23:00:00Z",
+		},
+		{
+			name:           "anniversary monthly with midnight skipped by DST",
+			billingTime:    BillingTimeAnniversary,
+			interval:       PlanIntervalMonthly,
+			subscriptionAt: "2024-09-08T12:00:00Z",
+			timezone:       "America/Santiago", // Clocks move from 00:00 to 01:00 on 2024-09-08
+			at:             "2024-09-20T12:00:00Z",
+			expectedStart:  "2024-09-08T04:00:00Z",
+			expectedEnd:    "2024-10-08T03:00:00Z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := &Subscription{
+				BillingTime: tt.billingTime,
+				StartedAt:   utils.NewNullTime(mustParseTime(t, "2020-01-01T00:00:00Z")),
+			}
+			if tt.subscriptionAt != "" {
+				sub.SubscriptionAt = utils.NewNullTime(mustParseTime(t, tt.subscriptionAt))
+			}
+			plan := &Plan{Interval: tt.interval}
+
+			period := ComputeBillingPeriod(sub, plan, tt.timezone, mustParseTime(t, tt.at))
+
+			require.NotNil(t, period)
+			assert.Equal(t, mustParseTime(t, tt.expectedStart), period.Start)
+			assert.Equal(t, mustParseTime(t, tt.expectedEnd), period.End)
+			assert.Equal(t, time.UTC, period.Start.Location())
+			assert.False(t, period.Start.After(mustParseTime(t, tt.at)))
+			assert.True(t, period.End.After(mustParseTime(t, tt.at)))
+		})
+	}
+
+	t.Run("anniversary without subscription date uses the start date", func(t *testing.T) {
+		sub := &Subscription{
+			BillingTime: BillingTimeAnniversary,
+			StartedAt:   utils.NewNullTime(mustParseTime(t, "2025-01-10T10:00:00Z")),
+		}
+		plan := &Plan{Interval: PlanIntervalMonthly}
+
+		period := ComputeBillingPeriod(sub, plan, "UTC", mustParseTime(t, "2025-03-05T00:00:00Z"))
+
+		require.NotNil(t, period)
+		assert.Equal(t, mustParseTime(t, "2025-02-10T00:00:00Z"), period.Start)
+		assert.Equal(t, mustParseTime(t, "2025-03-10T00:00:00Z"), period.End)
+	})
+
+	t.Run("unsupported interval", func(t *testing.T) {
+		sub := &Subscription{BillingTime: BillingTimeCalendar}
+		plan := &Plan{Interval: PlanInterval(42)}
+
+		period := ComputeBillingPeriod(sub, plan, "UTC", mustParseTime(t, "2025-03-05T00:00:00Z"))
+
+		assert.Nil(t, period)
+	})
+}
+
+func TestCustomerApplicableTimezone(t *testing.T) {
+	billingEntity := &BillingEntity{Timezone: utils.StringPtr("America/New_York")}
+	organization := &Organization{Timezone: utils.StringPtr("Asia/Tokyo")}
+
+	var nilCustomer *Customer
+	assert.Equal(t, "UTC", nilCustomer.ApplicableTimezone(nil, nil))
+	assert.Equal(t, "UTC", (&Customer{}).ApplicableTimezone(nil, nil))
+	assert.Equal(t, "UTC", (&Customer{Timezone: utils.StringPtr("")}).ApplicableTimezone(&BillingEntity{}, &Organization{Timezone: utils.StringPtr("")}))
+	assert.Equal(t, "Europe/Paris", (&Customer{Timezone: utils.StringPtr("Europe/Paris")}).ApplicableTimezone(billingEntity, organization))
+
+	// The customer without timezone falls back to its billing entity, then to its organization
+	assert.Equal(t, "America/New_York", (&Customer{}).ApplicableTimezone(billingEntity, organization))
+	assert.Equal(t, "Asia/Tokyo", (&Customer{}).ApplicableTimezone(&BillingEntity{}, organization))
+	assert.Equal(t, "Asia/Tokyo", nilCustomer.ApplicableTimezone(nil, organization))
+}
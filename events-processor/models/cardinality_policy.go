@@ -0,0 +1,108 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+type CardinalityPolicyAction string
+
+const (
+	CardinalityPolicyWarn       CardinalityPolicyAction = "warn"
+	CardinalityPolicyCap        CardinalityPolicyAction = "cap"
+	CardinalityPolicyDeadLetter CardinalityPolicyAction = "dead_letter"
+)
+
+// Value of the pricing group keys of the events capped by a cardinality policy
+const PRICING_GROUP_OVERFLOW_VALUE = "__other__"
+
+// CardinalityPolicy limits the number of distinct pricing groups of a charge, per subscription and billing period.
+// A pricing group is the combination of the values of the charge pricing group keys.
+type CardinalityPolicy struct {
+	MaxGroups int64                   `json:"max_groups"`
+	Action    CardinalityPolicyAction `json:"action"`
+}
+
+// ParseCardinalityPolicies parses a JSON object of cardinality policies indexed by organization ID
+func ParseCardinalityPolicies(raw string) (map[string]*CardinalityPolicy, error) {
+	policies := make(map[string]*CardinalityPolicy)
+	if raw == "" {
+		return policies, nil
+	}
+
+	if err := json.Unmarshal([]byte(raw), &policies); err != nil {
+		return nil, err
+	}
+
+	for organizationID, policy := range policies {
+		if err := policy.validate(); err != nil {
+			return nil, fmt.Errorf("invalid cardinality policy for organization %s: %w", organizationID, err)
+		}
+	}
+
+	return policies, nil
+}
+
+func (p *CardinalityPolicy) validate() error {
+	if p.Action == "" {
+		p.Action = CardinalityPolicyWarn
+	}
+
+	switch p.Action {
+	case CardinalityPolicyWarn, CardinalityPolicyCap, CardinalityPolicyDeadLetter:
+	default:
+		return fmt.Errorf("unknown action: %s", p.Action)
+	}
+
+	if p.MaxGroups <= 0 {
+		return fmt.Errorf("max_groups must be positive")
+	}
+
+	return nil
+}
+
+type CardinalityTracker interface {
+	Close() error
+	// TrackGroup records the group in the set, unless the set already holds maxGroups other groups.
+	// It returns false when the group exceeds the limit.
+	TrackGroup(ctx context.Context, key string, group string, maxGroups int64, expireAt time.Time) utils.Result[bool]
+}
+
+// PricingGroup returns the serialized values of the pricing group keys of an expanded event,
+// false when its charge has no pricing group keys
+func PricingGroup(ev *EnrichedEvent) (string, bool) {
+	if ev.FlatFilter == nil || len(ev.FlatFilter.PricingGroupKeys) == 0 {
+		return "", false
+	}
+
+	values := make(map[string]string, len(ev.FlatFilter.PricingGroupKeys))
+	for _, key := range ev.FlatFilter.PricingGroupKeys {
+		values[key] = ev.GroupedBy[key]
+	}
+
+	return groupedByKey(values), true
+}
+
+// CapPricingGroup replaces the values of the pricing group keys of the event by PRICING_GROUP_OVERFLOW_VALUE
+func CapPricingGroup(ev *EnrichedEvent) {
+	for _, key := range ev.FlatFilter.PricingGroupKeys {
+		ev.GroupedBy[key] = PRICING_GROUP_OVERFLOW_VALUE
+	}
+}
+
+// BuildCardinalityKey returns the key of the set holding the pricing groups of the event charge,
+// in the subscription billing period
+func BuildCardinalityKey(ev *EnrichedEvent) string {
+	return strings.Join([]string{
+		"cardinality",
+		USAGE_KEY_VERSION,
+		"{" + ev.SubscriptionID + "}",
+		*ev.ChargeID,
+		ev.BillingPeriodStart.UTC().Format(time.RFC3339),
+	}, "/")
+}
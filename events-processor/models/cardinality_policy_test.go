@@ -0,0 +1,120 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getlago/lago/events-processor/config/redis"
+)
+
+func setupCardinalityStore(t *testing.T) (*CardinalityStore, *miniredis.Miniredis) {
+	s := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	store := &CardinalityStore{
+		db: &redis.RedisDB{Client: client},
+	}
+	return store, s
+}
+
+func TestParseCardinalityPolicies(t *testing.T) {
+	t.Run("Without policies", func(t *testing.T) {
+		policies, err := ParseCardinalityPolicies("")
+		require.NoError(t, err)
+		assert.Empty(t, policies)
+	})
+
+	t.Run("With valid policies", func(t *testing.T) {
+		policies, err := ParseCardinalityPolicies(`{
+			"*": {"max_groups": 1000},
+			"org_id": {"max_groups": 50, "action": "cap"}
+		}`)
+		require.NoError(t, err)
+		require.Len(t, policies, 2)
+
+		assert.Equal(t, int64(1000), policies["*"].MaxGroups)
+		assert.Equal(t, CardinalityPolicyWarn, policies["*"].Action)
+		assert.Equal(t, CardinalityPolicyCap, policies["org_id"].Action)
+	})
+
+	t.Run("With invalid policies", func(t *testing.T) {
+		invalidPolicies := []string{
+			`[]`,
+			`{"*": {"action": "cap"}}`,
+			`{"*": {"max_groups": -1}}`,
+			`{"*": {"max_groups": 10, "action": "drop"}}`,
+		}
+
+		for _, raw := range invalidPolicies {
+			_, err := ParseCardinalityPolicies(raw)
+			assert.Error(t, err, raw)
+		}
+	})
+}
+
+func TestPricingGroup(t *testing.T) {
+	t.Run("With pricing group keys", func(t *testing.T) {
+		event := buildUsageEvent(t, AggregationTypeCount, "1")
+		event.FlatFilter = &FlatFilter{PricingGroupKeys: []string{"region", "user_id"}}
+		event.GroupedBy = map[string]string{"region": "eu", "user_id": "u_1", TARGET_WALLET_CODE: "prepaid"}
+
+		group, ok := PricingGroup(event)
+		require.True(t, ok)
+		assert.Equal(t, `{"region":"eu","user_id":"u_1"}`, group)
+
+		CapPricingGroup(event)
+		assert.Equal(t, map[string]string{"region": "__other__", "user_id": "__other__", TARGET_WALLET_CODE: "prepaid"}, event.GroupedBy)
+	})
+
+	t.Run("Without pricing group keys", func(t *testing.T) {
+		event := buildUsageEvent(t, AggregationTypeCount, "1")
+		event.FlatFilter = &FlatFilter{}
+
+		_, ok := PricingGroup(event)
+		assert.False(t, ok)
+	})
+}
+
+func TestBuildCardinalityKey(t *testing.T) {
+	event := buildUsageEvent(t, AggregationTypeCount, "1")
+	assert.Equal(t, "cardinality/1/{sub_id}/charge_id/2025-03-01T00:00:00Z", BuildCardinalityKey(event))
+}
+
+func TestCardinalityStoreTrackGroup(t *testing.T) {
+	key := "cardinality/1/{sub_id}/charge_id/2025-03-01T00:00:00Z"
+	expireAt := time.Now().Add(time.Hour)
+
+	t.Run("With groups over the limit", func(t *testing.T) {
+		store, s := setupCardinalityStore(t)
+
+		for _, group := range []string{"a", "b", "a"} {
+			result := store.TrackGroup(context.Background(), key, group, 2, expireAt)
+			require.True(t, result.Success())
+			assert.True(t, result.Value(), group)
+		}
+
+		result := store.TrackGroup(context.Background(), key, "c", 2, expireAt)
+		require.True(t, result.Success())
+		assert.False(t, result.Value())
+
+		// Known groups are still accepted once the limit is reached
+		assert.True(t, store.TrackGroup(context.Background(), key, "b", 2, expireAt).Value())
+
+		members, err := s.Members(key)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, members)
+		assert.True(t, s.TTL(key) > 0)
+	})
+
+	t.Run("With a Redis error", func(t *testing.T) {
+		store, s := setupCardinalityStore(t)
+		s.Close()
+
+		assert.False(t, store.TrackGroup(context.Background(), key, "a", 2, expireAt).Success())
+	})
+}
@@ -10,6 +10,7 @@ type ChargeFilter struct {
 	OrganizationID   string            `gorm:"->" json:"organization_id"`
 	ChargeID         string            `gorm:"->" json:"charge_id"`
 	PricingGroupKeys utils.StringArray `gorm:"type:jsonb;->" json:"properties.pricing_group_keys"`
+	Properties       ChargeProperties  `gorm:"type:jsonb;->" json:"properties"`
 	CreatedAt        utils.NullTime    `gorm:"->" json:"created_at"`
 	UpdatedAt        utils.NullTime    `gorm:"->" json:"updated_at"`
 	DeletedAt        utils.NullTime    `gorm:"->" json:"deleted_at"`
@@ -23,6 +24,7 @@ func GetAllChargeFilters(db *gorm.DB) utils.Result[[]ChargeFilter] {
 			"organization_id",
 			"charge_id",
 			"properties->'pricing_group_keys' as pricing_group_keys",
+			"properties",
 			"created_at",
 			"updated_at",
 			"deleted_at",
@@ -34,3 +36,29 @@ func GetAllChargeFilters(db *gorm.DB) utils.Result[[]ChargeFilter] {
 
 	return GetAllWithStreaming[ChargeFilter](db, config)
 }
+
+func (store *ApiStore) FetchChargeFilter(organizationID string, id string) utils.Result[*ChargeFilter] {
+	var chargeFilter ChargeFilter
+
+	result := store.db.Connection.
+		Table("charge_filters").
+		Select("id, organization_id, charge_id, properties, created_at, updated_at, deleted_at").
+		Unscoped().
+		Where("organization_id = ? AND id = ?", organizationID, id).
+		First(&chargeFilter)
+	if result.Error != nil {
+		return failedChargeFilterResult(result.Error)
+	}
+
+	return utils.SuccessResult(&chargeFilter)
+}
+
+func failedChargeFilterResult(err error) utils.Result[*ChargeFilter] {
+	result := utils.FailedResult[*ChargeFilter](err)
+
+	if err.Error() == gorm.ErrRecordNotFound.Error() {
+		result = result.NonCapturable().NonRetryable()
+	}
+
+	return result
+}
@@ -0,0 +1,385 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+type ChargeModel int
+
+const (
+	ChargeModelStandard ChargeModel = iota
+	ChargeModelGraduated
+	ChargeModelPackage
+	ChargeModelPercentage
+	ChargeModelVolume
+	ChargeModelGraduatedPercentage
+	ChargeModelCustom
+	ChargeModelDynamic
+)
+
+func (m ChargeModel) String() string {
+	chargeModel := ""
+
+	switch m {
+	case ChargeModelStandard:
+		chargeModel = "standard"
+	case ChargeModelGraduated:
+		chargeModel = "graduated"
+	case ChargeModelPackage:
+		chargeModel = "package"
+	case ChargeModelPercentage:
+		chargeModel = "percentage"
+	case ChargeModelVolume:
+		chargeModel = "volume"
+	case ChargeModelGraduatedPercentage:
+		chargeModel = "graduated_percentage"
+	case ChargeModelCustom:
+		chargeModel = "custom"
+	case ChargeModelDynamic:
+		chargeModel = "dynamic"
+	}
+
+	return chargeModel
+}
+
+// ChargeProperties holds the pricing properties of a charge or a charge filter (JSONB column)
+type ChargeProperties map[string]any
+
+// Implements the sql.Scanner interface to convert JSONB into ChargeProperties
+func (p *ChargeProperties) Scan(value any) error {
+	if value == nil {
+		*p = nil
+		return nil
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into ChargeProperties", value)
+	}
+
+	var result map[string]any
+	if err := json.Unmarshal(bytes, &result); err != nil {
+		return err
+	}
+
+	*p = ChargeProperties(result)
+	return nil
+}
+
+// Implements the driver.Valuer interface converting ChargeProperties to a JSONB value
+func (p ChargeProperties) Value() (driver.Value, error) {
+	if p == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(map[string]any(p))
+}
+
+// UnmarshalJSON accepts both a JSON object and a JSON encoded string,
+// as Debezium streams JSONB columns as strings
+func (p *ChargeProperties) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*p = nil
+		return nil
+	}
+
+	var encoded string
+	if err := json.Unmarshal(b, &encoded); err == nil {
+		if encoded == "" {
+			*p = nil
+			return nil
+		}
+		b = []byte(encoded)
+	}
+
+	var result map[string]any
+	if err := json.Unmarshal(b, &result); err != nil {
+		return err
+	}
+
+	*p = ChargeProperties(result)
+	return nil
+}
+
+// FeeEstimate is the fee estimated by the processor for an event landing on a pay in advance charge
+type FeeEstimate struct {
+	PreciseAmountCents string  `json:"precise_amount_cents"`
+	Currency           *string `json:"currency"`
+	ChargeModel        string  `json:"charge_model"`
+	Units              string  `json:"units"`
+}
+
+// ChargeUsage is the usage already aggregated on a charge in the current billing period
+type ChargeUsage struct {
+	Units  *big.Rat
+	Events int64
+}
+
+// DependsOnUsage returns true when the amount of an event on the charge depends on the previous usage
+// of the billing period: the ranges and packages, and the free units or events of a percentage charge
+func DependsOnUsage(chargeModel ChargeModel, properties ChargeProperties) bool {
+	switch chargeModel {
+	case ChargeModelPackage, ChargeModelGraduated, ChargeModelVolume:
+		return true
+	case ChargeModelPercentage:
+		_, freeEvents := properties.decimal("free_units_per_events")
+		_, freeUnits := properties.decimal("free_units_per_total_aggregation")
+		return freeEvents || freeUnits
+	}
+
+	return false
+}
+
+// EstimateChargeAmount returns the amount, in currency units, billed for the given units on top of the previous usage.
+// As for pay in advance fees, it is the difference between the price of the whole usage and the price of the previous usage,
+// never negative (eg: when the usage reaches a cheaper volume range).
+// It returns false when the charge model or the properties are not supported.
+func EstimateChargeAmount(chargeModel ChargeModel, properties ChargeProperties, units *big.Rat, previous ChargeUsage) (*big.Rat, bool) {
+	previousUnits := previous.Units
+	if previousUnits == nil {
+		previousUnits = new(big.Rat)
+	}
+	totalUnits := new(big.Rat).Add(previousUnits, units)
+
+	var price func(*big.Rat) (*big.Rat, bool)
+
+	switch chargeModel {
+	case ChargeModelStandard:
+		amount, ok := properties.decimal("amount")
+		if !ok {
+			return nil, false
+		}
+		return new(big.Rat).Mul(units, amount), true
+
+	case ChargeModelPercentage:
+		return properties.percentageAmount(units, previousUnits, previous.Events)
+
+	case ChargeModelPackage:
+		price = properties.packagePrice
+	case ChargeModelGraduated:
+		price = properties.graduatedPrice
+	case ChargeModelVolume:
+		price = properties.volumePrice
+	default:
+		return nil, false
+	}
+
+	totalPrice, ok := price(totalUnits)
+	if !ok {
+		return nil, false
+	}
+	previousPrice, ok := price(previousUnits)
+	if !ok {
+		return nil, false
+	}
+
+	amount := totalPrice.Sub(totalPrice, previousPrice)
+	if amount.Sign() < 0 {
+		amount.SetInt64(0)
+	}
+
+	return amount, true
+}
+
+// Package price: the number of started packages above the free units times the package amount
+func (p ChargeProperties) packagePrice(units *big.Rat) (*big.Rat, bool) {
+	amount, ok := p.decimal("amount")
+	if !ok {
+		return nil, false
+	}
+	packageSize, ok := p.decimal("package_size")
+	if !ok || packageSize.Sign() <= 0 {
+		return nil, false
+	}
+	freeUnits, ok := p.decimal("free_units")
+	if !ok {
+		freeUnits = new(big.Rat)
+	}
+
+	paidUnits := new(big.Rat).Sub(units, freeUnits)
+	if paidUnits.Sign() <= 0 {
+		return new(big.Rat), true
+	}
+
+	packages := ceil(new(big.Rat).Quo(paidUnits, packageSize))
+	return new(big.Rat).Mul(new(big.Rat).SetInt(packages), amount), true
+}
+
+// Graduated price: each range prices the units falling in it, its flat amount is billed once the range is reached
+func (p ChargeProperties) graduatedPrice(units *big.Rat) (*big.Rat, bool) {
+	ranges, ok := p.ranges("graduated_ranges")
+	if !ok {
+		return nil, false
+	}
+
+	total := new(big.Rat)
+	for _, r := range ranges {
+		if units.Cmp(r.lower) <= 0 {
+			break
+		}
+
+		rangeUnits := new(big.Rat).Sub(units, r.lower)
+		if r.upper != nil && units.Cmp(r.upper) > 0 {
+			rangeUnits.Sub(r.upper, r.lower)
+		}
+
+		total.Add(total, r.flatAmount)
+		total.Add(total, rangeUnits.Mul(rangeUnits, r.perUnitAmount))
+	}
+
+	return total, true
+}
+
+// Volume price: all units are priced with the range including the total units
+func (p ChargeProperties) volumePrice(units *big.Rat) (*big.Rat, bool) {
+	ranges, ok := p.ranges("volume_ranges")
+	if !ok {
+		return nil, false
+	}
+
+	if units.Sign() <= 0 {
+		return new(big.Rat), true
+	}
+
+	for _, r := range ranges {
+		if r.upper != nil && units.Cmp(r.upper) > 0 {
+			continue
+		}
+
+		total := new(big.Rat).Mul(units, r.perUnitAmount)
+		return total.Add(total, r.flatAmount), true
+	}
+
+	return nil, false
+}
+
+// Percentage amount of a single transaction: events within the free events are not billed,
+// otherwise the rate applies to the units above the free units and the fixed amount is added
+func (p ChargeProperties) percentageAmount(units *big.Rat, previousUnits *big.Rat, previousEvents int64) (*big.Rat, bool) {
+	rate, ok := p.decimal("rate")
+	if !ok {
+		return nil, false
+	}
+
+	if freeEvents, ok := p.decimal("free_units_per_events"); ok && big.NewRat(previousEvents+1, 1).Cmp(freeEvents) <= 0 {
+		return new(big.Rat), true
+	}
+
+	paidUnits := new(big.Rat).Set(units)
+	if freeUnits, ok := p.decimal("free_units_per_total_aggregation"); ok {
+		remainingFreeUnits := new(big.Rat).Sub(freeUnits, previousUnits)
+		if remainingFreeUnits.Sign() > 0 {
+			paidUnits.Sub(paidUnits, remainingFreeUnits)
+		}
+	}
+
+	amount := new(big.Rat)
+	if paidUnits.Sign() > 0 {
+		amount.Mul(paidUnits, rate)
+		amount.Quo(amount, big.NewRat(100, 1))
+
+		if minAmount, ok := p.decimal("per_transaction_min_amount"); ok && amount.Cmp(minAmount) < 0 {
+			amount.Set(minAmount)
+		}
+		if maxAmount, ok := p.decimal("per_transaction_max_amount"); ok && amount.Cmp(maxAmount) > 0 {
+			amount.Set(maxAmount)
+		}
+	}
+
+	if fixedAmount, ok := p.decimal("fixed_amount"); ok {
+		amount.Add(amount, fixedAmount)
+	}
+
+	return amount, true
+}
+
+type priceRange struct {
+	// Units above lower are priced in the range
+	lower         *big.Rat
+	upper         *big.Rat
+	perUnitAmount *big.Rat
+	flatAmount    *big.Rat
+}
+
+// ranges parses the ranges of a graduated or volume charge.
+// As in the API, ranges are defined with inclusive bounds (eg: 0-10, 11-20),
+// a range starting at N prices the units above N - 1.
+func (p ChargeProperties) ranges(key string) ([]priceRange, bool) {
+	rawRanges, ok := p[key].([]any)
+	if !ok || len(rawRanges) == 0 {
+		return nil, false
+	}
+
+	ranges := make([]priceRange, 0, len(rawRanges))
+	for _, rawRange := range rawRanges {
+		properties, ok := rawRange.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		rangeProperties := ChargeProperties(properties)
+
+		from, ok := rangeProperties.decimal("from_value")
+		if !ok {
+			return nil, false
+		}
+		perUnitAmount, ok := rangeProperties.decimal("per_unit_amount")
+		if !ok {
+			return nil, false
+		}
+		flatAmount, ok := rangeProperties.decimal("flat_amount")
+		if !ok {
+			flatAmount = new(big.Rat)
+		}
+		upper, _ := rangeProperties.decimal("to_value")
+
+		lower := from
+		if from.Sign() > 0 {
+			lower = new(big.Rat).Sub(from, big.NewRat(1, 1))
+		}
+
+		ranges = append(ranges, priceRange{
+			lower:         lower,
+			upper:         upper,
+			perUnitAmount: perUnitAmount,
+			flatAmount:    flatAmount,
+		})
+	}
+
+	return ranges, true
+}
+
+// decimal parses a numeric property sent either as a JSON number or as a string.
+// It returns false for missing, null or empty properties.
+func (p ChargeProperties) decimal(key string) (*big.Rat, bool) {
+	switch value := p[key].(type) {
+	case float64:
+		return new(big.Rat).SetString(strconv.FormatFloat(value, 'f', -1, 64))
+	case string:
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return nil, false
+		}
+		return new(big.Rat).SetString(value)
+	}
+
+	return nil, false
+}
+
+func ceil(value *big.Rat) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(value.Num(), value.Denom(), new(big.Int))
+	if remainder.Sign() > 0 {
+		quotient.Add(quotient, big.NewInt(1))
+	}
+
+	return quotient
+}
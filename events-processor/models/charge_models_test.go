@@ -0,0 +1,174 @@
+package models
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseProperties(t *testing.T, raw string) ChargeProperties {
+	var properties ChargeProperties
+	require.NoError(t, json.Unmarshal([]byte(raw), &properties))
+	return properties
+}
+
+func assertAmount(t *testing.T, expected string, amount *big.Rat, ok bool) {
+	t.Helper()
+
+	require.True(t, ok)
+	expectedAmount, _ := new(big.Rat).SetString(expected)
+	assert.Equal(t, expectedAmount.String(), amount.String())
+}
+
+func TestChargeModelString(t *testing.T) {
+	assert.Equal(t, "standard", ChargeModelStandard.String())
+	assert.Equal(t, "graduated_percentage", ChargeModelGraduatedPercentage.String())
+	assert.Equal(t, "dynamic", ChargeModelDynamic.String())
+	assert.Equal(t, "", ChargeModel(42).String())
+}
+
+func TestChargePropertiesUnmarshalJSON(t *testing.T) {
+	t.Run("With a JSON object", func(t *testing.T) {
+		properties := parseProperties(t, `{"amount": "10.5"}`)
+		assert.Equal(t, "10.5", properties["amount"])
+	})
+
+	t.Run("With a JSON encoded string", func(t *testing.T) {
+		properties := parseProperties(t, `"{\"amount\": \"10.5\"}"`)
+		assert.Equal(t, "10.5", properties["amount"])
+	})
+
+	t.Run("With a null value", func(t *testing.T) {
+		assert.Nil(t, parseProperties(t, `null`))
+		assert.Nil(t, parseProperties(t, `""`))
+	})
+
+	t.Run("With an invalid value", func(t *testing.T) {
+		var properties ChargeProperties
+		assert.Error(t, json.Unmarshal([]byte(`[]`), &properties))
+	})
+}
+
+func TestDependsOnUsage(t *testing.T) {
+	assert.False(t, DependsOnUsage(ChargeModelStandard, ChargeProperties{"amount": "1"}))
+	assert.True(t, DependsOnUsage(ChargeModelPackage, ChargeProperties{}))
+	assert.True(t, DependsOnUsage(ChargeModelGraduated, ChargeProperties{}))
+	assert.True(t, DependsOnUsage(ChargeModelVolume, ChargeProperties{}))
+	assert.False(t, DependsOnUsage(ChargeModelPercentage, ChargeProperties{"rate": "1"}))
+	assert.True(t, DependsOnUsage(ChargeModelPercentage, ChargeProperties{"rate": "1", "free_units_per_events": "3"}))
+	assert.True(t, DependsOnUsage(ChargeModelPercentage, ChargeProperties{"rate": "1", "free_units_per_total_aggregation": "10"}))
+}
+
+func TestEstimateChargeAmount(t *testing.T) {
+	units := func(value int64) *big.Rat { return big.NewRat(value, 1) }
+
+	t.Run("With a standard charge", func(t *testing.T) {
+		properties := parseProperties(t, `{"amount": "0.25"}`)
+
+		amount, ok := EstimateChargeAmount(ChargeModelStandard, properties, units(3), ChargeUsage{})
+		assertAmount(t, "0.75", amount, ok)
+
+		amount, ok = EstimateChargeAmount(ChargeModelStandard, properties, big.NewRat(1, 2), ChargeUsage{Units: units(10)})
+		assertAmount(t, "0.125", amount, ok)
+	})
+
+	t.Run("With a package charge", func(t *testing.T) {
+		properties := parseProperties(t, `{"amount": "5", "package_size": 10, "free_units": 10}`)
+
+		amount, ok := EstimateChargeAmount(ChargeModelPackage, properties, units(10), ChargeUsage{})
+		assertAmount(t, "0", amount, ok)
+
+		// A new package is started
+		amount, ok = EstimateChargeAmount(ChargeModelPackage, properties, units(1), ChargeUsage{Units: units(10)})
+		assertAmount(t, "5", amount, ok)
+
+		// The package is already paid
+		amount, ok = EstimateChargeAmount(ChargeModelPackage, properties, units(1), ChargeUsage{Units: units(11)})
+		assertAmount(t, "0", amount, ok)
+
+		_, ok = EstimateChargeAmount(ChargeModelPackage, parseProperties(t, `{"amount": "5", "package_size": 0}`), units(1), ChargeUsage{})
+		assert.False(t, ok)
+	})
+
+	t.Run("With a graduated charge", func(t *testing.T) {
+		properties := parseProperties(t, `{"graduated_ranges": [
+			{"from_value": 0, "to_value": 10, "per_unit_amount": "1", "flat_amount": "2"},
+			{"from_value": 11, "to_value": null, "per_unit_amount": "0.5", "flat_amount": "3"}
+		]}`)
+
+		amount, ok := EstimateChargeAmount(ChargeModelGraduated, properties, units(1), ChargeUsage{})
+		assertAmount(t, "3", amount, ok)
+
+		amount, ok = EstimateChargeAmount(ChargeModelGraduated, properties, units(12), ChargeUsage{})
+		assertAmount(t, "16", amount, ok)
+
+		// Crossing the second range bills its flat amount
+		amount, ok = EstimateChargeAmount(ChargeModelGraduated, properties, units(2), ChargeUsage{Units: units(9)})
+		assertAmount(t, "4.5", amount, ok)
+	})
+
+	t.Run("With a volume charge", func(t *testing.T) {
+		properties := parseProperties(t, `{"volume_ranges": [
+			{"from_value": 0, "to_value": 10, "per_unit_amount": "2", "flat_amount": "1"},
+			{"from_value": 11, "to_value": null, "per_unit_amount": "1", "flat_amount": "0"}
+		]}`)
+
+		amount, ok := EstimateChargeAmount(ChargeModelVolume, properties, units(10), ChargeUsage{})
+		assertAmount(t, "21", amount, ok)
+
+		// The whole usage is priced with the cheaper range, no amount is billed
+		amount, ok = EstimateChargeAmount(ChargeModelVolume, properties, units(1), ChargeUsage{Units: units(10)})
+		assertAmount(t, "0", amount, ok)
+
+		amount, ok = EstimateChargeAmount(ChargeModelVolume, properties, units(5), ChargeUsage{Units: units(11)})
+		assertAmount(t, "5", amount, ok)
+	})
+
+	t.Run("With a percentage charge", func(t *testing.T) {
+		properties := parseProperties(t, `{"rate": "2", "fixed_amount": "0.1"}`)
+
+		amount, ok := EstimateChargeAmount(ChargeModelPercentage, properties, units(100), ChargeUsage{})
+		assertAmount(t, "2.1", amount, ok)
+
+		t.Run("With free events", func(t *testing.T) {
+			properties := parseProperties(t, `{"rate": "2", "free_units_per_events": 2}`)
+
+			amount, ok := EstimateChargeAmount(ChargeModelPercentage, properties, units(100), ChargeUsage{Events: 1})
+			assertAmount(t, "0", amount, ok)
+
+			amount, ok = EstimateChargeAmount(ChargeModelPercentage, properties, units(100), ChargeUsage{Events: 2})
+			assertAmount(t, "2", amount, ok)
+		})
+
+		t.Run("With free units", func(t *testing.T) {
+			properties := parseProperties(t, `{"rate": "10", "free_units_per_total_aggregation": "150"}`)
+
+			amount, ok := EstimateChargeAmount(ChargeModelPercentage, properties, units(100), ChargeUsage{Units: units(100)})
+			assertAmount(t, "5", amount, ok)
+		})
+
+		t.Run("With per transaction limits", func(t *testing.T) {
+			properties := parseProperties(t, `{"rate": "1", "per_transaction_min_amount": "2", "per_transaction_max_amount": "5"}`)
+
+			amount, ok := EstimateChargeAmount(ChargeModelPercentage, properties, units(100), ChargeUsage{})
+			assertAmount(t, "2", amount, ok)
+
+			amount, ok = EstimateChargeAmount(ChargeModelPercentage, properties, units(1000), ChargeUsage{})
+			assertAmount(t, "5", amount, ok)
+		})
+	})
+
+	t.Run("With unsupported charges", func(t *testing.T) {
+		_, ok := EstimateChargeAmount(ChargeModelCustom, ChargeProperties{}, units(1), ChargeUsage{})
+		assert.False(t, ok)
+
+		_, ok = EstimateChargeAmount(ChargeModelGraduatedPercentage, ChargeProperties{}, units(1), ChargeUsage{})
+		assert.False(t, ok)
+
+		_, ok = EstimateChargeAmount(ChargeModelStandard, ChargeProperties{}, units(1), ChargeUsage{})
+		assert.False(t, ok)
+	})
+}
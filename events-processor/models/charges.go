@@ -13,6 +13,8 @@ type Charge struct {
 	PayInAdvance        bool              `gorm:"->" json:"pay_in_advance"`
 	AcceptsTargetWallet bool              `gorm:"->" json:"accepts_target_wallet"`
 	PricingGroupKeys    utils.StringArray `gorm:"type:jsonb;->" json:"properties.pricing_group_keys"`
+	ChargeModel         ChargeModel       `gorm:"->" json:"charge_model"`
+	Properties          ChargeProperties  `gorm:"type:jsonb;->" json:"properties"`
 	CreatedAt           utils.NullTime    `gorm:"->" json:"created_at"`
 	UpdatedAt           utils.NullTime    `gorm:"->" json:"updated_at"`
 	DeletedAt           utils.NullTime    `gorm:"->" json:"deleted_at"`
@@ -29,6 +31,8 @@ func GetAllCharges(db *gorm.DB) utils.Result[[]Charge] {
 			"pay_in_advance",
 			"accepts_target_wallet",
 			"properties->'pricing_group_keys' as pricing_group_keys",
+			"charge_model",
+			"properties",
 			"created_at",
 			"updated_at",
 			"deleted_at",
@@ -40,3 +44,29 @@ func GetAllCharges(db *gorm.DB) utils.Result[[]Charge] {
 
 	return GetAllWithStreaming[Charge](db, config)
 }
+
+func (store *ApiStore) FetchCharge(organizationID string, id string) utils.Result[*Charge] {
+	var charge Charge
+
+	result := store.db.Connection.
+		Table("charges").
+		Select("id, organization_id, plan_id, billable_metric_id, pay_in_advance, charge_model, properties, created_at, updated_at, deleted_at").
+		Unscoped().
+		Where("organization_id = ? AND id = ?", organizationID, id).
+		First(&charge)
+	if result.Error != nil {
+		return failedChargeResult(result.Error)
+	}
+
+	return utils.SuccessResult(&charge)
+}
+
+func failedChargeResult(err error) utils.Result[*Charge] {
+	result := utils.FailedResult[*Charge](err)
+
+	if err.Error() == gorm.ErrRecordNotFound.Error() {
+		result = result.NonCapturable().NonRetryable()
+	}
+
+	return result
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+type Customer struct {
+	ID              string         `gorm:"primaryKey;->" json:"id"`
+	OrganizationID  string         `gorm:"->" json:"organization_id"`
+	ExternalID      string         `gorm:"->" json:"external_id"`
+	BillingEntityID *string        `gorm:"->" json:"billing_entity_id"`
+	Timezone        *string        `gorm:"->" json:"timezone"`
+	CreatedAt       utils.NullTime `gorm:"->" json:"created_at"`
+	UpdatedAt       utils.NullTime `gorm:"->" json:"updated_at"`
+	DeletedAt       utils.NullTime `gorm:"->" json:"deleted_at"`
+}
+
+// ApplicableTimezone returns the IANA timezone used to compute the billing periods of the customer.
+// It falls back to the timezone of the billing entity, then of the organization, then to UTC.
+func (c *Customer) ApplicableTimezone(billingEntity *BillingEntity, organization *Organization) string {
+	switch {
+	case c != nil && c.Timezone != nil && *c.Timezone != "":
+		return *c.Timezone
+	case billingEntity != nil && billingEntity.Timezone != nil && *billingEntity.Timezone != "":
+		return *billingEntity.Timezone
+	case organization != nil && organization.Timezone != nil && *organization.Timezone != "":
+		return *organization.Timezone
+	}
+
+	return "UTC"
+}
+
+// Deleted customers are still fetched to enrich the events of their terminated subscriptions
+func (store *ApiStore) FetchCustomer(organizationID string, ID string) utils.Result[*Customer] {
+	var customer Customer
+	result := store.db.Connection.
+		Unscoped().
+		First(&customer, "organization_id = ? AND id = ?", organizationID, ID)
+
+	if result.Error != nil {
+		return failedCustomerResult(result.Error)
+	}
+
+	return utils.SuccessResult(&customer)
+}
+
+// FetchCustomerByExternalID returns the customer with the given external ID.
+// As an external ID can be reused after a deletion, active customers are preferred over deleted ones.
+func (store *ApiStore) FetchCustomerByExternalID(organizationID string, externalID string) utils.Result[*Customer] {
+	var customer Customer
+	result := store.db.Connection.
+		Unscoped().
+		Where("organization_id = ? AND external_id = ?", organizationID, externalID).
+		Order("deleted_at DESC NULLS FIRST").
+		Limit(1).
+		Find(&customer)
+
+	if result.Error != nil {
+		return failedCustomerResult(result.Error)
+	}
+	if customer.ID == "" {
+		return failedCustomerResult(gorm.ErrRecordNotFound)
+	}
+
+	return utils.SuccessResult(&customer)
+}
+
+// We select all active customers and customers deleted less than one month ago,
+// to match the subscriptions kept for the grace period events backfill
+func GetAllCustomers(db *gorm.DB) utils.Result[[]Customer] {
+	oneMonthAgo := time.Now().AddDate(0, -1, 0)
+
+	config := StreamQueryConfig{
+		TableName: "customers",
+		SelectFields: []string{
+			"id",
+			"organization_id",
+			"external_id",
+			"billing_entity_id",
+			"timezone",
+			"created_at",
+			"updated_at",
+			"deleted_at",
+		},
+		WhereCondition: "deleted_at IS NULL OR deleted_at >= ?",
+		WhereArgs:      []any{oneMonthAgo},
+		LogInterval:    50000,
+	}
+
+	return GetAllWithStreaming[Customer](db, config)
+}
+
+func failedCustomerResult(err error) utils.Result[*Customer] {
+	result := utils.FailedResult[*Customer](err)
+
+	if err.Error() == gorm.ErrRecordNotFound.Error() {
+		result = result.NonCapturable().NonRetryable()
+	}
+
+	return result
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+var fetchCustomerQuery = regexp.QuoteMeta(`
+	SELECT * FROM "customers"
+	WHERE organization_id = $1 AND id = $2
+	ORDER BY "customers"."id"
+	LIMIT $3`,
+)
+
+func TestFetchCustomer(t *testing.T) {
+	orgID := "1a901a90-1a90-1a90-1a90-1a901a901a90"
+	customerID := "1a901a90-1a90-1a90-1a90-1a901a901a91"
+
+	t.Run("should return customer when found", func(t *testing.T) {
+		store, mock, cleanup := setupApiStore(t)
+		defer cleanup()
+
+		now := time.Now()
+
+		columns := []string{"id", "organization_id", "external_id", "billing_entity_id", "timezone", "created_at", "updated_at", "deleted_at"}
+		rows := sqlmock.NewRows(columns).
+			AddRow(customerID, orgID, "cus_external", "be123", "Europe/Paris", now, now, nil)
+
+		mock.ExpectQuery(fetchCustomerQuery).
+			WithArgs(orgID, customerID, 1).
+			WillReturnRows(rows)
+
+		result := store.FetchCustomer(orgID, customerID)
+
+		assert.True(t, result.Success())
+
+		customer := result.Value()
+		assert.Equal(t, customerID, customer.ID)
+		assert.Equal(t, "cus_external", customer.ExternalID)
+		assert.Equal(t, "be123", *customer.BillingEntityID)
+		assert.Equal(t, "Europe/Paris", *customer.Timezone)
+		assert.False(t, customer.DeletedAt.Valid)
+	})
+
+	t.Run("should return error when customer not found", func(t *testing.T) {
+		store, mock, cleanup := setupApiStore(t)
+		defer cleanup()
+
+		mock.ExpectQuery(fetchCustomerQuery).
+			WithArgs(orgID, customerID, 1).
+			WillReturnError(gorm.ErrRecordNotFound)
+
+		result := store.FetchCustomer(orgID, customerID)
+
+		assert.False(t, result.Success())
+		assert.Equal(t, gorm.ErrRecordNotFound, result.Error())
+		assert.False(t, result.IsCapturable())
+		assert.False(t, result.IsRetryable())
+	})
+
+	t.Run("should handle database connection error", func(t *testing.T) {
+		store, mock, cleanup := setupApiStore(t)
+		defer cleanup()
+
+		dbError := errors.New("database connection failed")
+
+		mock.ExpectQuery(fetchCustomerQuery).
+			WithArgs(orgID, customerID, 1).
+			WillReturnError(dbError)
+
+		result := store.FetchCustomer(orgID, customerID)
+
+		assert.False(t, result.Success())
+		assert.Equal(t, dbError, result.Error())
+		assert.True(t, result.IsCapturable())
+		assert.True(t, result.IsRetryable())
+	})
+}
+
+func TestFetchCustomerByExternalID(t *testing.T) {
+	orgID := "1a901a90-1a90-1a90-1a90-1a901a901a90"
+	query := regexp.QuoteMeta(`
+		SELECT * FROM "customers"
+		WHERE organization_id = $1 AND external_id = $2
+		ORDER BY deleted_at DESC NULLS FIRST
+		LIMIT $3`,
+	)
+
+	t.Run("should return customer when found", func(t *testing.T) {
+		store, mock, cleanup := setupApiStore(t)
+		defer cleanup()
+
+		rows := sqlmock.NewRows([]string{"id", "organization_id", "external_id"}).
+			AddRow("cus123", orgID, "cus_external")
+
+		mock.ExpectQuery(query).
+			WithArgs(orgID, "cus_external", 1).
+			WillReturnRows(rows)
+
+		result := store.FetchCustomerByExternalID(orgID, "cus_external")
+
+		assert.True(t, result.Success())
+		assert.Equal(t, "cus123", result.Value().ID)
+	})
+
+	t.Run("should return error when customer not found", func(t *testing.T) {
+		store, mock, cleanup := setupApiStore(t)
+		defer cleanup()
+
+		mock.ExpectQuery(query).
+			WithArgs(orgID, "cus_external", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		result := store.FetchCustomerByExternalID(orgID, "cus_external")
+
+		assert.False(t, result.Success())
+		assert.Equal(t, gorm.ErrRecordNotFound, result.Error())
+		assert.False(t, result.IsCapturable())
+	})
+}
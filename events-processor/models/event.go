@@ -2,17 +2,25 @@ package models
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
+
 	"github.com/getlago/lago/events-processor/utils"
 )
 
 const HTTP_RUBY string = "http_ruby"
 const TARGET_WALLET_CODE string = "target_wallet_code"
 
+// Namespace of the enriched event IDs.
+// It must never change, otherwise replayed events would get new IDs
+var enrichedEventIDNamespace = uuid.MustParse("4f5a3c1e-9b0d-5e2a-8c7f-6d1b2a3e4f50")
+
 type Event struct {
 	OrganizationID          string           `json:"organization_id"`
 	ExternalSubscriptionID  string           `json:"external_subscription_id"`
+	ExternalCustomerID      string           `json:"external_customer_id,omitempty"`
 	TransactionID           string           `json:"transaction_id"`
 	Code                    string           `json:"code"`
 	Properties              map[string]any   `json:"properties"`
@@ -28,6 +36,12 @@ type SourceMetadata struct {
 	Reprocess      bool `json:"reprocess"`
 }
 
+// IsCustomerEvent returns true when the event targets every subscription of a customer
+// instead of a single subscription
+func (ev *Event) IsCustomerEvent() bool {
+	return ev.ExternalSubscriptionID == "" && ev.ExternalCustomerID != ""
+}
+
 func (ev *Event) IsReprocess() bool {
 	return ev.SourceMetadata != nil && ev.SourceMetadata.Reprocess
 }
@@ -36,12 +50,25 @@ type EnrichedEvent struct {
 	InitialEvent   *Event          `json:"-"`
 	BillableMetric *BillableMetric `json:"-"`
 	Subscription   *Subscription   `json:"-"`
+	Customer       *Customer       `json:"-"`
+	BillingEntity  *BillingEntity  `json:"-"`
+	Organization   *Organization   `json:"-"`
+	Plan           *Plan           `json:"-"`
 	FlatFilter     *FlatFilter     `json:"-"`
+	TargetWallet   *Wallet         `json:"-"`
 
+	ID                      string            `json:"id"`
 	OrganizationID          string            `json:"organization_id"`
 	ExternalSubscriptionID  string            `json:"external_subscription_id"`
 	SubscriptionID          string            `json:"subscription_id"`
 	PlanID                  string            `json:"plan_id"`
+	PlanCode                *string           `json:"plan_code"`
+	CustomerID              *string           `json:"customer_id"`
+	ExternalCustomerID      *string           `json:"external_customer_id"`
+	BillingEntityID         *string           `json:"billing_entity_id"`
+	Currency                *string           `json:"currency"`
+	BillingPeriodStart      *time.Time        `json:"billing_period_start"`
+	BillingPeriodEnd        *time.Time        `json:"billing_period_end"`
 	TransactionID           string            `json:"transaction_id"`
 	Code                    string            `json:"code"`
 	AggregationType         string            `json:"aggregation_type"`
@@ -58,6 +85,13 @@ type EnrichedEvent struct {
 	ChargeFilterUpdatedAt   *time.Time        `json:"charge_filter_updated_at"`
 	GroupedBy               map[string]string `json:"grouped_by"`
 	TargetWalletCode        *string           `json:"target_wallet_code"`
+	MatchTrace              *FilterMatchTrace `json:"match_trace,omitempty"`
+	// Set on a customer event whose customer has active subscriptions, none of them with a charge on the billable metric
+	SubscriptionsWithoutCharge bool `json:"-"`
+
+	TimestampPolicy *TimestampPolicyDecision `json:"timestamp_policy,omitempty"`
+	UnbilledReason  string                   `json:"unbilled_reason,omitempty"`
+	EstimatedFee    *FeeEstimate             `json:"estimated_fee,omitempty"`
 }
 
 type FailedEvent struct {
@@ -66,6 +100,8 @@ type FailedEvent struct {
 	ErrorMessage        string    `json:"error_message"`
 	ErrorCode           string    `json:"error_code"`
 	FailedAt            time.Time `json:"failed_at"`
+	// Only set when the processing of the event panicked
+	StackTrace string `json:"stack_trace,omitempty"`
 }
 
 func (ev *Event) ToEnrichedEvent() utils.Result[*EnrichedEvent] {
@@ -97,6 +133,51 @@ func (ev *Event) ToEnrichedEvent() utils.Result[*EnrichedEvent] {
 	return utils.SuccessResult(er)
 }
 
+// ApplyTimestampPolicy records the policy decision on the event.
+// Clamped events are moved to the limit of the policy, their original timestamp is kept in the decision.
+func (ev *EnrichedEvent) ApplyTimestampPolicy(decision *TimestampPolicyDecision) {
+	decision.OriginalTimestamp = ev.Timestamp
+	if ev.TimestampPolicy != nil {
+		decision.OriginalTimestamp = ev.TimestampPolicy.OriginalTimestamp
+	}
+	ev.TimestampPolicy = decision
+
+	if decision.Action != TimestampPolicyClamp {
+		return
+	}
+
+	ev.Time = decision.Limit.UTC()
+	ev.Timestamp = float64(ev.Time.UnixMilli()) / 1e3
+	ev.TimestampStr = fmt.Sprintf("%f", ev.Timestamp)
+}
+
+// EnrichedID returns the stable identifier of the enriched event.
+// It is a UUIDv5 of the organization, external subscription and transaction IDs.
+func (ev *EnrichedEvent) EnrichedID() string {
+	return buildEnrichedEventID(ev.OrganizationID, ev.ExternalSubscriptionID, ev.TransactionID)
+}
+
+// ExpandedID returns the stable identifier of the enriched expanded event.
+// On top of the enriched ID components, it includes the charge and charge filter IDs
+// as an event is expanded once per charge.
+func (ev *EnrichedEvent) ExpandedID() string {
+	chargeID := ""
+	if ev.ChargeID != nil {
+		chargeID = *ev.ChargeID
+	}
+
+	chargeFilterID := ""
+	if ev.ChargeFilterID != nil {
+		chargeFilterID = *ev.ChargeFilterID
+	}
+
+	return buildEnrichedEventID(ev.OrganizationID, ev.ExternalSubscriptionID, ev.TransactionID, chargeID, chargeFilterID)
+}
+
+func buildEnrichedEventID(parts ...string) string {
+	return uuid.NewSHA1(enrichedEventIDNamespace, []byte(strings.Join(parts, "\x00"))).String()
+}
+
 func (ev *Event) NotAPIPostProcessed() bool {
 	if ev.Source != HTTP_RUBY {
 		return true
@@ -1,10 +1,14 @@
 package models
 
 import (
+	"slices"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/getlago/lago/events-processor/utils"
 )
 
 func TestToEnrichedEvent(t *testing.T) {
@@ -87,3 +91,49 @@ func TestNotAPIPostProcessed(t *testing.T) {
 		assert.True(t, event.NotAPIPostProcessed())
 	})
 }
+
+func TestEnrichedEventIDs(t *testing.T) {
+	event := EnrichedEvent{
+		OrganizationID:         "1a901a90-1a90-1a90-1a90-1a901a901a90",
+		ExternalSubscriptionID: "sub_id",
+		TransactionID:          "transaction_id",
+	}
+
+	t.Run("should build stable UUIDv5 IDs", func(t *testing.T) {
+		enrichedID, err := uuid.Parse(event.EnrichedID())
+		assert.NoError(t, err)
+		assert.Equal(t, uuid.Version(5), enrichedID.Version())
+		assert.Equal(t, event.EnrichedID(), event.EnrichedID())
+
+		expandedID, err := uuid.Parse(event.ExpandedID())
+		assert.NoError(t, err)
+		assert.Equal(t, uuid.Version(5), expandedID.Version())
+		assert.NotEqual(t, event.EnrichedID(), event.ExpandedID())
+	})
+
+	t.Run("should build distinct IDs per charge and charge filter", func(t *testing.T) {
+		charge1 := event
+		charge1.ChargeID = utils.StringPtr("charge1")
+
+		charge2 := event
+		charge2.ChargeID = utils.StringPtr("charge2")
+
+		charge1Filter := charge1
+		charge1Filter.ChargeFilterID = utils.StringPtr("charge_filter1")
+
+		ids := []string{event.ExpandedID(), charge1.ExpandedID(), charge2.ExpandedID(), charge1Filter.ExpandedID()}
+		assert.Len(t, slices.Compact(slices.Sorted(slices.Values(ids))), 4)
+
+		// The enriched ID does not depend on the charge
+		assert.Equal(t, event.EnrichedID(), charge1Filter.EnrichedID())
+	})
+
+	t.Run("should not depend on other attributes", func(t *testing.T) {
+		other := event
+		other.Code = "other_code"
+		other.Properties = map[string]any{"value": 12}
+
+		assert.Equal(t, event.EnrichedID(), other.EnrichedID())
+		assert.Equal(t, event.ExpandedID(), other.ExpandedID())
+	})
+}
@@ -0,0 +1,341 @@
+package models
+
+import (
+	"fmt"
+	"maps"
+	"math/bits"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const FILTER_MATCHER_CACHE_MAX_ENTRIES = 10000
+
+// filterBitset is a fixed size set of filter indexes
+type filterBitset []uint64
+
+func newFilterBitset(size int) filterBitset {
+	return make(filterBitset, (size+63)/64)
+}
+
+func (b filterBitset) set(i int) {
+	b[i/64] |= 1 << (uint(i) % 64)
+}
+
+func (b filterBitset) fill(size int) {
+	for i := range b {
+		b[i] = ^uint64(0)
+	}
+	if rem := size % 64; rem != 0 {
+		b[len(b)-1] = (1 << uint(rem)) - 1
+	}
+}
+
+func (b filterBitset) isEmpty() bool {
+	for _, word := range b {
+		if word != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterMatcher is a precompiled index of the flat filters of a single charge.
+// For every filter key, it maps each accepted value to the set of filters accepting it,
+// so matching an event costs one map lookup per key instead of a scan of every filter.
+type FilterMatcher struct {
+	defaultFilter *FlatFilter
+
+	// Filters with at least one key, ordered by CompareFlatFilters
+	filters   []FlatFilter
+	keyCounts []int
+
+	keys []string
+	// key -> value -> filters accepting the value for this key
+	values map[string]map[string]filterBitset
+	// key -> filters not constraining this key
+	unconstrained map[string]filterBitset
+}
+
+// NewFilterMatcher compiles the flat filters of a single charge into a FilterMatcher
+func NewFilterMatcher(filters []FlatFilter) *FilterMatcher {
+	matcher := &FilterMatcher{
+		values:        make(map[string]map[string]filterBitset),
+		unconstrained: make(map[string]filterBitset),
+	}
+
+	if len(filters) == 0 {
+		return matcher
+	}
+
+	sortedFilters := slices.Clone(filters)
+	slices.SortStableFunc(sortedFilters, CompareFlatFilters)
+	matcher.defaultFilter = sortedFilters[0].ToDefaultFilter()
+
+	for _, filter := range sortedFilters {
+		if filter.HasFilters() {
+			matcher.filters = append(matcher.filters, filter)
+		}
+	}
+
+	size := len(matcher.filters)
+	matcher.keyCounts = make([]int, size)
+
+	for i, filter := range matcher.filters {
+		matcher.keyCounts[i] = len(*filter.Filters)
+
+		for key, values := range *filter.Filters {
+			valueIndex, ok := matcher.values[key]
+			if !ok {
+				valueIndex = make(map[string]filterBitset)
+				matcher.values[key] = valueIndex
+				matcher.keys = append(matcher.keys, key)
+			}
+
+			for _, value := range values {
+				set, ok := valueIndex[value]
+				if !ok {
+					set = newFilterBitset(size)
+					valueIndex[value] = set
+				}
+				set.set(i)
+			}
+		}
+	}
+	slices.Sort(matcher.keys)
+
+	for _, key := range matcher.keys {
+		set := newFilterBitset(size)
+		for i, filter := range matcher.filters {
+			if _, ok := (*filter.Filters)[key]; !ok {
+				set.set(i)
+			}
+		}
+		matcher.unconstrained[key] = set
+	}
+
+	return matcher
+}
+
+// Match returns the filter matching the most properties of the event,
+// or the charge's default bucket when no filter matches.
+//
+// Tie-break rule: when several filters match the same number of keys,
+// the one with the lowest charge filter ID (byte-wise comparison) wins.
+// The result never depends on the order of the filters given to NewFilterMatcher.
+func (m *FilterMatcher) Match(event *EnrichedEvent) *FlatFilter {
+	if m.defaultFilter == nil {
+		return nil
+	}
+
+	index := m.bestMatch(m.candidates(event))
+	if index < 0 {
+		defaultFilter := *m.defaultFilter
+		return &defaultFilter
+	}
+
+	filter := m.filters[index]
+	return &filter
+}
+
+// Reasons explaining why the matched filter was selected
+const (
+	FilterMatchReasonNoFilters     = "no_filters"
+	FilterMatchReasonDefaultBucket = "default_bucket"
+	FilterMatchReasonSingleMatch   = "single_match"
+	FilterMatchReasonMostKeys      = "most_matched_keys"
+	FilterMatchReasonTieBreak      = "tie_break_lowest_charge_filter_id"
+)
+
+// FilterMatchTrace explains how an event was assigned to a charge filter or to the charge's default bucket
+type FilterMatchTrace struct {
+	ChargeFilterID *string            `json:"charge_filter_id"`
+	Reason         string             `json:"reason"`
+	Evaluations    []FilterEvaluation `json:"evaluations,omitempty"`
+}
+
+// FilterEvaluation is the result of the evaluation of a single charge filter against an event
+type FilterEvaluation struct {
+	ChargeFilterID string   `json:"charge_filter_id"`
+	Matching       bool     `json:"matching"`
+	MatchedKeys    []string `json:"matched_keys,omitempty"`
+	FailedKeys     []string `json:"failed_keys,omitempty"`
+}
+
+// Explain returns the same filter as Match, along with a trace of the evaluation of every filter.
+// It is slower than Match and should only be used when the trace is needed.
+func (m *FilterMatcher) Explain(event *EnrichedEvent) (*FlatFilter, *FilterMatchTrace) {
+	filter := m.Match(event)
+	if filter == nil {
+		return nil, nil
+	}
+
+	trace := &FilterMatchTrace{
+		ChargeFilterID: filter.ChargeFilterID,
+		Evaluations:    make([]FilterEvaluation, 0, len(m.filters)),
+	}
+
+	matchingCount := 0
+	bestKeyCount := 0
+	bestCount := 0
+	for i, ff := range m.filters {
+		evaluation := FilterEvaluation{ChargeFilterID: flatFilterID(&ff)}
+
+		for _, key := range slices.Sorted(maps.Keys(*ff.Filters)) {
+			property := event.Properties[key]
+			if property != nil && slices.Contains((*ff.Filters)[key], fmt.Sprintf("%v", property)) {
+				evaluation.MatchedKeys = append(evaluation.MatchedKeys, key)
+			} else {
+				evaluation.FailedKeys = append(evaluation.FailedKeys, key)
+			}
+		}
+		evaluation.Matching = len(evaluation.FailedKeys) == 0
+
+		if evaluation.Matching {
+			matchingCount++
+			switch {
+			case m.keyCounts[i] > bestKeyCount:
+				bestKeyCount = m.keyCounts[i]
+				bestCount = 1
+			case m.keyCounts[i] == bestKeyCount:
+				bestCount++
+			}
+		}
+
+		trace.Evaluations = append(trace.Evaluations, evaluation)
+	}
+
+	switch {
+	case len(m.filters) == 0:
+		trace.Reason = FilterMatchReasonNoFilters
+	case matchingCount == 0:
+		trace.Reason = FilterMatchReasonDefaultBucket
+	case matchingCount == 1:
+		trace.Reason = FilterMatchReasonSingleMatch
+	case bestCount > 1:
+		trace.Reason = FilterMatchReasonTieBreak
+	default:
+		trace.Reason = FilterMatchReasonMostKeys
+	}
+
+	return filter, trace
+}
+
+// candidates returns the set of filters whose keys are all matched by the event properties
+func (m *FilterMatcher) candidates(event *EnrichedEvent) filterBitset {
+	size := len(m.filters)
+	candidates := newFilterBitset(size)
+	if size == 0 {
+		return candidates
+	}
+	candidates.fill(size)
+
+	for _, key := range m.keys {
+		unconstrained := m.unconstrained[key]
+
+		var accepted filterBitset
+		if property := event.Properties[key]; property != nil {
+			accepted = m.values[key][fmt.Sprintf("%v", property)]
+		}
+
+		for i := range candidates {
+			word := unconstrained[i]
+			if accepted != nil {
+				word |= accepted[i]
+			}
+			candidates[i] &= word
+		}
+
+		if candidates.isEmpty() {
+			break
+		}
+	}
+
+	return candidates
+}
+
+// bestMatch returns the index of the candidate with the most keys, -1 when there is no candidate.
+// Filters are sorted by priority, so the first candidate wins on equality.
+func (m *FilterMatcher) bestMatch(candidates filterBitset) int {
+	best := -1
+	for wordIndex, word := range candidates {
+		for word != 0 {
+			i := wordIndex*64 + bits.TrailingZeros64(word)
+			word &= word - 1
+
+			if best < 0 || m.keyCounts[i] > m.keyCounts[best] {
+				best = i
+			}
+		}
+	}
+
+	return best
+}
+
+// CompareFlatFilters orders flat filters by charge ID, then by charge filter ID.
+// Filters without charge filter ID (charge default bucket) come first.
+func CompareFlatFilters(a, b FlatFilter) int {
+	if c := strings.Compare(a.ChargeID, b.ChargeID); c != 0 {
+		return c
+	}
+	return strings.Compare(flatFilterID(&a), flatFilterID(&b))
+}
+
+func flatFilterID(ff *FlatFilter) string {
+	if ff.ChargeFilterID == nil {
+		return ""
+	}
+	return *ff.ChargeFilterID
+}
+
+// FilterMatcherCache keeps compiled matchers per charge to reuse them across events.
+// A matcher is rebuilt when the version of the filters it was compiled from changes.
+type FilterMatcherCache struct {
+	matchers sync.Map
+	size     int
+	mu       sync.Mutex
+}
+
+type versionedFilterMatcher struct {
+	version uint64
+	matcher *FilterMatcher
+}
+
+func NewFilterMatcherCache() *FilterMatcherCache {
+	return &FilterMatcherCache{}
+}
+
+// Get returns the compiled matcher for the filters of a single charge.
+// The version identifies the filters, it must change whenever they are updated.
+// The filters are only compiled when no matcher was cached for this version.
+// A nil cache always compiles a new matcher.
+func (c *FilterMatcherCache) Get(chargeID string, version uint64, filters []FlatFilter) *FilterMatcher {
+	if c == nil {
+		return NewFilterMatcher(filters)
+	}
+
+	if cached, ok := c.matchers.Load(chargeID); ok {
+		entry := cached.(*versionedFilterMatcher)
+		if entry.version == version {
+			return entry.matcher
+		}
+	}
+
+	matcher := NewFilterMatcher(filters)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &versionedFilterMatcher{version: version, matcher: matcher}
+	if _, loaded := c.matchers.Swap(chargeID, entry); !loaded {
+		c.size++
+	}
+
+	// Deleted charges are never evicted individually, reset the cache once it grows too much
+	if c.size > FILTER_MATCHER_CACHE_MAX_ENTRIES {
+		c.matchers.Clear()
+		c.size = 0
+	}
+
+	return matcher
+}
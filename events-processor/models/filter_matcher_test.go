@@ -0,0 +1,345 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+func buildMatcherFilter(chargeFilterID string, filters FlatFilterValues, updatedAt time.Time) FlatFilter {
+	return FlatFilter{
+		OrganizationID:        "org_id",
+		BillableMetricCode:    "api_call",
+		PlanID:                "plan_id",
+		ChargeID:              "charge_id",
+		ChargeUpdatedAt:       updatedAt,
+		ChargeFilterID:        utils.StringPtr(chargeFilterID),
+		ChargeFilterUpdatedAt: &updatedAt,
+		Filters:               &filters,
+	}
+}
+
+func TestFilterMatcher(t *testing.T) {
+	now := time.Now()
+
+	t.Run("should return nil without filters", func(t *testing.T) {
+		matcher := NewFilterMatcher([]FlatFilter{})
+
+		assert.Nil(t, matcher.Match(&EnrichedEvent{}))
+	})
+
+	t.Run("should return the matching filter", func(t *testing.T) {
+		filters := []FlatFilter{
+			buildMatcherFilter("cf1", FlatFilterValues{"scheme": {"visa"}}, now),
+			buildMatcherFilter("cf2", FlatFilterValues{"scheme": {"mastercard"}}, now),
+		}
+		matcher := NewFilterMatcher(filters)
+
+		result := matcher.Match(&EnrichedEvent{Properties: map[string]any{"scheme": "mastercard"}})
+
+		assert.Equal(t, "cf2", *result.ChargeFilterID)
+	})
+
+	t.Run("should match non string property values", func(t *testing.T) {
+		filters := []FlatFilter{
+			buildMatcherFilter("cf1", FlatFilterValues{"region": {"12"}}, now),
+		}
+		matcher := NewFilterMatcher(filters)
+
+		result := matcher.Match(&EnrichedEvent{Properties: map[string]any{"region": 12}})
+
+		assert.Equal(t, "cf1", *result.ChargeFilterID)
+	})
+
+	t.Run("should return the default bucket when no filter matches", func(t *testing.T) {
+		filters := []FlatFilter{
+			buildMatcherFilter("cf1", FlatFilterValues{"scheme": {"visa"}, "method": {"debit"}}, now),
+		}
+		matcher := NewFilterMatcher(filters)
+
+		result := matcher.Match(&EnrichedEvent{Properties: map[string]any{"scheme": "visa"}})
+
+		assert.Equal(t, "charge_id", result.ChargeID)
+		assert.Nil(t, result.ChargeFilterID)
+		assert.Nil(t, result.Filters)
+	})
+
+	t.Run("should return the filter matching the most keys", func(t *testing.T) {
+		filters := []FlatFilter{
+			buildMatcherFilter("cf3", FlatFilterValues{"scheme": {"visa"}, "method": {"debit"}, "country": {"fr"}}, now),
+			buildMatcherFilter("cf1", FlatFilterValues{"scheme": {"visa"}}, now),
+			buildMatcherFilter("cf2", FlatFilterValues{"scheme": {"visa"}, "method": {"debit"}}, now),
+		}
+		matcher := NewFilterMatcher(filters)
+
+		result := matcher.Match(&EnrichedEvent{Properties: map[string]any{"scheme": "visa", "method": "debit"}})
+		assert.Equal(t, "cf2", *result.ChargeFilterID)
+
+		result = matcher.Match(&EnrichedEvent{Properties: map[string]any{"scheme": "visa", "method": "debit", "country": "fr"}})
+		assert.Equal(t, "cf3", *result.ChargeFilterID)
+	})
+
+	t.Run("should break ties with the lowest charge filter ID", func(t *testing.T) {
+		filterB := buildMatcherFilter("cf_b", FlatFilterValues{"scheme": {"visa"}}, now)
+		filterA := buildMatcherFilter("cf_a", FlatFilterValues{"method": {"debit"}}, now)
+		event := &EnrichedEvent{Properties: map[string]any{"scheme": "visa", "method": "debit"}}
+
+		result := NewFilterMatcher([]FlatFilter{filterB, filterA}).Match(event)
+		assert.Equal(t, "cf_a", *result.ChargeFilterID)
+
+		result = NewFilterMatcher([]FlatFilter{filterA, filterB}).Match(event)
+		assert.Equal(t, "cf_a", *result.ChargeFilterID)
+	})
+
+	t.Run("should build the default bucket independently of the filters order", func(t *testing.T) {
+		filterA := buildMatcherFilter("cf_a", FlatFilterValues{"scheme": {"visa"}}, now)
+		filterA.PricingGroupKeys = []string{"region"}
+		filterB := buildMatcherFilter("cf_b", FlatFilterValues{"scheme": {"mastercard"}}, now)
+		filterB.PricingGroupKeys = []string{"country"}
+		event := &EnrichedEvent{Properties: map[string]any{"scheme": "amex"}}
+
+		result := NewFilterMatcher([]FlatFilter{filterB, filterA}).Match(event)
+		assert.Equal(t, PricingGroupKeys{"region"}, result.PricingGroupKeys)
+
+		result = NewFilterMatcher([]FlatFilter{filterA, filterB}).Match(event)
+		assert.Equal(t, PricingGroupKeys{"region"}, result.PricingGroupKeys)
+	})
+
+	t.Run("should handle more than 64 filters", func(t *testing.T) {
+		filters := make([]FlatFilter, 0, 150)
+		for i := range 150 {
+			filters = append(filters, buildMatcherFilter(
+				fmt.Sprintf("cf%03d", i),
+				FlatFilterValues{"region": {fmt.Sprintf("region_%d", i)}},
+				now,
+			))
+		}
+		matcher := NewFilterMatcher(filters)
+
+		result := matcher.Match(&EnrichedEvent{Properties: map[string]any{"region": "region_130"}})
+		assert.Equal(t, "cf130", *result.ChargeFilterID)
+	})
+}
+
+func TestFilterMatcherExplain(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name           string
+		filters        []FlatFilter
+		properties     map[string]any
+		chargeFilterID *string
+		reason         string
+	}{
+		{
+			name:       "without filters",
+			filters:    []FlatFilter{{ChargeID: "charge_id"}},
+			properties: map[string]any{"scheme": "visa"},
+			reason:     FilterMatchReasonNoFilters,
+		},
+		{
+			name: "without matching filters",
+			filters: []FlatFilter{
+				buildMatcherFilter("cf1", FlatFilterValues{"scheme": {"mastercard"}}, now),
+			},
+			properties: map[string]any{"scheme": "visa"},
+			reason:     FilterMatchReasonDefaultBucket,
+		},
+		{
+			name: "with a single matching filter",
+			filters: []FlatFilter{
+				buildMatcherFilter("cf1", FlatFilterValues{"scheme": {"mastercard"}}, now),
+				buildMatcherFilter("cf2", FlatFilterValues{"scheme": {"visa"}}, now),
+			},
+			properties:     map[string]any{"scheme": "visa"},
+			chargeFilterID: utils.StringPtr("cf2"),
+			reason:         FilterMatchReasonSingleMatch,
+		},
+		{
+			name: "with a filter matching more keys",
+			filters: []FlatFilter{
+				buildMatcherFilter("cf1", FlatFilterValues{"scheme": {"visa"}}, now),
+				buildMatcherFilter("cf2", FlatFilterValues{"scheme": {"visa"}, "method": {"debit"}}, now),
+			},
+			properties:     map[string]any{"scheme": "visa", "method": "debit"},
+			chargeFilterID: utils.StringPtr("cf2"),
+			reason:         FilterMatchReasonMostKeys,
+		},
+		{
+			name: "with filters matching the same number of keys",
+			filters: []FlatFilter{
+				buildMatcherFilter("cf2", FlatFilterValues{"scheme": {"visa"}}, now),
+				buildMatcherFilter("cf1", FlatFilterValues{"method": {"debit"}}, now),
+			},
+			properties:     map[string]any{"scheme": "visa", "method": "debit"},
+			chargeFilterID: utils.StringPtr("cf1"),
+			reason:         FilterMatchReasonTieBreak,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matcher := NewFilterMatcher(test.filters)
+			event := &EnrichedEvent{Properties: test.properties}
+
+			filter, trace := matcher.Explain(event)
+
+			assert.Equal(t, matcher.Match(event), filter)
+			assert.Equal(t, test.chargeFilterID, filter.ChargeFilterID)
+			assert.Equal(t, test.chargeFilterID, trace.ChargeFilterID)
+			assert.Equal(t, test.reason, trace.Reason)
+		})
+	}
+
+	t.Run("should report matched and failed keys", func(t *testing.T) {
+		matcher := NewFilterMatcher([]FlatFilter{
+			buildMatcherFilter("cf1", FlatFilterValues{"scheme": {"visa"}, "method": {"debit"}, "country": {"fr"}}, now),
+		})
+
+		_, trace := matcher.Explain(&EnrichedEvent{Properties: map[string]any{"scheme": "visa", "method": "credit"}})
+
+		assert.Equal(t, []FilterEvaluation{{
+			ChargeFilterID: "cf1",
+			Matching:       false,
+			MatchedKeys:    []string{"scheme"},
+			FailedKeys:     []string{"country", "method"},
+		}}, trace.Evaluations)
+	})
+}
+
+func TestCompareFlatFilters(t *testing.T) {
+	now := time.Now()
+
+	defaultBucket := FlatFilter{ChargeID: "charge1"}
+	filterA := buildMatcherFilter("cf_a", FlatFilterValues{}, now)
+	filterA.ChargeID = "charge1"
+	filterB := buildMatcherFilter("cf_b", FlatFilterValues{}, now)
+	filterB.ChargeID = "charge1"
+	otherCharge := buildMatcherFilter("cf_0", FlatFilterValues{}, now)
+	otherCharge.ChargeID = "charge2"
+
+	filters := []FlatFilter{otherCharge, filterB, filterA, defaultBucket}
+	slices.SortFunc(filters, CompareFlatFilters)
+
+	assert.Equal(t, []FlatFilter{defaultBucket, filterA, filterB, otherCharge}, filters)
+}
+
+func TestFilterMatcherCache(t *testing.T) {
+	now := time.Now()
+
+	t.Run("should reuse the compiled matcher", func(t *testing.T) {
+		matcherCache := NewFilterMatcherCache()
+		filters := []FlatFilter{buildMatcherFilter("cf1", FlatFilterValues{"scheme": {"visa"}}, now)}
+
+		matcher := matcherCache.Get("charge_id", 1, filters)
+		assert.Same(t, matcher, matcherCache.Get("charge_id", 1, filters))
+	})
+
+	t.Run("should rebuild the matcher when the filters version changes", func(t *testing.T) {
+		matcherCache := NewFilterMatcherCache()
+		filters := []FlatFilter{buildMatcherFilter("cf1", FlatFilterValues{"scheme": {"visa"}}, now)}
+		matcher := matcherCache.Get("charge_id", 1, filters)
+
+		updatedFilters := []FlatFilter{buildMatcherFilter("cf1", FlatFilterValues{"scheme": {"mastercard"}}, now)}
+		updatedMatcher := matcherCache.Get("charge_id", 2, updatedFilters)
+
+		assert.NotSame(t, matcher, updatedMatcher)
+		result := updatedMatcher.Match(&EnrichedEvent{Properties: map[string]any{"scheme": "mastercard"}})
+		assert.Equal(t, "cf1", *result.ChargeFilterID)
+	})
+
+	t.Run("should compile a new matcher with a nil cache", func(t *testing.T) {
+		var matcherCache *FilterMatcherCache
+		filters := []FlatFilter{buildMatcherFilter("cf1", FlatFilterValues{"scheme": {"visa"}}, now)}
+
+		assert.NotNil(t, matcherCache.Get("charge_id", 1, filters))
+	})
+}
+
+// buildBenchmarkFilters builds a charge with one filter per combination of values
+func buildBenchmarkFilters(schemes, methods, regions int) []FlatFilter {
+	now := time.Now()
+	filters := make([]FlatFilter, 0, schemes*methods*regions)
+
+	for s := range schemes {
+		for m := range methods {
+			for r := range regions {
+				filters = append(filters, buildMatcherFilter(
+					fmt.Sprintf("cf_%d_%d_%d", s, m, r),
+					FlatFilterValues{
+						"scheme": {fmt.Sprintf("scheme_%d", s)},
+						"method": {fmt.Sprintf("method_%d", m)},
+						"region": {fmt.Sprintf("region_%d", r), "all"},
+					},
+					now,
+				))
+			}
+		}
+	}
+
+	return filters
+}
+
+func linearMatchingFilter(filters []FlatFilter, event *EnrichedEvent) *FlatFilter {
+	var bestFilter *FlatFilter
+	for _, filter := range filters {
+		if !filter.HasFilters() || !filter.IsMatchingEvent(event).Value() {
+			continue
+		}
+
+		if bestFilter == nil || len(filter.Filters.Keys()) > len(bestFilter.Filters.Keys()) {
+			bestFilter = &filter
+		}
+	}
+
+	if bestFilter == nil {
+		return filters[0].ToDefaultFilter()
+	}
+	return bestFilter
+}
+
+func BenchmarkMatchingFilter(b *testing.B) {
+	filters := buildBenchmarkFilters(10, 5, 10)
+	event := &EnrichedEvent{
+		Properties: map[string]any{"scheme": "scheme_7", "method": "method_3", "region": "region_9"},
+	}
+
+	b.Run("Linear", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			linearMatchingFilter(filters, event)
+		}
+	})
+
+	b.Run("Compiled", func(b *testing.B) {
+		matcher := NewFilterMatcher(filters)
+
+		b.ReportAllocs()
+		for b.Loop() {
+			matcher.Match(event)
+		}
+	})
+
+	b.Run("Cached", func(b *testing.B) {
+		matcherCache := NewFilterMatcherCache()
+
+		b.ReportAllocs()
+		for b.Loop() {
+			matcherCache.Get("charge_id", 1, filters).Match(event)
+		}
+	})
+}
+
+func BenchmarkNewFilterMatcher(b *testing.B) {
+	filters := buildBenchmarkFilters(10, 5, 10)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		NewFilterMatcher(filters)
+	}
+}
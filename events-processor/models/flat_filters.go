@@ -87,17 +87,17 @@ func (fm PricingGroupKeys) Value() (driver.Value, error) {
 }
 
 type FlatFilter struct {
-	OrganizationID        string            `gorm:"->"`
-	BillableMetricCode    string            `gorm:"->"`
-	PlanID                string            `gorm:"->"`
-	ChargeID              string            `gorm:"->"`
-	ChargeUpdatedAt       time.Time         `gorm:"->"`
-	ChargeFilterID        *string           `gorm:"->"`
-	ChargeFilterUpdatedAt *time.Time        `gorm:"->"`
-	Filters               *FlatFilterValues `gorm:"type:jsonb"`
-	PricingGroupKeys      PricingGroupKeys  `gorm:"type:jsonb"`
-	PayInAdvance          bool              `gorm:"type:boolean"`
-	AcceptsTargetWallet   bool              `gorm:"type:boolean"`
+	OrganizationID        string            `gorm:"->" json:"organization_id"`
+	BillableMetricCode    string            `gorm:"->" json:"billable_metric_code"`
+	PlanID                string            `gorm:"->" json:"plan_id"`
+	ChargeID              string            `gorm:"->" json:"charge_id"`
+	ChargeUpdatedAt       time.Time         `gorm:"->" json:"charge_updated_at"`
+	ChargeFilterID        *string           `gorm:"->" json:"charge_filter_id"`
+	ChargeFilterUpdatedAt *time.Time        `gorm:"->" json:"charge_filter_updated_at"`
+	Filters               *FlatFilterValues `gorm:"type:jsonb" json:"filters"`
+	PricingGroupKeys      PricingGroupKeys  `gorm:"type:jsonb" json:"pricing_group_keys"`
+	PayInAdvance          bool              `gorm:"type:boolean" json:"pay_in_advance"`
+	AcceptsTargetWallet   bool              `gorm:"type:boolean" json:"accepts_target_wallet"`
 }
 
 var flatFilterSchema, _ = schema.Parse(&FlatFilter{}, &sync.Map{}, schema.NamingStrategy{})
@@ -177,51 +177,8 @@ func (ff *FlatFilter) ToDefaultFilter() *FlatFilter {
 	return defaultFilter
 }
 
+// MatchingFilter returns the filter of a single charge matching the event.
+// It compiles the filters on each call, use a FilterMatcherCache to reuse the compiled matcher across events.
 func MatchingFilter(filters []FlatFilter, event *EnrichedEvent) *FlatFilter {
-	// Multiple filters are present, identify the best match
-	if len(filters) > 1 {
-		// First select all matching filters
-		matchingFilters := make([]FlatFilter, 0)
-		for _, filter := range filters {
-			if filter.HasFilters() && filter.IsMatchingEvent(event).Value() {
-				matchingFilters = append(matchingFilters, filter)
-			}
-		}
-
-		// No filters matches the event
-		if len(matchingFilters) == 0 {
-			// Return the charge's default bucket
-			return filters[0].ToDefaultFilter()
-
-		} else {
-			// NOTE: Multiple filters match the event (parent/child filters),
-			//       We must take only the one matching the most properties
-			var bestFilter *FlatFilter
-			for _, filter := range matchingFilters {
-				if bestFilter == nil {
-					bestFilter = &filter
-					continue
-				}
-
-				if len(filter.Filters.Keys()) > len(bestFilter.Filters.Keys()) {
-					bestFilter = &filter
-				}
-			}
-
-			// Return the best match
-			return bestFilter
-		}
-
-	} else {
-		filter := filters[0]
-
-		// Check if the only filter is matching the event
-		if filter.HasFilters() && filter.IsMatchingEvent(event).Value() {
-			// Return the only matching filter
-			return &filter
-		} else {
-			// Otherwise, return the charge's default bucket
-			return filter.ToDefaultFilter()
-		}
-	}
+	return NewFilterMatcher(filters).Match(event)
 }
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Name of the lane processing the events matching no configured lane
+const DEFAULT_LANE = "default"
+
+// Lane is an input lane of the processor: its events are processed with their own concurrency budget,
+// so latency sensitive events don't wait behind the bulk traffic.
+// An event of the raw events topic belongs to the first lane matching its header or its organization,
+// all the events of the topic of a lane belong to the lane.
+type Lane struct {
+	Name string `json:"name"`
+	// Optional, topic consumed by a dedicated consumer group
+	Topic string `json:"topic"`
+	// Maximum number of events of a batch of the lane processed concurrently, 0 for no limit
+	Concurrency int `json:"concurrency"`
+	// Optional, Kafka header of the raw events of the lane, with the header value when set
+	Header      string `json:"header"`
+	HeaderValue string `json:"header_value"`
+	// Optional, organizations whose raw events belong to the lane
+	OrganizationIDs []string `json:"organization_ids"`
+}
+
+// ParseLanes parses a JSON array of lanes, in their matching order
+func ParseLanes(raw string) ([]*Lane, error) {
+	lanes := make([]*Lane, 0)
+	if raw == "" {
+		return lanes, nil
+	}
+
+	if err := json.Unmarshal([]byte(raw), &lanes); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool, len(lanes))
+	topics := make(map[string]bool, len(lanes))
+	for _, lane := range lanes {
+		if err := lane.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid lane %s: %w", lane.Name, err)
+		}
+
+		if names[lane.Name] {
+			return nil, fmt.Errorf("duplicated lane %s", lane.Name)
+		}
+		names[lane.Name] = true
+
+		if lane.Topic != "" {
+			if topics[lane.Topic] {
+				return nil, fmt.Errorf("topic %s is used by several lanes", lane.Topic)
+			}
+			topics[lane.Topic] = true
+		}
+	}
+
+	return lanes, nil
+}
+
+// Validate checks the lane can receive events
+func (l *Lane) Validate() error {
+	if l.Name == "" || l.Name == DEFAULT_LANE {
+		return fmt.Errorf("name must be set and differ from %s", DEFAULT_LANE)
+	}
+
+	if l.Topic == "" && l.Header == "" && len(l.OrganizationIDs) == 0 {
+		return fmt.Errorf("a topic, a header or organizations must be set")
+	}
+
+	if l.HeaderValue != "" && l.Header == "" {
+		return fmt.Errorf("header value requires a header")
+	}
+
+	if l.Concurrency < 0 {
+		return fmt.Errorf("concurrency must be positive")
+	}
+
+	return nil
+}
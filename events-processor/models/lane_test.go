@@ -0,0 +1,45 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLanes(t *testing.T) {
+	t.Run("Without lanes", func(t *testing.T) {
+		lanes, err := ParseLanes("")
+		require.NoError(t, err)
+		assert.Empty(t, lanes)
+	})
+
+	t.Run("With valid lanes", func(t *testing.T) {
+		lanes, err := ParseLanes(`[
+			{"name": "in_advance", "topic": "events_raw_in_advance", "concurrency": 20, "header": "lago-pay-in-advance"},
+			{"name": "premium", "organization_ids": ["org_id"]}
+		]`)
+		require.NoError(t, err)
+
+		assert.Equal(t, []*Lane{
+			{Name: "in_advance", Topic: "events_raw_in_advance", Concurrency: 20, Header: "lago-pay-in-advance"},
+			{Name: "premium", OrganizationIDs: []string{"org_id"}},
+		}, lanes)
+	})
+
+	t.Run("With invalid lanes", func(t *testing.T) {
+		for _, raw := range []string{
+			`[{"topic": "events_raw_in_advance"}]`,
+			`[{"name": "default", "topic": "events_raw_in_advance"}]`,
+			`[{"name": "premium"}]`,
+			`[{"name": "premium", "header_value": "true", "organization_ids": ["org_id"]}]`,
+			`[{"name": "premium", "concurrency": -1, "organization_ids": ["org_id"]}]`,
+			`[{"name": "premium", "header": "lago-premium"}, {"name": "premium", "header": "lago-priority"}]`,
+			`[{"name": "premium", "topic": "events_raw_priority"}, {"name": "in_advance", "topic": "events_raw_priority"}]`,
+			`{"name": "premium"}`,
+		} {
+			_, err := ParseLanes(raw)
+			assert.Error(t, err, raw)
+		}
+	})
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+// Redis hash holding the frozen organizations, shared by all the processor instances
+const FROZEN_ORGANIZATIONS_KEY = "frozen_organizations"
+
+// OrganizationFreeze stops the processing of the events of an organization,
+// its events are held until the freeze is lifted
+type OrganizationFreeze struct {
+	OrganizationID string    `json:"organization_id"`
+	Reason         string    `json:"reason,omitempty"`
+	FrozenAt       time.Time `json:"frozen_at"`
+}
+
+type OrganizationFreezer interface {
+	Close() error
+	Freeze(ctx context.Context, freeze *OrganizationFreeze) utils.Result[bool]
+	Unfreeze(ctx context.Context, organizationID string) utils.Result[bool]
+	FrozenOrganizations(ctx context.Context) utils.Result[map[string]*OrganizationFreeze]
+}
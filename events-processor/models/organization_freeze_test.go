@@ -0,0 +1,71 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getlago/lago/events-processor/config/redis"
+)
+
+func setupFreezeStore(t *testing.T) (*FreezeStore, *miniredis.Miniredis) {
+	s := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	store := &FreezeStore{
+		db: &redis.RedisDB{Client: client},
+	}
+	return store, s
+}
+
+func TestFreezeStore(t *testing.T) {
+	ctx := context.Background()
+	frozenAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("With frozen organizations", func(t *testing.T) {
+		store, s := setupFreezeStore(t)
+
+		require.True(t, store.Freeze(ctx, &OrganizationFreeze{OrganizationID: "org_1", Reason: "migration", FrozenAt: frozenAt}).Success())
+		require.True(t, store.Freeze(ctx, &OrganizationFreeze{OrganizationID: "org_2", FrozenAt: frozenAt}).Success())
+		assert.True(t, s.Exists(FROZEN_ORGANIZATIONS_KEY))
+
+		result := store.FrozenOrganizations(ctx)
+		require.True(t, result.Success())
+		require.Len(t, result.Value(), 2)
+		assert.Equal(t, "migration", result.Value()["org_1"].Reason)
+		assert.Equal(t, frozenAt, result.Value()["org_1"].FrozenAt)
+
+		unfrozen := store.Unfreeze(ctx, "org_1")
+		require.True(t, unfrozen.Success())
+		assert.True(t, unfrozen.Value())
+
+		unfrozen = store.Unfreeze(ctx, "org_1")
+		require.True(t, unfrozen.Success())
+		assert.False(t, unfrozen.Value())
+
+		result = store.FrozenOrganizations(ctx)
+		require.True(t, result.Success())
+		assert.Len(t, result.Value(), 1)
+	})
+
+	t.Run("Without frozen organizations", func(t *testing.T) {
+		store, _ := setupFreezeStore(t)
+
+		result := store.FrozenOrganizations(ctx)
+		require.True(t, result.Success())
+		assert.Empty(t, result.Value())
+	})
+
+	t.Run("With a Redis error", func(t *testing.T) {
+		store, s := setupFreezeStore(t)
+		s.Close()
+
+		assert.False(t, store.Freeze(ctx, &OrganizationFreeze{OrganizationID: "org_1"}).Success())
+		assert.False(t, store.Unfreeze(ctx, "org_1").Success())
+		assert.False(t, store.FrozenOrganizations(ctx).Success())
+	})
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// OrganizationSelector restricts a processor instance to a subset of the organizations,
+// with an allowlist, a denylist and a shard of the organization ID hash range.
+// A nil selector selects every organization.
+type OrganizationSelector struct {
+	allowlist  map[string]bool
+	denylist   map[string]bool
+	shardIndex uint32
+	shardCount uint32
+}
+
+// NewOrganizationSelector builds a selector from the lists of organization IDs and a shard formatted as `<index>/<count>`.
+// It returns nil when nothing restricts the organizations.
+func NewOrganizationSelector(allowlist []string, denylist []string, shard string) (*OrganizationSelector, error) {
+	shardIndex, shardCount, err := parseOrganizationShard(shard)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(allowlist) == 0 && len(denylist) == 0 && shardCount <= 1 {
+		return nil, nil
+	}
+
+	selector := &OrganizationSelector{
+		allowlist:  make(map[string]bool, len(allowlist)),
+		denylist:   make(map[string]bool, len(denylist)),
+		shardIndex: shardIndex,
+		shardCount: shardCount,
+	}
+	for _, organizationID := range allowlist {
+		selector.allowlist[organizationID] = true
+	}
+	for _, organizationID := range denylist {
+		selector.denylist[organizationID] = true
+	}
+
+	return selector, nil
+}
+
+func parseOrganizationShard(shard string) (uint32, uint32, error) {
+	if shard == "" {
+		return 0, 1, nil
+	}
+
+	rawIndex, rawCount, found := strings.Cut(shard, "/")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid organization shard %s, expected <index>/<count>", shard)
+	}
+
+	index, err := strconv.ParseUint(rawIndex, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid organization shard index: %w", err)
+	}
+	count, err := strconv.ParseUint(rawCount, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid organization shard count: %w", err)
+	}
+	if count == 0 || index >= count {
+		return 0, 0, fmt.Errorf("invalid organization shard %s, the index must be lower than the count", shard)
+	}
+
+	return uint32(index), uint32(count), nil
+}
+
+// Selects returns true when the instance handles the organization
+func (s *OrganizationSelector) Selects(organizationID string) bool {
+	if s == nil {
+		return true
+	}
+
+	if s.denylist[organizationID] {
+		return false
+	}
+	if len(s.allowlist) > 0 && !s.allowlist[organizationID] {
+		return false
+	}
+	if s.shardCount > 1 && OrganizationShard(organizationID, s.shardCount) != s.shardIndex {
+		return false
+	}
+
+	return true
+}
+
+// OrganizationShard splits the 32 bits FNV-1a hash range of the organization IDs in count contiguous ranges,
+// and returns the index of the range holding the organization
+func OrganizationShard(organizationID string, count uint32) uint32 {
+	hash := fnv.New32a()
+	hash.Write([]byte(organizationID))
+
+	return uint32(uint64(hash.Sum32()) * uint64(count) >> 32)
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewOrganizationSelector(t *testing.T) {
+	t.Run("Without restriction", func(t *testing.T) {
+		selector, err := NewOrganizationSelector(nil, nil, "")
+		require.NoError(t, err)
+		assert.Nil(t, selector)
+		assert.True(t, selector.Selects("org_id"))
+
+		selector, err = NewOrganizationSelector(nil, nil, "0/1")
+		require.NoError(t, err)
+		assert.Nil(t, selector)
+	})
+
+	t.Run("With an allowlist and a denylist", func(t *testing.T) {
+		selector, err := NewOrganizationSelector([]string{"org_1", "org_2"}, []string{"org_2"}, "")
+		require.NoError(t, err)
+
+		assert.True(t, selector.Selects("org_1"))
+		assert.False(t, selector.Selects("org_2"))
+		assert.False(t, selector.Selects("org_3"))
+	})
+
+	t.Run("With a denylist only", func(t *testing.T) {
+		selector, err := NewOrganizationSelector(nil, []string{"org_1"}, "")
+		require.NoError(t, err)
+
+		assert.False(t, selector.Selects("org_1"))
+		assert.True(t, selector.Selects("org_2"))
+	})
+
+	t.Run("With shards", func(t *testing.T) {
+		shards := make([]*OrganizationSelector, 0, 4)
+		for _, shard := range []string{"0/4", "1/4", "2/4", "3/4"} {
+			selector, err := NewOrganizationSelector(nil, nil, shard)
+			require.NoError(t, err)
+			shards = append(shards, selector)
+		}
+
+		// Each organization belongs to exactly one shard
+		for _, organizationID := range []string{"org_1", "org_2", "org_3", "org_4", "org_5", "org_6", "org_7", "org_8"} {
+			selected := 0
+			for _, selector := range shards {
+				if selector.Selects(organizationID) {
+					selected++
+				}
+			}
+			assert.Equal(t, 1, selected, organizationID)
+			assert.Equal(t, int(OrganizationShard(organizationID, 4)), indexOfSelectingShard(shards, organizationID))
+		}
+	})
+
+	t.Run("With an invalid shard", func(t *testing.T) {
+		for _, shard := range []string{"1", "a/2", "1/b", "2/2", "0/0"} {
+			_, err := NewOrganizationSelector(nil, nil, shard)
+			assert.Error(t, err, shard)
+		}
+	})
+}
+
+func indexOfSelectingShard(shards []*OrganizationSelector, organizationID string) int {
+	for i, selector := range shards {
+		if selector.Selects(organizationID) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+type Organization struct {
+	ID        string         `gorm:"primaryKey;->" json:"id"`
+	Timezone  *string        `gorm:"->" json:"timezone"`
+	CreatedAt utils.NullTime `gorm:"->" json:"created_at"`
+	UpdatedAt utils.NullTime `gorm:"->" json:"updated_at"`
+}
+
+func (store *ApiStore) FetchOrganization(ID string) utils.Result[*Organization] {
+	var organization Organization
+	result := store.db.Connection.
+		First(&organization, "id = ?", ID)
+
+	if result.Error != nil {
+		return failedOrganizationResult(result.Error)
+	}
+
+	return utils.SuccessResult(&organization)
+}
+
+func GetAllOrganizations(db *gorm.DB) utils.Result[[]Organization] {
+	config := StreamQueryConfig{
+		TableName: "organizations",
+		SelectFields: []string{
+			"id",
+			"timezone",
+			"created_at",
+			"updated_at",
+		},
+		LogInterval: 50000,
+	}
+
+	return GetAllWithStreaming[Organization](db, config)
+}
+
+func failedOrganizationResult(err error) utils.Result[*Organization] {
+	result := utils.FailedResult[*Organization](err)
+
+	if err.Error() == gorm.ErrRecordNotFound.Error() {
+		result = result.NonCapturable().NonRetryable()
+	}
+
+	return result
+}
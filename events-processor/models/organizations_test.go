@@ -0,0 +1,76 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+var fetchOrganizationQuery = regexp.QuoteMeta(`
+	SELECT * FROM "organizations"
+	WHERE id = $1
+	ORDER BY "organizations"."id"
+	LIMIT $2`,
+)
+
+func TestFetchOrganization(t *testing.T) {
+	orgID := "1a901a90-1a90-1a90-1a90-1a901a901a90"
+
+	t.Run("should return organization when found", func(t *testing.T) {
+		store, mock, cleanup := setupApiStore(t)
+		defer cleanup()
+
+		now := time.Now()
+
+		columns := []string{"id", "timezone", "created_at", "updated_at"}
+		rows := sqlmock.NewRows(columns).
+			AddRow(orgID, "Asia/Tokyo", now, now)
+
+		mock.ExpectQuery(fetchOrganizationQuery).
+			WithArgs(orgID, 1).
+			WillReturnRows(rows)
+
+		result := store.FetchOrganization(orgID)
+
+		assert.True(t, result.Success())
+		assert.Equal(t, orgID, result.Value().ID)
+		assert.Equal(t, "Asia/Tokyo", *result.Value().Timezone)
+	})
+
+	t.Run("should return error when organization not found", func(t *testing.T) {
+		store, mock, cleanup := setupApiStore(t)
+		defer cleanup()
+
+		mock.ExpectQuery(fetchOrganizationQuery).
+			WithArgs(orgID, 1).
+			WillReturnError(gorm.ErrRecordNotFound)
+
+		result := store.FetchOrganization(orgID)
+
+		assert.False(t, result.Success())
+		assert.False(t, result.IsCapturable())
+		assert.False(t, result.IsRetryable())
+	})
+
+	t.Run("should handle database connection error", func(t *testing.T) {
+		store, mock, cleanup := setupApiStore(t)
+		defer cleanup()
+
+		dbError := errors.New("database connection failed")
+
+		mock.ExpectQuery(fetchOrganizationQuery).
+			WithArgs(orgID, 1).
+			WillReturnError(dbError)
+
+		result := store.FetchOrganization(orgID)
+
+		assert.False(t, result.Success())
+		assert.Equal(t, dbError, result.Error())
+		assert.True(t, result.IsCapturable())
+	})
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+type Plan struct {
+	ID             string         `gorm:"primaryKey;->" json:"id"`
+	OrganizationID string         `gorm:"->" json:"organization_id"`
+	Code           string         `gorm:"->" json:"code"`
+	AmountCurrency string         `gorm:"->" json:"amount_currency"`
+	Interval       PlanInterval   `gorm:"->" json:"interval"`
+	ParentID       *string        `gorm:"->" json:"parent_id"`
+	CreatedAt      utils.NullTime `gorm:"->" json:"created_at"`
+	UpdatedAt      utils.NullTime `gorm:"->" json:"updated_at"`
+	DeletedAt      utils.NullTime `gorm:"->" json:"deleted_at"`
+}
+
+// Deleted plans are still fetched to enrich the events of their terminated subscriptions
+func (store *ApiStore) FetchPlan(organizationID string, ID string) utils.Result[*Plan] {
+	var plan Plan
+	result := store.db.Connection.
+		Unscoped().
+		First(&plan, "organization_id = ? AND id = ?", organizationID, ID)
+
+	if result.Error != nil {
+		return failedPlanResult(result.Error)
+	}
+
+	return utils.SuccessResult(&plan)
+}
+
+// We select all active plans and plans deleted less than one month ago,
+// to match the subscriptions kept for the grace period events backfill
+func GetAllPlans(db *gorm.DB) utils.Result[[]Plan] {
+	oneMonthAgo := time.Now().AddDate(0, -1, 0)
+
+	config := StreamQueryConfig{
+		TableName: "plans",
+		SelectFields: []string{
+			"id",
+			"organization_id",
+			"code",
+			"amount_currency",
+			"interval",
+			"parent_id",
+			"created_at",
+			"updated_at",
+			"deleted_at",
+		},
+		WhereCondition: "deleted_at IS NULL OR deleted_at >= ?",
+		WhereArgs:      []any{oneMonthAgo},
+		LogInterval:    50000,
+	}
+
+	return GetAllWithStreaming[Plan](db, config)
+}
+
+func failedPlanResult(err error) utils.Result[*Plan] {
+	result := utils.FailedResult[*Plan](err)
+
+	if err.Error() == gorm.ErrRecordNotFound.Error() {
+		result = result.NonCapturable().NonRetryable()
+	}
+
+	return result
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+var fetchPlanQuery = regexp.QuoteMeta(`
+	SELECT * FROM "plans"
+	WHERE organization_id = $1 AND id = $2
+	ORDER BY "plans"."id"
+	LIMIT $3`,
+)
+
+func TestFetchPlan(t *testing.T) {
+	orgID := "1a901a90-1a90-1a90-1a90-1a901a901a90"
+	planID := "1a901a90-1a90-1a90-1a90-1a901a901a91"
+
+	t.Run("should return plan when found", func(t *testing.T) {
+		store, mock, cleanup := setupApiStore(t)
+		defer cleanup()
+
+		now := time.Now()
+
+		columns := []string{"id", "organization_id", "code", "amount_currency", "parent_id", "created_at", "updated_at", "deleted_at"}
+		rows := sqlmock.NewRows(columns).
+			AddRow(planID, orgID, "premium", "USD", nil, now, now, nil)
+
+		mock.ExpectQuery(fetchPlanQuery).
+			WithArgs(orgID, planID, 1).
+			WillReturnRows(rows)
+
+		result := store.FetchPlan(orgID, planID)
+
+		assert.True(t, result.Success())
+
+		plan := result.Value()
+		assert.Equal(t, planID, plan.ID)
+		assert.Equal(t, "premium", plan.Code)
+		assert.Equal(t, "USD", plan.AmountCurrency)
+		assert.Nil(t, plan.ParentID)
+	})
+
+	t.Run("should return error when plan not found", func(t *testing.T) {
+		store, mock, cleanup := setupApiStore(t)
+		defer cleanup()
+
+		mock.ExpectQuery(fetchPlanQuery).
+			WithArgs(orgID, planID, 1).
+			WillReturnError(gorm.ErrRecordNotFound)
+
+		result := store.FetchPlan(orgID, planID)
+
+		assert.False(t, result.Success())
+		assert.Equal(t, gorm.ErrRecordNotFound, result.Error())
+		assert.False(t, result.IsCapturable())
+		assert.False(t, result.IsRetryable())
+	})
+
+	t.Run("should handle database connection error", func(t *testing.T) {
+		store, mock, cleanup := setupApiStore(t)
+		defer cleanup()
+
+		dbError := errors.New("database connection failed")
+
+		mock.ExpectQuery(fetchPlanQuery).
+			WithArgs(orgID, planID, 1).
+			WillReturnError(dbError)
+
+		result := store.FetchPlan(orgID, planID)
+
+		assert.False(t, result.Success())
+		assert.Equal(t, dbError, result.Error())
+		assert.True(t, result.IsCapturable())
+		assert.True(t, result.IsRetryable())
+	})
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+// Redis hash holding the rate limit policies set at runtime, shared by all the processor instances
+const RATE_LIMIT_POLICIES_KEY = "rate_limit_policies"
+
+type RateLimitAction string
+
+const (
+	RateLimitOverflow     RateLimitAction = "overflow"
+	RateLimitDeprioritize RateLimitAction = "deprioritize"
+)
+
+// RateLimitPolicy limits the number of events processed per second for an organization with a token bucket.
+// The bucket holds up to Burst events and is refilled with Rate events per second.
+type RateLimitPolicy struct {
+	Rate   float64         `json:"rate"`
+	Burst  int64           `json:"burst"`
+	Action RateLimitAction `json:"action"`
+}
+
+type RateLimitPolicyStorer interface {
+	Close() error
+	SetPolicy(ctx context.Context, organizationID string, policy *RateLimitPolicy) utils.Result[bool]
+	DeletePolicy(ctx context.Context, organizationID string) utils.Result[bool]
+	Policies(ctx context.Context) utils.Result[map[string]*RateLimitPolicy]
+}
+
+// ParseRateLimitPolicies parses a JSON object of rate limit policies indexed by organization ID
+func ParseRateLimitPolicies(raw string) (map[string]*RateLimitPolicy, error) {
+	policies := make(map[string]*RateLimitPolicy)
+	if raw == "" {
+		return policies, nil
+	}
+
+	if err := json.Unmarshal([]byte(raw), &policies); err != nil {
+		return nil, err
+	}
+
+	for organizationID, policy := range policies {
+		if err := policy.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid rate limit policy for organization %s: %w", organizationID, err)
+		}
+	}
+
+	return policies, nil
+}
+
+// Validate checks the policy and sets the default action and burst
+func (p *RateLimitPolicy) Validate() error {
+	if p.Action == "" {
+		p.Action = RateLimitDeprioritize
+	}
+
+	switch p.Action {
+	case RateLimitOverflow, RateLimitDeprioritize:
+	default:
+		return fmt.Errorf("unknown action: %s", p.Action)
+	}
+
+	if p.Rate <= 0 {
+		return fmt.Errorf("rate must be positive")
+	}
+	if p.Burst < 0 {
+		return fmt.Errorf("burst must be positive")
+	}
+	if p.Burst == 0 {
+		p.Burst = int64(math.Max(1, math.Ceil(p.Rate)))
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getlago/lago/events-processor/config/redis"
+)
+
+func TestParseRateLimitPolicies(t *testing.T) {
+	t.Run("Without policies", func(t *testing.T) {
+		policies, err := ParseRateLimitPolicies("")
+		require.NoError(t, err)
+		assert.Empty(t, policies)
+	})
+
+	t.Run("With valid policies", func(t *testing.T) {
+		policies, err := ParseRateLimitPolicies(`{
+			"*": {"rate": 2.5},
+			"org_id": {"rate": 100, "burst": 500, "action": "overflow"}
+		}`)
+		require.NoError(t, err)
+		require.Len(t, policies, 2)
+
+		assert.Equal(t, &RateLimitPolicy{Rate: 2.5, Burst: 3, Action: RateLimitDeprioritize}, policies["*"])
+		assert.Equal(t, &RateLimitPolicy{Rate: 100, Burst: 500, Action: RateLimitOverflow}, policies["org_id"])
+	})
+
+	t.Run("With invalid policies", func(t *testing.T) {
+		for _, raw := range []string{
+			`{"*": {"rate": 0}}`,
+			`{"*": {"rate": 1, "burst": -1}}`,
+			`{"*": {"rate": 1, "action": "drop"}}`,
+			`{"*": "invalid"}`,
+		} {
+			_, err := ParseRateLimitPolicies(raw)
+			assert.Error(t, err, raw)
+		}
+	})
+}
+
+func setupRateLimitPolicyStore(t *testing.T) (*RateLimitPolicyStore, *miniredis.Miniredis) {
+	s := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	store := &RateLimitPolicyStore{
+		db: &redis.RedisDB{Client: client},
+	}
+	return store, s
+}
+
+func TestRateLimitPolicyStore(t *testing.T) {
+	ctx := context.Background()
+	t.Run("With stored policies", func(t *testing.T) {
+		store, s := setupRateLimitPolicyStore(t)
+
+		policy := &RateLimitPolicy{Rate: 5, Burst: 10, Action: RateLimitOverflow}
+		require.True(t, store.SetPolicy(ctx, "org_id", policy).Success())
+		require.True(t, store.SetPolicy(ctx, "*", &RateLimitPolicy{Rate: 1, Burst: 1, Action: RateLimitDeprioritize}).Success())
+		assert.True(t, s.Exists(RATE_LIMIT_POLICIES_KEY))
+
+		result := store.Policies(ctx)
+		require.True(t, result.Success())
+		require.Len(t, result.Value(), 2)
+		assert.Equal(t, policy, result.Value()["org_id"])
+
+		deleted := store.DeletePolicy(ctx, "org_id")
+		require.True(t, deleted.Success())
+		assert.True(t, deleted.Value())
+
+		deleted = store.DeletePolicy(ctx, "org_id")
+		require.True(t, deleted.Success())
+		assert.False(t, deleted.Value())
+	})
+
+	t.Run("With a Redis error", func(t *testing.T) {
+		store, s := setupRateLimitPolicyStore(t)
+		s.Close()
+
+		assert.False(t, store.SetPolicy(ctx, "org_id", &RateLimitPolicy{Rate: 1}).Success())
+		assert.False(t, store.DeletePolicy(ctx, "org_id").Success())
+		assert.False(t, store.Policies(ctx).Success())
+	})
+}
@@ -2,7 +2,11 @@ package models
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
 	"time"
 
 	goredis "github.com/redis/go-redis/v9"
@@ -26,20 +30,18 @@ func NewApiStore(db *database.DB) *ApiStore {
 }
 
 type FlagStore struct {
-	name    string
-	context context.Context
-	db      *redis.RedisDB
+	name string
+	db   *redis.RedisDB
 }
 
 type Flagger interface {
-	Flag(value string) error
+	Flag(ctx context.Context, value string) error
 }
 
-func NewFlagStore(ctx context.Context, redis *redis.RedisDB, name string) *FlagStore {
+func NewFlagStore(redis *redis.RedisDB, name string) *FlagStore {
 	return &FlagStore{
-		name:    name,
-		context: ctx,
-		db:      redis,
+		name: name,
+		db:   redis,
 	}
 }
 
@@ -49,13 +51,13 @@ func NewFlagStore(ctx context.Context, redis *redis.RedisDB, name string) *FlagS
 // score to the latest event, waiting after the last event in that window.
 // Once the window elapses, new events create a new member, ensuring the
 // previous one ages out and gets picked up by the consumer (no starvation).
-func (store *FlagStore) Flag(value string) error {
+func (store *FlagStore) Flag(ctx context.Context, value string) error {
 	now := time.Now().Unix()
 
 	// Calculate the bucket (time window) for the event
 	bucket := (now / SUBSCRIPTION_BUCKET_DURATION) * SUBSCRIPTION_BUCKET_DURATION
 
-	result := store.db.Client.ZAdd(store.context, store.name, goredis.Z{
+	result := store.db.Client.ZAdd(ctx, store.name, goredis.Z{
 		Score:  float64(now),
 		Member: fmt.Sprintf("%s|%d", value, bucket),
 	})
@@ -72,18 +74,16 @@ func (store *FlagStore) Close() error {
 
 type Cacher interface {
 	Close() error
-	ExpireKey(key string) utils.Result[bool]
+	ExpireKey(ctx context.Context, key string) utils.Result[bool]
 }
 
 type CacheStore struct {
-	context context.Context
-	db      *redis.RedisDB
+	db *redis.RedisDB
 }
 
-func NewCacheStore(ctx context.Context, redis *redis.RedisDB) *CacheStore {
+func NewCacheStore(redis *redis.RedisDB) *CacheStore {
 	return &CacheStore{
-		context: ctx,
-		db:      redis,
+		db: redis,
 	}
 }
 
@@ -91,12 +91,348 @@ func (store *CacheStore) Close() error {
 	return store.db.Client.Close()
 }
 
-func (store *CacheStore) ExpireKey(key string) utils.Result[bool] {
+func (store *CacheStore) ExpireKey(ctx context.Context, key string) utils.Result[bool] {
 	// Uses Expire command rather than Del to take clickhouse propagation time into account
-	res := store.db.Client.Expire(store.context, key, EXPIRATION_TIME)
+	res := store.db.Client.Expire(ctx, key, EXPIRATION_TIME)
 	if err := res.Err(); err != nil {
 		return utils.FailedBoolResult(err)
 	}
 
 	return utils.SuccessResult(true)
 }
+
+// Increments the usage aggregates of an event in a single round trip, and returns the aggregates before the event.
+// The event key is set first, an event already aggregated is ignored.
+var usageIncrementScript = goredis.NewScript(`
+if not redis.call('SET', KEYS[3], '1', 'NX', 'PXAT', ARGV[1]) then
+	return {0}
+end
+
+local previousEvents = redis.call('HGET', KEYS[1], 'events') or '0'
+local previousSum = redis.call('HGET', KEYS[1], 'sum') or '0'
+local previousUnique = 0
+local uniqueAdded = 0
+
+redis.call('HINCRBY', KEYS[1], 'events', 1)
+
+if ARGV[2] ~= '' then
+	redis.call('HINCRBYFLOAT', KEYS[1], 'sum', ARGV[2])
+end
+
+if ARGV[3] ~= '' then
+	local max = redis.call('HGET', KEYS[1], 'max')
+	if not max or tonumber(ARGV[3]) > tonumber(max) then
+		redis.call('HSET', KEYS[1], 'max', ARGV[3])
+	end
+end
+
+if ARGV[4] ~= '' then
+	local latestTimestamp = redis.call('HGET', KEYS[1], 'latest_timestamp')
+	if not latestTimestamp or tonumber(ARGV[5]) >= tonumber(latestTimestamp) then
+		redis.call('HSET', KEYS[1], 'latest', ARGV[4], 'latest_timestamp', ARGV[5])
+	end
+end
+
+redis.call('PEXPIREAT', KEYS[1], ARGV[1])
+
+if ARGV[6] ~= '' then
+	previousUnique = redis.call('PFCOUNT', KEYS[2])
+	redis.call('PFADD', KEYS[2], ARGV[6])
+	uniqueAdded = redis.call('PFCOUNT', KEYS[2]) - previousUnique
+	redis.call('PEXPIREAT', KEYS[2], ARGV[1])
+end
+
+return {1, previousEvents, previousSum, previousUnique, uniqueAdded}
+`)
+
+type UsageStore struct {
+	db *redis.RedisDB
+}
+
+func NewUsageStore(redis *redis.RedisDB) *UsageStore {
+	return &UsageStore{
+		db: redis,
+	}
+}
+
+func (store *UsageStore) Close() error {
+	return store.db.Client.Close()
+}
+
+func (store *UsageStore) Increment(ctx context.Context, increment *UsageIncrement) utils.Result[*UsageIncrementResult] {
+	optional := func(value *string) string {
+		if value == nil {
+			return ""
+		}
+		return *value
+	}
+
+	res := usageIncrementScript.Run(
+		ctx,
+		store.db.Client,
+		[]string{increment.Key, increment.UniqueKey, increment.EventKey},
+		increment.ExpireAt.UnixMilli(),
+		optional(increment.Sum),
+		optional(increment.Max),
+		optional(increment.Latest),
+		fmt.Sprintf("%f", increment.Timestamp),
+		optional(increment.Unique),
+	)
+
+	values, err := res.Slice()
+	if err != nil {
+		return utils.FailedResult[*UsageIncrementResult](err)
+	}
+
+	if len(values) == 1 {
+		return utils.SuccessResult(&UsageIncrementResult{Aggregated: false})
+	}
+	if len(values) != 5 {
+		return utils.FailedResult[*UsageIncrementResult](fmt.Errorf("unexpected usage increment result: %v", values))
+	}
+
+	integers := make([]int64, 0, 3)
+	for _, value := range []any{values[1], values[3], values[4]} {
+		integer, err := strconv.ParseInt(fmt.Sprint(value), 10, 64)
+		if err != nil {
+			return utils.FailedResult[*UsageIncrementResult](err)
+		}
+		integers = append(integers, integer)
+	}
+
+	return utils.SuccessResult(&UsageIncrementResult{
+		Aggregated:     true,
+		PreviousEvents: integers[0],
+		PreviousSum:    fmt.Sprint(values[2]),
+		PreviousUnique: integers[1],
+		UniqueAdded:    integers[2] > 0,
+	})
+}
+
+// Increments the fields of the totals hash in a single round trip, and returns their new values
+var thresholdTotalsScript = goredis.NewScript(`
+local totals = {}
+for i = 2, #ARGV, 2 do
+	totals[#totals + 1] = redis.call('HINCRBYFLOAT', KEYS[1], ARGV[i], ARGV[i + 1])
+end
+
+redis.call('PEXPIREAT', KEYS[1], ARGV[1])
+
+return totals
+`)
+
+type ThresholdStore struct {
+	db *redis.RedisDB
+}
+
+func NewThresholdStore(redis *redis.RedisDB) *ThresholdStore {
+	return &ThresholdStore{
+		db: redis,
+	}
+}
+
+func (store *ThresholdStore) Close() error {
+	return store.db.Client.Close()
+}
+
+func (store *ThresholdStore) IncrementTotals(ctx context.Context, key string, expireAt time.Time, increments map[string]*big.Rat) utils.Result[map[string]*big.Rat] {
+	fields := make([]string, 0, len(increments))
+	for field := range increments {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	args := []any{expireAt.UnixMilli()}
+	for _, field := range fields {
+		args = append(args, field, decimalString(increments[field]))
+	}
+
+	values, err := thresholdTotalsScript.Run(ctx, store.db.Client, []string{key}, args...).StringSlice()
+	if err != nil {
+		return utils.FailedResult[map[string]*big.Rat](err)
+	}
+	if len(values) != len(fields) {
+		return utils.FailedResult[map[string]*big.Rat](fmt.Errorf("unexpected threshold totals result: %v", values))
+	}
+
+	totals := make(map[string]*big.Rat, len(fields))
+	for i, field := range fields {
+		total, ok := new(big.Rat).SetString(values[i])
+		if !ok {
+			return utils.FailedResult[map[string]*big.Rat](fmt.Errorf("invalid total %s for field %s", values[i], field))
+		}
+		totals[field] = total
+	}
+
+	return utils.SuccessResult(totals)
+}
+
+func (store *ThresholdStore) MarkCrossed(ctx context.Context, key string, expireAt time.Time) utils.Result[bool] {
+	res := store.db.Client.SetArgs(ctx, key, "1", goredis.SetArgs{Mode: "NX", ExpireAt: expireAt})
+	if err := res.Err(); err != nil {
+		if err == goredis.Nil {
+			return utils.SuccessResult(false)
+		}
+		return utils.FailedBoolResult(err)
+	}
+
+	return utils.SuccessResult(true)
+}
+
+// Adds a group to a set bounded to ARGV[2] members, known groups are always accepted
+var cardinalityTrackScript = goredis.NewScript(`
+if redis.call('SISMEMBER', KEYS[1], ARGV[1]) == 1 then
+	return 1
+end
+
+if redis.call('SCARD', KEYS[1]) >= tonumber(ARGV[2]) then
+	return 0
+end
+
+redis.call('SADD', KEYS[1], ARGV[1])
+redis.call('PEXPIREAT', KEYS[1], ARGV[3])
+
+return 1
+`)
+
+// CardinalityStore tracks the pricing groups of the charges in Redis sets.
+// The sets never hold more groups than the limit, so the groups over the limit don't use any memory.
+type CardinalityStore struct {
+	db *redis.RedisDB
+}
+
+func NewCardinalityStore(redis *redis.RedisDB) *CardinalityStore {
+	return &CardinalityStore{
+		db: redis,
+	}
+}
+
+func (store *CardinalityStore) Close() error {
+	return store.db.Client.Close()
+}
+
+func (store *CardinalityStore) TrackGroup(ctx context.Context, key string, group string, maxGroups int64, expireAt time.Time) utils.Result[bool] {
+	accepted, err := cardinalityTrackScript.Run(
+		ctx,
+		store.db.Client,
+		[]string{key},
+		group,
+		maxGroups,
+		expireAt.UnixMilli(),
+	).Int()
+	if err != nil {
+		return utils.FailedBoolResult(err)
+	}
+
+	return utils.SuccessResult(accepted == 1)
+}
+
+// FreezeStore keeps the frozen organizations in a Redis hash indexed by organization ID
+type FreezeStore struct {
+	db *redis.RedisDB
+}
+
+func NewFreezeStore(redis *redis.RedisDB) *FreezeStore {
+	return &FreezeStore{
+		db: redis,
+	}
+}
+
+func (store *FreezeStore) Close() error {
+	return store.db.Client.Close()
+}
+
+func (store *FreezeStore) Freeze(ctx context.Context, freeze *OrganizationFreeze) utils.Result[bool] {
+	data, err := json.Marshal(freeze)
+	if err != nil {
+		return utils.FailedBoolResult(err)
+	}
+
+	if err := store.db.Client.HSet(ctx, FROZEN_ORGANIZATIONS_KEY, freeze.OrganizationID, data).Err(); err != nil {
+		return utils.FailedBoolResult(err)
+	}
+
+	return utils.SuccessResult(true)
+}
+
+func (store *FreezeStore) Unfreeze(ctx context.Context, organizationID string) utils.Result[bool] {
+	deleted, err := store.db.Client.HDel(ctx, FROZEN_ORGANIZATIONS_KEY, organizationID).Result()
+	if err != nil {
+		return utils.FailedBoolResult(err)
+	}
+
+	return utils.SuccessResult(deleted > 0)
+}
+
+func (store *FreezeStore) FrozenOrganizations(ctx context.Context) utils.Result[map[string]*OrganizationFreeze] {
+	values, err := store.db.Client.HGetAll(ctx, FROZEN_ORGANIZATIONS_KEY).Result()
+	if err != nil {
+		return utils.FailedResult[map[string]*OrganizationFreeze](err)
+	}
+
+	freezes := make(map[string]*OrganizationFreeze, len(values))
+	for organizationID, value := range values {
+		freeze := &OrganizationFreeze{}
+		if err := json.Unmarshal([]byte(value), freeze); err != nil {
+			return utils.FailedResult[map[string]*OrganizationFreeze](err)
+		}
+		freezes[organizationID] = freeze
+	}
+
+	return utils.SuccessResult(freezes)
+}
+
+// RateLimitPolicyStore keeps the rate limit policies set at runtime in a Redis hash indexed by organization ID
+type RateLimitPolicyStore struct {
+	db *redis.RedisDB
+}
+
+func NewRateLimitPolicyStore(redis *redis.RedisDB) *RateLimitPolicyStore {
+	return &RateLimitPolicyStore{
+		db: redis,
+	}
+}
+
+func (store *RateLimitPolicyStore) Close() error {
+	return store.db.Client.Close()
+}
+
+func (store *RateLimitPolicyStore) SetPolicy(ctx context.Context, organizationID string, policy *RateLimitPolicy) utils.Result[bool] {
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return utils.FailedBoolResult(err)
+	}
+
+	if err := store.db.Client.HSet(ctx, RATE_LIMIT_POLICIES_KEY, organizationID, data).Err(); err != nil {
+		return utils.FailedBoolResult(err)
+	}
+
+	return utils.SuccessResult(true)
+}
+
+func (store *RateLimitPolicyStore) DeletePolicy(ctx context.Context, organizationID string) utils.Result[bool] {
+	deleted, err := store.db.Client.HDel(ctx, RATE_LIMIT_POLICIES_KEY, organizationID).Result()
+	if err != nil {
+		return utils.FailedBoolResult(err)
+	}
+
+	return utils.SuccessResult(deleted > 0)
+}
+
+func (store *RateLimitPolicyStore) Policies(ctx context.Context) utils.Result[map[string]*RateLimitPolicy] {
+	values, err := store.db.Client.HGetAll(ctx, RATE_LIMIT_POLICIES_KEY).Result()
+	if err != nil {
+		return utils.FailedResult[map[string]*RateLimitPolicy](err)
+	}
+
+	policies := make(map[string]*RateLimitPolicy, len(values))
+	for organizationID, value := range values {
+		policy := &RateLimitPolicy{}
+		if err := json.Unmarshal([]byte(value), policy); err != nil {
+			return utils.FailedResult[map[string]*RateLimitPolicy](err)
+		}
+		policies[organizationID] = policy
+	}
+
+	return utils.SuccessResult(policies)
+}
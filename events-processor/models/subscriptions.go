@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"sync"
 	"time"
 
@@ -14,7 +15,10 @@ type Subscription struct {
 	ID             string         `gorm:"primaryKey;->" json:"id"`
 	OrganizationID *string        `gorm:"->" json:"organization_id"`
 	ExternalID     string         `gorm:"->" json:"external_id"`
+	CustomerID     string         `gorm:"->" json:"customer_id"`
 	PlanID         string         `gorm:"->" json:"plan_id"`
+	BillingTime    BillingTime    `gorm:"->" json:"billing_time"`
+	SubscriptionAt utils.NullTime `gorm:"->" json:"subscription_at"`
 	CreatedAt      utils.NullTime `gorm:"->" json:"created_at"`
 	UpdatedAt      utils.NullTime `gorm:"->" json:"updated_at"`
 	StartedAt      utils.NullTime `gorm:"->" json:"started_at"`
@@ -51,6 +55,32 @@ func (store *ApiStore) FetchSubscription(organizationID string, externalID strin
 	return utils.SuccessResult(&sub)
 }
 
+// FetchCustomerSubscriptions returns the subscriptions of a customer active at the given timestamp,
+// at most one per subscription external ID, ordered by external ID
+func (store *ApiStore) FetchCustomerSubscriptions(organizationID string, customerID string, timestamp time.Time) utils.Result[[]*Subscription] {
+	var subs []*Subscription
+
+	var conditions = `
+		subscriptions.organization_id = ?
+		AND subscriptions.customer_id = ?
+		AND date_trunc('millisecond', subscriptions.started_at::timestamp) <= ?::timestamp
+		AND (subscriptions.terminated_at IS NULL OR date_trunc('millisecond', subscriptions.terminated_at::timestamp) >= ?)
+	`
+	result := store.db.Connection.
+		Table("subscriptions").
+		Select("DISTINCT ON (subscriptions.external_id) "+strings.Join(subscriptionSchema.DBNames, ", ")).
+		Unscoped().
+		Where(conditions, organizationID, customerID, timestamp, timestamp).
+		Order("external_id, terminated_at DESC NULLS FIRST, started_at DESC").
+		Find(&subs)
+
+	if result.Error != nil {
+		return utils.FailedResult[[]*Subscription](result.Error)
+	}
+
+	return utils.SuccessResult(subs)
+}
+
 // We want to get terminated subscriptions to permit grace period events backfill
 // So we select all non terminated subscriptions and subs terminated less that one month ago
 func GetAllSubscriptions(db *gorm.DB) utils.Result[[]Subscription] {
@@ -62,7 +92,10 @@ func GetAllSubscriptions(db *gorm.DB) utils.Result[[]Subscription] {
 			"id",
 			"organization_id",
 			"external_id",
+			"customer_id",
 			"plan_id",
+			"billing_time",
+			"subscription_at",
 			"created_at",
 			"updated_at",
 			"started_at",
@@ -12,7 +12,7 @@ import (
 )
 
 var fetchSubscriptionQuery = regexp.QuoteMeta(`
-	SELECT "id","organization_id","external_id","plan_id","created_at","updated_at","started_at","terminated_at"
+	SELECT "id","organization_id","external_id","customer_id","plan_id","billing_time","subscription_at","created_at","updated_at","started_at","terminated_at"
 	FROM "subscriptions"
 	WHERE subscriptions.organization_id = $1
 		AND subscriptions.external_id = $2
@@ -107,3 +107,57 @@ func TestFetchSubscription(t *testing.T) {
 		assert.True(t, result.IsRetryable())
 	})
 }
+
+func TestFetchCustomerSubscriptions(t *testing.T) {
+	query := regexp.QuoteMeta(`
+		SELECT DISTINCT ON (subscriptions.external_id) id, organization_id, external_id, customer_id, plan_id, billing_time, subscription_at, created_at, updated_at, started_at, terminated_at
+		FROM "subscriptions"
+		WHERE subscriptions.organization_id = $1
+			AND subscriptions.customer_id = $2
+			AND date_trunc('millisecond', subscriptions.started_at::timestamp) <= $3::timestamp
+			AND (subscriptions.terminated_at IS NULL OR date_trunc('millisecond', subscriptions.terminated_at::timestamp) >= $4)
+		ORDER BY external_id, terminated_at DESC NULLS FIRST, started_at DESC`,
+	)
+
+	orgID := "1a901a90-1a90-1a90-1a90-1a901a901a90"
+	customerID := "1a901a90-1a90-1a90-1a90-1a901a901a91"
+
+	t.Run("should return the active subscriptions of the customer", func(t *testing.T) {
+		store, mock, cleanup := setupApiStore(t)
+		defer cleanup()
+
+		timestamp := time.Now()
+
+		rows := sqlmock.NewRows([]string{"id", "organization_id", "external_id", "customer_id", "plan_id"}).
+			AddRow("sub1", orgID, "sub_external_1", customerID, "plan1").
+			AddRow("sub2", orgID, "sub_external_2", customerID, "plan2")
+
+		mock.ExpectQuery(query).
+			WithArgs(orgID, customerID, timestamp, timestamp).
+			WillReturnRows(rows)
+
+		result := store.FetchCustomerSubscriptions(orgID, customerID, timestamp)
+
+		assert.True(t, result.Success())
+		assert.Equal(t, 2, len(result.Value()))
+		assert.Equal(t, "sub1", result.Value()[0].ID)
+		assert.Equal(t, "plan2", result.Value()[1].PlanID)
+	})
+
+	t.Run("should handle database connection error", func(t *testing.T) {
+		store, mock, cleanup := setupApiStore(t)
+		defer cleanup()
+
+		timestamp := time.Now()
+		dbError := errors.New("database connection failed")
+
+		mock.ExpectQuery(query).
+			WithArgs(orgID, customerID, timestamp, timestamp).
+			WillReturnError(dbError)
+
+		result := store.FetchCustomerSubscriptions(orgID, customerID, timestamp)
+
+		assert.False(t, result.Success())
+		assert.True(t, result.IsRetryable())
+	})
+}
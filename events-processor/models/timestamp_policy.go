@@ -0,0 +1,179 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type TimestampPolicyAction string
+
+const (
+	TimestampPolicyAccept     TimestampPolicyAction = "accept"
+	TimestampPolicyClamp      TimestampPolicyAction = "clamp"
+	TimestampPolicyRoute      TimestampPolicyAction = "route"
+	TimestampPolicyDeadLetter TimestampPolicyAction = "dead_letter"
+)
+
+type LatenessReference string
+
+const (
+	LatenessFromIngestedAt    LatenessReference = "ingested_at"
+	LatenessFromBillingPeriod LatenessReference = "billing_period"
+)
+
+type TimestampViolation string
+
+const (
+	TimestampViolationFuture TimestampViolation = "future"
+	TimestampViolationLate   TimestampViolation = "late"
+)
+
+// PolicyDuration is a duration expressed as a Go duration string in JSON (eg: "36h", "15m")
+type PolicyDuration struct {
+	time.Duration
+}
+
+func (d *PolicyDuration) UnmarshalJSON(b []byte) error {
+	var value string
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	if duration < 0 {
+		return fmt.Errorf("negative duration: %s", value)
+	}
+
+	d.Duration = duration
+	return nil
+}
+
+func (d PolicyDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// TimestampPolicy defines how events dated too far in the future or too late are handled.
+// A nil duration disables the matching check.
+type TimestampPolicy struct {
+	// Maximum duration between the ingestion time and an event dated in the future
+	MaxFutureSkew *PolicyDuration       `json:"max_future_skew"`
+	FutureAction  TimestampPolicyAction `json:"future_action"`
+
+	// Maximum lateness of an event, measured from its timestamp (ingested_at reference)
+	// or from the end of its billing period (billing_period reference) to the ingestion time
+	MaxLateness       *PolicyDuration       `json:"max_lateness"`
+	LatenessReference LatenessReference     `json:"lateness_reference"`
+	LateAction        TimestampPolicyAction `json:"late_action"`
+}
+
+// TimestampPolicyDecision describes a policy violation and the action taken for the event
+type TimestampPolicyDecision struct {
+	Violation         TimestampViolation    `json:"violation"`
+	Action            TimestampPolicyAction `json:"action"`
+	Limit             time.Time             `json:"limit"`
+	OriginalTimestamp float64               `json:"original_timestamp"`
+}
+
+// ParseTimestampPolicies parses a JSON object of timestamp policies indexed by organization ID
+func ParseTimestampPolicies(raw string) (map[string]*TimestampPolicy, error) {
+	policies := make(map[string]*TimestampPolicy)
+	if raw == "" {
+		return policies, nil
+	}
+
+	if err := json.Unmarshal([]byte(raw), &policies); err != nil {
+		return nil, err
+	}
+
+	for organizationID, policy := range policies {
+		if err := policy.validate(); err != nil {
+			return nil, fmt.Errorf("invalid timestamp policy for organization %s: %w", organizationID, err)
+		}
+	}
+
+	return policies, nil
+}
+
+func (p *TimestampPolicy) validate() error {
+	if p.FutureAction == "" {
+		p.FutureAction = TimestampPolicyAccept
+	}
+	if p.LateAction == "" {
+		p.LateAction = TimestampPolicyAccept
+	}
+	if p.LatenessReference == "" {
+		p.LatenessReference = LatenessFromIngestedAt
+	}
+
+	for _, action := range []TimestampPolicyAction{p.FutureAction, p.LateAction} {
+		switch action {
+		case TimestampPolicyAccept, TimestampPolicyClamp, TimestampPolicyRoute, TimestampPolicyDeadLetter:
+		default:
+			return fmt.Errorf("unknown action: %s", action)
+		}
+	}
+
+	switch p.LatenessReference {
+	case LatenessFromIngestedAt, LatenessFromBillingPeriod:
+	default:
+		return fmt.Errorf("unknown lateness reference: %s", p.LatenessReference)
+	}
+
+	return nil
+}
+
+// Routes returns true when the policy sends events to the late events topic
+func (p *TimestampPolicy) Routes() bool {
+	return p.FutureAction == TimestampPolicyRoute || p.LateAction == TimestampPolicyRoute
+}
+
+// CheckIngestionTime returns the violation of the policy when the event is too far in the future
+// or, with the ingested_at reference, too late compared to its ingestion time.
+// It returns nil when the event complies with the policy.
+func (p *TimestampPolicy) CheckIngestionTime(at time.Time, ingestedAt time.Time) *TimestampPolicyDecision {
+	if p.MaxFutureSkew != nil {
+		limit := ingestedAt.Add(p.MaxFutureSkew.Duration)
+		if at.After(limit) {
+			return &TimestampPolicyDecision{Violation: TimestampViolationFuture, Action: p.FutureAction, Limit: limit}
+		}
+	}
+
+	if p.MaxLateness != nil && p.LatenessReference == LatenessFromIngestedAt {
+		limit := ingestedAt.Add(-p.MaxLateness.Duration)
+		if at.Before(limit) {
+			return &TimestampPolicyDecision{Violation: TimestampViolationLate, Action: p.LateAction, Limit: limit}
+		}
+	}
+
+	return nil
+}
+
+// CheckBillingPeriod returns the violation of the policy when, with the billing_period reference,
+// the billing period of the event ended more than the max lateness before the ingestion time.
+// The limit is the start of the earliest billing period still accepting events.
+// It returns nil when the event complies with the policy or when the billing period can't be computed.
+func (p *TimestampPolicy) CheckBillingPeriod(sub *Subscription, plan *Plan, timezone string, at time.Time, ingestedAt time.Time) *TimestampPolicyDecision {
+	if p.MaxLateness == nil || p.LatenessReference != LatenessFromBillingPeriod {
+		return nil
+	}
+
+	period := ComputeBillingPeriod(sub, plan, timezone, at)
+	if period == nil {
+		return nil
+	}
+
+	threshold := ingestedAt.Add(-p.MaxLateness.Duration)
+	if !period.End.Before(threshold) {
+		return nil
+	}
+
+	return &TimestampPolicyDecision{
+		Violation: TimestampViolationLate,
+		Action:    p.LateAction,
+		Limit:     ComputeBillingPeriod(sub, plan, timezone, threshold).Start,
+	}
+}
@@ -0,0 +1,169 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+func TestParseTimestampPolicies(t *testing.T) {
+	t.Run("Without policies", func(t *testing.T) {
+		policies, err := ParseTimestampPolicies("")
+		require.NoError(t, err)
+		assert.Empty(t, policies)
+	})
+
+	t.Run("With valid policies", func(t *testing.T) {
+		policies, err := ParseTimestampPolicies(`{
+			"*": {"max_future_skew": "24h", "future_action": "dead_letter"},
+			"org_id": {"max_lateness": "0s", "lateness_reference": "billing_period", "late_action": "route"}
+		}`)
+		require.NoError(t, err)
+		require.Len(t, policies, 2)
+
+		defaultPolicy := policies["*"]
+		assert.Equal(t, 24*time.Hour, defaultPolicy.MaxFutureSkew.Duration)
+		assert.Equal(t, TimestampPolicyDeadLetter, defaultPolicy.FutureAction)
+		assert.Nil(t, defaultPolicy.MaxLateness)
+		assert.Equal(t, TimestampPolicyAccept, defaultPolicy.LateAction)
+		assert.Equal(t, LatenessFromIngestedAt, defaultPolicy.LatenessReference)
+		assert.False(t, defaultPolicy.Routes())
+
+		orgPolicy := policies["org_id"]
+		assert.Nil(t, orgPolicy.MaxFutureSkew)
+		assert.Equal(t, time.Duration(0), orgPolicy.MaxLateness.Duration)
+		assert.Equal(t, LatenessFromBillingPeriod, orgPolicy.LatenessReference)
+		assert.True(t, orgPolicy.Routes())
+	})
+
+	t.Run("With invalid policies", func(t *testing.T) {
+		invalidPolicies := []string{
+			`[]`,
+			`{"*": {"max_future_skew": "one day"}}`,
+			`{"*": {"max_future_skew": "-1h"}}`,
+			`{"*": {"future_action": "drop"}}`,
+			`{"*": {"lateness_reference": "created_at"}}`,
+		}
+
+		for _, raw := range invalidPolicies {
+			_, err := ParseTimestampPolicies(raw)
+			assert.Error(t, err, raw)
+		}
+	})
+}
+
+func TestCheckIngestionTime(t *testing.T) {
+	ingestedAt := mustParseTime(t, "2025-03-15T12:00:00Z")
+
+	policy := &TimestampPolicy{
+		MaxFutureSkew:     &PolicyDuration{time.Hour},
+		FutureAction:      TimestampPolicyClamp,
+		MaxLateness:       &PolicyDuration{48 * time.Hour},
+		LatenessReference: LatenessFromIngestedAt,
+		LateAction:        TimestampPolicyRoute,
+	}
+
+	t.Run("Within the limits", func(t *testing.T) {
+		assert.Nil(t, policy.CheckIngestionTime(ingestedAt.Add(time.Hour), ingestedAt))
+		assert.Nil(t, policy.CheckIngestionTime(ingestedAt.Add(-48*time.Hour), ingestedAt))
+	})
+
+	t.Run("With an event in the future", func(t *testing.T) {
+		decision := policy.CheckIngestionTime(ingestedAt.Add(61*time.Minute), ingestedAt)
+		require.NotNil(t, decision)
+		assert.Equal(t, TimestampViolationFuture, decision.Violation)
+		assert.Equal(t, TimestampPolicyClamp, decision.Action)
+		assert.Equal(t, ingestedAt.Add(time.Hour), decision.Limit)
+	})
+
+	t.Run("With a late event", func(t *testing.T) {
+		decision := policy.CheckIngestionTime(ingestedAt.Add(-49*time.Hour), ingestedAt)
+		require.NotNil(t, decision)
+		assert.Equal(t, TimestampViolationLate, decision.Violation)
+		assert.Equal(t, TimestampPolicyRoute, decision.Action)
+		assert.Equal(t, ingestedAt.Add(-48*time.Hour), decision.Limit)
+	})
+
+	t.Run("With the billing period reference", func(t *testing.T) {
+		billingPeriodPolicy := *policy
+		billingPeriodPolicy.LatenessReference = LatenessFromBillingPeriod
+
+		assert.Nil(t, billingPeriodPolicy.CheckIngestionTime(ingestedAt.Add(-49*time.Hour), ingestedAt))
+	})
+}
+
+func TestCheckBillingPeriod(t *testing.T) {
+	sub := &Subscription{
+		BillingTime: BillingTimeCalendar,
+		StartedAt:   utils.NewNullTime(mustParseTime(t, "2024-01-10T00:00:00Z")),
+	}
+	plan := &Plan{Interval: PlanIntervalMonthly}
+	ingestedAt := mustParseTime(t, "2025-03-02T12:00:00Z")
+
+	policy := &TimestampPolicy{
+		MaxLateness:       &PolicyDuration{0},
+		LatenessReference: LatenessFromBillingPeriod,
+		LateAction:        TimestampPolicyClamp,
+	}
+
+	t.Run("With an event in the current billing period", func(t *testing.T) {
+		assert.Nil(t, policy.CheckBillingPeriod(sub, plan, "UTC", mustParseTime(t, "2025-03-01T00:00:00Z"), ingestedAt))
+	})
+
+	t.Run("With an event in a closed billing period", func(t *testing.T) {
+		decision := policy.CheckBillingPeriod(sub, plan, "UTC", mustParseTime(t, "2025-02-28T23:59:59Z"), ingestedAt)
+		require.NotNil(t, decision)
+		assert.Equal(t, TimestampViolationLate, decision.Violation)
+		assert.Equal(t, TimestampPolicyClamp, decision.Action)
+		assert.Equal(t, mustParseTime(t, "2025-03-01T00:00:00Z"), decision.Limit)
+	})
+
+	t.Run("With a grace period", func(t *testing.T) {
+		gracePolicy := *policy
+		gracePolicy.MaxLateness = &PolicyDuration{72 * time.Hour}
+
+		assert.Nil(t, gracePolicy.CheckBillingPeriod(sub, plan, "UTC", mustParseTime(t, "2025-02-10T00:00:00Z"), ingestedAt))
+
+		decision := gracePolicy.CheckBillingPeriod(sub, plan, "UTC", mustParseTime(t, "2025-01-31T00:00:00Z"), ingestedAt)
+		require.NotNil(t, decision)
+		assert.Equal(t, mustParseTime(t, "2025-02-01T00:00:00Z"), decision.Limit)
+	})
+
+	t.Run("With the ingested at reference", func(t *testing.T) {
+		ingestedAtPolicy := *policy
+		ingestedAtPolicy.LatenessReference = LatenessFromIngestedAt
+
+		assert.Nil(t, ingestedAtPolicy.CheckBillingPeriod(sub, plan, "UTC", mustParseTime(t, "2025-01-31T00:00:00Z"), ingestedAt))
+	})
+}
+
+func TestApplyTimestampPolicy(t *testing.T) {
+	event := Event{Timestamp: 1741007009.123}
+	limit := mustParseTime(t, "2025-03-01T00:00:00Z")
+
+	t.Run("With a clamp decision", func(t *testing.T) {
+		enrichedEvent := event.ToEnrichedEvent().Value()
+		enrichedEvent.ApplyTimestampPolicy(&TimestampPolicyDecision{Violation: TimestampViolationLate, Action: TimestampPolicyClamp, Limit: limit})
+
+		assert.Equal(t, limit, enrichedEvent.Time)
+		assert.Equal(t, 1740787200.0, enrichedEvent.Timestamp)
+		assert.Equal(t, "1740787200.000000", enrichedEvent.TimestampStr)
+		assert.Equal(t, 1741007009.123, enrichedEvent.TimestampPolicy.OriginalTimestamp)
+
+		// The original timestamp is kept when the event is clamped twice
+		enrichedEvent.ApplyTimestampPolicy(&TimestampPolicyDecision{Violation: TimestampViolationLate, Action: TimestampPolicyClamp, Limit: limit.Add(time.Hour)})
+		assert.Equal(t, 1741007009.123, enrichedEvent.TimestampPolicy.OriginalTimestamp)
+	})
+
+	t.Run("With a route decision", func(t *testing.T) {
+		enrichedEvent := event.ToEnrichedEvent().Value()
+		enrichedEvent.ApplyTimestampPolicy(&TimestampPolicyDecision{Violation: TimestampViolationLate, Action: TimestampPolicyRoute, Limit: limit})
+
+		assert.Equal(t, 1741007009.123, enrichedEvent.Timestamp)
+		assert.Equal(t, TimestampPolicyRoute, enrichedEvent.TimestampPolicy.Action)
+	})
+}
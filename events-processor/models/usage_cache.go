@@ -0,0 +1,203 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+const USAGE_KEY_VERSION = "1"
+
+// Aggregates are kept after the end of their billing period,
+// so the usage of the closed period can still be read while the invoice is generated
+const USAGE_RETENTION = 7 * 24 * time.Hour
+
+// UsageIncrement is the contribution of an enriched expanded event to the usage of its charge
+type UsageIncrement struct {
+	// Hash holding the events count, sum, max and latest value
+	Key string
+	// HyperLogLog holding the unique values
+	UniqueKey string
+	// Marker of the event, an event is aggregated only once
+	EventKey string
+	ExpireAt time.Time
+
+	Sum       *string
+	Max       *string
+	Latest    *string
+	Unique    *string
+	Timestamp float64
+}
+
+// UsageIncrementResult holds the aggregates of a key before an increment
+type UsageIncrementResult struct {
+	// False when the event was already aggregated
+	Aggregated     bool
+	PreviousEvents int64
+	PreviousSum    string
+	PreviousUnique int64
+	// True when the unique value was not part of the aggregate yet
+	UniqueAdded bool
+}
+
+// AggregatedUsage is the usage of a charge before an event, and the units added by the event.
+// Units are only tracked for the count, sum and unique count aggregations.
+type AggregatedUsage struct {
+	Previous ChargeUsage
+	Units    *big.Rat
+}
+
+type UsageAggregator interface {
+	Close() error
+	Increment(ctx context.Context, increment *UsageIncrement) utils.Result[*UsageIncrementResult]
+}
+
+// UsageCache maintains the running usage of each subscription charge,
+// charge filter and grouped_by values during the billing period
+type UsageCache struct {
+	UsageStore UsageAggregator
+}
+
+func NewUsageCache(usageStore UsageAggregator) *UsageCache {
+	return &UsageCache{
+		UsageStore: usageStore,
+	}
+}
+
+// Aggregate adds the event to the usage of its charge and returns the usage before the event.
+// It returns nil when the event is not aggregated: already aggregated,
+// without billing period or with an unsupported aggregation.
+func (cache *UsageCache) Aggregate(ctx context.Context, ev *EnrichedEvent) utils.Result[*AggregatedUsage] {
+	increment, ok := buildUsageIncrement(ev)
+	if !ok {
+		return utils.SuccessResult[*AggregatedUsage](nil)
+	}
+
+	incrementResult := cache.UsageStore.Increment(ctx, increment)
+	if incrementResult.Failure() {
+		return utils.FailedResult[*AggregatedUsage](incrementResult.Error())
+	}
+
+	result := incrementResult.Value()
+	if !result.Aggregated {
+		return utils.SuccessResult[*AggregatedUsage](nil)
+	}
+
+	usage := &AggregatedUsage{
+		Previous: ChargeUsage{Events: result.PreviousEvents},
+	}
+
+	switch ev.BillableMetric.AggregationType {
+	case AggregationTypeCount:
+		usage.Previous.Units = big.NewRat(result.PreviousEvents, 1)
+		usage.Units = big.NewRat(1, 1)
+	case AggregationTypeSum:
+		previousSum, ok := new(big.Rat).SetString(result.PreviousSum)
+		if !ok {
+			previousSum = new(big.Rat)
+		}
+		usage.Previous.Units = previousSum
+		usage.Units, _ = new(big.Rat).SetString(*increment.Sum)
+	case AggregationTypeUniqueCount:
+		usage.Previous.Units = big.NewRat(result.PreviousUnique, 1)
+		usage.Units = new(big.Rat)
+		if result.UniqueAdded {
+			usage.Units.SetInt64(1)
+		}
+	}
+
+	return utils.SuccessResult(usage)
+}
+
+func buildUsageIncrement(ev *EnrichedEvent) (*UsageIncrement, bool) {
+	if ev.ChargeID == nil || ev.BillableMetric == nil || ev.BillingPeriodStart == nil || ev.BillingPeriodEnd == nil {
+		return nil, false
+	}
+
+	increment := &UsageIncrement{
+		Key:       BuildUsageKey(ev),
+		ExpireAt:  ev.BillingPeriodEnd.Add(USAGE_RETENTION),
+		Timestamp: ev.Timestamp,
+	}
+	increment.UniqueKey = increment.Key + "/unique"
+	increment.EventKey = strings.Join([]string{"usage", USAGE_KEY_VERSION, "{" + ev.SubscriptionID + "}", "events", ev.ExpandedID()}, "/")
+
+	switch ev.BillableMetric.AggregationType {
+	case AggregationTypeCount:
+	case AggregationTypeSum, AggregationTypeMax, AggregationTypeLatest:
+		value, ok := numericValue(ev)
+		if !ok {
+			return nil, false
+		}
+
+		switch ev.BillableMetric.AggregationType {
+		case AggregationTypeSum:
+			increment.Sum = &value
+		case AggregationTypeMax:
+			increment.Max = &value
+		default:
+			increment.Latest = &value
+		}
+	case AggregationTypeUniqueCount:
+		if ev.Properties[ev.BillableMetric.FieldName] == nil || ev.Value == nil {
+			return nil, false
+		}
+		increment.Unique = ev.Value
+	default:
+		return nil, false
+	}
+
+	return increment, true
+}
+
+// BuildUsageKey returns the key of the usage aggregate of the event charge.
+// The subscription ID is used as hash tag, so all the keys of a subscription live in the same cluster slot.
+func BuildUsageKey(ev *EnrichedEvent) string {
+	keyParts := []string{
+		"usage",
+		USAGE_KEY_VERSION,
+		"{" + ev.SubscriptionID + "}",
+		*ev.ChargeID,
+		ev.BillingPeriodStart.UTC().Format(time.RFC3339),
+	}
+
+	if ev.ChargeFilterID != nil {
+		keyParts = append(keyParts, *ev.ChargeFilterID)
+	}
+
+	if len(ev.GroupedBy) > 0 {
+		keyParts = append(keyParts, groupedByKey(ev.GroupedBy))
+	}
+
+	return strings.Join(keyParts, "/")
+}
+
+// groupedByKey serializes the grouped_by values as JSON with sorted keys and without HTML escaping
+func groupedByKey(groupedBy map[string]string) string {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(groupedBy)
+
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
+
+func numericValue(ev *EnrichedEvent) (string, bool) {
+	if ev.Value == nil {
+		return "", false
+	}
+
+	value, err := strconv.ParseFloat(*ev.Value, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return "", false
+	}
+
+	return strconv.FormatFloat(value, 'f', -1, 64), true
+}
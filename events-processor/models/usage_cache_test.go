@@ -0,0 +1,225 @@
+package models
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getlago/lago/events-processor/config/redis"
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+type mockUsageStore struct {
+	increments []*UsageIncrement
+}
+
+func (m *mockUsageStore) Close() error {
+	return nil
+}
+
+func (m *mockUsageStore) Increment(ctx context.Context, increment *UsageIncrement) utils.Result[*UsageIncrementResult] {
+	m.increments = append(m.increments, increment)
+	return utils.SuccessResult(&UsageIncrementResult{Aggregated: true, PreviousEvents: 4, PreviousSum: "10.5"})
+}
+
+func setupUsageStore(t *testing.T) (*UsageStore, *miniredis.Miniredis) {
+	s := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	store := &UsageStore{
+		db: &redis.RedisDB{Client: client},
+	}
+	return store, s
+}
+
+func buildUsageEvent(t *testing.T, aggregationType AggregationType, value string) *EnrichedEvent {
+	periodStart := mustParseTime(t, "2025-03-01T00:00:00Z")
+	periodEnd := mustParseTime(t, "2025-04-01T00:00:00Z")
+
+	return &EnrichedEvent{
+		OrganizationID:         "org_id",
+		ExternalSubscriptionID: "external_sub_id",
+		SubscriptionID:         "sub_id",
+		TransactionID:          "tr_1",
+		ChargeID:               utils.StringPtr("charge_id"),
+		BillingPeriodStart:     &periodStart,
+		BillingPeriodEnd:       &periodEnd,
+		Properties:             map[string]any{"value": value},
+		Value:                  &value,
+		Timestamp:              1741007009,
+		GroupedBy:              map[string]string{},
+		BillableMetric: &BillableMetric{
+			AggregationType: aggregationType,
+			FieldName:       "value",
+		},
+	}
+}
+
+func TestBuildUsageKey(t *testing.T) {
+	t.Run("Without charge filter", func(t *testing.T) {
+		event := buildUsageEvent(t, AggregationTypeCount, "1")
+		assert.Equal(t, "usage/1/{sub_id}/charge_id/2025-03-01T00:00:00Z", BuildUsageKey(event))
+	})
+
+	t.Run("With charge filter and grouped by values", func(t *testing.T) {
+		event := buildUsageEvent(t, AggregationTypeCount, "1")
+		event.ChargeFilterID = utils.StringPtr("filter_id")
+		event.GroupedBy = map[string]string{"region": "eu", "cloud": "<aws>"}
+
+		assert.Equal(
+			t,
+			`usage/1/{sub_id}/charge_id/2025-03-01T00:00:00Z/filter_id/{"cloud":"<aws>","region":"eu"}`,
+			BuildUsageKey(event),
+		)
+	})
+}
+
+func TestUsageCacheAggregate(t *testing.T) {
+	t.Run("With a sum aggregation", func(t *testing.T) {
+		store := &mockUsageStore{}
+		cache := NewUsageCache(store)
+
+		result := cache.Aggregate(context.Background(), buildUsageEvent(t, AggregationTypeSum, "12.50"))
+		require.True(t, result.Success())
+
+		usage := result.Value()
+		require.NotNil(t, usage)
+		assert.Equal(t, big.NewRat(21, 2), usage.Previous.Units)
+		assert.Equal(t, int64(4), usage.Previous.Events)
+		assert.Equal(t, big.NewRat(25, 2), usage.Units)
+
+		require.Len(t, store.increments, 1)
+		increment := store.increments[0]
+		assert.Equal(t, "12.5", *increment.Sum)
+		assert.Nil(t, increment.Max)
+		assert.Equal(t, "usage/1/{sub_id}/charge_id/2025-03-01T00:00:00Z/unique", increment.UniqueKey)
+		assert.Equal(t, mustParseTime(t, "2025-04-08T00:00:00Z"), increment.ExpireAt)
+	})
+
+	t.Run("With a unique count aggregation", func(t *testing.T) {
+		store := &mockUsageStore{}
+		cache := NewUsageCache(store)
+
+		usage := cache.Aggregate(context.Background(), buildUsageEvent(t, AggregationTypeUniqueCount, "user_1")).Value()
+		require.NotNil(t, usage)
+		assert.Equal(t, "user_1", *store.increments[0].Unique)
+		// The mocked store reports the value as already seen
+		assert.Equal(t, new(big.Rat), usage.Units)
+
+		event := buildUsageEvent(t, AggregationTypeUniqueCount, "user_1")
+		event.Properties = map[string]any{}
+		assert.Nil(t, cache.Aggregate(context.Background(), event).Value())
+	})
+
+	t.Run("With events that can't be aggregated", func(t *testing.T) {
+		store := &mockUsageStore{}
+		cache := NewUsageCache(store)
+
+		assert.Nil(t, cache.Aggregate(context.Background(), buildUsageEvent(t, AggregationTypeSum, "twelve")).Value())
+		assert.Nil(t, cache.Aggregate(context.Background(), buildUsageEvent(t, AggregationTypeMax, "NaN")).Value())
+		assert.Nil(t, cache.Aggregate(context.Background(), buildUsageEvent(t, AggregationTypeWeightedSum, "1")).Value())
+
+		withoutPeriod := buildUsageEvent(t, AggregationTypeCount, "1")
+		withoutPeriod.BillingPeriodStart = nil
+		assert.Nil(t, cache.Aggregate(context.Background(), withoutPeriod).Value())
+
+		withoutCharge := buildUsageEvent(t, AggregationTypeCount, "1")
+		withoutCharge.ChargeID = nil
+		assert.Nil(t, cache.Aggregate(context.Background(), withoutCharge).Value())
+
+		assert.Empty(t, store.increments)
+	})
+}
+
+func TestUsageStoreIncrement(t *testing.T) {
+	key := "usage/1/{sub_id}/charge_id/2025-03-01T00:00:00Z"
+	expireAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+
+	increment := func(eventKey string, timestamp float64, sum, max, latest, unique *string) *UsageIncrement {
+		return &UsageIncrement{
+			Key:       key,
+			UniqueKey: key + "/unique",
+			EventKey:  "usage/1/{sub_id}/events/" + eventKey,
+			ExpireAt:  expireAt,
+			Sum:       sum,
+			Max:       max,
+			Latest:    latest,
+			Unique:    unique,
+			Timestamp: timestamp,
+		}
+	}
+
+	t.Run("With numeric aggregates", func(t *testing.T) {
+		store, s := setupUsageStore(t)
+
+		for _, inc := range []*UsageIncrement{
+			increment("ev_1", 20, utils.StringPtr("1.5"), utils.StringPtr("7"), utils.StringPtr("3"), nil),
+			increment("ev_2", 10, utils.StringPtr("2"), utils.StringPtr("12"), utils.StringPtr("4"), nil),
+			increment("ev_3", 30, utils.StringPtr("0.25"), utils.StringPtr("9"), utils.StringPtr("5"), nil),
+		} {
+			result := store.Increment(context.Background(), inc)
+			require.True(t, result.Success())
+			assert.True(t, result.Value().Aggregated)
+		}
+
+		assert.Equal(t, "3", s.HGet(key, "events"))
+		assert.Equal(t, "3.75", s.HGet(key, "sum"))
+		assert.Equal(t, "12", s.HGet(key, "max"))
+		// The latest value is the one of the most recent event, not of the last aggregated one
+		assert.Equal(t, "5", s.HGet(key, "latest"))
+		assert.Equal(t, time.Until(expireAt).Round(time.Minute), s.TTL(key).Round(time.Minute))
+	})
+
+	t.Run("With unique values", func(t *testing.T) {
+		store, s := setupUsageStore(t)
+
+		for i, value := range []string{"user_1", "user_2", "user_1"} {
+			result := store.Increment(context.Background(), increment(string(rune('a'+i)), 10, nil, nil, nil, &value))
+			require.True(t, result.Success())
+			assert.Equal(t, int64(i), result.Value().PreviousEvents)
+			// The last value was already counted
+			assert.Equal(t, i < 2, result.Value().UniqueAdded)
+		}
+
+		count, err := store.db.Client.PFCount(context.Background(), key+"/unique").Result()
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), count)
+		assert.Equal(t, "3", s.HGet(key, "events"))
+		assert.True(t, s.TTL(key+"/unique") > 0)
+	})
+
+	t.Run("With an event aggregated twice", func(t *testing.T) {
+		store, s := setupUsageStore(t)
+
+		result := store.Increment(context.Background(), increment("ev_1", 10, utils.StringPtr("2"), nil, nil, nil))
+		require.True(t, result.Success())
+		assert.True(t, result.Value().Aggregated)
+		assert.Equal(t, int64(0), result.Value().PreviousEvents)
+		assert.Equal(t, "0", result.Value().PreviousSum)
+
+		result = store.Increment(context.Background(), increment("ev_1", 10, utils.StringPtr("2"), nil, nil, nil))
+		require.True(t, result.Success())
+		assert.False(t, result.Value().Aggregated)
+
+		result = store.Increment(context.Background(), increment("ev_2", 10, utils.StringPtr("3"), nil, nil, nil))
+		require.True(t, result.Success())
+		assert.Equal(t, int64(1), result.Value().PreviousEvents)
+		assert.Equal(t, "2", result.Value().PreviousSum)
+
+		assert.Equal(t, "2", s.HGet(key, "events"))
+		assert.Equal(t, "5", s.HGet(key, "sum"))
+	})
+
+	t.Run("With a Redis error", func(t *testing.T) {
+		store, s := setupUsageStore(t)
+		s.Close()
+
+		result := store.Increment(context.Background(), increment("ev_1", 10, nil, nil, nil, nil))
+		assert.False(t, result.Success())
+	})
+}
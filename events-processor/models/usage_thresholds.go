@@ -0,0 +1,312 @@
+package models
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+// UsageThreshold is a progressive billing threshold, on the current usage amount of a subscription.
+// It is defined either on a plan or on a subscription, subscription thresholds override the plan ones.
+type UsageThreshold struct {
+	ID                   string         `gorm:"primaryKey;->" json:"id"`
+	OrganizationID       string         `gorm:"->" json:"organization_id"`
+	PlanID               *string        `gorm:"->" json:"plan_id"`
+	SubscriptionID       *string        `gorm:"->" json:"subscription_id"`
+	AmountCents          int64          `gorm:"->" json:"amount_cents"`
+	Recurring            bool           `gorm:"->" json:"recurring"`
+	ThresholdDisplayName *string        `gorm:"->" json:"threshold_display_name"`
+	CreatedAt            utils.NullTime `gorm:"->" json:"created_at"`
+	UpdatedAt            utils.NullTime `gorm:"->" json:"updated_at"`
+	DeletedAt            utils.NullTime `gorm:"->" json:"deleted_at"`
+}
+
+func GetAllUsageThresholds(db *gorm.DB) utils.Result[[]UsageThreshold] {
+	config := StreamQueryConfig{
+		TableName: "usage_thresholds",
+		SelectFields: []string{
+			"id",
+			"organization_id",
+			"plan_id",
+			"subscription_id",
+			"amount_cents",
+			"recurring",
+			"threshold_display_name",
+			"created_at",
+			"updated_at",
+			"deleted_at",
+		},
+		WhereCondition: "deleted_at IS NULL",
+		WhereArgs:      []any{},
+		LogInterval:    10000,
+	}
+
+	return GetAllWithStreaming[UsageThreshold](db, config)
+}
+
+type UsageAlertType string
+
+const (
+	UsageAlertTypeCurrentUsageAmount               UsageAlertType = "current_usage_amount"
+	UsageAlertTypeBillableMetricCurrentUsageAmount UsageAlertType = "billable_metric_current_usage_amount"
+	UsageAlertTypeBillableMetricCurrentUsageUnits  UsageAlertType = "billable_metric_current_usage_units"
+)
+
+// UsageAlert is a usage monitoring alert of a subscription
+type UsageAlert struct {
+	ID                     string         `gorm:"primaryKey;->" json:"id"`
+	OrganizationID         string         `gorm:"->" json:"organization_id"`
+	SubscriptionExternalID string         `gorm:"->" json:"subscription_external_id"`
+	BillableMetricID       *string        `gorm:"->" json:"billable_metric_id"`
+	AlertType              UsageAlertType `gorm:"->" json:"alert_type"`
+	Code                   *string        `gorm:"->" json:"code"`
+	CreatedAt              utils.NullTime `gorm:"->" json:"created_at"`
+	UpdatedAt              utils.NullTime `gorm:"->" json:"updated_at"`
+	DeletedAt              utils.NullTime `gorm:"->" json:"deleted_at"`
+}
+
+func GetAllUsageAlerts(db *gorm.DB) utils.Result[[]UsageAlert] {
+	config := StreamQueryConfig{
+		TableName: "usage_monitoring_alerts",
+		SelectFields: []string{
+			"id",
+			"organization_id",
+			"subscription_external_id",
+			"billable_metric_id",
+			"alert_type",
+			"code",
+			"created_at",
+			"updated_at",
+			"deleted_at",
+		},
+		WhereCondition: "deleted_at IS NULL",
+		WhereArgs:      []any{},
+		LogInterval:    10000,
+	}
+
+	return GetAllWithStreaming[UsageAlert](db, config)
+}
+
+// UsageAlertThreshold is a threshold of a usage monitoring alert.
+// Its value is in cents for the amount alerts and in units for the units alerts.
+// Alert thresholds are hard deleted, Debezium flags their deletion with the __deleted field.
+type UsageAlertThreshold struct {
+	ID             string         `gorm:"primaryKey;->" json:"id"`
+	OrganizationID string         `gorm:"->" json:"organization_id"`
+	UsageAlertID   string         `gorm:"column:usage_monitoring_alert_id;->" json:"usage_monitoring_alert_id"`
+	Value          string         `gorm:"->" json:"value"`
+	Code           *string        `gorm:"->" json:"code"`
+	Recurring      bool           `gorm:"->" json:"recurring"`
+	CreatedAt      utils.NullTime `gorm:"->" json:"created_at"`
+	UpdatedAt      utils.NullTime `gorm:"->" json:"updated_at"`
+	Deleted        string         `gorm:"-" json:"__deleted"`
+}
+
+func (t *UsageAlertThreshold) IsDeleted() bool {
+	return t.Deleted == "true"
+}
+
+func GetAllUsageAlertThresholds(db *gorm.DB) utils.Result[[]UsageAlertThreshold] {
+	config := StreamQueryConfig{
+		TableName: "usage_monitoring_alert_thresholds",
+		SelectFields: []string{
+			"id",
+			"organization_id",
+			"usage_monitoring_alert_id",
+			"value::text AS value",
+			"code",
+			"recurring",
+			"created_at",
+			"updated_at",
+		},
+		LogInterval: 10000,
+	}
+
+	return GetAllWithStreaming[UsageAlertThreshold](db, config)
+}
+
+type ThresholdType string
+
+const (
+	ThresholdTypeUsageThreshold ThresholdType = "usage_threshold"
+	ThresholdTypeUsageAlert     ThresholdType = "usage_alert"
+)
+
+// Fields of the subscription totals hash
+const (
+	THRESHOLD_TOTAL_AMOUNT_CENTS = "amount_cents"
+	thresholdBillableMetricField = "bm"
+)
+
+// ThresholdTotalField returns the field of the subscription totals hash
+// holding the amount in cents or the units of a billable metric
+func ThresholdTotalField(billableMetricID string, total string) string {
+	return strings.Join([]string{thresholdBillableMetricField, billableMetricID, total}, "/")
+}
+
+// BuildThresholdTotalsKey returns the key of the hash holding the totals of the event subscription in its billing period.
+// It shares the hash tag of the usage keys of the subscription.
+func BuildThresholdTotalsKey(ev *EnrichedEvent) string {
+	return strings.Join([]string{
+		"thresholds",
+		USAGE_KEY_VERSION,
+		"{" + ev.SubscriptionID + "}",
+		ev.BillingPeriodStart.UTC().Format(time.RFC3339),
+	}, "/")
+}
+
+// BuildThresholdCrossedKey returns the key marking a threshold occurrence as crossed in the billing period
+func BuildThresholdCrossedKey(totalsKey string, crossed CrossedThreshold) string {
+	return strings.Join([]string{totalsKey, "crossed", crossed.Threshold.ID, strconv.FormatInt(crossed.Occurrence, 10)}, "/")
+}
+
+type ThresholdTracker interface {
+	Close() error
+	// IncrementTotals adds the increments to the fields of the totals hash and returns their new values
+	IncrementTotals(ctx context.Context, key string, expireAt time.Time, increments map[string]*big.Rat) utils.Result[map[string]*big.Rat]
+	// MarkCrossed flags a threshold as crossed, it returns false when it was already flagged
+	MarkCrossed(ctx context.Context, key string, expireAt time.Time) utils.Result[bool]
+}
+
+// UsageThresholdCrossedEvent is produced once per billing period when the usage of a subscription
+// reaches a usage threshold or a usage alert threshold (once per occurrence for the recurring ones)
+type UsageThresholdCrossedEvent struct {
+	ID                     string          `json:"id"`
+	OrganizationID         string          `json:"organization_id"`
+	SubscriptionID         string          `json:"subscription_id"`
+	ExternalSubscriptionID string          `json:"external_subscription_id"`
+	PlanID                 string          `json:"plan_id"`
+	BillingPeriodStart     time.Time       `json:"billing_period_start"`
+	BillingPeriodEnd       time.Time       `json:"billing_period_end"`
+	ThresholdType          ThresholdType   `json:"threshold_type"`
+	ThresholdID            string          `json:"threshold_id"`
+	AlertID                *string         `json:"alert_id,omitempty"`
+	AlertType              *UsageAlertType `json:"alert_type,omitempty"`
+	AlertCode              *string         `json:"alert_code,omitempty"`
+	BillableMetricID       *string         `json:"billable_metric_id,omitempty"`
+	ThresholdValue         string          `json:"threshold_value"`
+	Recurring              bool            `json:"recurring"`
+	Occurrence             int64           `json:"occurrence"`
+	CurrentValue           string          `json:"current_value"`
+	TransactionID          string          `json:"transaction_id"`
+}
+
+// NewUsageThresholdCrossedEvent builds the crossing event of a threshold by the event.
+// Its ID is stable for a threshold occurrence in a billing period.
+func NewUsageThresholdCrossedEvent(ev *EnrichedEvent, thresholdType ThresholdType, crossed CrossedThreshold, current *big.Rat) *UsageThresholdCrossedEvent {
+	return &UsageThresholdCrossedEvent{
+		ID: buildEnrichedEventID(
+			ev.OrganizationID,
+			ev.SubscriptionID,
+			ev.BillingPeriodStart.UTC().Format(time.RFC3339),
+			crossed.Threshold.ID,
+			strconv.FormatInt(crossed.Occurrence, 10),
+		),
+		OrganizationID:         ev.OrganizationID,
+		SubscriptionID:         ev.SubscriptionID,
+		ExternalSubscriptionID: ev.ExternalSubscriptionID,
+		PlanID:                 ev.PlanID,
+		BillingPeriodStart:     ev.BillingPeriodStart.UTC(),
+		BillingPeriodEnd:       ev.BillingPeriodEnd.UTC(),
+		ThresholdType:          thresholdType,
+		ThresholdID:            crossed.Threshold.ID,
+		ThresholdValue:         decimalString(crossed.Value),
+		Recurring:              crossed.Threshold.Recurring,
+		Occurrence:             crossed.Occurrence,
+		CurrentValue:           decimalString(current),
+		TransactionID:          ev.TransactionID,
+	}
+}
+
+// Threshold is a value to monitor. A recurring threshold is crossed again every time the value
+// increases by its amount above the highest non recurring threshold.
+type Threshold struct {
+	ID        string
+	Value     *big.Rat
+	Recurring bool
+}
+
+// CrossedThreshold is a threshold crossed by an increment.
+// Occurrence is the number of times a recurring threshold was crossed in the period, 0 for the other thresholds.
+type CrossedThreshold struct {
+	Threshold  Threshold
+	Value      *big.Rat
+	Occurrence int64
+}
+
+// CrossedThresholds returns the thresholds reached when a value goes from previous to current.
+// A threshold is crossed when previous < threshold <= current.
+func CrossedThresholds(thresholds []Threshold, previous *big.Rat, current *big.Rat) []CrossedThreshold {
+	if current.Cmp(previous) <= 0 {
+		return nil
+	}
+
+	var crossed []CrossedThreshold
+	var recurring []Threshold
+	base := new(big.Rat)
+
+	sorted := make([]Threshold, len(thresholds))
+	copy(sorted, thresholds)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Value.Cmp(sorted[j].Value) < 0 })
+
+	for _, threshold := range sorted {
+		if threshold.Value.Sign() <= 0 {
+			continue
+		}
+
+		if threshold.Recurring {
+			recurring = append(recurring, threshold)
+			continue
+		}
+
+		base = threshold.Value
+		if previous.Cmp(threshold.Value) < 0 && current.Cmp(threshold.Value) >= 0 {
+			crossed = append(crossed, CrossedThreshold{Threshold: threshold, Value: threshold.Value})
+		}
+	}
+
+	// Recurring thresholds are counted from the highest fixed threshold,
+	// only the last occurrence is returned when several are crossed at once
+	for _, threshold := range recurring {
+		before := occurrences(previous, base, threshold.Value)
+		after := occurrences(current, base, threshold.Value)
+		if after <= before {
+			continue
+		}
+
+		value := new(big.Rat).Mul(threshold.Value, new(big.Rat).SetInt64(after))
+		crossed = append(crossed, CrossedThreshold{
+			Threshold:  threshold,
+			Value:      value.Add(value, base),
+			Occurrence: after,
+		})
+	}
+
+	return crossed
+}
+
+func occurrences(value *big.Rat, base *big.Rat, step *big.Rat) int64 {
+	above := new(big.Rat).Sub(value, base)
+	if above.Sign() <= 0 {
+		return 0
+	}
+
+	count := new(big.Int).Quo(
+		new(big.Int).Mul(above.Num(), step.Denom()),
+		new(big.Int).Mul(above.Denom(), step.Num()),
+	)
+	return count.Int64()
+}
+
+// decimalString formats a value with 6 decimals, without trailing zeros
+func decimalString(value *big.Rat) string {
+	formatted := strings.TrimRight(value.FloatString(6), "0")
+	return strings.TrimSuffix(formatted, ".")
+}
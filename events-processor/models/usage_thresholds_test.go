@@ -0,0 +1,145 @@
+package models
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getlago/lago/events-processor/config/redis"
+)
+
+func setupThresholdStore(t *testing.T) (*ThresholdStore, *miniredis.Miniredis) {
+	s := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	store := &ThresholdStore{
+		db: &redis.RedisDB{Client: client},
+	}
+	return store, s
+}
+
+func TestCrossedThresholds(t *testing.T) {
+	thresholds := []Threshold{
+		{ID: "t_200", Value: big.NewRat(200, 1)},
+		{ID: "t_100", Value: big.NewRat(100, 1)},
+		{ID: "t_every_50", Value: big.NewRat(50, 1), Recurring: true},
+	}
+
+	t.Run("With a fixed threshold crossed", func(t *testing.T) {
+		crossed := CrossedThresholds(thresholds, big.NewRat(90, 1), big.NewRat(100, 1))
+
+		require.Len(t, crossed, 1)
+		assert.Equal(t, "t_100", crossed[0].Threshold.ID)
+		assert.Equal(t, big.NewRat(100, 1), crossed[0].Value)
+		assert.Equal(t, int64(0), crossed[0].Occurrence)
+	})
+
+	t.Run("With several fixed thresholds crossed at once", func(t *testing.T) {
+		crossed := CrossedThresholds(thresholds, big.NewRat(0, 1), big.NewRat(240, 1))
+
+		require.Len(t, crossed, 2)
+		assert.Equal(t, "t_100", crossed[0].Threshold.ID)
+		assert.Equal(t, "t_200", crossed[1].Threshold.ID)
+	})
+
+	t.Run("With a recurring threshold", func(t *testing.T) {
+		crossed := CrossedThresholds(thresholds, big.NewRat(240, 1), big.NewRat(260, 1))
+
+		require.Len(t, crossed, 1)
+		assert.Equal(t, "t_every_50", crossed[0].Threshold.ID)
+		assert.Equal(t, big.NewRat(250, 1), crossed[0].Value)
+		assert.Equal(t, int64(1), crossed[0].Occurrence)
+
+		// Only the last occurrence is returned
+		crossed = CrossedThresholds(thresholds, big.NewRat(260, 1), big.NewRat(410, 1))
+		require.Len(t, crossed, 1)
+		assert.Equal(t, big.NewRat(400, 1), crossed[0].Value)
+		assert.Equal(t, int64(4), crossed[0].Occurrence)
+	})
+
+	t.Run("Without threshold crossed", func(t *testing.T) {
+		assert.Empty(t, CrossedThresholds(thresholds, big.NewRat(100, 1), big.NewRat(120, 1)))
+		assert.Empty(t, CrossedThresholds(thresholds, big.NewRat(120, 1), big.NewRat(120, 1)))
+		assert.Empty(t, CrossedThresholds(nil, big.NewRat(0, 1), big.NewRat(120, 1)))
+	})
+}
+
+func TestNewUsageThresholdCrossedEvent(t *testing.T) {
+	event := buildUsageEvent(t, AggregationTypeCount, "1")
+	crossed := CrossedThreshold{
+		Threshold:  Threshold{ID: "threshold_id", Value: big.NewRat(1, 2), Recurring: true},
+		Value:      big.NewRat(3, 2),
+		Occurrence: 2,
+	}
+
+	crossedEvent := NewUsageThresholdCrossedEvent(event, ThresholdTypeUsageAlert, crossed, big.NewRat(16, 10))
+	assert.Equal(t, "1.5", crossedEvent.ThresholdValue)
+	assert.Equal(t, "1.6", crossedEvent.CurrentValue)
+	assert.Equal(t, int64(2), crossedEvent.Occurrence)
+	assert.Equal(t, "tr_1", crossedEvent.TransactionID)
+
+	// The ID is stable for a threshold occurrence
+	other := buildUsageEvent(t, AggregationTypeCount, "1")
+	other.TransactionID = "tr_2"
+	assert.Equal(t, crossedEvent.ID, NewUsageThresholdCrossedEvent(other, ThresholdTypeUsageAlert, crossed, big.NewRat(2, 1)).ID)
+
+	crossed.Occurrence = 3
+	assert.NotEqual(t, crossedEvent.ID, NewUsageThresholdCrossedEvent(event, ThresholdTypeUsageAlert, crossed, big.NewRat(2, 1)).ID)
+}
+
+func TestThresholdStore(t *testing.T) {
+	key := "thresholds/1/{sub_id}/2025-03-01T00:00:00Z"
+	expireAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	unitsField := ThresholdTotalField("bm_id", "units")
+
+	t.Run("With increments", func(t *testing.T) {
+		store, s := setupThresholdStore(t)
+
+		result := store.IncrementTotals(context.Background(), key, expireAt, map[string]*big.Rat{
+			THRESHOLD_TOTAL_AMOUNT_CENTS: big.NewRat(125, 100),
+			unitsField:                   big.NewRat(1, 1),
+		})
+		require.True(t, result.Success())
+
+		result = store.IncrementTotals(context.Background(), key, expireAt, map[string]*big.Rat{
+			THRESHOLD_TOTAL_AMOUNT_CENTS: big.NewRat(2, 1),
+		})
+		require.True(t, result.Success())
+		assert.Equal(t, map[string]*big.Rat{THRESHOLD_TOTAL_AMOUNT_CENTS: big.NewRat(325, 100)}, result.Value())
+
+		assert.Equal(t, "1", s.HGet(key, "bm/bm_id/units"))
+		assert.True(t, s.TTL(key) > 0)
+	})
+
+	t.Run("With a threshold marked as crossed", func(t *testing.T) {
+		store, s := setupThresholdStore(t)
+
+		result := store.MarkCrossed(context.Background(), key+"/crossed/threshold_id/0", expireAt)
+		require.True(t, result.Success())
+		assert.True(t, result.Value())
+
+		result = store.MarkCrossed(context.Background(), key+"/crossed/threshold_id/0", expireAt)
+		require.True(t, result.Success())
+		assert.False(t, result.Value())
+
+		assert.True(t, s.TTL(key+"/crossed/threshold_id/0") > 0)
+	})
+
+	t.Run("With a Redis error", func(t *testing.T) {
+		store, s := setupThresholdStore(t)
+		s.Close()
+
+		assert.False(t, store.IncrementTotals(context.Background(), key, expireAt, map[string]*big.Rat{unitsField: big.NewRat(1, 1)}).Success())
+		assert.False(t, store.MarkCrossed(context.Background(), key+"/crossed/threshold_id/0", expireAt).Success())
+	})
+}
+
+func TestBuildThresholdTotalsKey(t *testing.T) {
+	event := buildUsageEvent(t, AggregationTypeCount, "1")
+	assert.Equal(t, "thresholds/1/{sub_id}/2025-03-01T00:00:00Z", BuildThresholdTotalsKey(event))
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+type WalletStatus int
+
+const (
+	WalletStatusActive WalletStatus = iota
+	WalletStatusTerminated
+)
+
+// Wallet is a prepaid credits wallet of a customer.
+// Events can target a wallet by its code on the charges accepting a target wallet.
+type Wallet struct {
+	ID             string         `gorm:"primaryKey;->" json:"id"`
+	OrganizationID string         `gorm:"->" json:"organization_id"`
+	CustomerID     string         `gorm:"->" json:"customer_id"`
+	Code           *string        `gorm:"->" json:"code"`
+	Status         WalletStatus   `gorm:"->" json:"status"`
+	Currency       string         `gorm:"column:balance_currency;->" json:"balance_currency"`
+	CreatedAt      utils.NullTime `gorm:"->" json:"created_at"`
+	UpdatedAt      utils.NullTime `gorm:"->" json:"updated_at"`
+	TerminatedAt   utils.NullTime `gorm:"->" json:"terminated_at"`
+}
+
+func (w *Wallet) IsActive() bool {
+	return w.Status == WalletStatusActive
+}
+
+// WalletDebitIntent is the usage of an expanded event targeting a wallet,
+// to be debited from the wallet prepaid credits
+type WalletDebitIntent struct {
+	ID                     string       `json:"id"`
+	OrganizationID         string       `json:"organization_id"`
+	CustomerID             string       `json:"customer_id"`
+	SubscriptionID         string       `json:"subscription_id"`
+	ExternalSubscriptionID string       `json:"external_subscription_id"`
+	WalletID               string       `json:"wallet_id"`
+	WalletCode             string       `json:"wallet_code"`
+	ChargeID               string       `json:"charge_id"`
+	ChargeFilterID         *string      `json:"charge_filter_id"`
+	TransactionID          string       `json:"transaction_id"`
+	Code                   string       `json:"code"`
+	Timestamp              float64      `json:"timestamp"`
+	Value                  *string      `json:"value"`
+	Currency               string       `json:"currency"`
+	EstimatedFee           *FeeEstimate `json:"estimated_fee,omitempty"`
+}
+
+// NewWalletDebitIntent builds the debit intent of an expanded event resolved to a target wallet.
+// Its ID is the one of the expanded event, so the intents can be deduplicated downstream.
+func NewWalletDebitIntent(ev *EnrichedEvent, estimatedFee *FeeEstimate) *WalletDebitIntent {
+	return &WalletDebitIntent{
+		ID:                     ev.ExpandedID(),
+		OrganizationID:         ev.OrganizationID,
+		CustomerID:             ev.TargetWallet.CustomerID,
+		SubscriptionID:         ev.SubscriptionID,
+		ExternalSubscriptionID: ev.ExternalSubscriptionID,
+		WalletID:               ev.TargetWallet.ID,
+		WalletCode:             *ev.TargetWalletCode,
+		ChargeID:               *ev.ChargeID,
+		ChargeFilterID:         ev.ChargeFilterID,
+		TransactionID:          ev.TransactionID,
+		Code:                   ev.Code,
+		Timestamp:              ev.Timestamp,
+		Value:                  ev.Value,
+		Currency:               ev.TargetWallet.Currency,
+		EstimatedFee:           estimatedFee,
+	}
+}
+
+// FetchActiveWalletByCode returns the active wallet of the customer with the given code
+func (store *ApiStore) FetchActiveWalletByCode(organizationID string, customerID string, code string) utils.Result[*Wallet] {
+	var wallet Wallet
+	result := store.db.Connection.
+		Where(
+			"organization_id = ? AND customer_id = ? AND code = ? AND status = ?",
+			organizationID, customerID, code, WalletStatusActive,
+		).
+		Limit(1).
+		Find(&wallet)
+
+	if result.Error != nil {
+		return failedWalletResult(result.Error)
+	}
+	if wallet.ID == "" {
+		return failedWalletResult(gorm.ErrRecordNotFound)
+	}
+
+	return utils.SuccessResult(&wallet)
+}
+
+// Only the active wallets with a code can be targeted by the events
+func GetAllWallets(db *gorm.DB) utils.Result[[]Wallet] {
+	config := StreamQueryConfig{
+		TableName: "wallets",
+		SelectFields: []string{
+			"id",
+			"organization_id",
+			"customer_id",
+			"code",
+			"status",
+			"balance_currency",
+			"created_at",
+			"updated_at",
+			"terminated_at",
+		},
+		WhereCondition: "status = ? AND code IS NOT NULL",
+		WhereArgs:      []any{WalletStatusActive},
+		LogInterval:    50000,
+	}
+
+	return GetAllWithStreaming[Wallet](db, config)
+}
+
+func failedWalletResult(err error) utils.Result[*Wallet] {
+	result := utils.FailedResult[*Wallet](err)
+
+	if err.Error() == gorm.ErrRecordNotFound.Error() {
+		result = result.NonCapturable().NonRetryable()
+	}
+
+	return result
+}
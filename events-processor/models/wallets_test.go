@@ -0,0 +1,54 @@
+package models
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestFetchActiveWalletByCode(t *testing.T) {
+	orgID := "1a901a90-1a90-1a90-1a90-1a901a901a90"
+	query := regexp.QuoteMeta(`
+		SELECT * FROM "wallets"
+		WHERE organization_id = $1 AND customer_id = $2 AND code = $3 AND status = $4
+		LIMIT $5`,
+	)
+
+	t.Run("should return wallet when found", func(t *testing.T) {
+		store, mock, cleanup := setupApiStore(t)
+		defer cleanup()
+
+		rows := sqlmock.NewRows([]string{"id", "organization_id", "customer_id", "code", "status", "balance_currency"}).
+			AddRow("wallet123", orgID, "cus123", "prepaid", 0, "EUR")
+
+		mock.ExpectQuery(query).
+			WithArgs(orgID, "cus123", "prepaid", WalletStatusActive, 1).
+			WillReturnRows(rows)
+
+		result := store.FetchActiveWalletByCode(orgID, "cus123", "prepaid")
+
+		assert.True(t, result.Success())
+		assert.Equal(t, "wallet123", result.Value().ID)
+		assert.Equal(t, "EUR", result.Value().Currency)
+		assert.True(t, result.Value().IsActive())
+	})
+
+	t.Run("should return error when wallet not found", func(t *testing.T) {
+		store, mock, cleanup := setupApiStore(t)
+		defer cleanup()
+
+		mock.ExpectQuery(query).
+			WithArgs(orgID, "cus123", "unknown", WalletStatusActive, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		result := store.FetchActiveWalletByCode(orgID, "cus123", "unknown")
+
+		assert.False(t, result.Success())
+		assert.Equal(t, gorm.ErrRecordNotFound, result.Error())
+		assert.False(t, result.IsCapturable())
+		assert.False(t, result.IsRetryable())
+	})
+}
@@ -0,0 +1,105 @@
+package events_processor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+// CardinalityGuardService limits the number of distinct pricing groups of the charges,
+// so a customer sending unique values (eg: UUIDs) as pricing group keys can't explode the usage groups downstream
+type CardinalityGuardService struct {
+	store    models.CardinalityTracker
+	policies map[string]*models.CardinalityPolicy
+	metrics  *ProcessorMetrics
+}
+
+func NewCardinalityGuardService(store models.CardinalityTracker, policies map[string]*models.CardinalityPolicy, metrics *ProcessorMetrics) *CardinalityGuardService {
+	return &CardinalityGuardService{
+		store:    store,
+		policies: policies,
+		metrics:  metrics,
+	}
+}
+
+func (s *CardinalityGuardService) policy(organizationID string) *models.CardinalityPolicy {
+	if policy, ok := s.policies[organizationID]; ok {
+		return policy
+	}
+
+	return s.policies[ALL_ORGANIZATIONS]
+}
+
+// GuardPricingGroups checks the pricing groups of the expanded events against the cardinality policy of their organization,
+// and returns the events exceeding the limit. Their pricing group values are replaced by `__other__` with the cap action,
+// a failed result is returned with the dead_letter action.
+// Tracking is best effort: when the store is unavailable, the events are accepted.
+func (s *CardinalityGuardService) GuardPricingGroups(ctx context.Context, events []*models.EnrichedEvent) utils.Result[[]*models.EnrichedEvent] {
+	var overflows []*models.EnrichedEvent
+
+	for _, event := range events {
+		if event.ChargeID == nil || event.BillingPeriodStart == nil || event.BillingPeriodEnd == nil {
+			continue
+		}
+
+		policy := s.policy(event.OrganizationID)
+		if policy == nil {
+			continue
+		}
+
+		group, ok := models.PricingGroup(event)
+		if !ok {
+			continue
+		}
+
+		trackResult := s.store.TrackGroup(
+			ctx,
+			models.BuildCardinalityKey(event),
+			group,
+			policy.MaxGroups,
+			event.BillingPeriodEnd.Add(models.USAGE_RETENTION),
+		)
+		if trackResult.Failure() {
+			slog.Error(
+				"Error tracking pricing groups",
+				slog.String("organization_id", event.OrganizationID),
+				slog.String("charge_id", *event.ChargeID),
+				slog.String("error", trackResult.ErrorMsg()),
+			)
+			utils.CaptureError(trackResult.Error())
+			continue
+		}
+
+		if trackResult.Value() {
+			continue
+		}
+
+		slog.Warn(
+			"Pricing group cardinality exceeded",
+			slog.String("organization_id", event.OrganizationID),
+			slog.String("subscription_id", event.SubscriptionID),
+			slog.String("charge_id", *event.ChargeID),
+			slog.Int64("max_groups", policy.MaxGroups),
+			slog.String("action", string(policy.Action)),
+		)
+		s.metrics.RecordPricingGroupOverflow(ctx, event, policy.Action)
+		overflows = append(overflows, event)
+
+		switch policy.Action {
+		case models.CardinalityPolicyCap:
+			models.CapPricingGroup(event)
+		case models.CardinalityPolicyDeadLetter:
+			return utils.FailedResult[[]*models.EnrichedEvent](
+				fmt.Errorf("charge %s exceeds %d pricing groups", *event.ChargeID, policy.MaxGroups),
+			).
+				AddErrorDetails("pricing_group_cardinality_exceeded", "Event pricing group exceeds the cardinality limit of the charge").
+				NonCapturable().
+				NonRetryable()
+		}
+	}
+
+	return utils.SuccessResult(overflows)
+}
@@ -0,0 +1,141 @@
+package events_processor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+type mockCardinalityStore struct {
+	groups map[string][]string
+	err    error
+}
+
+func (m *mockCardinalityStore) Close() error {
+	return nil
+}
+
+func (m *mockCardinalityStore) TrackGroup(ctx context.Context, key string, group string, maxGroups int64, expireAt time.Time) utils.Result[bool] {
+	if m.err != nil {
+		return utils.FailedBoolResult(m.err)
+	}
+
+	for _, known := range m.groups[key] {
+		if known == group {
+			return utils.SuccessResult(true)
+		}
+	}
+	if int64(len(m.groups[key])) >= maxGroups {
+		return utils.SuccessResult(false)
+	}
+
+	m.groups[key] = append(m.groups[key], group)
+	return utils.SuccessResult(true)
+}
+
+func setupCardinalityGuardService(policies map[string]*models.CardinalityPolicy) (*CardinalityGuardService, *mockCardinalityStore, *sdkmetric.ManualReader) {
+	store := &mockCardinalityStore{groups: map[string][]string{}}
+	reader := sdkmetric.NewManualReader()
+	metrics := NewProcessorMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter(METER_NAME))
+
+	return NewCardinalityGuardService(store, policies, metrics), store, reader
+}
+
+func TestGuardPricingGroups(t *testing.T) {
+	periodStart := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	periodEnd := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	buildEvent := func(userID string) *models.EnrichedEvent {
+		return &models.EnrichedEvent{
+			OrganizationID:     "org_id",
+			SubscriptionID:     "sub_id",
+			ChargeID:           utils.StringPtr("charge_id"),
+			BillingPeriodStart: &periodStart,
+			BillingPeriodEnd:   &periodEnd,
+			FlatFilter:         &models.FlatFilter{PricingGroupKeys: []string{"user_id"}},
+			GroupedBy:          map[string]string{"user_id": userID},
+		}
+	}
+
+	guard := func(t *testing.T, service *CardinalityGuardService, userIDs ...string) ([]*models.EnrichedEvent, utils.Result[[]*models.EnrichedEvent]) {
+		var events []*models.EnrichedEvent
+		var result utils.Result[[]*models.EnrichedEvent]
+		for _, userID := range userIDs {
+			event := buildEvent(userID)
+			events = append(events, event)
+			result = service.GuardPricingGroups(context.Background(), []*models.EnrichedEvent{event})
+		}
+		return events, result
+	}
+
+	t.Run("With the warn action", func(t *testing.T) {
+		service, _, reader := setupCardinalityGuardService(map[string]*models.CardinalityPolicy{
+			ALL_ORGANIZATIONS: {MaxGroups: 2, Action: models.CardinalityPolicyWarn},
+		})
+
+		events, result := guard(t, service, "u_1", "u_2", "u_3")
+		require.True(t, result.Success())
+		require.Len(t, result.Value(), 1)
+		assert.Equal(t, "u_3", events[2].GroupedBy["user_id"])
+
+		rm := metricdata.ResourceMetrics{}
+		require.NoError(t, reader.Collect(context.Background(), &rm))
+		require.Len(t, rm.ScopeMetrics, 1)
+		assert.Equal(t, "lago.events_processor.pricing_group_overflows", rm.ScopeMetrics[0].Metrics[0].Name)
+	})
+
+	t.Run("With the cap action", func(t *testing.T) {
+		service, _, _ := setupCardinalityGuardService(map[string]*models.CardinalityPolicy{
+			"org_id": {MaxGroups: 2, Action: models.CardinalityPolicyCap},
+		})
+
+		events, result := guard(t, service, "u_1", "u_2", "u_3", "u_1")
+		require.True(t, result.Success())
+		assert.Equal(t, "__other__", events[2].GroupedBy["user_id"])
+		// Known groups keep their values
+		assert.Equal(t, "u_1", events[3].GroupedBy["user_id"])
+	})
+
+	t.Run("With the dead_letter action", func(t *testing.T) {
+		service, _, _ := setupCardinalityGuardService(map[string]*models.CardinalityPolicy{
+			"org_id": {MaxGroups: 1, Action: models.CardinalityPolicyDeadLetter},
+		})
+
+		_, result := guard(t, service, "u_1", "u_2")
+		assert.False(t, result.Success())
+		assert.Equal(t, "pricing_group_cardinality_exceeded", result.ErrorCode())
+		assert.False(t, result.IsRetryable())
+		assert.False(t, result.IsCapturable())
+	})
+
+	t.Run("Without policy for the organization", func(t *testing.T) {
+		service, store, _ := setupCardinalityGuardService(map[string]*models.CardinalityPolicy{
+			"other_org_id": {MaxGroups: 1, Action: models.CardinalityPolicyDeadLetter},
+		})
+
+		_, result := guard(t, service, "u_1", "u_2")
+		assert.True(t, result.Success())
+		assert.Empty(t, store.groups)
+	})
+
+	t.Run("With a store error", func(t *testing.T) {
+		service, store, _ := setupCardinalityGuardService(map[string]*models.CardinalityPolicy{
+			"org_id": {MaxGroups: 1, Action: models.CardinalityPolicyDeadLetter},
+		})
+		store.err = errors.New("connection refused")
+
+		// Events are accepted when the groups can't be tracked
+		_, result := guard(t, service, "u_1", "u_2")
+		assert.True(t, result.Success())
+		assert.Empty(t, result.Value())
+	})
+}
@@ -0,0 +1,165 @@
+package events_processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/getlago/lago/events-processor/config/kafka"
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/server"
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+// ConsumerGroupAdmin is the subset of a consumer group operated through the admin API
+type ConsumerGroupAdmin interface {
+	Assignments() []kafka.PartitionAssignment
+	PausePartition(partition int32) error
+	ResumePartition(partition int32) error
+	SkipOffset(ctx context.Context, partition int32, offset int64) error
+	SeekToTimestamp(ctx context.Context, partition int32, timestamp time.Time) (int64, error)
+}
+
+// ConsumerAdminService exposes the partitions of the raw events consumer group and of the lane consumer groups,
+// to unblock a partition without stopping the processor.
+// The raw events consumer group is named after the default lane, the other ones after their lane.
+type ConsumerAdminService struct {
+	consumerGroups map[string]ConsumerGroupAdmin
+}
+
+func NewConsumerAdminService(consumerGroup ConsumerGroupAdmin) *ConsumerAdminService {
+	return &ConsumerAdminService{
+		consumerGroups: map[string]ConsumerGroupAdmin{models.DEFAULT_LANE: consumerGroup},
+	}
+}
+
+// AddLane exposes the consumer group of a lane consuming its own topic
+func (s *ConsumerAdminService) AddLane(name string, consumerGroup ConsumerGroupAdmin) {
+	s.consumerGroups[name] = consumerGroup
+}
+
+type skipRequest struct {
+	Offset *int64 `json:"offset"`
+}
+
+type seekRequest struct {
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type seekResponse struct {
+	Partition int32 `json:"partition"`
+	Offset    int64 `json:"offset"`
+}
+
+// ServeHTTP lists the assigned partitions (GET), or runs the `action` path value
+// (pause, resume, skip or seek) on the `partition` path value (POST),
+// of the consumer group named by the `consumer_group` path value
+func (s *ConsumerAdminService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	consumerGroup, found := s.consumerGroups[r.PathValue("consumer_group")]
+	if !found {
+		server.WriteError(w, http.StatusNotFound, server.ErrorResponse{
+			Error:     "unknown consumer group",
+			ErrorCode: "unknown_consumer_group",
+		})
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		server.WriteJSON(w, http.StatusOK, consumerGroup.Assignments())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		server.WriteError(w, http.StatusMethodNotAllowed, server.ErrorResponse{Error: "method not allowed"})
+		return
+	}
+
+	partition, err := strconv.ParseInt(r.PathValue("partition"), 10, 32)
+	if err != nil {
+		writeInvalidConsumerAction(w, err, "Invalid partition")
+		return
+	}
+
+	switch r.PathValue("action") {
+	case "pause":
+		err = consumerGroup.PausePartition(int32(partition))
+
+	case "resume":
+		err = consumerGroup.ResumePartition(int32(partition))
+
+	case "skip":
+		request := skipRequest{}
+		if decodeErr := json.NewDecoder(r.Body).Decode(&request); decodeErr != nil || request.Offset == nil {
+			writeInvalidConsumerAction(w, decodeErr, "The offset to skip is required")
+			return
+		}
+		err = consumerGroup.SkipOffset(r.Context(), int32(partition), *request.Offset)
+
+	case "seek":
+		request := seekRequest{}
+		if decodeErr := json.NewDecoder(r.Body).Decode(&request); decodeErr != nil || request.Timestamp.IsZero() {
+			writeInvalidConsumerAction(w, decodeErr, "The timestamp to seek is required")
+			return
+		}
+
+		var offset int64
+		offset, err = consumerGroup.SeekToTimestamp(r.Context(), int32(partition), request.Timestamp)
+		if err == nil {
+			server.WriteJSON(w, http.StatusOK, seekResponse{Partition: int32(partition), Offset: offset})
+			return
+		}
+
+	default:
+		server.WriteError(w, http.StatusNotFound, server.ErrorResponse{
+			Error:     "unknown action",
+			ErrorCode: "unknown_consumer_action",
+		})
+		return
+	}
+
+	if err != nil {
+		writeConsumerActionError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeInvalidConsumerAction(w http.ResponseWriter, err error, message string) {
+	response := server.ErrorResponse{
+		Error:     "invalid request",
+		ErrorCode: "invalid_consumer_action",
+		Message:   message,
+	}
+	if err != nil {
+		response.Error = err.Error()
+	}
+
+	server.WriteError(w, http.StatusBadRequest, response)
+}
+
+func writeConsumerActionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, kafka.ErrPartitionNotAssigned):
+		server.WriteError(w, http.StatusNotFound, server.ErrorResponse{
+			Error:     err.Error(),
+			ErrorCode: "partition_not_assigned",
+		})
+
+	case errors.Is(err, kafka.ErrOffsetCommitted):
+		server.WriteError(w, http.StatusConflict, server.ErrorResponse{
+			Error:     err.Error(),
+			ErrorCode: "offset_committed",
+		})
+
+	default:
+		utils.CaptureError(err)
+		server.WriteError(w, http.StatusInternalServerError, server.ErrorResponse{
+			Error:     err.Error(),
+			ErrorCode: "consumer_action_error",
+		})
+	}
+}
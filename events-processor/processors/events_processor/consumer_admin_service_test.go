@@ -0,0 +1,203 @@
+package events_processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/getlago/lago/events-processor/config/kafka"
+	"github.com/getlago/lago/events-processor/models"
+)
+
+type mockConsumerGroup struct {
+	paused      map[int32]bool
+	skipped     map[int32]int64
+	seekedAt    time.Time
+	seekedTo    int64
+	seekFailure error
+}
+
+func (m *mockConsumerGroup) partition(partition int32) error {
+	if partition > 1 {
+		return fmt.Errorf("%w: partition %d", kafka.ErrPartitionNotAssigned, partition)
+	}
+	return nil
+}
+
+func (m *mockConsumerGroup) Assignments() []kafka.PartitionAssignment {
+	return []kafka.PartitionAssignment{
+		{Topic: "events_raw", Partition: 0, LastProcessedOffset: 41, CommittedOffset: 42, Paused: m.paused[0]},
+		{Topic: "events_raw", Partition: 1, LastProcessedOffset: -1, CommittedOffset: -1, Paused: m.paused[1]},
+	}
+}
+
+func (m *mockConsumerGroup) PausePartition(partition int32) error {
+	if err := m.partition(partition); err != nil {
+		return err
+	}
+	m.paused[partition] = true
+	return nil
+}
+
+func (m *mockConsumerGroup) ResumePartition(partition int32) error {
+	if err := m.partition(partition); err != nil {
+		return err
+	}
+	delete(m.paused, partition)
+	return nil
+}
+
+func (m *mockConsumerGroup) SkipOffset(ctx context.Context, partition int32, offset int64) error {
+	if err := m.partition(partition); err != nil {
+		return err
+	}
+	if offset < 42 {
+		return fmt.Errorf("%w: offset %d", kafka.ErrOffsetCommitted, offset)
+	}
+	m.skipped[partition] = offset
+	return nil
+}
+
+func (m *mockConsumerGroup) SeekToTimestamp(ctx context.Context, partition int32, timestamp time.Time) (int64, error) {
+	if err := m.partition(partition); err != nil {
+		return 0, err
+	}
+	if m.seekFailure != nil {
+		return 0, m.seekFailure
+	}
+	m.seekedAt = timestamp
+	return m.seekedTo, nil
+}
+
+func TestConsumerAdminServeHTTP(t *testing.T) {
+	consumerGroup := &mockConsumerGroup{
+		paused:   make(map[int32]bool),
+		skipped:  make(map[int32]int64),
+		seekedTo: 100,
+	}
+	laneConsumerGroup := &mockConsumerGroup{
+		paused:  make(map[int32]bool),
+		skipped: make(map[int32]int64),
+	}
+	service := NewConsumerAdminService(consumerGroup)
+	service.AddLane("premium", laneConsumerGroup)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /consumer_groups/{consumer_group}/partitions", service)
+	mux.Handle("POST /consumer_groups/{consumer_group}/partitions/{partition}/{action}", service)
+
+	serve := func(method string, path string, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return recorder
+	}
+
+	t.Run("With a paused partition", func(t *testing.T) {
+		response := serve(http.MethodPost, "/consumer_groups/default/partitions/0/pause", "")
+		require.Equal(t, http.StatusNoContent, response.Code)
+
+		response = serve(http.MethodGet, "/consumer_groups/default/partitions", "")
+		require.Equal(t, http.StatusOK, response.Code)
+
+		assignments := []kafka.PartitionAssignment{}
+		require.NoError(t, json.Unmarshal(response.Body.Bytes(), &assignments))
+		require.Len(t, assignments, 2)
+		assert.True(t, assignments[0].Paused)
+		assert.Equal(t, int64(41), assignments[0].LastProcessedOffset)
+		assert.Equal(t, int64(42), assignments[0].CommittedOffset)
+		assert.False(t, assignments[1].Paused)
+
+		response = serve(http.MethodPost, "/consumer_groups/default/partitions/0/resume", "")
+		require.Equal(t, http.StatusNoContent, response.Code)
+		assert.Empty(t, consumerGroup.paused)
+	})
+
+	t.Run("With a skipped offset", func(t *testing.T) {
+		response := serve(http.MethodPost, "/consumer_groups/default/partitions/1/skip", `{"offset": 42}`)
+		require.Equal(t, http.StatusNoContent, response.Code)
+		assert.Equal(t, int64(42), consumerGroup.skipped[1])
+
+		response = serve(http.MethodPost, "/consumer_groups/default/partitions/1/skip", `{"offset": 12}`)
+		assert.Equal(t, http.StatusConflict, response.Code)
+		assert.Contains(t, response.Body.String(), "offset_committed")
+
+		response = serve(http.MethodPost, "/consumer_groups/default/partitions/1/skip", `{}`)
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Contains(t, response.Body.String(), "invalid_consumer_action")
+	})
+
+	t.Run("With a seek to a timestamp", func(t *testing.T) {
+		response := serve(http.MethodPost, "/consumer_groups/default/partitions/0/seek", `{"timestamp": "2025-03-01T12:00:00Z"}`)
+		require.Equal(t, http.StatusOK, response.Code)
+		assert.JSONEq(t, `{"partition": 0, "offset": 100}`, response.Body.String())
+		assert.Equal(t, time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC), consumerGroup.seekedAt)
+
+		response = serve(http.MethodPost, "/consumer_groups/default/partitions/0/seek", `{"timestamp": "yesterday"}`)
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+
+		consumerGroup.seekFailure = errors.New("broker unavailable")
+		defer func() { consumerGroup.seekFailure = nil }()
+
+		response = serve(http.MethodPost, "/consumer_groups/default/partitions/0/seek", `{"timestamp": "2025-03-01T12:00:00Z"}`)
+		assert.Equal(t, http.StatusInternalServerError, response.Code)
+		assert.Contains(t, response.Body.String(), "consumer_action_error")
+	})
+
+	t.Run("With a lane consumer group", func(t *testing.T) {
+		response := serve(http.MethodPost, "/consumer_groups/premium/partitions/1/pause", "")
+		require.Equal(t, http.StatusNoContent, response.Code)
+		assert.True(t, laneConsumerGroup.paused[1])
+		assert.Empty(t, consumerGroup.paused)
+
+		response = serve(http.MethodPost, "/consumer_groups/premium/partitions/1/skip", `{"offset": 50}`)
+		require.Equal(t, http.StatusNoContent, response.Code)
+		assert.Equal(t, int64(50), laneConsumerGroup.skipped[1])
+		assert.Equal(t, int64(42), consumerGroup.skipped[1])
+
+		response = serve(http.MethodGet, "/consumer_groups/unknown/partitions", "")
+		assert.Equal(t, http.StatusNotFound, response.Code)
+		assert.Contains(t, response.Body.String(), "unknown_consumer_group")
+	})
+
+	t.Run("With an invalid partition or action", func(t *testing.T) {
+		response := serve(http.MethodPost, "/consumer_groups/default/partitions/3/pause", "")
+		assert.Equal(t, http.StatusNotFound, response.Code)
+		assert.Contains(t, response.Body.String(), "partition_not_assigned")
+
+		response = serve(http.MethodPost, "/consumer_groups/default/partitions/first/pause", "")
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+
+		response = serve(http.MethodPost, "/consumer_groups/default/partitions/0/rewind", "")
+		assert.Equal(t, http.StatusNotFound, response.Code)
+		assert.Contains(t, response.Body.String(), "unknown_consumer_action")
+	})
+}
+
+func TestSkipRecord(t *testing.T) {
+	testEnv := setupProcessorTestEnv(t, true)
+	defer testEnv.Cleanup()
+
+	events := buildScheduledEvents("org_id")
+	events[0].record.Offset = 42
+	testEnv.EventProcessor.SkipRecord(context.Background(), events[0].record)
+
+	require.Equal(t, 1, testEnv.Producers.deadLetterProducer.ExecutionCount)
+
+	failedEvent := models.FailedEvent{}
+	require.NoError(t, json.Unmarshal(testEnv.Producers.deadLetterProducer.Value, &failedEvent))
+	assert.Equal(t, "skipped_record", failedEvent.ErrorCode)
+	assert.Equal(t, "org_id", failedEvent.Event.OrganizationID)
+
+	testEnv.EventProcessor.SkipRecord(context.Background(), &kgo.Record{Value: []byte("invalid")})
+	assert.Equal(t, 1, testEnv.Producers.deadLetterProducer.ExecutionCount)
+}
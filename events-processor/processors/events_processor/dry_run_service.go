@@ -0,0 +1,179 @@
+package events_processor
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/server"
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+// Maximum size of the event sent to the dry run endpoint
+const DRY_RUN_MAX_BODY_SIZE = 1 << 20
+
+// DryRunService runs the enrichment of an event without producing anything
+// to Kafka and without touching the Redis stores
+type DryRunService struct {
+	enrichmentService              *EventEnrichmentService
+	expandedInAdvanceOrganizations organizationSet
+}
+
+// DryRunResult lists the records that would be produced.
+// An event sent with an external customer ID yields one enriched event per subscription.
+// The charged in advance events don't carry their estimated fee, it depends on the usage aggregated in Redis.
+type DryRunResult struct {
+	EnrichedEvents         []*models.EnrichedEvent `json:"enriched_events"`
+	EnrichedExpandedEvents []*models.EnrichedEvent `json:"enriched_expanded_events"`
+	LateEvents             []*models.EnrichedEvent `json:"late_events"`
+	UnbilledEvents         []*models.EnrichedEvent `json:"unbilled_events"`
+	ChargedInAdvanceEvents []*models.EnrichedEvent `json:"charged_in_advance_events"`
+	BillableMetric         *models.BillableMetric  `json:"billable_metric"`
+	Customer               *models.Customer        `json:"customer"`
+	Subscriptions          []*models.Subscription  `json:"subscriptions"`
+	Plans                  []*models.Plan          `json:"plans"`
+	FlatFilters            []*models.FlatFilter    `json:"flat_filters"`
+}
+
+func NewDryRunService(enrichmentService *EventEnrichmentService) *DryRunService {
+	return &DryRunService{
+		enrichmentService: enrichmentService,
+	}
+}
+
+// SetExpandedInAdvanceOrganizations mirrors the option of the event processor,
+// the charged in advance events of these organizations are listed per pay in advance charge
+func (s *DryRunService) SetExpandedInAdvanceOrganizations(organizationIDs []string) {
+	s.expandedInAdvanceOrganizations = newOrganizationSet(organizationIDs)
+}
+
+// DryRun returns what the processor would produce for the event
+func (s *DryRunService) DryRun(event *models.Event) utils.Result[*DryRunResult] {
+	enrichedEventsResult := s.enrichmentService.EnrichEvent(event)
+	if enrichedEventsResult.Failure() {
+		return failedDryRunResult(enrichedEventsResult)
+	}
+
+	enrichedEvents := enrichedEventsResult.Value()
+
+	result := &DryRunResult{
+		EnrichedEvents:         []*models.EnrichedEvent{},
+		EnrichedExpandedEvents: []*models.EnrichedEvent{},
+		LateEvents:             []*models.EnrichedEvent{},
+		UnbilledEvents:         []*models.EnrichedEvent{},
+		ChargedInAdvanceEvents: []*models.EnrichedEvent{},
+		BillableMetric:         enrichedEvents[0].BillableMetric,
+		Customer:               enrichedEvents[0].Customer,
+		Subscriptions:          []*models.Subscription{},
+		Plans:                  []*models.Plan{},
+		FlatFilters:            []*models.FlatFilter{},
+	}
+
+	subscriptionGroups, lateEvents := splitLateEvents(groupBySubscription(enrichedEvents))
+	expandedInAdvance := s.expandedInAdvanceOrganizations.Contains(event.OrganizationID)
+
+	// Mirrors the records built by EventProducerService
+	for _, ev := range lateEvents {
+		lateEvent := *ev
+		lateEvent.ID = lateEvent.EnrichedID()
+		result.LateEvents = append(result.LateEvents, &lateEvent)
+		result.appendSubscription(ev)
+	}
+
+	for _, subscriptionEvents := range subscriptionGroups {
+		enrichedEvent := *subscriptionEvents[0]
+		enrichedEvent.ID = enrichedEvent.EnrichedID()
+		result.EnrichedEvents = append(result.EnrichedEvents, &enrichedEvent)
+		result.appendSubscription(subscriptionEvents[0])
+
+		if isChargedInAdvance(event, subscriptionEvents) {
+			result.appendChargedInAdvanceEvents(subscriptionEvents, expandedInAdvance)
+		}
+
+		if reason, ok := unbilledReason(subscriptionEvents); ok {
+			unbilledEvent := enrichedEvent
+			unbilledEvent.UnbilledReason = string(reason)
+			result.UnbilledEvents = append(result.UnbilledEvents, &unbilledEvent)
+		}
+
+		for _, ev := range subscriptionEvents {
+			if ev.ChargeID == nil {
+				continue
+			}
+
+			expandedEvent := *ev
+			expandedEvent.ID = expandedEvent.ExpandedID()
+			result.EnrichedExpandedEvents = append(result.EnrichedExpandedEvents, &expandedEvent)
+			result.FlatFilters = append(result.FlatFilters, ev.FlatFilter)
+		}
+	}
+
+	return utils.SuccessResult(result)
+}
+
+func (r *DryRunResult) appendChargedInAdvanceEvents(subscriptionEvents []*models.EnrichedEvent, expandedInAdvance bool) {
+	if !expandedInAdvance {
+		inAdvanceEvent := *subscriptionEvents[0]
+		inAdvanceEvent.ID = inAdvanceEvent.EnrichedID()
+		r.ChargedInAdvanceEvents = append(r.ChargedInAdvanceEvents, &inAdvanceEvent)
+		return
+	}
+
+	for _, ev := range payInAdvanceEvents(subscriptionEvents) {
+		inAdvanceEvent := *ev
+		inAdvanceEvent.ID = inAdvanceEvent.ExpandedID()
+		r.ChargedInAdvanceEvents = append(r.ChargedInAdvanceEvents, &inAdvanceEvent)
+	}
+}
+
+func (r *DryRunResult) appendSubscription(enrichedEvent *models.EnrichedEvent) {
+	if enrichedEvent.Subscription != nil {
+		r.Subscriptions = append(r.Subscriptions, enrichedEvent.Subscription)
+	}
+	if enrichedEvent.Plan != nil {
+		r.Plans = append(r.Plans, enrichedEvent.Plan)
+	}
+}
+
+// ServeHTTP accepts a raw event as JSON body and responds with the dry run result
+func (s *DryRunService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	event := models.Event{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, DRY_RUN_MAX_BODY_SIZE)).Decode(&event); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			server.WriteError(w, http.StatusRequestEntityTooLarge, server.ErrorResponse{
+				Error:     err.Error(),
+				ErrorCode: "event_too_large",
+				Message:   "The event exceeds the maximum body size",
+			})
+			return
+		}
+
+		server.WriteError(w, http.StatusBadRequest, server.ErrorResponse{
+			Error:     err.Error(),
+			ErrorCode: "invalid_event",
+			Message:   "Error while decoding the event",
+		})
+		return
+	}
+
+	result := s.DryRun(&event)
+	if result.Failure() {
+		server.WriteError(w, http.StatusUnprocessableEntity, server.ErrorResponse{
+			Error:     result.ErrorMsg(),
+			ErrorCode: result.ErrorCode(),
+			Message:   result.ErrorMessage(),
+		})
+		return
+	}
+
+	server.WriteJSON(w, http.StatusOK, result.Value())
+}
+
+func failedDryRunResult(r utils.AnyResult) utils.Result[*DryRunResult] {
+	result := utils.FailedResult[*DryRunResult](r.Error()).AddErrorDetails(r.ErrorCode(), r.ErrorMessage())
+	result.Retryable = r.IsRetryable()
+	result.Capture = r.IsCapturable()
+	return result
+}
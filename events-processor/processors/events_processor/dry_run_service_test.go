@@ -0,0 +1,191 @@
+package events_processor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/server"
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+func TestDryRun(t *testing.T) {
+	now := time.Now()
+	orgID := "1a901a90-1a90-1a90-1a90-1a901a901a90"
+
+	event := models.Event{
+		OrganizationID:         orgID,
+		ExternalSubscriptionID: "sub_id",
+		TransactionID:          "transaction_id",
+		Code:                   "api_calls",
+		Timestamp:              1741007009.0,
+		Properties:             map[string]any{"scheme": "visa", "country": "france"},
+		Source:                 "SQS",
+	}
+
+	setupDryRunTestEnv := func(t *testing.T) (*enrichmentTestEnv, *DryRunService) {
+		testEnv := setupEnrichmentTestEnv(t, false)
+
+		testEnv.DataStore.SetBillableMetric(&models.BillableMetric{
+			ID:              "bm123",
+			OrganizationID:  orgID,
+			Code:            event.Code,
+			AggregationType: models.AggregationTypeCount,
+			CreatedAt:       utils.NowNullTime(),
+			UpdatedAt:       utils.NowNullTime(),
+		})
+		testEnv.DataStore.SetSubscription(&models.Subscription{
+			ID:             "sub123",
+			OrganizationID: &event.OrganizationID,
+			ExternalID:     event.ExternalSubscriptionID,
+			PlanID:         "plan_id",
+			StartedAt:      utils.NewNullTime(time.Unix(1700000000, 0)),
+		})
+		testEnv.DataStore.SetFlatFilters([]*models.FlatFilter{
+			{
+				OrganizationID:        orgID,
+				BillableMetricCode:    event.Code,
+				PlanID:                "plan_id",
+				PayInAdvance:          true,
+				ChargeID:              "charge1",
+				ChargeUpdatedAt:       now,
+				ChargeFilterID:        utils.StringPtr("charge_filter1"),
+				ChargeFilterUpdatedAt: &now,
+				Filters:               &models.FlatFilterValues{"scheme": []string{"visa"}},
+				PricingGroupKeys:      []string{"country"},
+			},
+		})
+
+		return testEnv, NewDryRunService(testEnv.EventProcessor)
+	}
+
+	t.Run("With a valid event", func(t *testing.T) {
+		testEnv, service := setupDryRunTestEnv(t)
+		defer testEnv.Cleanup()
+
+		result := service.DryRun(&event)
+		assert.True(t, result.Success())
+
+		dryRun := result.Value()
+		assert.Equal(t, "bm123", dryRun.BillableMetric.ID)
+		assert.Equal(t, 1, len(dryRun.Subscriptions))
+		assert.Equal(t, "sub123", dryRun.Subscriptions[0].ID)
+		require.Equal(t, 1, len(dryRun.ChargedInAdvanceEvents))
+		assert.Equal(t, dryRun.EnrichedEvents[0].ID, dryRun.ChargedInAdvanceEvents[0].ID)
+
+		assert.Equal(t, 1, len(dryRun.EnrichedEvents))
+		assert.Equal(t, dryRun.EnrichedEvents[0].EnrichedID(), dryRun.EnrichedEvents[0].ID)
+
+		assert.Equal(t, 1, len(dryRun.EnrichedExpandedEvents))
+		expandedEvent := dryRun.EnrichedExpandedEvents[0]
+		assert.Equal(t, expandedEvent.ExpandedID(), expandedEvent.ID)
+		assert.Equal(t, "charge1", *expandedEvent.ChargeID)
+		assert.Equal(t, "charge_filter1", *expandedEvent.ChargeFilterID)
+		assert.Equal(t, map[string]string{"country": "france"}, expandedEvent.GroupedBy)
+
+		assert.Equal(t, 1, len(dryRun.FlatFilters))
+		assert.Equal(t, "charge_filter1", *dryRun.FlatFilters[0].ChargeFilterID)
+	})
+
+	t.Run("With expanded charged in advance events", func(t *testing.T) {
+		testEnv, service := setupDryRunTestEnv(t)
+		defer testEnv.Cleanup()
+
+		service.SetExpandedInAdvanceOrganizations([]string{orgID})
+
+		result := service.DryRun(&event)
+		assert.True(t, result.Success())
+
+		dryRun := result.Value()
+		require.Equal(t, 1, len(dryRun.ChargedInAdvanceEvents))
+		assert.Equal(t, dryRun.EnrichedExpandedEvents[0].ID, dryRun.ChargedInAdvanceEvents[0].ID)
+		assert.Equal(t, "charge_filter1", *dryRun.ChargedInAdvanceEvents[0].ChargeFilterID)
+	})
+
+	t.Run("With an API post processed event", func(t *testing.T) {
+		testEnv, service := setupDryRunTestEnv(t)
+		defer testEnv.Cleanup()
+
+		apiEvent := event
+		apiEvent.Source = models.HTTP_RUBY
+		apiEvent.SourceMetadata = &models.SourceMetadata{ApiPostProcess: true}
+
+		result := service.DryRun(&apiEvent)
+		assert.True(t, result.Success())
+		assert.Empty(t, result.Value().ChargedInAdvanceEvents)
+	})
+
+	t.Run("When the billable metric is not found", func(t *testing.T) {
+		testEnv := setupEnrichmentTestEnv(t, false)
+		defer testEnv.Cleanup()
+
+		testEnv.DataStore.ExpectBillableMetricNotFound()
+
+		result := NewDryRunService(testEnv.EventProcessor).DryRun(&event)
+		assert.False(t, result.Success())
+		assert.Equal(t, "fetch_billable_metric", result.ErrorCode())
+		assert.False(t, result.IsRetryable())
+	})
+}
+
+func TestDryRunHTTP(t *testing.T) {
+	t.Run("With an invalid body", func(t *testing.T) {
+		testEnv := setupEnrichmentTestEnv(t, false)
+		defer testEnv.Cleanup()
+
+		req := httptest.NewRequest(http.MethodPost, "/dry_run/enrich", strings.NewReader("{invalid"))
+		rec := httptest.NewRecorder()
+
+		NewDryRunService(testEnv.EventProcessor).ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		var response server.ErrorResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, "invalid_event", response.ErrorCode)
+	})
+
+	t.Run("When the enrichment fails", func(t *testing.T) {
+		testEnv := setupEnrichmentTestEnv(t, false)
+		defer testEnv.Cleanup()
+
+		testEnv.DataStore.ExpectBillableMetricNotFound()
+
+		body := `{"organization_id":"org_id","external_subscription_id":"sub_id","code":"api_calls","timestamp":1741007009}`
+		req := httptest.NewRequest(http.MethodPost, "/dry_run/enrich", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		NewDryRunService(testEnv.EventProcessor).ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		var response server.ErrorResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, "fetch_billable_metric", response.ErrorCode)
+		assert.Equal(t, "Error fetching billable metric", response.Message)
+	})
+
+	t.Run("With a body exceeding the maximum size", func(t *testing.T) {
+		testEnv := setupEnrichmentTestEnv(t, false)
+		defer testEnv.Cleanup()
+
+		body := `{"organization_id":"` + strings.Repeat("a", DRY_RUN_MAX_BODY_SIZE) + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/dry_run/enrich", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		NewDryRunService(testEnv.EventProcessor).ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+		var response server.ErrorResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, "event_too_large", response.ErrorCode)
+	})
+}
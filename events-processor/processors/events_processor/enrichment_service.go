@@ -3,6 +3,9 @@ package events_processor
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
+	"slices"
+	"time"
 
 	"github.com/getlago/lago-expression/expression-go"
 	"github.com/getlago/lago/events-processor/cache"
@@ -11,15 +14,49 @@ import (
 )
 
 type EventEnrichmentService struct {
-	apiStore *models.ApiStore
-	memCache *cache.Cache
+	apiStore       *models.ApiStore
+	memCache       *cache.Cache
+	filterMatchers *models.FilterMatcherCache
+
+	// Organizations for which a filter match trace is attached to the expanded events
+	explainOrganizations organizationSet
+
+	// Late and future events policies indexed by organization ID, ALL_ORGANIZATIONS being the default policy
+	timestampPolicies map[string]*models.TimestampPolicy
 }
 
 func NewEventEnrichmentService(apiStore *models.ApiStore, memCache *cache.Cache) *EventEnrichmentService {
-	return &EventEnrichmentService{
+	service := &EventEnrichmentService{
 		apiStore: apiStore,
 		memCache: memCache,
 	}
+
+	// Compiled matchers are only reused with the cache, the API store provides no version of the filters
+	if memCache != nil {
+		service.filterMatchers = models.NewFilterMatcherCache()
+	}
+
+	return service
+}
+
+// SetExplainOrganizations enables the filter match trace for the given organizations,
+// ALL_ORGANIZATIONS enables it for every organization
+func (s *EventEnrichmentService) SetExplainOrganizations(organizationIDs []string) {
+	s.explainOrganizations = newOrganizationSet(organizationIDs)
+}
+
+// SetTimestampPolicies configures the late and future events policies.
+// The policy of an organization replaces the ALL_ORGANIZATIONS one, it is not merged with it.
+func (s *EventEnrichmentService) SetTimestampPolicies(policies map[string]*models.TimestampPolicy) {
+	s.timestampPolicies = policies
+}
+
+func (s *EventEnrichmentService) timestampPolicy(organizationID string) *models.TimestampPolicy {
+	if policy, ok := s.timestampPolicies[organizationID]; ok {
+		return policy
+	}
+
+	return s.timestampPolicies[ALL_ORGANIZATIONS]
 }
 
 func (s *EventEnrichmentService) EnrichEvent(event *models.Event) utils.Result[[]*models.EnrichedEvent] {
@@ -29,6 +66,14 @@ func (s *EventEnrichmentService) EnrichEvent(event *models.Event) utils.Result[[
 	}
 	enrichedEvent := enrichedEventResult.Value()
 
+	policy := s.timestampPolicy(event.OrganizationID)
+	if policy != nil {
+		policyResult := applyTimestampPolicy(enrichedEvent, policy.CheckIngestionTime(enrichedEvent.Time, ingestionTime(event)))
+		if policyResult.Failure() {
+			return toMultiEventsResult(policyResult)
+		}
+	}
+
 	var bmResult utils.Result[*models.BillableMetric]
 
 	if s.memCache != nil {
@@ -48,6 +93,10 @@ func (s *EventEnrichmentService) EnrichEvent(event *models.Event) utils.Result[[
 		}
 	}
 
+	if event.IsCustomerEvent() {
+		return s.enrichCustomerEvent(enrichedEvent)
+	}
+
 	var subResult utils.Result[*models.Subscription]
 	if s.memCache != nil {
 		subResult = s.memCache.SearchSubscriptions(event.OrganizationID, event.ExternalSubscriptionID, enrichedEvent.Time)
@@ -69,6 +118,28 @@ func (s *EventEnrichmentService) EnrichEvent(event *models.Event) utils.Result[[
 		if enrichSubResult.Failure() {
 			return toMultiEventsResult(enrichSubResult)
 		}
+
+		enrichCustomerResult := s.enrichWithCustomer(enrichedEvent, sub)
+		if enrichCustomerResult.Failure() {
+			return toMultiEventsResult(enrichCustomerResult)
+		}
+
+		enrichPlanResult := s.enrichWithPlan(enrichedEvent, sub)
+		if enrichPlanResult.Failure() {
+			return toMultiEventsResult(enrichPlanResult)
+		}
+
+		enrichTimezoneResult := s.enrichWithTimezoneFallbacks(enrichedEvent)
+		if enrichTimezoneResult.Failure() {
+			return toMultiEventsResult(enrichTimezoneResult)
+		}
+
+		s.enrichWithBillingPeriod(enrichedEvent)
+
+		policyResult := s.applyBillingPeriodPolicy(enrichedEvent, policy)
+		if policyResult.Failure() {
+			return toMultiEventsResult(policyResult)
+		}
 	}
 
 	enrichedEvents := s.enrichWithChargeInfo(enrichedEvent)
@@ -127,13 +198,285 @@ func (s *EventEnrichmentService) enrichWithSubscription(enrichedEvent *models.En
 	return utils.SuccessResult(enrichedEvent)
 }
 
+// Customer metadata is optional: a customer missing from the store (eg: not yet replicated) leaves the fields empty
+func (s *EventEnrichmentService) enrichWithCustomer(enrichedEvent *models.EnrichedEvent, sub *models.Subscription) utils.Result[*models.EnrichedEvent] {
+	if sub.CustomerID == "" {
+		return utils.SuccessResult(enrichedEvent)
+	}
+
+	var customerResult utils.Result[*models.Customer]
+	if s.memCache != nil {
+		customerResult = s.memCache.GetCustomer(enrichedEvent.OrganizationID, sub.CustomerID)
+	} else {
+		customerResult = s.apiStore.FetchCustomer(enrichedEvent.OrganizationID, sub.CustomerID)
+	}
+
+	if customerResult.Failure() {
+		if customerResult.IsCapturable() {
+			return failedResult(customerResult, "fetch_customer", "Error fetching customer")
+		}
+
+		return utils.SuccessResult(enrichedEvent)
+	}
+
+	setCustomer(enrichedEvent, customerResult.Value())
+	return utils.SuccessResult(enrichedEvent)
+}
+
+func setCustomer(enrichedEvent *models.EnrichedEvent, customer *models.Customer) {
+	enrichedEvent.Customer = customer
+	enrichedEvent.CustomerID = &customer.ID
+	enrichedEvent.ExternalCustomerID = &customer.ExternalID
+	enrichedEvent.BillingEntityID = customer.BillingEntityID
+}
+
+// enrichWithTimezoneFallbacks fetches the billing entity and the organization whose timezones apply to a customer without timezone.
+// They are only fetched to compute a billing period and are optional: when they are missing from the store, the periods are computed in UTC.
+func (s *EventEnrichmentService) enrichWithTimezoneFallbacks(enrichedEvent *models.EnrichedEvent) utils.Result[*models.EnrichedEvent] {
+	customer := enrichedEvent.Customer
+	if enrichedEvent.Plan == nil || (customer != nil && customer.Timezone != nil && *customer.Timezone != "") {
+		return utils.SuccessResult(enrichedEvent)
+	}
+
+	if customer != nil && customer.BillingEntityID != nil {
+		var billingEntityResult utils.Result[*models.BillingEntity]
+		if s.memCache != nil {
+			billingEntityResult = s.memCache.GetBillingEntity(enrichedEvent.OrganizationID, *customer.BillingEntityID)
+		} else {
+			billingEntityResult = s.apiStore.FetchBillingEntity(enrichedEvent.OrganizationID, *customer.BillingEntityID)
+		}
+
+		if billingEntityResult.Failure() && billingEntityResult.IsCapturable() {
+			return failedResult(billingEntityResult, "fetch_billing_entity", "Error fetching billing entity")
+		}
+		if billingEntityResult.Success() {
+			enrichedEvent.BillingEntity = billingEntityResult.Value()
+
+			if timezone := enrichedEvent.BillingEntity.Timezone; timezone != nil && *timezone != "" {
+				return utils.SuccessResult(enrichedEvent)
+			}
+		}
+	}
+
+	var organizationResult utils.Result[*models.Organization]
+	if s.memCache != nil {
+		organizationResult = s.memCache.GetOrganization(enrichedEvent.OrganizationID)
+	} else {
+		organizationResult = s.apiStore.FetchOrganization(enrichedEvent.OrganizationID)
+	}
+
+	if organizationResult.Failure() && organizationResult.IsCapturable() {
+		return failedResult(organizationResult, "fetch_organization", "Error fetching organization")
+	}
+	if organizationResult.Success() {
+		enrichedEvent.Organization = organizationResult.Value()
+	}
+
+	return utils.SuccessResult(enrichedEvent)
+}
+
+// enrichCustomerEvent fans out an event sent with an external customer ID to every active subscription of the customer
+// whose plan has a charge on the event's billable metric.
+// When no subscription matches, the event is returned without subscription information.
+func (s *EventEnrichmentService) enrichCustomerEvent(enrichedEvent *models.EnrichedEvent) utils.Result[[]*models.EnrichedEvent] {
+	externalCustomerID := enrichedEvent.InitialEvent.ExternalCustomerID
+	policy := s.timestampPolicy(enrichedEvent.OrganizationID)
+
+	var customerResult utils.Result[*models.Customer]
+	if s.memCache != nil {
+		customerResult = s.memCache.SearchCustomer(enrichedEvent.OrganizationID, externalCustomerID)
+	} else {
+		customerResult = s.apiStore.FetchCustomerByExternalID(enrichedEvent.OrganizationID, externalCustomerID)
+	}
+
+	if customerResult.Failure() {
+		if customerResult.IsCapturable() {
+			return failedMultiEventsResult(customerResult, "fetch_customer", "Error fetching customer")
+		}
+
+		enrichedEvent.ExternalCustomerID = &externalCustomerID
+		return utils.SuccessResult([]*models.EnrichedEvent{enrichedEvent})
+	}
+
+	customer := customerResult.Value()
+	setCustomer(enrichedEvent, customer)
+
+	var subsResult utils.Result[[]*models.Subscription]
+	if s.memCache != nil {
+		subsResult = s.memCache.SearchCustomerSubscriptions(enrichedEvent.OrganizationID, customer.ID, enrichedEvent.Time)
+	} else {
+		subsResult = s.apiStore.FetchCustomerSubscriptions(enrichedEvent.OrganizationID, customer.ID, enrichedEvent.Time)
+	}
+	if subsResult.Failure() {
+		return failedMultiEventsResult(subsResult, "fetch_subscription", "Error fetching customer subscriptions")
+	}
+
+	var enrichedEvents []*models.EnrichedEvent
+	for _, sub := range subsResult.Value() {
+		subscriptionEvent := *enrichedEvent
+		subscriptionEvent.GroupedBy = make(map[string]string)
+		subscriptionEvent.ExternalSubscriptionID = sub.ExternalID
+
+		enrichSubResult := s.enrichWithSubscription(&subscriptionEvent, sub)
+		if enrichSubResult.Failure() {
+			return toMultiEventsResult(enrichSubResult)
+		}
+
+		enrichPlanResult := s.enrichWithPlan(&subscriptionEvent, sub)
+		if enrichPlanResult.Failure() {
+			return toMultiEventsResult(enrichPlanResult)
+		}
+
+		enrichTimezoneResult := s.enrichWithTimezoneFallbacks(&subscriptionEvent)
+		if enrichTimezoneResult.Failure() {
+			return toMultiEventsResult(enrichTimezoneResult)
+		}
+
+		s.enrichWithBillingPeriod(&subscriptionEvent)
+
+		policyResult := s.applyBillingPeriodPolicy(&subscriptionEvent, policy)
+		if policyResult.Failure() {
+			return toMultiEventsResult(policyResult)
+		}
+
+		chargesResult := s.enrichWithChargeInfo(&subscriptionEvent)
+		if chargesResult.Failure() {
+			return chargesResult
+		}
+
+		// Subscriptions without charge on the billable metric are skipped
+		if chargesResult.Value()[0].ChargeID == nil {
+			continue
+		}
+		enrichedEvents = append(enrichedEvents, chargesResult.Value()...)
+	}
+
+	if len(enrichedEvents) == 0 {
+		enrichedEvent.SubscriptionsWithoutCharge = len(subsResult.Value()) > 0
+		return utils.SuccessResult([]*models.EnrichedEvent{enrichedEvent})
+	}
+
+	return utils.SuccessResult(enrichedEvents)
+}
+
+// The billing period can only be computed when the plan is known
+func (s *EventEnrichmentService) enrichWithBillingPeriod(enrichedEvent *models.EnrichedEvent) {
+	if enrichedEvent.Subscription == nil || enrichedEvent.Plan == nil {
+		return
+	}
+
+	period := models.ComputeBillingPeriod(
+		enrichedEvent.Subscription,
+		enrichedEvent.Plan,
+		enrichedEvent.Customer.ApplicableTimezone(enrichedEvent.BillingEntity, enrichedEvent.Organization),
+		enrichedEvent.Time,
+	)
+	if period == nil {
+		return
+	}
+
+	enrichedEvent.BillingPeriodStart = &period.Start
+	enrichedEvent.BillingPeriodEnd = &period.End
+}
+
+// applyBillingPeriodPolicy checks the lateness of the event against its billing period.
+// Clamped events are moved to the earliest billing period still open, keeping their subscription.
+func (s *EventEnrichmentService) applyBillingPeriodPolicy(enrichedEvent *models.EnrichedEvent, policy *models.TimestampPolicy) utils.Result[*models.EnrichedEvent] {
+	if policy == nil || enrichedEvent.Subscription == nil || enrichedEvent.Plan == nil {
+		return utils.SuccessResult(enrichedEvent)
+	}
+
+	decision := policy.CheckBillingPeriod(
+		enrichedEvent.Subscription,
+		enrichedEvent.Plan,
+		enrichedEvent.Customer.ApplicableTimezone(enrichedEvent.BillingEntity, enrichedEvent.Organization),
+		enrichedEvent.Time,
+		ingestionTime(enrichedEvent.InitialEvent),
+	)
+
+	result := applyTimestampPolicy(enrichedEvent, decision)
+	if result.Success() && decision != nil && decision.Action == models.TimestampPolicyClamp {
+		s.enrichWithBillingPeriod(enrichedEvent)
+	}
+
+	return result
+}
+
+// applyTimestampPolicy records the policy decision on the event,
+// events to send to the dead letter queue are returned as a non retryable failure
+func applyTimestampPolicy(enrichedEvent *models.EnrichedEvent, decision *models.TimestampPolicyDecision) utils.Result[*models.EnrichedEvent] {
+	if decision == nil || decision.Action == models.TimestampPolicyAccept {
+		return utils.SuccessResult(enrichedEvent)
+	}
+
+	if decision.Action == models.TimestampPolicyDeadLetter {
+		err := fmt.Errorf(
+			"event timestamp %s is beyond the %s limit %s",
+			enrichedEvent.Time.Format(time.RFC3339),
+			decision.Violation,
+			decision.Limit.Format(time.RFC3339),
+		)
+
+		errorCode := "event_timestamp_too_late"
+		if decision.Violation == models.TimestampViolationFuture {
+			errorCode = "event_timestamp_in_future"
+		}
+
+		return utils.FailedResult[*models.EnrichedEvent](err).
+			AddErrorDetails(errorCode, "Event timestamp rejected by the organization's timestamp policy").
+			NonRetryable().
+			NonCapturable()
+	}
+
+	enrichedEvent.ApplyTimestampPolicy(decision)
+	return utils.SuccessResult(enrichedEvent)
+}
+
+// ingestionTime returns the time the event was received by the API, the current time when it is unknown
+func ingestionTime(event *models.Event) time.Time {
+	ingestedAt := event.IngestedAt.Time()
+	if ingestedAt.IsZero() {
+		return time.Now()
+	}
+
+	return ingestedAt
+}
+
+// Plan metadata is optional: a plan missing from the store (eg: not yet replicated) leaves the fields empty
+func (s *EventEnrichmentService) enrichWithPlan(enrichedEvent *models.EnrichedEvent, sub *models.Subscription) utils.Result[*models.EnrichedEvent] {
+	var planResult utils.Result[*models.Plan]
+	if s.memCache != nil {
+		planResult = s.memCache.GetPlan(enrichedEvent.OrganizationID, sub.PlanID)
+	} else {
+		planResult = s.apiStore.FetchPlan(enrichedEvent.OrganizationID, sub.PlanID)
+	}
+
+	if planResult.Failure() {
+		if planResult.IsCapturable() {
+			return failedResult(planResult, "fetch_plan", "Error fetching plan")
+		}
+
+		return utils.SuccessResult(enrichedEvent)
+	}
+
+	plan := planResult.Value()
+	enrichedEvent.Plan = plan
+	enrichedEvent.PlanCode = &plan.Code
+	enrichedEvent.Currency = &plan.AmountCurrency
+
+	return utils.SuccessResult(enrichedEvent)
+}
+
 func (s *EventEnrichmentService) enrichWithChargeInfo(enrichedEvent *models.EnrichedEvent) utils.Result[[]*models.EnrichedEvent] {
 	if enrichedEvent.Subscription == nil {
 		return utils.SuccessResult([]*models.EnrichedEvent{enrichedEvent})
 	}
 
+	var filtersVersion uint64
 	var filtersResult utils.Result[[]*models.FlatFilter]
 	if s.memCache != nil {
+		// The version is read before the filters, so that a concurrent update always invalidates the matchers
+		filtersVersion = s.memCache.FiltersVersion(enrichedEvent.OrganizationID)
 		filtersResult = s.memCache.BuildFlatFilters(enrichedEvent.OrganizationID, enrichedEvent.Code, enrichedEvent.PlanID)
 	} else {
 		filtersResult = s.apiStore.FetchFlatFilters(enrichedEvent.OrganizationID, enrichedEvent.PlanID, enrichedEvent.Code)
@@ -157,10 +500,21 @@ func (s *EventEnrichmentService) enrichWithChargeInfo(enrichedEvent *models.Enri
 		charges[filter.ChargeID] = append(charges[filter.ChargeID], *filter)
 	}
 
+	explain := s.explainOrganizations.Contains(enrichedEvent.OrganizationID)
+
 	var enrichedEvents []*models.EnrichedEvent
-	// For each charge, find matching filter and create an enriched event
-	for _, chargeFilters := range charges {
-		matchingFilter := models.MatchingFilter(chargeFilters, enrichedEvent)
+	// For each charge, find matching filter and create an enriched event.
+	// Charges are iterated by ID so that the expanded events are always built in the same order.
+	for _, chargeID := range slices.Sorted(maps.Keys(charges)) {
+		matcher := s.filterMatchers.Get(chargeID, filtersVersion, charges[chargeID])
+
+		var matchingFilter *models.FlatFilter
+		var matchTrace *models.FilterMatchTrace
+		if explain {
+			matchingFilter, matchTrace = matcher.Explain(enrichedEvent)
+		} else {
+			matchingFilter = matcher.Match(enrichedEvent)
+		}
 
 		// Create a copy of the enriched event for this filter
 		enrichedEventCopy := *enrichedEvent
@@ -172,15 +526,70 @@ func (s *EventEnrichmentService) enrichWithChargeInfo(enrichedEvent *models.Enri
 		enrichedEventCopy.ChargeUpdatedAt = &matchingFilter.ChargeUpdatedAt
 		enrichedEventCopy.ChargeFilterID = matchingFilter.ChargeFilterID
 		enrichedEventCopy.ChargeFilterUpdatedAt = matchingFilter.ChargeFilterUpdatedAt
+		enrichedEventCopy.MatchTrace = matchTrace
 
 		enrichWithPricingGroupKeys(&enrichedEventCopy)
 
 		enrichedEvents = append(enrichedEvents, &enrichedEventCopy)
 	}
 
+	walletResult := s.enrichWithTargetWallet(enrichedEvents)
+	if walletResult.Failure() {
+		return walletResult
+	}
+
 	return utils.SuccessResult(enrichedEvents)
 }
 
+// enrichWithTargetWallet resolves the wallet targeted by the events.
+// A target wallet code must match an active wallet of the customer, otherwise the usage could never be settled.
+func (s *EventEnrichmentService) enrichWithTargetWallet(enrichedEvents []*models.EnrichedEvent) utils.Result[[]*models.EnrichedEvent] {
+	wallets := make(map[string]*models.Wallet)
+
+	for _, event := range enrichedEvents {
+		if event.TargetWalletCode == nil {
+			continue
+		}
+
+		code := *event.TargetWalletCode
+		wallet, ok := wallets[code]
+		if !ok {
+			if event.CustomerID == nil {
+				return unknownTargetWalletResult(code)
+			}
+
+			var walletResult utils.Result[*models.Wallet]
+			if s.memCache != nil {
+				walletResult = s.memCache.SearchActiveWallet(event.OrganizationID, *event.CustomerID, code)
+			} else {
+				walletResult = s.apiStore.FetchActiveWalletByCode(event.OrganizationID, *event.CustomerID, code)
+			}
+
+			if walletResult.Failure() {
+				if walletResult.IsCapturable() {
+					return failedMultiEventsResult(walletResult, "fetch_wallet", "Error fetching target wallet")
+				}
+
+				return unknownTargetWalletResult(code)
+			}
+
+			wallet = walletResult.Value()
+			wallets[code] = wallet
+		}
+
+		event.TargetWallet = wallet
+	}
+
+	return utils.SuccessResult(enrichedEvents)
+}
+
+func unknownTargetWalletResult(code string) utils.Result[[]*models.EnrichedEvent] {
+	return utils.FailedResult[[]*models.EnrichedEvent](fmt.Errorf("no active wallet found with code %s", code)).
+		AddErrorDetails("unknown_target_wallet", "Target wallet code does not match any active wallet of the customer").
+		NonCapturable().
+		NonRetryable()
+}
+
 func enrichWithPricingGroupKeys(event *models.EnrichedEvent) {
 	if event.FlatFilter == nil {
 		return
@@ -2,7 +2,7 @@ package events_processor
 
 import (
 	"context"
-	"sort"
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -286,10 +286,8 @@ func TestEnrichEvent(t *testing.T) {
 				assert.True(t, enrichResult.Success())
 				assert.Equal(t, 2, len(enrichResult.Value()))
 
+				// Expanded events are ordered by charge ID
 				events := enrichResult.Value()
-				sort.Slice(events, func(i, j int) bool {
-					return *events[i].ChargeID < *events[j].ChargeID
-				})
 
 				eventResult1 := events[0]
 				assert.Equal(t, "12", *eventResult1.Value)
@@ -302,6 +300,124 @@ func TestEnrichEvent(t *testing.T) {
 				assert.Equal(t, map[string]string{}, eventResult2.GroupedBy)
 			})
 
+			t.Run("With multiple flat filters in a non sorted order", func(t *testing.T) {
+				testEnv := setupEnrichmentTestEnv(t, mode.useCache)
+				defer testEnv.Cleanup()
+
+				event := models.Event{
+					OrganizationID:         "1a901a90-1a90-1a90-1a90-1a901a901a90",
+					ExternalSubscriptionID: "sub_id",
+					TransactionID:          "transaction_id",
+					Code:                   "api_calls",
+					Timestamp:              1741007009.0,
+					Properties:             map[string]any{"scheme": "visa", "method": "debit", "region": "eu"},
+					Source:                 "SQS",
+				}
+
+				bm := &models.BillableMetric{
+					ID:              "bm123",
+					OrganizationID:  event.OrganizationID,
+					Code:            event.Code,
+					AggregationType: models.AggregationTypeCount,
+					CreatedAt:       utils.NowNullTime(),
+					UpdatedAt:       utils.NowNullTime(),
+				}
+
+				sub := &models.Subscription{
+					ID:             "sub123",
+					OrganizationID: &event.OrganizationID,
+					ExternalID:     event.ExternalSubscriptionID,
+					PlanID:         "plan_id",
+					StartedAt:      utils.NewNullTime(time.Unix(1700000000, 0)),
+				}
+
+				now := time.Now()
+				flatFilters := []*models.FlatFilter{
+					{
+						OrganizationID:        event.OrganizationID,
+						BillableMetricCode:    event.Code,
+						PlanID:                "plan_id",
+						ChargeID:              "charge3",
+						ChargeUpdatedAt:       now,
+						ChargeFilterID:        utils.StringPtr("charge_filter_b"),
+						ChargeFilterUpdatedAt: &now,
+						Filters:               &models.FlatFilterValues{"scheme": []string{"visa"}},
+					},
+					{
+						OrganizationID:        event.OrganizationID,
+						BillableMetricCode:    event.Code,
+						PlanID:                "plan_id",
+						ChargeID:              "charge3",
+						ChargeUpdatedAt:       now,
+						ChargeFilterID:        utils.StringPtr("charge_filter_a"),
+						ChargeFilterUpdatedAt: &now,
+						Filters:               &models.FlatFilterValues{"method": []string{"debit"}},
+					},
+					{
+						OrganizationID:     event.OrganizationID,
+						BillableMetricCode: event.Code,
+						PlanID:             "plan_id",
+						ChargeID:           "charge1",
+						ChargeUpdatedAt:    now,
+					},
+					{
+						OrganizationID:     event.OrganizationID,
+						BillableMetricCode: event.Code,
+						PlanID:             "plan_id",
+						ChargeID:           "charge2",
+						ChargeUpdatedAt:    now,
+						PricingGroupKeys:   []string{"region", "scheme"},
+					},
+				}
+
+				var previousJSON [][]byte
+				for range 3 {
+					testEnv.DataStore.SetBillableMetric(bm)
+					testEnv.DataStore.SetSubscription(sub)
+					testEnv.DataStore.SetFlatFilters(flatFilters)
+					if mode.useCache {
+						for _, ff := range flatFilters {
+							testEnv.DataStore.SetCharge(&models.Charge{
+								ID:               ff.ChargeID,
+								OrganizationID:   event.OrganizationID,
+								PlanID:           "plan_id",
+								BillableMetricID: bm.ID,
+								PricingGroupKeys: utils.StringArray(ff.PricingGroupKeys),
+								UpdatedAt:        utils.NewNullTime(now),
+							})
+						}
+					}
+
+					enrichResult := testEnv.EventProcessor.EnrichEvent(&event)
+					assert.True(t, enrichResult.Success())
+
+					events := enrichResult.Value()
+					assert.Equal(t, 3, len(events))
+					assert.Equal(t, "charge1", *events[0].ChargeID)
+					assert.Equal(t, "charge2", *events[1].ChargeID)
+					assert.Equal(t, "charge3", *events[2].ChargeID)
+
+					eventsJSON := make([][]byte, 0, len(events))
+					for _, ev := range events {
+						eventJSON, err := json.Marshal(ev)
+						assert.NoError(t, err)
+						eventsJSON = append(eventsJSON, eventJSON)
+					}
+
+					if previousJSON != nil {
+						assert.Equal(t, previousJSON, eventsJSON)
+					}
+					previousJSON = eventsJSON
+				}
+
+				if !mode.useCache {
+					// Both filters of charge3 match a single key, the lowest charge filter ID wins
+					var lastEvent models.EnrichedEvent
+					assert.NoError(t, json.Unmarshal(previousJSON[2], &lastEvent))
+					assert.Equal(t, "charge_filter_a", *lastEvent.ChargeFilterID)
+				}
+			})
+
 			t.Run("With a flat filter with pricing group keys", func(t *testing.T) {
 				testEnv := setupEnrichmentTestEnv(t, mode.useCache)
 				defer testEnv.Cleanup()
@@ -460,10 +576,17 @@ func TestEnrichEvent(t *testing.T) {
 				}
 				testEnv.DataStore.SetBillableMetricFilter(bmf)
 
+				testEnv.DataStore.SetCustomer(&models.Customer{
+					ID:             "cus123",
+					OrganizationID: orgID,
+					ExternalID:     "cus_external",
+				})
+
 				sub := &models.Subscription{
 					ID:             "sub123",
 					OrganizationID: &orgID,
 					ExternalID:     extSubID,
+					CustomerID:     "cus123",
 					PlanID:         planID,
 					StartedAt:      utils.NewNullTime(time.Unix(1700000000, 0)),
 				}
@@ -512,6 +635,14 @@ func TestEnrichEvent(t *testing.T) {
 					testEnv.DataStore.SetFlatFilters([]*models.FlatFilter{flatFilter})
 				}
 
+				testEnv.DataStore.SetWallet(&models.Wallet{
+					ID:             "wallet_id1",
+					OrganizationID: orgID,
+					CustomerID:     "cus123",
+					Code:           utils.StringPtr("wallet123"),
+					Status:         models.WalletStatusActive,
+				})
+
 				enrichResult := testEnv.EventProcessor.EnrichEvent(&event)
 				assert.True(t, enrichResult.Success())
 				assert.Equal(t, 1, len(enrichResult.Value()))
@@ -521,6 +652,7 @@ func TestEnrichEvent(t *testing.T) {
 				assert.Equal(t, "charge_id1", *eventResult.ChargeID)
 				assert.Equal(t, map[string]string{"target_wallet_code": "wallet123"}, eventResult.GroupedBy)
 				assert.Equal(t, "wallet123", *eventResult.TargetWalletCode)
+				assert.Equal(t, "wallet_id1", eventResult.TargetWallet.ID)
 			})
 
 			t.Run("With a flat filter with pricing group keys and accepting target wallet code", func(t *testing.T) {
@@ -571,10 +703,17 @@ func TestEnrichEvent(t *testing.T) {
 				}
 				testEnv.DataStore.SetBillableMetricFilter(bmf)
 
+				testEnv.DataStore.SetCustomer(&models.Customer{
+					ID:             "cus123",
+					OrganizationID: orgID,
+					ExternalID:     "cus_external",
+				})
+
 				sub := &models.Subscription{
 					ID:             "sub123",
 					OrganizationID: &orgID,
 					ExternalID:     extSubID,
+					CustomerID:     "cus123",
 					PlanID:         planID,
 					StartedAt:      utils.NewNullTime(time.Unix(1700000000, 0)),
 				}
@@ -626,6 +765,14 @@ func TestEnrichEvent(t *testing.T) {
 					testEnv.DataStore.SetFlatFilters([]*models.FlatFilter{flatFilter})
 				}
 
+				testEnv.DataStore.SetWallet(&models.Wallet{
+					ID:             "wallet_id1",
+					OrganizationID: orgID,
+					CustomerID:     "cus123",
+					Code:           utils.StringPtr("wallet123"),
+					Status:         models.WalletStatusActive,
+				})
+
 				enrichResult := testEnv.EventProcessor.EnrichEvent(&event)
 				assert.True(t, enrichResult.Success())
 				assert.Equal(t, 1, len(enrichResult.Value()))
@@ -637,6 +784,122 @@ func TestEnrichEvent(t *testing.T) {
 				assert.Equal(t, "wallet123", *eventResult.TargetWalletCode)
 			})
 
+			t.Run("With an unknown target wallet code", func(t *testing.T) {
+				testEnv := setupEnrichmentTestEnv(t, mode.useCache)
+				defer testEnv.Cleanup()
+
+				orgID := uuid.New().String()
+				bmID := uuid.New().String()
+				extSubID := "sub_id"
+				bmCode := "test_metric"
+				planID := "plan_id"
+
+				properties := map[string]any{
+					"value":              "12.12",
+					"scheme":             "visa",
+					"country":            "US",
+					"type":               "debit",
+					"target_wallet_code": "wallet123",
+				}
+
+				event := models.Event{
+					OrganizationID:         orgID,
+					ExternalSubscriptionID: extSubID,
+					Code:                   bmCode,
+					Timestamp:              1741007009.0,
+					Properties:             properties,
+					Source:                 "SQS",
+				}
+
+				bm := &models.BillableMetric{
+					ID:              bmID,
+					OrganizationID:  orgID,
+					Code:            bmCode,
+					AggregationType: models.AggregationTypeWeightedSum,
+					FieldName:       "api_requests",
+					Expression:      "round(event.properties.value)",
+					CreatedAt:       utils.NowNullTime(),
+					UpdatedAt:       utils.NowNullTime(),
+				}
+				testEnv.DataStore.SetBillableMetric(bm)
+
+				bmf := &models.BillableMetricFilter{
+					ID:               "bmf123",
+					OrganizationID:   orgID,
+					BillableMetricID: bmID,
+					Key:              "country",
+					Values:           []string{"US"},
+				}
+				testEnv.DataStore.SetBillableMetricFilter(bmf)
+
+				testEnv.DataStore.SetCustomer(&models.Customer{
+					ID:             "cus123",
+					OrganizationID: orgID,
+					ExternalID:     "cus_external",
+				})
+
+				sub := &models.Subscription{
+					ID:             "sub123",
+					OrganizationID: &orgID,
+					ExternalID:     extSubID,
+					CustomerID:     "cus123",
+					PlanID:         planID,
+					StartedAt:      utils.NewNullTime(time.Unix(1700000000, 0)),
+				}
+				testEnv.DataStore.SetSubscription(sub)
+
+				if mode.useCache {
+					charge := &models.Charge{
+						ID:                  "charge_id1",
+						OrganizationID:      orgID,
+						BillableMetricID:    bmID,
+						PlanID:              planID,
+						UpdatedAt:           utils.NowNullTime(),
+						AcceptsTargetWallet: true,
+					}
+					testEnv.DataStore.SetCharge(charge)
+
+					chargeFilter := &models.ChargeFilter{
+						ID:             "charge_filter_id1",
+						OrganizationID: orgID,
+						ChargeID:       charge.ID,
+					}
+					testEnv.DataStore.SetChargeFilter(chargeFilter)
+
+					chargeFilterValue := &models.ChargeFilterValue{
+						ID:                     uuid.New().String(),
+						OrganizationID:         orgID,
+						ChargeFilterID:         chargeFilter.ID,
+						BillableMetricFilterID: bmf.ID,
+						Values:                 []string{"US"},
+					}
+					testEnv.DataStore.SetChargeFilterValue(chargeFilterValue)
+				} else {
+					now := time.Now()
+					chargeFilterID := "charge_filter_id"
+					flatFilter := &models.FlatFilter{
+						OrganizationID:        orgID,
+						BillableMetricCode:    bmCode,
+						PlanID:                planID,
+						ChargeID:              "charge_id1",
+						ChargeUpdatedAt:       now,
+						ChargeFilterID:        &chargeFilterID,
+						ChargeFilterUpdatedAt: &now,
+						Filters:               &models.FlatFilterValues{"scheme": []string{"visa"}},
+						AcceptsTargetWallet:   true,
+					}
+					testEnv.DataStore.SetFlatFilters([]*models.FlatFilter{flatFilter})
+				}
+
+				testEnv.DataStore.ExpectWalletNotFound()
+
+				enrichResult := testEnv.EventProcessor.EnrichEvent(&event)
+				assert.False(t, enrichResult.Success())
+				assert.Equal(t, "unknown_target_wallet", enrichResult.ErrorCode())
+				assert.False(t, enrichResult.IsCapturable())
+				assert.False(t, enrichResult.IsRetryable())
+			})
+
 			t.Run("With a flat filter with accepting target wallet code and event wallet code is null", func(t *testing.T) {
 				testEnv := setupEnrichmentTestEnv(t, mode.useCache)
 				defer testEnv.Cleanup()
@@ -908,6 +1171,269 @@ func TestEnrichEvent(t *testing.T) {
 	}
 }
 
+func TestEnrichEventWithCustomerAndPlan(t *testing.T) {
+	testModes := []struct {
+		name     string
+		useCache bool
+	}{
+		{"WithCache", true},
+		{"WithoutCache", false},
+	}
+
+	orgID := "1a901a90-1a90-1a90-1a90-1a901a901a90"
+
+	event := models.Event{
+		OrganizationID:         orgID,
+		ExternalSubscriptionID: "sub_id",
+		Code:                   "api_calls",
+		Timestamp:              1741007009.0,
+		Source:                 "SQS",
+	}
+
+	bm := &models.BillableMetric{
+		ID:              "bm123",
+		OrganizationID:  orgID,
+		Code:            event.Code,
+		AggregationType: models.AggregationTypeCount,
+		CreatedAt:       utils.NowNullTime(),
+		UpdatedAt:       utils.NowNullTime(),
+	}
+
+	sub := &models.Subscription{
+		ID:             "sub123",
+		OrganizationID: &event.OrganizationID,
+		ExternalID:     event.ExternalSubscriptionID,
+		CustomerID:     "customer123",
+		PlanID:         "plan123",
+		StartedAt:      utils.NewNullTime(time.Unix(1700000000, 0)),
+	}
+
+	for _, mode := range testModes {
+		t.Run(mode.name, func(t *testing.T) {
+			t.Run("With customer and plan", func(t *testing.T) {
+				testEnv := setupEnrichmentTestEnv(t, mode.useCache)
+				defer testEnv.Cleanup()
+
+				testEnv.DataStore.SetBillableMetric(bm)
+				testEnv.DataStore.SetCustomer(&models.Customer{
+					ID:              "customer123",
+					OrganizationID:  orgID,
+					ExternalID:      "external_customer",
+					BillingEntityID: utils.StringPtr("billing_entity123"),
+					Timezone:        utils.StringPtr("Europe/Paris"),
+				})
+				testEnv.DataStore.SetPlan(&models.Plan{
+					ID:             "plan123",
+					OrganizationID: orgID,
+					Code:           "premium",
+					AmountCurrency: "USD",
+					Interval:       models.PlanIntervalMonthly,
+				})
+				testEnv.DataStore.SetSubscription(sub)
+				testEnv.DataStore.SetFlatFilters([]*models.FlatFilter{})
+
+				enrichResult := testEnv.EventProcessor.EnrichEvent(&event)
+				assert.True(t, enrichResult.Success())
+
+				eventResult := enrichResult.Value()[0]
+				assert.Equal(t, "customer123", *eventResult.CustomerID)
+				assert.Equal(t, "external_customer", *eventResult.ExternalCustomerID)
+				assert.Equal(t, "billing_entity123", *eventResult.BillingEntityID)
+				assert.Equal(t, "premium", *eventResult.PlanCode)
+				assert.Equal(t, "USD", *eventResult.Currency)
+				assert.Equal(t, "external_customer", eventResult.Customer.ExternalID)
+				assert.Equal(t, "premium", eventResult.Plan.Code)
+
+				// Calendar period of March 2025 in Paris
+				assert.Equal(t, time.Date(2025, time.February, 28, 23, 0, 0, 0, time.UTC), *eventResult.BillingPeriodStart)
+				assert.Equal(t, time.Date(2025, time.March, 31, 22, 0, 0, 0, time.UTC), *eventResult.BillingPeriodEnd)
+			})
+
+			t.Run("With a customer without timezone", func(t *testing.T) {
+				plan := &models.Plan{
+					ID:             "plan123",
+					OrganizationID: orgID,
+					Code:           "premium",
+					AmountCurrency: "USD",
+					Interval:       models.PlanIntervalMonthly,
+				}
+				customer := &models.Customer{
+					ID:              "customer123",
+					OrganizationID:  orgID,
+					ExternalID:      "external_customer",
+					BillingEntityID: utils.StringPtr("billing_entity123"),
+				}
+
+				t.Run("It uses the billing entity timezone", func(t *testing.T) {
+					testEnv := setupEnrichmentTestEnv(t, mode.useCache)
+					defer testEnv.Cleanup()
+
+					testEnv.DataStore.SetBillableMetric(bm)
+					testEnv.DataStore.SetCustomer(customer)
+					testEnv.DataStore.SetPlan(plan)
+					testEnv.DataStore.SetBillingEntity(&models.BillingEntity{
+						ID:             "billing_entity123",
+						OrganizationID: orgID,
+						Timezone:       utils.StringPtr("Europe/Paris"),
+					})
+					testEnv.DataStore.SetOrganization(&models.Organization{ID: orgID, Timezone: utils.StringPtr("Asia/Tokyo")})
+					testEnv.DataStore.SetSubscription(sub)
+					testEnv.DataStore.SetFlatFilters([]*models.FlatFilter{})
+
+					enrichResult := testEnv.EventProcessor.EnrichEvent(&event)
+					assert.True(t, enrichResult.Success())
+
+					eventResult := enrichResult.Value()[0]
+					assert.Equal(t, time.Date(2025, time.February, 28, 23, 0, 0, 0, time.UTC), *eventResult.BillingPeriodStart)
+					assert.Equal(t, time.Date(2025, time.March, 31, 22, 0, 0, 0, time.UTC), *eventResult.BillingPeriodEnd)
+				})
+
+				t.Run("It uses the organization timezone", func(t *testing.T) {
+					testEnv := setupEnrichmentTestEnv(t, mode.useCache)
+					defer testEnv.Cleanup()
+
+					testEnv.DataStore.SetBillableMetric(bm)
+					testEnv.DataStore.SetCustomer(customer)
+					testEnv.DataStore.SetPlan(plan)
+					testEnv.DataStore.SetOrganization(&models.Organization{ID: orgID, Timezone: utils.StringPtr("Asia/Tokyo")})
+					testEnv.DataStore.SetSubscription(sub)
+					testEnv.DataStore.SetFlatFilters([]*models.FlatFilter{})
+
+					enrichResult := testEnv.EventProcessor.EnrichEvent(&event)
+					assert.True(t, enrichResult.Success())
+
+					eventResult := enrichResult.Value()[0]
+					assert.Equal(t, time.Date(2025, time.February, 28, 15, 0, 0, 0, time.UTC), *eventResult.BillingPeriodStart)
+					assert.Equal(t, time.Date(2025, time.March, 31, 15, 0, 0, 0, time.UTC), *eventResult.BillingPeriodEnd)
+				})
+			})
+
+			t.Run("When customer and plan are not found", func(t *testing.T) {
+				testEnv := setupEnrichmentTestEnv(t, mode.useCache)
+				defer testEnv.Cleanup()
+
+				testEnv.DataStore.SetBillableMetric(bm)
+				testEnv.DataStore.SetSubscription(sub)
+				testEnv.DataStore.SetFlatFilters([]*models.FlatFilter{})
+
+				enrichResult := testEnv.EventProcessor.EnrichEvent(&event)
+				assert.True(t, enrichResult.Success())
+
+				eventResult := enrichResult.Value()[0]
+				assert.Equal(t, "sub123", eventResult.SubscriptionID)
+				assert.Nil(t, eventResult.CustomerID)
+				assert.Nil(t, eventResult.ExternalCustomerID)
+				assert.Nil(t, eventResult.BillingEntityID)
+				assert.Nil(t, eventResult.PlanCode)
+				assert.Nil(t, eventResult.Currency)
+				assert.Nil(t, eventResult.BillingPeriodStart)
+				assert.Nil(t, eventResult.BillingPeriodEnd)
+			})
+		})
+	}
+}
+
+func TestEnrichEventWithExplainMode(t *testing.T) {
+	now := time.Now()
+	orgID := "1a901a90-1a90-1a90-1a90-1a901a901a90"
+
+	event := models.Event{
+		OrganizationID:         orgID,
+		ExternalSubscriptionID: "sub_id",
+		Code:                   "api_calls",
+		Timestamp:              1741007009.0,
+		Properties:             map[string]any{"scheme": "visa", "method": "credit"},
+		Source:                 "SQS",
+	}
+
+	setupExplainTestEnv := func(t *testing.T) *enrichmentTestEnv {
+		testEnv := setupEnrichmentTestEnv(t, false)
+
+		testEnv.DataStore.SetBillableMetric(&models.BillableMetric{
+			ID:              "bm123",
+			OrganizationID:  orgID,
+			Code:            event.Code,
+			AggregationType: models.AggregationTypeCount,
+			CreatedAt:       utils.NowNullTime(),
+			UpdatedAt:       utils.NowNullTime(),
+		})
+		testEnv.DataStore.SetSubscription(&models.Subscription{
+			ID:             "sub123",
+			OrganizationID: &event.OrganizationID,
+			ExternalID:     event.ExternalSubscriptionID,
+			PlanID:         "plan_id",
+			StartedAt:      utils.NewNullTime(time.Unix(1700000000, 0)),
+		})
+		testEnv.DataStore.SetFlatFilters([]*models.FlatFilter{
+			{
+				OrganizationID:        orgID,
+				BillableMetricCode:    event.Code,
+				PlanID:                "plan_id",
+				ChargeID:              "charge1",
+				ChargeUpdatedAt:       now,
+				ChargeFilterID:        utils.StringPtr("charge_filter1"),
+				ChargeFilterUpdatedAt: &now,
+				Filters:               &models.FlatFilterValues{"scheme": []string{"visa"}},
+			},
+			{
+				OrganizationID:        orgID,
+				BillableMetricCode:    event.Code,
+				PlanID:                "plan_id",
+				ChargeID:              "charge1",
+				ChargeUpdatedAt:       now,
+				ChargeFilterID:        utils.StringPtr("charge_filter2"),
+				ChargeFilterUpdatedAt: &now,
+				Filters:               &models.FlatFilterValues{"scheme": []string{"visa"}, "method": []string{"debit"}},
+			},
+		})
+
+		return testEnv
+	}
+
+	t.Run("When explain mode is disabled", func(t *testing.T) {
+		testEnv := setupExplainTestEnv(t)
+		defer testEnv.Cleanup()
+
+		testEnv.EventProcessor.SetExplainOrganizations([]string{"other_org_id"})
+
+		enrichResult := testEnv.EventProcessor.EnrichEvent(&event)
+		assert.True(t, enrichResult.Success())
+		assert.Nil(t, enrichResult.Value()[0].MatchTrace)
+	})
+
+	t.Run("When explain mode is enabled for the organization", func(t *testing.T) {
+		testEnv := setupExplainTestEnv(t)
+		defer testEnv.Cleanup()
+
+		testEnv.EventProcessor.SetExplainOrganizations([]string{orgID})
+
+		enrichResult := testEnv.EventProcessor.EnrichEvent(&event)
+		assert.True(t, enrichResult.Success())
+
+		eventResult := enrichResult.Value()[0]
+		assert.Equal(t, "charge_filter1", *eventResult.ChargeFilterID)
+		assert.Equal(t, &models.FilterMatchTrace{
+			ChargeFilterID: utils.StringPtr("charge_filter1"),
+			Reason:         models.FilterMatchReasonSingleMatch,
+			Evaluations: []models.FilterEvaluation{
+				{ChargeFilterID: "charge_filter1", Matching: true, MatchedKeys: []string{"scheme"}},
+				{ChargeFilterID: "charge_filter2", Matching: false, MatchedKeys: []string{"scheme"}, FailedKeys: []string{"method"}},
+			},
+		}, eventResult.MatchTrace)
+	})
+
+	t.Run("When explain mode is enabled for all organizations", func(t *testing.T) {
+		testEnv := setupExplainTestEnv(t)
+		defer testEnv.Cleanup()
+
+		testEnv.EventProcessor.SetExplainOrganizations([]string{ALL_ORGANIZATIONS})
+
+		enrichResult := testEnv.EventProcessor.EnrichEvent(&event)
+		assert.True(t, enrichResult.Success())
+		assert.NotNil(t, enrichResult.Value()[0].MatchTrace)
+	})
+}
+
 func TestEvaluateExpression(t *testing.T) {
 	testEnv := setupEnrichmentTestEnv(t, true)
 	defer testEnv.Cleanup()
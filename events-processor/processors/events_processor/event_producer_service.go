@@ -3,20 +3,39 @@ package events_processor
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
 
+	"github.com/twmb/franz-go/pkg/kgo"
+
 	"github.com/getlago/lago/events-processor/config/kafka"
 	"github.com/getlago/lago/events-processor/models"
 	"github.com/getlago/lago/events-processor/utils"
 )
 
+// Kafka header holding the stable ID of the produced enriched event
+const EVENT_ID_HEADER = "lago-event-id"
+
 type EventProducerService struct {
 	enrichedProducer         kafka.MessageProducer
 	enrichedExpendedProducer kafka.MessageProducer
 	inAdvanceProducer        kafka.MessageProducer
 	deadLetterProducer       kafka.MessageProducer
+
+	// Optional, receives the events routed by a timestamp policy
+	lateProducer kafka.MessageProducer
+	// Optional, receives the events matching no charge
+	unbilledProducer kafka.MessageProducer
+	// Optional, receives the usage thresholds crossed by the subscriptions
+	usageThresholdsProducer kafka.MessageProducer
+	// Optional, receives the debit intents of the events targeting a wallet
+	walletDebitIntentsProducer kafka.MessageProducer
+	// Optional, receives the raw events over the rate limit of their organization
+	rateLimitedProducer kafka.MessageProducer
+	// Optional, receives the raw events of the frozen organizations
+	holdProducer kafka.MessageProducer
 }
 
 func NewEventProducerService(enrichedProducer, enrichedExpendedProducer, inAdvanceProducer, deadLetterProducer kafka.MessageProducer) *EventProducerService {
@@ -28,10 +47,174 @@ func NewEventProducerService(enrichedProducer, enrichedExpendedProducer, inAdvan
 	}
 }
 
+func (eps *EventProducerService) SetLateEventsProducer(lateProducer kafka.MessageProducer) {
+	eps.lateProducer = lateProducer
+}
+
+// ProduceLateEvent pushes an enriched event routed by a timestamp policy to the late events topic,
+// the event is sent to the dead letter queue when no late events topic is configured
+func (eps *EventProducerService) ProduceLateEvent(context context.Context, event *models.EnrichedEvent) {
+	if eps.lateProducer == nil {
+		eps.ProduceToDeadLetterQueue(
+			context,
+			*event.InitialEvent,
+			utils.FailedBoolResult(fmt.Errorf("no late events topic configured")).
+				AddErrorDetails("late_events_topic_missing", "Event routed to the late events topic but the topic is not configured"),
+		)
+		return
+	}
+
+	msgKey := fmt.Sprintf("%s-%s", event.OrganizationID, event.TransactionID)
+
+	err := eps.produceEvent(context, event, event.EnrichedID(), msgKey, eps.lateProducer)
+	if err != nil {
+		slog.Error("error while marshaling late events")
+		utils.CaptureError(err)
+	}
+}
+
+func (eps *EventProducerService) SetUnbilledEventsProducer(unbilledProducer kafka.MessageProducer) {
+	eps.unbilledProducer = unbilledProducer
+}
+
+// ProduceUnbilledEvent pushes an enriched event matching no charge to the unbilled events topic, when it is configured
+func (eps *EventProducerService) ProduceUnbilledEvent(context context.Context, event *models.EnrichedEvent, reason UnbilledReason) {
+	if eps.unbilledProducer == nil {
+		return
+	}
+
+	msgKey := fmt.Sprintf("%s-%s", event.OrganizationID, event.TransactionID)
+
+	payload := *event
+	payload.UnbilledReason = string(reason)
+
+	err := eps.produceEvent(context, &payload, event.EnrichedID(), msgKey, eps.unbilledProducer)
+	if err != nil {
+		slog.Error("error while marshaling unbilled events")
+		utils.CaptureError(err)
+	}
+}
+
+func (eps *EventProducerService) SetUsageThresholdsProducer(usageThresholdsProducer kafka.MessageProducer) {
+	eps.usageThresholdsProducer = usageThresholdsProducer
+}
+
+// ProduceUsageThresholdCrossedEvent pushes a crossed threshold to the usage thresholds topic, when it is configured.
+// Messages are keyed by subscription to keep the crossings of a subscription ordered.
+func (eps *EventProducerService) ProduceUsageThresholdCrossedEvent(context context.Context, event *models.UsageThresholdCrossedEvent) {
+	if eps.usageThresholdsProducer == nil {
+		return
+	}
+
+	eventJson, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("error while marshaling usage threshold crossed event")
+		utils.CaptureError(err)
+		return
+	}
+
+	pushed := eps.usageThresholdsProducer.Produce(context, &kafka.ProducerMessage{
+		Key:     []byte(fmt.Sprintf("%s-%s", event.OrganizationID, event.SubscriptionID)),
+		Value:   eventJson,
+		Headers: []kgo.RecordHeader{{Key: EVENT_ID_HEADER, Value: []byte(event.ID)}},
+	})
+
+	if !pushed {
+		slog.Error(
+			"error while pushing to usage thresholds topic",
+			slog.String("topic", eps.usageThresholdsProducer.GetTopic()),
+			slog.String("threshold_id", event.ThresholdID),
+		)
+		utils.CaptureError(fmt.Errorf("failed to push to %s topic", eps.usageThresholdsProducer.GetTopic()))
+	}
+}
+
+func (eps *EventProducerService) SetWalletDebitIntentsProducer(walletDebitIntentsProducer kafka.MessageProducer) {
+	eps.walletDebitIntentsProducer = walletDebitIntentsProducer
+}
+
+func (eps *EventProducerService) HasWalletDebitIntentsProducer() bool {
+	return eps.walletDebitIntentsProducer != nil
+}
+
+// ProduceWalletDebitIntent pushes a wallet debit intent to the wallet debit intents topic, when it is configured.
+// Messages are keyed by wallet to keep the debits of a wallet ordered.
+func (eps *EventProducerService) ProduceWalletDebitIntent(context context.Context, intent *models.WalletDebitIntent) {
+	if eps.walletDebitIntentsProducer == nil {
+		return
+	}
+
+	intentJson, err := json.Marshal(intent)
+	if err != nil {
+		slog.Error("error while marshaling wallet debit intent")
+		utils.CaptureError(err)
+		return
+	}
+
+	pushed := eps.walletDebitIntentsProducer.Produce(context, &kafka.ProducerMessage{
+		Key:     []byte(fmt.Sprintf("%s-%s", intent.OrganizationID, intent.WalletID)),
+		Value:   intentJson,
+		Headers: []kgo.RecordHeader{{Key: EVENT_ID_HEADER, Value: []byte(intent.ID)}},
+	})
+
+	if !pushed {
+		slog.Error(
+			"error while pushing to wallet debit intents topic",
+			slog.String("topic", eps.walletDebitIntentsProducer.GetTopic()),
+			slog.String("wallet_id", intent.WalletID),
+		)
+		utils.CaptureError(fmt.Errorf("failed to push to %s topic", eps.walletDebitIntentsProducer.GetTopic()))
+	}
+}
+
+func (eps *EventProducerService) SetRateLimitedEventsProducer(rateLimitedProducer kafka.MessageProducer) {
+	eps.rateLimitedProducer = rateLimitedProducer
+}
+
+// ProduceRateLimitedEvent pushes a raw event over the rate limit of its organization to the rate limited events topic
+func (eps *EventProducerService) ProduceRateLimitedEvent(context context.Context, event *models.Event, record *kgo.Record) bool {
+	return eps.produceRawEvent(context, eps.rateLimitedProducer, event, record)
+}
+
+func (eps *EventProducerService) SetHoldProducer(holdProducer kafka.MessageProducer) {
+	eps.holdProducer = holdProducer
+}
+
+// ProduceHeldEvent pushes a raw event of a frozen organization to the hold topic
+func (eps *EventProducerService) ProduceHeldEvent(context context.Context, event *models.Event, record *kgo.Record) bool {
+	return eps.produceRawEvent(context, eps.holdProducer, event, record)
+}
+
+// produceRawEvent pushes a raw event as is to the producer topic.
+// Messages are keyed by organization so the events of an organization share a partition and keep their order.
+func (eps *EventProducerService) produceRawEvent(context context.Context, producer kafka.MessageProducer, event *models.Event, record *kgo.Record) bool {
+	if producer == nil {
+		return false
+	}
+
+	pushed := producer.Produce(context, &kafka.ProducerMessage{
+		Key:     []byte(event.OrganizationID),
+		Value:   record.Value,
+		Headers: record.Headers,
+	})
+
+	if !pushed {
+		slog.Error(
+			"error while pushing raw event",
+			slog.String("topic", producer.GetTopic()),
+			slog.String("organization_id", event.OrganizationID),
+			slog.String("transaction_id", event.TransactionID),
+		)
+		utils.CaptureError(fmt.Errorf("failed to push to %s topic", producer.GetTopic()))
+	}
+
+	return pushed
+}
+
 func (eps *EventProducerService) ProduceEnrichedEvent(context context.Context, event *models.EnrichedEvent) {
 	msgKey := fmt.Sprintf("%s-%s", event.OrganizationID, event.TransactionID)
 
-	err := eps.produceEvent(context, event, msgKey, eps.enrichedProducer)
+	err := eps.produceEvent(context, event, event.EnrichedID(), msgKey, eps.enrichedProducer)
 
 	if err != nil {
 		slog.Error("error while marshaling enriched events")
@@ -42,7 +225,7 @@ func (eps *EventProducerService) ProduceEnrichedEvent(context context.Context, e
 func (eps *EventProducerService) ProduceEnrichedExpandedEvent(context context.Context, event *models.EnrichedEvent) {
 	msgKey := fmt.Sprintf("%s-%s", event.OrganizationID, event.TransactionID)
 
-	err := eps.produceEvent(context, event, msgKey, eps.enrichedExpendedProducer)
+	err := eps.produceEvent(context, event, event.ExpandedID(), msgKey, eps.enrichedExpendedProducer)
 	if err != nil {
 		slog.Error("error while marshaling enriched expended events")
 		utils.CaptureError(err)
@@ -52,7 +235,7 @@ func (eps *EventProducerService) ProduceEnrichedExpandedEvent(context context.Co
 func (eps *EventProducerService) ProduceChargedInAdvanceEvent(context context.Context, event *models.EnrichedEvent) {
 	msgKey := fmt.Sprintf("%s-%s", event.OrganizationID, event.TransactionID)
 
-	err := eps.produceEvent(context, event, msgKey, eps.inAdvanceProducer)
+	err := eps.produceEvent(context, event, event.EnrichedID(), msgKey, eps.inAdvanceProducer)
 
 	if err != nil {
 		slog.Error("error while marshaling charged in advance events")
@@ -60,6 +243,18 @@ func (eps *EventProducerService) ProduceChargedInAdvanceEvent(context context.Co
 	}
 }
 
+// ProduceChargedInAdvanceExpandedEvent pushes one record per pay in advance charge and charge filter,
+// identified like the enriched expanded events
+func (eps *EventProducerService) ProduceChargedInAdvanceExpandedEvent(context context.Context, event *models.EnrichedEvent) {
+	msgKey := fmt.Sprintf("%s-%s", event.OrganizationID, event.TransactionID)
+
+	err := eps.produceEvent(context, event, event.ExpandedID(), msgKey, eps.inAdvanceProducer)
+	if err != nil {
+		slog.Error("error while marshaling charged in advance expanded events")
+		utils.CaptureError(err)
+	}
+}
+
 func (eps *EventProducerService) ProduceToDeadLetterQueue(context context.Context, event models.Event, errorResult utils.AnyResult) {
 	failedEvent := models.FailedEvent{
 		Event:               event,
@@ -69,6 +264,11 @@ func (eps *EventProducerService) ProduceToDeadLetterQueue(context context.Contex
 		FailedAt:            time.Now(),
 	}
 
+	var panicErr *PanicError
+	if errors.As(errorResult.Error(), &panicErr) {
+		failedEvent.StackTrace = string(panicErr.Stack)
+	}
+
 	eventJson, err := json.Marshal(failedEvent)
 	if err != nil {
 		slog.Error("error while marshaling failed event with error details")
@@ -85,15 +285,21 @@ func (eps *EventProducerService) ProduceToDeadLetterQueue(context context.Contex
 	}
 }
 
-func (eps *EventProducerService) produceEvent(context context.Context, event *models.EnrichedEvent, msgKey string, producer kafka.MessageProducer) error {
-	eventJson, err := json.Marshal(event)
+// produceEvent pushes a copy of the event carrying the given ID, both in the payload and as a header,
+// the message key is kept as is to preserve the partitioning
+func (eps *EventProducerService) produceEvent(context context.Context, event *models.EnrichedEvent, eventID string, msgKey string, producer kafka.MessageProducer) error {
+	payload := *event
+	payload.ID = eventID
+
+	eventJson, err := json.Marshal(&payload)
 	if err != nil {
 		return err
 	}
 
 	pushed := producer.Produce(context, &kafka.ProducerMessage{
-		Key:   []byte(msgKey),
-		Value: eventJson,
+		Key:     []byte(msgKey),
+		Value:   eventJson,
+		Headers: []kgo.RecordHeader{{Key: EVENT_ID_HEADER, Value: []byte(eventID)}},
 	})
 
 	if !pushed {
@@ -11,6 +11,7 @@ import (
 	"github.com/getlago/lago/events-processor/tests"
 	"github.com/getlago/lago/events-processor/utils"
 	"github.com/stretchr/testify/assert"
+	"github.com/twmb/franz-go/pkg/kgo"
 )
 
 var (
@@ -54,8 +55,14 @@ func TestProduceEnrichedEvent(t *testing.T) {
 		enrichedProducer.Key,
 	)
 
+	event.ID = event.EnrichedID()
 	eventJson, _ := json.Marshal(event)
 	assert.Equal(t, eventJson, enrichedProducer.Value)
+	assert.Equal(
+		t,
+		[]kgo.RecordHeader{{Key: EVENT_ID_HEADER, Value: []byte(event.ID)}},
+		enrichedProducer.Headers,
+	)
 }
 
 func TestProduceEnrichedExtendedEvent(t *testing.T) {
@@ -78,6 +85,7 @@ func TestProduceEnrichedExtendedEvent(t *testing.T) {
 			enrichedExpandedProducer.Key,
 		)
 
+		event.ID = event.ExpandedID()
 		eventJson, _ := json.Marshal(event)
 		assert.Equal(t, eventJson, enrichedExpandedProducer.Value)
 	})
@@ -102,6 +110,7 @@ func TestProduceEnrichedExtendedEvent(t *testing.T) {
 			enrichedExpandedProducer.Key,
 		)
 
+		event.ID = event.ExpandedID()
 		eventJson, _ := json.Marshal(event)
 		assert.Equal(t, eventJson, enrichedExpandedProducer.Value)
 	})
@@ -126,6 +135,7 @@ func TestProduceEnrichedExtendedEvent(t *testing.T) {
 			enrichedExpandedProducer.Key,
 		)
 
+		event.ID = event.ExpandedID()
 		eventJson, _ := json.Marshal(event)
 		assert.Equal(t, eventJson, enrichedExpandedProducer.Value)
 	})
@@ -150,6 +160,7 @@ func TestProduceEnrichedExtendedEvent(t *testing.T) {
 			enrichedExpandedProducer.Key,
 		)
 
+		event.ID = event.ExpandedID()
 		eventJson, _ := json.Marshal(event)
 		assert.Equal(t, eventJson, enrichedExpandedProducer.Value)
 	})
@@ -174,6 +185,7 @@ func TestProduceEnrichedExtendedEvent(t *testing.T) {
 			enrichedExpandedProducer.Key,
 		)
 
+		event.ID = event.ExpandedID()
 		eventJson, _ := json.Marshal(event)
 		assert.Equal(t, eventJson, enrichedExpandedProducer.Value)
 	})
@@ -198,6 +210,7 @@ func TestProduceChargedInAdvanceEvent(t *testing.T) {
 		inAdvanceProducer.Key,
 	)
 
+	event.ID = event.EnrichedID()
 	eventJson, _ := json.Marshal(event)
 	assert.Equal(t, eventJson, inAdvanceProducer.Value)
 }
@@ -227,3 +240,42 @@ func TestProduceToDeadLetterQueue(t *testing.T) {
 	assert.Equal(t, "", producedEvent.ErrorMessage)
 	assert.WithinDuration(t, time.Now(), producedEvent.FailedAt, 5*time.Second)
 }
+
+func TestProduceLateEvent(t *testing.T) {
+	event := models.EnrichedEvent{
+		InitialEvent:           &models.Event{OrganizationID: "1a901a90-1a90-1a90-1a90-1a901a901a90"},
+		OrganizationID:         "1a901a90-1a90-1a90-1a90-1a901a901a90",
+		ExternalSubscriptionID: "sub_id",
+		Code:                   "api_calls",
+		TransactionID:          "transaction_id",
+		TimestampPolicy: &models.TimestampPolicyDecision{
+			Violation: models.TimestampViolationLate,
+			Action:    models.TimestampPolicyRoute,
+		},
+	}
+
+	t.Run("With a late events producer", func(t *testing.T) {
+		setupProducerServiceEnv()
+		lateProducer := &tests.MockMessageProducer{}
+		producerService.SetLateEventsProducer(lateProducer)
+
+		producerService.ProduceLateEvent(context.Background(), &event)
+
+		assert.Equal(t, 1, lateProducer.ExecutionCount)
+		assert.Equal(t, 0, deadLetterProducer.ExecutionCount)
+		assert.Equal(t, []byte("1a901a90-1a90-1a90-1a90-1a901a901a90-transaction_id"), lateProducer.Key)
+		assert.Equal(t, []kgo.RecordHeader{{Key: EVENT_ID_HEADER, Value: []byte(event.EnrichedID())}}, lateProducer.Headers)
+	})
+
+	t.Run("Without late events producer", func(t *testing.T) {
+		setupProducerServiceEnv()
+
+		producerService.ProduceLateEvent(context.Background(), &event)
+
+		assert.Equal(t, 1, deadLetterProducer.ExecutionCount)
+
+		failedEvent := models.FailedEvent{}
+		assert.NoError(t, json.Unmarshal(deadLetterProducer.Value, &failedEvent))
+		assert.Equal(t, "late_events_topic_missing", failedEvent.ErrorCode)
+	})
+}
@@ -0,0 +1,166 @@
+package events_processor
+
+import (
+	"log/slog"
+	"math/big"
+	"strings"
+
+	"github.com/getlago/lago/events-processor/cache"
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+// Number of decimals of the estimated amounts in cents
+const ESTIMATED_AMOUNT_PRECISION = 6
+
+// FeeEstimationService prices the events landing on a pay in advance charge.
+// Estimations are best effort: when a charge can't be priced, the event is produced without estimated fee.
+type FeeEstimationService struct {
+	apiStore *models.ApiStore
+	memCache *cache.Cache
+}
+
+func NewFeeEstimationService(apiStore *models.ApiStore, memCache *cache.Cache) *FeeEstimationService {
+	return &FeeEstimationService{
+		apiStore: apiStore,
+		memCache: memCache,
+	}
+}
+
+// EstimateFee returns the fee of an enriched expanded event, nil when it can't be estimated.
+// The event is priced on top of the usage aggregated before it. Without aggregated usage,
+// the charges whose price depends on the previous usage (eg: graduated) are not estimated.
+func (s *FeeEstimationService) EstimateFee(event *models.EnrichedEvent, usage *models.AggregatedUsage) *models.FeeEstimate {
+	if usage == nil {
+		return s.estimateFee(event, nil)
+	}
+
+	return s.estimateFee(event, &usage.Previous)
+}
+
+func (s *FeeEstimationService) estimateFee(event *models.EnrichedEvent, previous *models.ChargeUsage) *models.FeeEstimate {
+	if event.ChargeID == nil || event.BillableMetric == nil {
+		return nil
+	}
+
+	charge := s.fetchCharge(event)
+	if charge == nil {
+		return nil
+	}
+
+	properties := charge.Properties
+	if event.ChargeFilterID != nil {
+		chargeFilter := s.fetchChargeFilter(event)
+		if chargeFilter == nil {
+			return nil
+		}
+		if len(chargeFilter.Properties) > 0 {
+			properties = chargeFilter.Properties
+		}
+	}
+
+	estimate := &models.FeeEstimate{
+		Currency:    event.Currency,
+		ChargeModel: charge.ChargeModel.String(),
+	}
+
+	// Dynamic charges are priced by the event itself
+	if charge.ChargeModel == models.ChargeModelDynamic {
+		amountCents, ok := new(big.Rat).SetString(event.PreciseTotalAmountCents)
+		if !ok {
+			return nil
+		}
+
+		estimate.PreciseAmountCents = formatDecimal(amountCents)
+		estimate.Units = "1"
+		return estimate
+	}
+
+	if previous == nil {
+		if models.DependsOnUsage(charge.ChargeModel, properties) {
+			return nil
+		}
+		previous = &models.ChargeUsage{}
+	}
+
+	units, ok := eventUnits(event)
+	if !ok {
+		return nil
+	}
+
+	amount, ok := models.EstimateChargeAmount(charge.ChargeModel, properties, units, *previous)
+	if !ok {
+		return nil
+	}
+
+	estimate.PreciseAmountCents = formatDecimal(amount.Mul(amount, big.NewRat(100, 1)))
+	estimate.Units = formatDecimal(units)
+	return estimate
+}
+
+func (s *FeeEstimationService) fetchCharge(event *models.EnrichedEvent) *models.Charge {
+	var chargeResult utils.Result[*models.Charge]
+	if s.memCache != nil {
+		chargeResult = s.memCache.GetCharge(event.OrganizationID, event.PlanID, event.BillableMetric.ID, *event.ChargeID)
+	} else {
+		chargeResult = s.apiStore.FetchCharge(event.OrganizationID, *event.ChargeID)
+	}
+
+	if chargeResult.Failure() {
+		logEstimationFailure(chargeResult, "charge_id", *event.ChargeID)
+		return nil
+	}
+
+	return chargeResult.Value()
+}
+
+func (s *FeeEstimationService) fetchChargeFilter(event *models.EnrichedEvent) *models.ChargeFilter {
+	var chargeFilterResult utils.Result[*models.ChargeFilter]
+	if s.memCache != nil {
+		chargeFilterResult = s.memCache.GetChargeFilter(event.OrganizationID, *event.ChargeID, *event.ChargeFilterID)
+	} else {
+		chargeFilterResult = s.apiStore.FetchChargeFilter(event.OrganizationID, *event.ChargeFilterID)
+	}
+
+	if chargeFilterResult.Failure() {
+		logEstimationFailure(chargeFilterResult, "charge_filter_id", *event.ChargeFilterID)
+		return nil
+	}
+
+	return chargeFilterResult.Value()
+}
+
+func logEstimationFailure(result utils.AnyResult, key string, id string) {
+	slog.Warn(
+		"Unable to estimate fee",
+		slog.String(key, id),
+		slog.String("error", result.ErrorMsg()),
+	)
+
+	if result.IsCapturable() {
+		utils.CaptureErrorResult(result)
+	}
+}
+
+// eventUnits returns the units brought by the event on its charge.
+// Pay in advance charges only support the count, unique count and sum aggregations.
+func eventUnits(event *models.EnrichedEvent) (*big.Rat, bool) {
+	switch event.BillableMetric.AggregationType {
+	case models.AggregationTypeCount, models.AggregationTypeUniqueCount:
+		return big.NewRat(1, 1), true
+	case models.AggregationTypeSum:
+		if event.Value == nil {
+			return nil, false
+		}
+		return new(big.Rat).SetString(*event.Value)
+	}
+
+	return nil, false
+}
+
+// formatDecimal formats an amount with ESTIMATED_AMOUNT_PRECISION decimals, without trailing zeros
+func formatDecimal(value *big.Rat) string {
+	formatted := value.FloatString(ESTIMATED_AMOUNT_PRECISION)
+	formatted = strings.TrimRight(formatted, "0")
+	return strings.TrimSuffix(formatted, ".")
+}
@@ -0,0 +1,158 @@
+package events_processor
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getlago/lago/events-processor/cache"
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+func setupFeeEstimationService(t *testing.T) (*FeeEstimationService, *CacheDataStore, func()) {
+	memCache, err := cache.NewCache(cache.CacheConfig{
+		Context: context.Background(),
+	})
+	require.NoError(t, err)
+
+	return NewFeeEstimationService(nil, memCache), &CacheDataStore{cache: memCache, t: t}, func() { memCache.Close() }
+}
+
+func TestEstimateFee(t *testing.T) {
+	currency := "EUR"
+	chargeID := "charge123"
+	chargeFilterID := "charge_filter123"
+
+	buildEvent := func(aggregationType models.AggregationType, value *string) *models.EnrichedEvent {
+		return &models.EnrichedEvent{
+			OrganizationID: "org123",
+			PlanID:         "plan123",
+			ChargeID:       &chargeID,
+			Currency:       &currency,
+			Value:          value,
+			BillableMetric: &models.BillableMetric{
+				ID:              "bm123",
+				AggregationType: aggregationType,
+			},
+		}
+	}
+
+	buildCharge := func(chargeModel models.ChargeModel, properties models.ChargeProperties) *models.Charge {
+		return &models.Charge{
+			ID:               chargeID,
+			OrganizationID:   "org123",
+			PlanID:           "plan123",
+			BillableMetricID: "bm123",
+			PayInAdvance:     true,
+			ChargeModel:      chargeModel,
+			Properties:       properties,
+			UpdatedAt:        utils.NowNullTime(),
+		}
+	}
+
+	t.Run("With a standard charge", func(t *testing.T) {
+		service, dataStore, cleanup := setupFeeEstimationService(t)
+		defer cleanup()
+
+		dataStore.SetCharge(buildCharge(models.ChargeModelStandard, models.ChargeProperties{"amount": "0.0125"}))
+
+		estimate := service.EstimateFee(buildEvent(models.AggregationTypeCount, nil), nil)
+		require.NotNil(t, estimate)
+		assert.Equal(t, "1.25", estimate.PreciseAmountCents)
+		assert.Equal(t, "EUR", *estimate.Currency)
+		assert.Equal(t, "standard", estimate.ChargeModel)
+		assert.Equal(t, "1", estimate.Units)
+	})
+
+	t.Run("With a sum aggregation", func(t *testing.T) {
+		service, dataStore, cleanup := setupFeeEstimationService(t)
+		defer cleanup()
+
+		dataStore.SetCharge(buildCharge(models.ChargeModelStandard, models.ChargeProperties{"amount": "2"}))
+
+		value := "12.5"
+		estimate := service.EstimateFee(buildEvent(models.AggregationTypeSum, &value), nil)
+		require.NotNil(t, estimate)
+		assert.Equal(t, "2500", estimate.PreciseAmountCents)
+		assert.Equal(t, "12.5", estimate.Units)
+
+		invalidValue := "twelve"
+		assert.Nil(t, service.EstimateFee(buildEvent(models.AggregationTypeSum, &invalidValue), nil))
+	})
+
+	t.Run("With a charge filter", func(t *testing.T) {
+		service, dataStore, cleanup := setupFeeEstimationService(t)
+		defer cleanup()
+
+		dataStore.SetCharge(buildCharge(models.ChargeModelStandard, models.ChargeProperties{"amount": "1"}))
+		dataStore.SetChargeFilter(&models.ChargeFilter{
+			ID:             chargeFilterID,
+			OrganizationID: "org123",
+			ChargeID:       chargeID,
+			Properties:     models.ChargeProperties{"amount": "3"},
+			UpdatedAt:      utils.NowNullTime(),
+		})
+
+		event := buildEvent(models.AggregationTypeCount, nil)
+		event.ChargeFilterID = &chargeFilterID
+
+		estimate := service.EstimateFee(event, nil)
+		require.NotNil(t, estimate)
+		assert.Equal(t, "300", estimate.PreciseAmountCents)
+	})
+
+	t.Run("With a charge depending on the previous usage", func(t *testing.T) {
+		service, dataStore, cleanup := setupFeeEstimationService(t)
+		defer cleanup()
+
+		dataStore.SetCharge(buildCharge(models.ChargeModelPackage, models.ChargeProperties{"amount": "5", "package_size": "10"}))
+
+		// Without aggregated usage, the event can't be priced
+		assert.Nil(t, service.EstimateFee(buildEvent(models.AggregationTypeCount, nil), nil))
+
+		usage := &models.AggregatedUsage{Previous: models.ChargeUsage{Units: big.NewRat(10, 1), Events: 10}}
+		estimate := service.EstimateFee(buildEvent(models.AggregationTypeCount, nil), usage)
+		require.NotNil(t, estimate)
+		assert.Equal(t, "500", estimate.PreciseAmountCents)
+
+		usage = &models.AggregatedUsage{Previous: models.ChargeUsage{Units: big.NewRat(11, 1), Events: 11}}
+		estimate = service.EstimateFee(buildEvent(models.AggregationTypeCount, nil), usage)
+		require.NotNil(t, estimate)
+		assert.Equal(t, "0", estimate.PreciseAmountCents)
+	})
+
+	t.Run("With a dynamic charge", func(t *testing.T) {
+		service, dataStore, cleanup := setupFeeEstimationService(t)
+		defer cleanup()
+
+		dataStore.SetCharge(buildCharge(models.ChargeModelDynamic, models.ChargeProperties{}))
+
+		event := buildEvent(models.AggregationTypeSum, nil)
+		event.PreciseTotalAmountCents = "123.4500"
+
+		estimate := service.EstimateFee(event, nil)
+		require.NotNil(t, estimate)
+		assert.Equal(t, "123.45", estimate.PreciseAmountCents)
+		assert.Equal(t, "dynamic", estimate.ChargeModel)
+	})
+
+	t.Run("With an unsupported charge model", func(t *testing.T) {
+		service, dataStore, cleanup := setupFeeEstimationService(t)
+		defer cleanup()
+
+		dataStore.SetCharge(buildCharge(models.ChargeModelCustom, models.ChargeProperties{}))
+
+		assert.Nil(t, service.EstimateFee(buildEvent(models.AggregationTypeCount, nil), nil))
+	})
+
+	t.Run("Without charge", func(t *testing.T) {
+		service, _, cleanup := setupFeeEstimationService(t)
+		defer cleanup()
+
+		assert.Nil(t, service.EstimateFee(buildEvent(models.AggregationTypeCount, nil), nil))
+	})
+}
@@ -0,0 +1,207 @@
+package events_processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/server"
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+// Delay after which the frozen organizations are read again from Redis,
+// a freeze set by another instance is applied after at most this delay
+const FROZEN_ORGANIZATIONS_REFRESH_INTERVAL = 5 * time.Second
+
+// FreezeService tracks the frozen organizations, their events are diverted to the hold topic
+// until the freeze is lifted. The freezes are stored in Redis so all the instances agree.
+type FreezeService struct {
+	store models.OrganizationFreezer
+	now   func() time.Time
+
+	mu          sync.Mutex
+	frozen      map[string]*models.OrganizationFreeze
+	refreshedAt time.Time
+	refreshing  bool
+	// Incremented by the freezes and unfreezes of this instance, a refresh reading Redis meanwhile is discarded
+	updates uint64
+}
+
+func NewFreezeService(store models.OrganizationFreezer) *FreezeService {
+	return &FreezeService{
+		store:  store,
+		now:    time.Now,
+		frozen: make(map[string]*models.OrganizationFreeze),
+	}
+}
+
+// IsFrozen returns true when the events of the organization must be held
+func (s *FreezeService) IsFrozen(ctx context.Context, organizationID string) bool {
+	s.refresh(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.frozen[organizationID] != nil
+}
+
+// FrozenOrganizations returns the current freezes, sorted by organization ID
+func (s *FreezeService) FrozenOrganizations(ctx context.Context) []*models.OrganizationFreeze {
+	s.refresh(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	freezes := make([]*models.OrganizationFreeze, 0, len(s.frozen))
+	for _, freeze := range s.frozen {
+		freezes = append(freezes, freeze)
+	}
+	sort.Slice(freezes, func(i, j int) bool {
+		return freezes[i].OrganizationID < freezes[j].OrganizationID
+	})
+
+	return freezes
+}
+
+func (s *FreezeService) Freeze(ctx context.Context, organizationID string, reason string) utils.Result[*models.OrganizationFreeze] {
+	freeze := &models.OrganizationFreeze{
+		OrganizationID: organizationID,
+		Reason:         reason,
+		FrozenAt:       s.now().UTC(),
+	}
+
+	result := s.store.Freeze(ctx, freeze)
+	if result.Failure() {
+		return utils.FailedResult[*models.OrganizationFreeze](result.Error())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frozen[organizationID] = freeze
+	s.updates++
+
+	return utils.SuccessResult(freeze)
+}
+
+// Unfreeze lifts the freeze of the organization, it returns false when the organization was not frozen
+func (s *FreezeService) Unfreeze(ctx context.Context, organizationID string) utils.Result[bool] {
+	result := s.store.Unfreeze(ctx, organizationID)
+	if result.Failure() {
+		return result
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.frozen, organizationID)
+	s.updates++
+
+	return result
+}
+
+// refresh reads the frozen organizations from Redis once per refresh interval.
+// Redis is read outside the lock: the other callers keep using the last known freezes during the read,
+// only the callers coming before the first read is done read Redis as well.
+// The last known freezes are kept when Redis is unavailable.
+func (s *FreezeService) refresh(ctx context.Context) {
+	s.mu.Lock()
+	now := s.now()
+	if !s.refreshedAt.IsZero() && (s.refreshing || now.Sub(s.refreshedAt) < FROZEN_ORGANIZATIONS_REFRESH_INTERVAL) {
+		s.mu.Unlock()
+		return
+	}
+	s.refreshing = true
+	updates := s.updates
+	s.mu.Unlock()
+
+	result := s.store.FrozenOrganizations(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refreshing = false
+	s.refreshedAt = now
+
+	if result.Failure() {
+		slog.Error("Error reading the frozen organizations", slog.String("error", result.ErrorMsg()))
+		utils.CaptureErrorResult(result)
+		return
+	}
+
+	// The read may miss a freeze or an unfreeze of this instance, the freezes are read again on the next call
+	if s.updates != updates {
+		s.refreshedAt = time.Time{}
+		return
+	}
+
+	s.frozen = result.Value()
+}
+
+type freezeRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ServeHTTP lists the frozen organizations (GET), freezes an organization (PUT)
+// or lifts its freeze (DELETE), the organization ID being the `organization_id` path value
+func (s *FreezeService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	organizationID := r.PathValue("organization_id")
+
+	switch r.Method {
+	case http.MethodGet:
+		server.WriteJSON(w, http.StatusOK, s.FrozenOrganizations(r.Context()))
+
+	case http.MethodPut:
+		request := freezeRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+			server.WriteError(w, http.StatusBadRequest, server.ErrorResponse{
+				Error:     err.Error(),
+				ErrorCode: "invalid_freeze",
+				Message:   "Error while decoding the freeze",
+			})
+			return
+		}
+
+		result := s.Freeze(r.Context(), organizationID, request.Reason)
+		if result.Failure() {
+			writeFreezeStoreError(w, result)
+			return
+		}
+
+		server.WriteJSON(w, http.StatusOK, result.Value())
+
+	case http.MethodDelete:
+		result := s.Unfreeze(r.Context(), organizationID)
+		if result.Failure() {
+			writeFreezeStoreError(w, result)
+			return
+		}
+
+		if !result.Value() {
+			server.WriteError(w, http.StatusNotFound, server.ErrorResponse{
+				Error:     "organization is not frozen",
+				ErrorCode: "organization_not_frozen",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		server.WriteError(w, http.StatusMethodNotAllowed, server.ErrorResponse{Error: "method not allowed"})
+	}
+}
+
+func writeFreezeStoreError(w http.ResponseWriter, result utils.AnyResult) {
+	utils.CaptureErrorResult(result)
+	server.WriteError(w, http.StatusInternalServerError, server.ErrorResponse{
+		Error:     result.ErrorMsg(),
+		ErrorCode: "freeze_store_error",
+		Message:   "Error while updating the frozen organizations",
+	})
+}
@@ -0,0 +1,239 @@
+package events_processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+type mockFreezer struct {
+	frozen    map[string]*models.OrganizationFreeze
+	err       error
+	ReadCount int
+	// Optional, called once the freezes are read, before they are returned
+	afterRead func()
+}
+
+func (m *mockFreezer) Close() error { return nil }
+
+func (m *mockFreezer) Freeze(ctx context.Context, freeze *models.OrganizationFreeze) utils.Result[bool] {
+	if m.err != nil {
+		return utils.FailedBoolResult(m.err)
+	}
+	m.frozen[freeze.OrganizationID] = freeze
+	return utils.SuccessResult(true)
+}
+
+func (m *mockFreezer) Unfreeze(ctx context.Context, organizationID string) utils.Result[bool] {
+	if m.err != nil {
+		return utils.FailedBoolResult(m.err)
+	}
+	_, found := m.frozen[organizationID]
+	delete(m.frozen, organizationID)
+	return utils.SuccessResult(found)
+}
+
+func (m *mockFreezer) FrozenOrganizations(ctx context.Context) utils.Result[map[string]*models.OrganizationFreeze] {
+	m.ReadCount++
+	if m.err != nil {
+		return utils.FailedResult[map[string]*models.OrganizationFreeze](m.err)
+	}
+
+	frozen := make(map[string]*models.OrganizationFreeze, len(m.frozen))
+	for organizationID, freeze := range m.frozen {
+		frozen[organizationID] = freeze
+	}
+	if m.afterRead != nil {
+		m.afterRead()
+	}
+	return utils.SuccessResult(frozen)
+}
+
+func setupFreezeService(frozenOrganizationIDs ...string) (*FreezeService, *mockFreezer, *time.Time) {
+	store := &mockFreezer{frozen: make(map[string]*models.OrganizationFreeze)}
+	for _, organizationID := range frozenOrganizationIDs {
+		store.frozen[organizationID] = &models.OrganizationFreeze{OrganizationID: organizationID}
+	}
+
+	now := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	service := NewFreezeService(store)
+	service.now = func() time.Time { return now }
+
+	return service, store, &now
+}
+
+func TestFreezeServiceIsFrozen(t *testing.T) {
+	ctx := context.Background()
+	t.Run("With organizations frozen by another instance", func(t *testing.T) {
+		service, store, now := setupFreezeService("org_1")
+
+		assert.True(t, service.IsFrozen(ctx, "org_1"))
+		assert.False(t, service.IsFrozen(ctx, "org_2"))
+		assert.Equal(t, 1, store.ReadCount)
+
+		// The freezes are read again after the refresh interval
+		store.frozen["org_2"] = &models.OrganizationFreeze{OrganizationID: "org_2"}
+		assert.False(t, service.IsFrozen(ctx, "org_2"))
+
+		*now = now.Add(FROZEN_ORGANIZATIONS_REFRESH_INTERVAL)
+		assert.True(t, service.IsFrozen(ctx, "org_2"))
+		assert.Equal(t, 2, store.ReadCount)
+	})
+
+	t.Run("With a freeze set by the instance", func(t *testing.T) {
+		service, _, _ := setupFreezeService()
+		assert.False(t, service.IsFrozen(ctx, "org_1"))
+
+		result := service.Freeze(ctx, "org_1", "migration")
+		require.True(t, result.Success())
+		assert.Equal(t, "migration", result.Value().Reason)
+		assert.True(t, service.IsFrozen(ctx, "org_1"))
+
+		unfrozen := service.Unfreeze(ctx, "org_1")
+		require.True(t, unfrozen.Success())
+		assert.True(t, unfrozen.Value())
+		assert.False(t, service.IsFrozen(ctx, "org_1"))
+	})
+
+	t.Run("With a store error", func(t *testing.T) {
+		service, store, now := setupFreezeService("org_1")
+		assert.True(t, service.IsFrozen(ctx, "org_1"))
+
+		// The last known freezes are kept
+		store.err = errors.New("connection refused")
+		*now = now.Add(FROZEN_ORGANIZATIONS_REFRESH_INTERVAL)
+		assert.True(t, service.IsFrozen(ctx, "org_1"))
+
+		assert.False(t, service.Freeze(ctx, "org_2", "").Success())
+		assert.False(t, service.IsFrozen(ctx, "org_2"))
+	})
+
+	t.Run("With a refresh in progress", func(t *testing.T) {
+		service, store, now := setupFreezeService("org_1")
+		assert.True(t, service.IsFrozen(ctx, "org_1"))
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		store.afterRead = func() {
+			close(started)
+			<-release
+		}
+		*now = now.Add(FROZEN_ORGANIZATIONS_REFRESH_INTERVAL)
+
+		refreshed := make(chan bool)
+		go func() {
+			refreshed <- service.IsFrozen(ctx, "org_1")
+		}()
+		<-started
+
+		// The other callers are not blocked by the read, they use the last known freezes
+		checked := make(chan bool)
+		go func() {
+			checked <- service.IsFrozen(ctx, "org_1")
+		}()
+		select {
+		case frozen := <-checked:
+			assert.True(t, frozen)
+		case <-time.After(time.Second):
+			t.Fatal("IsFrozen blocked by the refresh in progress")
+		}
+
+		// The freeze is lifted during the read, the stale freezes are discarded
+		store.afterRead = nil
+		require.True(t, service.Unfreeze(ctx, "org_1").Success())
+		close(release)
+
+		assert.False(t, <-refreshed)
+		assert.False(t, service.IsFrozen(ctx, "org_1"))
+		assert.Equal(t, 3, store.ReadCount)
+	})
+}
+
+func TestFreezeServeHTTP(t *testing.T) {
+	service, store, _ := setupFreezeService()
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /frozen_organizations", service)
+	mux.Handle("PUT /frozen_organizations/{organization_id}", service)
+	mux.Handle("DELETE /frozen_organizations/{organization_id}", service)
+
+	serve := func(method string, path string, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return recorder
+	}
+
+	t.Run("With an organization frozen", func(t *testing.T) {
+		response := serve(http.MethodPut, "/frozen_organizations/org_1", `{"reason": "migration"}`)
+		require.Equal(t, http.StatusOK, response.Code)
+
+		response = serve(http.MethodPut, "/frozen_organizations/org_2", "")
+		require.Equal(t, http.StatusOK, response.Code)
+
+		response = serve(http.MethodGet, "/frozen_organizations", "")
+		require.Equal(t, http.StatusOK, response.Code)
+
+		freezes := []*models.OrganizationFreeze{}
+		require.NoError(t, json.Unmarshal(response.Body.Bytes(), &freezes))
+		require.Len(t, freezes, 2)
+		assert.Equal(t, "org_1", freezes[0].OrganizationID)
+		assert.Equal(t, "migration", freezes[0].Reason)
+		assert.Equal(t, "org_2", freezes[1].OrganizationID)
+	})
+
+	t.Run("With an organization unfrozen", func(t *testing.T) {
+		response := serve(http.MethodDelete, "/frozen_organizations/org_1", "")
+		assert.Equal(t, http.StatusNoContent, response.Code)
+		assert.NotContains(t, store.frozen, "org_1")
+
+		response = serve(http.MethodDelete, "/frozen_organizations/org_1", "")
+		assert.Equal(t, http.StatusNotFound, response.Code)
+		assert.Contains(t, response.Body.String(), "organization_not_frozen")
+	})
+
+	t.Run("With an invalid body", func(t *testing.T) {
+		response := serve(http.MethodPut, "/frozen_organizations/org_1", `{"reason":`)
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Contains(t, response.Body.String(), "invalid_freeze")
+	})
+
+	t.Run("With a store error", func(t *testing.T) {
+		store.err = errors.New("connection refused")
+		defer func() { store.err = nil }()
+
+		response := serve(http.MethodPut, "/frozen_organizations/org_1", "")
+		assert.Equal(t, http.StatusInternalServerError, response.Code)
+		assert.Contains(t, response.Body.String(), "freeze_store_error")
+	})
+}
+
+func TestProcessEventsWithFrozenOrganization(t *testing.T) {
+	testEnv := setupProcessorTestEnv(t, true)
+	defer testEnv.Cleanup()
+
+	testEnv.EventProcessor.FreezeService, _, _ = setupFreezeService("frozen_org")
+
+	events := buildScheduledEvents("frozen_org", "frozen_org")
+	records := []*kgo.Record{events[0].record, events[1].record}
+
+	processed := testEnv.EventProcessor.ProcessEvents(context.Background(), records)
+
+	// Events of a frozen organization are pushed to the hold topic and committed
+	assert.Equal(t, 2, testEnv.Producers.holdProducer.ExecutionCount)
+	assert.Equal(t, []byte("frozen_org"), testEnv.Producers.holdProducer.Key)
+	assert.Equal(t, records[1].Value, testEnv.Producers.holdProducer.Value)
+	assert.ElementsMatch(t, records, processed)
+	assert.Equal(t, 0, testEnv.Producers.enrichedProducer.ExecutionCount)
+}
@@ -0,0 +1,61 @@
+package events_processor
+
+import (
+	"net/http"
+
+	"github.com/getlago/lago/events-processor/config/kafka"
+	"github.com/getlago/lago/events-processor/server"
+)
+
+// ConsumerGroupHealth is the subset of the raw events consumer group reporting its fetch errors
+type ConsumerGroupHealth interface {
+	Health() kafka.ConsumerHealth
+}
+
+// HealthResponse is the health of the raw events consumer group, along with the consumer groups of the lanes
+type HealthResponse struct {
+	kafka.ConsumerHealth
+	Lanes map[string]kafka.ConsumerHealth `json:"lanes,omitempty"`
+}
+
+// HealthService reports the health of the raw events consumer group and of the lane consumer groups
+type HealthService struct {
+	consumerGroup ConsumerGroupHealth
+	lanes         map[string]ConsumerGroupHealth
+}
+
+func NewHealthService(consumerGroup ConsumerGroupHealth) *HealthService {
+	return &HealthService{
+		consumerGroup: consumerGroup,
+		lanes:         make(map[string]ConsumerGroupHealth),
+	}
+}
+
+// AddLane reports the consumer group of a lane consuming its own topic
+func (s *HealthService) AddLane(name string, consumerGroup ConsumerGroupHealth) {
+	s.lanes[name] = consumerGroup
+}
+
+// ServeHTTP returns the consumer groups health, with a 503 once one of them stopped on a fatal error
+func (s *HealthService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	response := HealthResponse{ConsumerHealth: s.consumerGroup.Health()}
+
+	status := http.StatusOK
+	if response.Status == kafka.HealthStatusFailed {
+		status = http.StatusServiceUnavailable
+	}
+
+	if len(s.lanes) > 0 {
+		response.Lanes = make(map[string]kafka.ConsumerHealth, len(s.lanes))
+		for name, consumerGroup := range s.lanes {
+			health := consumerGroup.Health()
+			response.Lanes[name] = health
+
+			if health.Status == kafka.HealthStatusFailed {
+				status = http.StatusServiceUnavailable
+			}
+		}
+	}
+
+	server.WriteJSON(w, status, response)
+}
@@ -0,0 +1,66 @@
+package events_processor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getlago/lago/events-processor/config/kafka"
+)
+
+type mockConsumerGroupHealth struct {
+	health kafka.ConsumerHealth
+}
+
+func (m *mockConsumerGroupHealth) Health() kafka.ConsumerHealth {
+	return m.health
+}
+
+func TestHealthServeHTTP(t *testing.T) {
+	consumerGroup := &mockConsumerGroupHealth{}
+	service := NewHealthService(consumerGroup)
+
+	serve := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		service.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+		return recorder
+	}
+
+	t.Run("With a degraded consumer group", func(t *testing.T) {
+		consumerGroup.health = kafka.ConsumerHealth{Status: kafka.HealthStatusDegraded, ConsecutiveFetchErrors: 2}
+
+		response := serve()
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Contains(t, response.Body.String(), `"status":"degraded"`)
+	})
+
+	t.Run("With a failed consumer group", func(t *testing.T) {
+		consumerGroup.health = kafka.ConsumerHealth{Status: kafka.HealthStatusFailed, LastFetchError: "invalid topic"}
+
+		response := serve()
+		assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+		assert.Contains(t, response.Body.String(), "invalid topic")
+	})
+
+	t.Run("With lane consumer groups", func(t *testing.T) {
+		consumerGroup.health = kafka.ConsumerHealth{Status: kafka.HealthStatusHealthy}
+		laneConsumerGroup := &mockConsumerGroupHealth{health: kafka.ConsumerHealth{Status: kafka.HealthStatusDegraded}}
+		service.AddLane("in_advance", laneConsumerGroup)
+
+		response := serve()
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		var health HealthResponse
+		require.NoError(t, json.Unmarshal(response.Body.Bytes(), &health))
+		assert.Equal(t, kafka.HealthStatusHealthy, health.Status)
+		assert.Equal(t, kafka.HealthStatusDegraded, health.Lanes["in_advance"].Status)
+
+		// A failed lane consumer group fails the health check
+		laneConsumerGroup.health = kafka.ConsumerHealth{Status: kafka.HealthStatusFailed}
+		assert.Equal(t, http.StatusServiceUnavailable, serve().Code)
+	})
+}
@@ -0,0 +1,206 @@
+package events_processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+// Maximum duration of a poll of the hold topic, the paused partitions are resumed between two polls
+const HOLD_POLL_TIMEOUT = time.Second
+
+// Delays before retrying a held event failing with a retryable error, doubled on each consecutive failure
+const (
+	HOLD_RETRY_MIN_BACKOFF = time.Second
+	HOLD_RETRY_MAX_BACKOFF = 30 * time.Second
+)
+
+// HoldClient is the subset of the Kafka client used to consume the hold topic
+type HoldClient interface {
+	PollRecords(ctx context.Context, maxPollRecords int) kgo.Fetches
+	CommitRecords(ctx context.Context, records ...*kgo.Record) error
+	SetOffsets(setOffsets map[string]map[int32]kgo.EpochOffset)
+	PauseFetchPartitions(topicPartitions map[string][]int32) map[string][]int32
+	ResumeFetchPartitions(topicPartitions map[string][]int32)
+	AllowRebalance()
+	Close()
+}
+
+// HoldService re-injects the events held while their organization was frozen, in the order of the hold topic.
+// The events of an organization still frozen are produced again to the hold topic and committed,
+// so they don't block the events of the other organizations sharing their partition.
+// The new events of an unfrozen organization are not diverted anymore: they can be processed before its held events.
+type HoldService struct {
+	client        HoldClient
+	topic         string
+	processor     *EventProcessor
+	freezeService *FreezeService
+	logger        *slog.Logger
+	now           func() time.Time
+
+	// Paused partitions, with their resume time
+	paused map[int32]*heldPartition
+	// Consecutive retryable failures per partition
+	retries map[int32]int
+}
+
+// heldPartition is a partition of the hold topic paused until its retry time,
+// after a retryable failure or a batch of events all held again
+type heldPartition struct {
+	retryAt time.Time
+}
+
+func NewHoldService(client HoldClient, topic string, processor *EventProcessor, freezeService *FreezeService) *HoldService {
+	return &HoldService{
+		client:        client,
+		topic:         topic,
+		processor:     processor,
+		freezeService: freezeService,
+		logger:        slog.Default().With("component", "hold-consumer"),
+		now:           time.Now,
+		paused:        make(map[int32]*heldPartition),
+		retries:       make(map[int32]int),
+	}
+}
+
+// Start consumes the hold topic until the context is canceled
+func (s *HoldService) Start(ctx context.Context) {
+	defer s.client.Close()
+
+	s.logger.Info("Starting hold consumer", slog.String("topic", s.topic))
+	for ctx.Err() == nil {
+		s.resumeReleasedPartitions()
+
+		pollCtx, cancel := context.WithTimeout(ctx, HOLD_POLL_TIMEOUT)
+		fetches := s.client.PollRecords(pollCtx, 1000)
+		cancel()
+
+		if fetches.IsClientClosed() {
+			break
+		}
+
+		fetches.EachError(func(_ string, _ int32, err error) {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				return
+			}
+
+			s.logger.Error("Fetch error", slog.String("error", err.Error()))
+			utils.CaptureError(err)
+		})
+
+		fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+			s.releasePartition(ctx, p.Partition, p.Records)
+		})
+
+		s.client.AllowRebalance()
+	}
+	s.logger.Info("Hold consumer stopped")
+}
+
+// releasePartition processes the held records of a partition up to the first record failing with a retryable error,
+// the partition is then rewound to this record and paused.
+// A partition whose records were all held again is paused until the freezes are read again, to not loop on them.
+func (s *HoldService) releasePartition(ctx context.Context, partition int32, records []*kgo.Record) {
+	released, heldAgain, blocking := s.releaseRecords(ctx, records)
+
+	if len(released) > 0 {
+		if err := s.client.CommitRecords(ctx, released[len(released)-1]); err != nil {
+			s.logger.Error("Error committing held records", slog.Int("partition", int(partition)), slog.String("error", err.Error()))
+			utils.CaptureError(err)
+		}
+	}
+
+	if len(released) > 0 || blocking == nil {
+		delete(s.retries, partition)
+	}
+
+	if blocking != nil {
+		s.pausePartition(partition, blocking)
+		s.retryPartition(partition)
+		return
+	}
+
+	if len(released) > 0 && heldAgain == len(released) {
+		next := released[len(released)-1]
+		s.pausePartition(partition, &kgo.Record{LeaderEpoch: next.LeaderEpoch, Offset: next.Offset + 1})
+		s.paused[partition] = &heldPartition{retryAt: s.now().Add(FROZEN_ORGANIZATIONS_REFRESH_INTERVAL)}
+	}
+}
+
+// pausePartition rewinds a partition to the given record and pauses it
+func (s *HoldService) pausePartition(partition int32, from *kgo.Record) {
+	s.client.SetOffsets(map[string]map[int32]kgo.EpochOffset{
+		s.topic: {partition: {Epoch: from.LeaderEpoch, Offset: from.Offset}},
+	})
+	s.client.PauseFetchPartitions(map[string][]int32{s.topic: {partition}})
+}
+
+// retryPartition records the retry time of a partition paused by a retryable failure,
+// after a backoff doubled on each consecutive failure
+func (s *HoldService) retryPartition(partition int32) {
+	backoff := HOLD_RETRY_MIN_BACKOFF << min(s.retries[partition], 5)
+	s.paused[partition] = &heldPartition{retryAt: s.now().Add(min(backoff, HOLD_RETRY_MAX_BACKOFF))}
+	s.retries[partition]++
+}
+
+// releaseRecords processes the records in order and stops on the first record failing with a retryable error.
+// The records of a frozen organization are produced again to the hold topic, they are released with the processed records
+// and counted apart. A record that can't be produced again stops the release like a retryable error.
+func (s *HoldService) releaseRecords(ctx context.Context, records []*kgo.Record) ([]*kgo.Record, int, *kgo.Record) {
+	released := make([]*kgo.Record, 0, len(records))
+	heldAgain := 0
+
+	for _, record := range records {
+		event := models.Event{}
+		if err := json.Unmarshal(record.Value, &event); err != nil {
+			s.logger.Error("Error unmarshalling held message", slog.String("error", err.Error()))
+			utils.CaptureError(err)
+
+			released = append(released, record)
+			continue
+		}
+
+		if s.freezeService.IsFrozen(ctx, event.OrganizationID) {
+			if !s.processor.ProducerService.ProduceHeldEvent(ctx, &event, record) {
+				return released, heldAgain, record
+			}
+
+			released = append(released, record)
+			heldAgain++
+			continue
+		}
+
+		if !s.processor.processRecord(ctx, &scheduledEvent{record: record, event: event}) {
+			return released, heldAgain, record
+		}
+
+		released = append(released, record)
+	}
+
+	return released, heldAgain, nil
+}
+
+// resumeReleasedPartitions resumes the paused partitions once their retry time is over
+func (s *HoldService) resumeReleasedPartitions() {
+	now := s.now()
+
+	var partitions []int32
+	for partition, held := range s.paused {
+		if !now.Before(held.retryAt) {
+			partitions = append(partitions, partition)
+			delete(s.paused, partition)
+		}
+	}
+
+	if len(partitions) > 0 {
+		s.logger.Info("Resuming held events", slog.Any("partitions", partitions))
+		s.client.ResumeFetchPartitions(map[string][]int32{s.topic: partitions})
+	}
+}
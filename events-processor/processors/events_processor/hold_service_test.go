@@ -0,0 +1,164 @@
+package events_processor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+type mockHoldClient struct {
+	committed []*kgo.Record
+	offsets   map[string]map[int32]kgo.EpochOffset
+	paused    []int32
+	resumed   []int32
+}
+
+func (m *mockHoldClient) PollRecords(ctx context.Context, maxPollRecords int) kgo.Fetches {
+	return nil
+}
+
+func (m *mockHoldClient) CommitRecords(ctx context.Context, records ...*kgo.Record) error {
+	m.committed = append(m.committed, records...)
+	return nil
+}
+
+func (m *mockHoldClient) SetOffsets(setOffsets map[string]map[int32]kgo.EpochOffset) {
+	m.offsets = setOffsets
+}
+
+func (m *mockHoldClient) PauseFetchPartitions(topicPartitions map[string][]int32) map[string][]int32 {
+	m.paused = append(m.paused, topicPartitions["hold_topic"]...)
+	return topicPartitions
+}
+
+func (m *mockHoldClient) ResumeFetchPartitions(topicPartitions map[string][]int32) {
+	m.resumed = append(m.resumed, topicPartitions["hold_topic"]...)
+}
+
+func (m *mockHoldClient) AllowRebalance() {}
+
+func (m *mockHoldClient) Close() {}
+
+func TestHoldServiceReleasePartition(t *testing.T) {
+	t.Run("With every organization unfrozen", func(t *testing.T) {
+		testEnv := setupProcessorTestEnv(t, true)
+		defer testEnv.Cleanup()
+
+		freezeService, _, _ := setupFreezeService()
+		client := &mockHoldClient{}
+		service := NewHoldService(client, "hold_topic", testEnv.EventProcessor, freezeService)
+
+		events := buildScheduledEvents("org_1", "org_2")
+		service.releasePartition(context.Background(), 0, []*kgo.Record{events[0].record, events[1].record})
+
+		assert.Equal(t, []*kgo.Record{events[1].record}, client.committed)
+		assert.Nil(t, client.offsets)
+		assert.Empty(t, client.paused)
+	})
+
+	t.Run("With a frozen organization", func(t *testing.T) {
+		testEnv := setupProcessorTestEnv(t, true)
+		defer testEnv.Cleanup()
+
+		freezeService, _, _ := setupFreezeService("org_2")
+		client := &mockHoldClient{}
+		service := NewHoldService(client, "hold_topic", testEnv.EventProcessor, freezeService)
+
+		events := buildScheduledEvents("org_1", "org_2", "org_1")
+		service.releasePartition(context.Background(), 2, []*kgo.Record{events[0].record, events[1].record, events[2].record})
+
+		// The event of the frozen organization is held again, the partition is not blocked
+		assert.Equal(t, 1, testEnv.Producers.holdProducer.ExecutionCount)
+		assert.Equal(t, []byte("org_2"), testEnv.Producers.holdProducer.Key)
+		assert.Equal(t, events[1].record.Value, testEnv.Producers.holdProducer.Value)
+		assert.Equal(t, []*kgo.Record{events[2].record}, client.committed)
+		assert.Nil(t, client.offsets)
+		assert.Empty(t, client.paused)
+	})
+
+	t.Run("With only events of frozen organizations", func(t *testing.T) {
+		testEnv := setupProcessorTestEnv(t, true)
+		defer testEnv.Cleanup()
+
+		freezeService, _, now := setupFreezeService("org_1")
+		client := &mockHoldClient{}
+		service := NewHoldService(client, "hold_topic", testEnv.EventProcessor, freezeService)
+		service.now = func() time.Time { return *now }
+
+		events := buildScheduledEvents("org_1", "org_1")
+		events[1].record.Offset = 42
+		events[1].record.LeaderEpoch = 3
+		service.releasePartition(context.Background(), 2, []*kgo.Record{events[0].record, events[1].record})
+
+		// The events are held again and committed, the partition is paused until the freezes are read again
+		assert.Equal(t, 2, testEnv.Producers.holdProducer.ExecutionCount)
+		assert.Equal(t, []*kgo.Record{events[1].record}, client.committed)
+		require.Contains(t, client.offsets, "hold_topic")
+		assert.Equal(t, kgo.EpochOffset{Epoch: 3, Offset: 43}, client.offsets["hold_topic"][2])
+		assert.Equal(t, []int32{2}, client.paused)
+
+		service.resumeReleasedPartitions()
+		assert.Empty(t, client.resumed)
+
+		*now = now.Add(FROZEN_ORGANIZATIONS_REFRESH_INTERVAL)
+		service.resumeReleasedPartitions()
+		assert.Equal(t, []int32{2}, client.resumed)
+		assert.Empty(t, service.paused)
+	})
+
+	t.Run("With an invalid held message", func(t *testing.T) {
+		testEnv := setupProcessorTestEnv(t, true)
+		defer testEnv.Cleanup()
+
+		freezeService, _, _ := setupFreezeService()
+		client := &mockHoldClient{}
+		service := NewHoldService(client, "hold_topic", testEnv.EventProcessor, freezeService)
+
+		record := &kgo.Record{Value: []byte("invalid")}
+		service.releasePartition(context.Background(), 0, []*kgo.Record{record})
+
+		assert.Equal(t, []*kgo.Record{record}, client.committed)
+		assert.Empty(t, client.paused)
+	})
+}
+
+func TestHoldServiceRetryBackoff(t *testing.T) {
+	freezeService, _, _ := setupFreezeService()
+	client := &mockHoldClient{}
+	service := NewHoldService(client, "hold_topic", nil, freezeService)
+	now := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+
+	// A partition blocked by a retryable failure is not resumed before its backoff
+	service.retryPartition(1)
+	service.resumeReleasedPartitions()
+	assert.Empty(t, client.resumed)
+
+	now = now.Add(HOLD_RETRY_MIN_BACKOFF)
+	service.resumeReleasedPartitions()
+	assert.Equal(t, []int32{1}, client.resumed)
+
+	// The backoff is doubled on each consecutive failure, up to the maximum
+	service.retryPartition(1)
+	now = now.Add(HOLD_RETRY_MIN_BACKOFF)
+	service.resumeReleasedPartitions()
+	assert.Equal(t, []int32{1}, client.resumed)
+
+	now = now.Add(HOLD_RETRY_MIN_BACKOFF)
+	service.resumeReleasedPartitions()
+	assert.Equal(t, []int32{1, 1}, client.resumed)
+
+	for range 10 {
+		service.retryPartition(1)
+	}
+	assert.Equal(t, now.Add(HOLD_RETRY_MAX_BACKOFF), service.paused[1].retryAt)
+
+	// Releasing held events resets the backoff
+	service.releasePartition(context.Background(), 1, nil)
+	service.retryPartition(1)
+	assert.Equal(t, now.Add(HOLD_RETRY_MIN_BACKOFF), service.paused[1].retryAt)
+}
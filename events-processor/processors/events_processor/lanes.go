@@ -0,0 +1,100 @@
+package events_processor
+
+import (
+	"github.com/getlago/lago/events-processor/models"
+)
+
+// processingLane classifies the raw events of a lane and bounds their concurrency
+type processingLane struct {
+	name          string
+	concurrency   int
+	header        string
+	headerValue   string
+	organizations organizationSet
+}
+
+func newProcessingLane(lane *models.Lane) *processingLane {
+	return &processingLane{
+		name:          lane.Name,
+		concurrency:   lane.Concurrency,
+		header:        lane.Header,
+		headerValue:   lane.HeaderValue,
+		organizations: newOrganizationSet(lane.OrganizationIDs),
+	}
+}
+
+// matches returns true when the event belongs to the lane, by its organization or by its header
+func (l *processingLane) matches(ev *scheduledEvent) bool {
+	if l.organizations.Contains(ev.event.OrganizationID) {
+		return true
+	}
+
+	if l.header == "" {
+		return false
+	}
+
+	for _, header := range ev.record.Headers {
+		if header.Key == l.header && (l.headerValue == "" || string(header.Value) == l.headerValue) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type laneEvents struct {
+	lane   *processingLane
+	events []*scheduledEvent
+}
+
+// SetLanes classifies the raw events in lanes processed concurrently, each with its own concurrency budget.
+// The events matching no lane are processed in the default lane, with the processor concurrency.
+func (processor *EventProcessor) SetLanes(lanes []*models.Lane) {
+	processor.lanes = make([]*processingLane, 0, len(lanes))
+	for _, lane := range lanes {
+		processor.lanes = append(processor.lanes, newProcessingLane(lane))
+	}
+}
+
+func (processor *EventProcessor) lane(name string) (*processingLane, bool) {
+	for _, lane := range processor.lanes {
+		if lane.name == name {
+			return lane, true
+		}
+	}
+
+	return nil, false
+}
+
+func (processor *EventProcessor) defaultLane() *processingLane {
+	return &processingLane{name: models.DEFAULT_LANE, concurrency: processor.concurrency}
+}
+
+// splitByLane assigns each event to the first lane it matches, the lanes without events are left out
+func (processor *EventProcessor) splitByLane(events []*scheduledEvent) []*laneEvents {
+	byLane := make([]*laneEvents, len(processor.lanes)+1)
+	for i, lane := range processor.lanes {
+		byLane[i] = &laneEvents{lane: lane}
+	}
+	byLane[len(processor.lanes)] = &laneEvents{lane: processor.defaultLane()}
+
+	for _, ev := range events {
+		index := len(processor.lanes)
+		for i, lane := range processor.lanes {
+			if lane.matches(ev) {
+				index = i
+				break
+			}
+		}
+		byLane[index].events = append(byLane[index].events, ev)
+	}
+
+	split := make([]*laneEvents, 0, len(byLane))
+	for _, le := range byLane {
+		if len(le.events) > 0 {
+			split = append(split, le)
+		}
+	}
+
+	return split
+}
@@ -0,0 +1,99 @@
+package events_processor
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/getlago/lago/events-processor/models"
+)
+
+func newLaneEvent(organizationID string, headers ...kgo.RecordHeader) *scheduledEvent {
+	return &scheduledEvent{
+		record: &kgo.Record{Headers: headers},
+		event:  models.Event{OrganizationID: organizationID},
+	}
+}
+
+func TestSplitByLane(t *testing.T) {
+	processor := &EventProcessor{concurrency: 4}
+	processor.SetLanes([]*models.Lane{
+		{Name: "in_advance", Concurrency: 10, Header: "lago-pay-in-advance", HeaderValue: "true"},
+		{Name: "premium", Concurrency: 2, Header: "lago-premium", OrganizationIDs: []string{"premium_org"}},
+	})
+
+	inAdvance := newLaneEvent("premium_org", kgo.RecordHeader{Key: "lago-pay-in-advance", Value: []byte("true")})
+	premium := newLaneEvent("premium_org")
+	flagged := newLaneEvent("org_id", kgo.RecordHeader{Key: "lago-premium"})
+	notInAdvance := newLaneEvent("org_id", kgo.RecordHeader{Key: "lago-pay-in-advance", Value: []byte("false")})
+	bulk := newLaneEvent("org_id")
+
+	split := processor.splitByLane([]*scheduledEvent{inAdvance, premium, flagged, notInAdvance, bulk})
+	require.Len(t, split, 3)
+
+	// Events belong to the first lane they match
+	assert.Equal(t, "in_advance", split[0].lane.name)
+	assert.Equal(t, []*scheduledEvent{inAdvance}, split[0].events)
+
+	assert.Equal(t, "premium", split[1].lane.name)
+	assert.Equal(t, 2, split[1].lane.concurrency)
+	assert.Equal(t, []*scheduledEvent{premium, flagged}, split[1].events)
+
+	assert.Equal(t, models.DEFAULT_LANE, split[2].lane.name)
+	assert.Equal(t, 4, split[2].lane.concurrency)
+	assert.Equal(t, []*scheduledEvent{notInAdvance, bulk}, split[2].events)
+
+	t.Run("Without lane events", func(t *testing.T) {
+		split := processor.splitByLane([]*scheduledEvent{bulk})
+		require.Len(t, split, 1)
+		assert.Equal(t, models.DEFAULT_LANE, split[0].lane.name)
+	})
+}
+
+func TestProcessEventsWithLanes(t *testing.T) {
+	testEnv := setupProcessorTestEnv(t, true)
+	defer testEnv.Cleanup()
+
+	testEnv.EventProcessor.SetLanes([]*models.Lane{
+		{Name: "premium", Topic: "events_raw_premium", Concurrency: 1, OrganizationIDs: []string{"premium_org"}},
+	})
+
+	newRecord := func(organizationID string, transactionID string) *kgo.Record {
+		value, err := json.Marshal(models.Event{
+			OrganizationID:         organizationID,
+			ExternalSubscriptionID: "sub_id",
+			Code:                   "api_calls",
+			TransactionID:          transactionID,
+			Timestamp:              1741007009,
+		})
+		require.NoError(t, err)
+		return &kgo.Record{Value: value}
+	}
+
+	t.Run("With events of several lanes", func(t *testing.T) {
+		records := []*kgo.Record{
+			newRecord("premium_org", "tr_1"),
+			newRecord("org_id", "tr_2"),
+			newRecord("premium_org", "tr_3"),
+		}
+
+		// Events without billable metric are pushed to the dead letter queue and committed, whatever their lane
+		processed := testEnv.EventProcessor.ProcessEvents(context.Background(), records)
+		assert.ElementsMatch(t, records, processed)
+		assert.Equal(t, 3, testEnv.Producers.deadLetterProducer.ExecutionCount)
+	})
+
+	t.Run("With the topic of a lane", func(t *testing.T) {
+		records := []*kgo.Record{newRecord("org_id", "tr_4")}
+
+		processed := testEnv.EventProcessor.ProcessLaneEvents(context.Background(), "premium", records)
+		assert.Equal(t, records, processed)
+
+		processed = testEnv.EventProcessor.ProcessLaneEvents(context.Background(), "unknown", records)
+		assert.Equal(t, records, processed)
+	})
+}
@@ -0,0 +1,179 @@
+package events_processor
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+
+	"github.com/getlago/lago/events-processor/models"
+)
+
+const METER_NAME = "github.com/getlago/lago/events-processor"
+
+type UnbilledReason string
+
+const (
+	UnbilledReasonNoSubscription UnbilledReason = "no_subscription"
+	UnbilledReasonNoCharge       UnbilledReason = "no_charge"
+)
+
+// MissingEnrichment is the metadata of a subscription missing from the store when enriching its events
+type MissingEnrichment string
+
+const (
+	MissingEnrichmentCustomer MissingEnrichment = "customer"
+	MissingEnrichmentPlan     MissingEnrichment = "plan"
+)
+
+// ProcessorMetrics holds the business metrics of the processor,
+// they are exported with the OpenTelemetry meter provider when tracing is enabled
+type ProcessorMetrics struct {
+	unbilledEvents        metric.Int64Counter
+	pricingGroupOverflows metric.Int64Counter
+	rateLimitedEvents     metric.Int64Counter
+	panickedEvents        metric.Int64Counter
+	timedOutEvents        metric.Int64Counter
+	unestimatedFees       metric.Int64Counter
+	missingEnrichments    metric.Int64Counter
+}
+
+func NewProcessorMetrics(meter metric.Meter) *ProcessorMetrics {
+	unbilledEvents, err := meter.Int64Counter(
+		"lago.events_processor.unbilled_events",
+		metric.WithDescription("Events with no charge to bill them, by organization, billable metric code and plan"),
+		metric.WithUnit("{event}"),
+	)
+	if err != nil {
+		slog.Error("Error creating the unbilled events counter", slog.String("error", err.Error()))
+		unbilledEvents = noop.Int64Counter{}
+	}
+
+	pricingGroupOverflows, err := meter.Int64Counter(
+		"lago.events_processor.pricing_group_overflows",
+		metric.WithDescription("Events exceeding the pricing group cardinality limit of their charge, by organization, charge and action"),
+		metric.WithUnit("{event}"),
+	)
+	if err != nil {
+		slog.Error("Error creating the pricing group overflows counter", slog.String("error", err.Error()))
+		pricingGroupOverflows = noop.Int64Counter{}
+	}
+
+	rateLimitedEvents, err := meter.Int64Counter(
+		"lago.events_processor.rate_limited_events",
+		metric.WithDescription("Events exceeding the rate limit of their organization, by organization and action"),
+		metric.WithUnit("{event}"),
+	)
+	if err != nil {
+		slog.Error("Error creating the rate limited events counter", slog.String("error", err.Error()))
+		rateLimitedEvents = noop.Int64Counter{}
+	}
+
+	panickedEvents, err := meter.Int64Counter(
+		"lago.events_processor.panicked_events",
+		metric.WithDescription("Events whose processing panicked, by organization"),
+		metric.WithUnit("{event}"),
+	)
+	if err != nil {
+		slog.Error("Error creating the panicked events counter", slog.String("error", err.Error()))
+		panickedEvents = noop.Int64Counter{}
+	}
+
+	timedOutEvents, err := meter.Int64Counter(
+		"lago.events_processor.timed_out_events",
+		metric.WithDescription("Events processed after their deadline and consumed again, by organization"),
+		metric.WithUnit("{event}"),
+	)
+	if err != nil {
+		slog.Error("Error creating the timed out events counter", slog.String("error", err.Error()))
+		timedOutEvents = noop.Int64Counter{}
+	}
+
+	unestimatedFees, err := meter.Int64Counter(
+		"lago.events_processor.unestimated_fees",
+		metric.WithDescription("Aggregated events whose fee can't be estimated, missing from the usage amount of their subscription, by organization and charge"),
+		metric.WithUnit("{event}"),
+	)
+	if err != nil {
+		slog.Error("Error creating the unestimated fees counter", slog.String("error", err.Error()))
+		unestimatedFees = noop.Int64Counter{}
+	}
+
+	missingEnrichments, err := meter.Int64Counter(
+		"lago.events_processor.missing_enrichments",
+		metric.WithDescription("Events enriched without the customer or the plan of their subscription, by organization and missing metadata"),
+		metric.WithUnit("{event}"),
+	)
+	if err != nil {
+		slog.Error("Error creating the missing enrichments counter", slog.String("error", err.Error()))
+		missingEnrichments = noop.Int64Counter{}
+	}
+
+	return &ProcessorMetrics{
+		unbilledEvents:        unbilledEvents,
+		pricingGroupOverflows: pricingGroupOverflows,
+		rateLimitedEvents:     rateLimitedEvents,
+		panickedEvents:        panickedEvents,
+		timedOutEvents:        timedOutEvents,
+		unestimatedFees:       unestimatedFees,
+		missingEnrichments:    missingEnrichments,
+	}
+}
+
+// NewDefaultProcessorMetrics creates the metrics from the global meter provider
+func NewDefaultProcessorMetrics() *ProcessorMetrics {
+	return NewProcessorMetrics(otel.Meter(METER_NAME))
+}
+
+func (m *ProcessorMetrics) RecordUnbilledEvent(ctx context.Context, event *models.EnrichedEvent, reason UnbilledReason) {
+	m.unbilledEvents.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("organization_id", event.OrganizationID),
+		attribute.String("code", event.Code),
+		attribute.String("plan_id", event.PlanID),
+		attribute.String("reason", string(reason)),
+	))
+}
+
+func (m *ProcessorMetrics) RecordPricingGroupOverflow(ctx context.Context, event *models.EnrichedEvent, action models.CardinalityPolicyAction) {
+	m.pricingGroupOverflows.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("organization_id", event.OrganizationID),
+		attribute.String("charge_id", *event.ChargeID),
+		attribute.String("action", string(action)),
+	))
+}
+
+func (m *ProcessorMetrics) RecordRateLimitedEvent(ctx context.Context, organizationID string, action models.RateLimitAction) {
+	m.rateLimitedEvents.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("organization_id", organizationID),
+		attribute.String("action", string(action)),
+	))
+}
+
+func (m *ProcessorMetrics) RecordPanickedEvent(ctx context.Context, organizationID string) {
+	m.panickedEvents.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("organization_id", organizationID),
+	))
+}
+
+func (m *ProcessorMetrics) RecordTimedOutEvent(ctx context.Context, organizationID string) {
+	m.timedOutEvents.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("organization_id", organizationID),
+	))
+}
+
+func (m *ProcessorMetrics) RecordUnestimatedFee(ctx context.Context, event *models.EnrichedEvent) {
+	m.unestimatedFees.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("organization_id", event.OrganizationID),
+		attribute.String("charge_id", *event.ChargeID),
+	))
+}
+
+func (m *ProcessorMetrics) RecordMissingEnrichment(ctx context.Context, event *models.EnrichedEvent, missing MissingEnrichment) {
+	m.missingEnrichments.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("organization_id", event.OrganizationID),
+		attribute.String("missing", string(missing)),
+	))
+}
@@ -0,0 +1,21 @@
+package events_processor
+
+// Wildcard enabling a per organization option for every organization
+const ALL_ORGANIZATIONS = "*"
+
+// organizationSet holds the organizations for which a per organization option is enabled
+type organizationSet map[string]bool
+
+func newOrganizationSet(organizationIDs []string) organizationSet {
+	set := make(organizationSet, len(organizationIDs))
+	for _, organizationID := range organizationIDs {
+		set[organizationID] = true
+	}
+
+	return set
+}
+
+// Contains returns true when the option is enabled for the organization or for every organization
+func (s organizationSet) Contains(organizationID string) bool {
+	return s[ALL_ORGANIZATIONS] || s[organizationID]
+}
@@ -0,0 +1,130 @@
+package events_processor
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// PanicError is the failure of an event whose processing panicked, with the stack trace of the panic
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// newPanicError wraps a recovered value, it must be called from the deferred function recovering the panic
+func newPanicError(value any) *PanicError {
+	if panicErr, ok := value.(*PanicError); ok {
+		return panicErr
+	}
+
+	return &PanicError{Value: value, Stack: debug.Stack()}
+}
+
+// recoveredGroup runs goroutines like an errgroup.Group, but recovers their panic
+// and raises it again in Wait, so it reaches the goroutine processing the record
+type recoveredGroup struct {
+	group errgroup.Group
+
+	mu    sync.Mutex
+	panic *PanicError
+}
+
+func (g *recoveredGroup) Go(f func() error) {
+	g.group.Go(func() error {
+		defer func() {
+			if value := recover(); value != nil {
+				g.mu.Lock()
+				defer g.mu.Unlock()
+
+				if g.panic == nil {
+					g.panic = newPanicError(value)
+				}
+			}
+		}()
+
+		return f()
+	})
+}
+
+func (g *recoveredGroup) Wait() error {
+	err := g.group.Wait()
+	if g.panic != nil {
+		panic(g.panic)
+	}
+
+	return err
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// PanicCircuitBreaker stops a partition when too many of its records panic within a time window,
+// so a bug doesn't push a whole partition to the dead letter queue
+type PanicCircuitBreaker struct {
+	threshold int
+	window    time.Duration
+	stop      func(topic string, partition int32) error
+	now       func() time.Time
+
+	mu     sync.Mutex
+	panics map[topicPartition][]time.Time
+}
+
+// NewPanicCircuitBreaker trips when threshold panics happen within the window on a partition,
+// the partition is then stopped with the stop function
+func NewPanicCircuitBreaker(threshold int, window time.Duration, stop func(topic string, partition int32) error) *PanicCircuitBreaker {
+	return &PanicCircuitBreaker{
+		threshold: threshold,
+		window:    window,
+		stop:      stop,
+		now:       time.Now,
+		panics:    make(map[topicPartition][]time.Time),
+	}
+}
+
+// RecordPanic tracks a panic of a record of the partition, and returns true when it trips the breaker
+func (b *PanicCircuitBreaker) RecordPanic(topic string, partition int32) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tp := topicPartition{topic: topic, partition: partition}
+	now := b.now()
+
+	panics := b.panics[tp]
+	for len(panics) > 0 && now.Sub(panics[0]) >= b.window {
+		panics = panics[1:]
+	}
+	panics = append(panics, now)
+
+	if len(panics) < b.threshold {
+		b.panics[tp] = panics
+		return false
+	}
+
+	// The count starts over once the partition is resumed
+	delete(b.panics, tp)
+
+	slog.Error(
+		"Too many panics, stopping the partition",
+		slog.String("topic", topic),
+		slog.Int("partition", int(partition)),
+		slog.Int("panics", len(panics)),
+		slog.Duration("window", b.window),
+	)
+	if err := b.stop(topic, partition); err != nil {
+		slog.Error("Error stopping the partition", slog.String("topic", topic), slog.Int("partition", int(partition)), slog.String("error", err.Error()))
+	}
+
+	return true
+}
@@ -0,0 +1,106 @@
+package events_processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/getlago/lago/events-processor/models"
+)
+
+func TestRecoveredGroup(t *testing.T) {
+	t.Run("Without panic", func(t *testing.T) {
+		group := recoveredGroup{}
+		group.Go(func() error { return errors.New("failure") })
+
+		assert.EqualError(t, group.Wait(), "failure")
+	})
+
+	t.Run("With a panicking goroutine", func(t *testing.T) {
+		group := recoveredGroup{}
+		group.Go(func() error { panic("boom") })
+
+		defer func() {
+			panicErr, ok := recover().(*PanicError)
+			require.True(t, ok)
+			assert.Equal(t, "panic: boom", panicErr.Error())
+			assert.Contains(t, string(panicErr.Stack), "TestRecoveredGroup")
+		}()
+		_ = group.Wait()
+		t.Fatal("Wait should panic")
+	})
+}
+
+func TestPanicCircuitBreaker(t *testing.T) {
+	now := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	var stopped []int32
+
+	breaker := NewPanicCircuitBreaker(3, time.Minute, func(topic string, partition int32) error {
+		stopped = append(stopped, partition)
+		return nil
+	})
+	breaker.now = func() time.Time { return now }
+
+	assert.False(t, breaker.RecordPanic("events_raw", 0))
+	assert.False(t, breaker.RecordPanic("events_raw", 0))
+	assert.False(t, breaker.RecordPanic("events_raw", 1))
+
+	// Panics older than the window are not counted
+	now = now.Add(time.Minute)
+	assert.False(t, breaker.RecordPanic("events_raw", 0))
+	assert.False(t, breaker.RecordPanic("events_raw", 0))
+	assert.Empty(t, stopped)
+
+	assert.True(t, breaker.RecordPanic("events_raw", 0))
+	assert.Equal(t, []int32{0}, stopped)
+
+	// The count starts over after a trip
+	assert.False(t, breaker.RecordPanic("events_raw", 0))
+}
+
+func TestProcessEventsWithPanic(t *testing.T) {
+	testEnv := setupProcessorTestEnv(t, true)
+	defer testEnv.Cleanup()
+
+	// A missing enrichment service makes the processing panic
+	testEnv.EventProcessor.EnrichmentService = nil
+
+	var stopped []int32
+	testEnv.EventProcessor.PanicCircuitBreaker = NewPanicCircuitBreaker(2, time.Minute, func(topic string, partition int32) error {
+		stopped = append(stopped, partition)
+		return nil
+	})
+
+	records := make([]*kgo.Record, 0, 2)
+	for _, transactionID := range []string{"tr_1", "tr_2"} {
+		value, err := json.Marshal(models.Event{
+			OrganizationID:         "org_id",
+			ExternalSubscriptionID: "sub_id",
+			Code:                   "api_calls",
+			TransactionID:          transactionID,
+			Timestamp:              1741007009,
+		})
+		require.NoError(t, err)
+		records = append(records, &kgo.Record{Topic: "events_raw", Partition: 3, Value: value})
+	}
+
+	processed := testEnv.EventProcessor.ProcessEvents(context.Background(), records)
+
+	// Panicking events are committed and pushed to the dead letter queue with their stack trace
+	assert.ElementsMatch(t, records, processed)
+	require.Equal(t, 2, testEnv.Producers.deadLetterProducer.ExecutionCount)
+
+	failedEvent := models.FailedEvent{}
+	require.NoError(t, json.Unmarshal(testEnv.Producers.deadLetterProducer.Value, &failedEvent))
+	assert.Equal(t, "panic", failedEvent.ErrorCode)
+	assert.Contains(t, failedEvent.InitialErrorMessage, "panic:")
+	assert.Contains(t, failedEvent.StackTrace, "processEvent")
+
+	assert.Equal(t, []int32{3}, stopped)
+}
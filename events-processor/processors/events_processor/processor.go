@@ -3,6 +3,8 @@ package events_processor
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"sync"
 	"time"
@@ -20,86 +22,321 @@ type EventProcessor struct {
 	ProducerService   *EventProducerService
 	RefreshService    *SubscriptionRefreshService
 	CacheService      *CacheService
+	Metrics           *ProcessorMetrics
+	// Optional, attaches an estimated fee to the charged in advance records
+	FeeEstimationService *FeeEstimationService
+	// Optional, maintains the running usage of the subscriptions
+	UsageAggregationService *UsageAggregationService
+	// Optional, detects the usage thresholds crossed by the aggregated usage
+	UsageThresholdService *UsageThresholdService
+	// Optional, limits the number of pricing groups of the charges
+	CardinalityGuardService *CardinalityGuardService
+	// Optional, limits the number of events processed per second for each organization
+	RateLimitService *RateLimitService
+	// Optional, holds the events of the frozen organizations
+	FreezeService *FreezeService
+	// Optional, stops the partitions with too many panicking records
+	PanicCircuitBreaker *PanicCircuitBreaker
+
+	// Organizations receiving one charged in advance record per pay in advance charge and charge filter,
+	// the other ones receive a single record per subscription
+	expandedInAdvanceOrganizations organizationSet
+	// Maximum number of events of a batch processed concurrently, 0 for no limit
+	concurrency int
+	// Organizations handled by the instance, the events of the other ones are skipped
+	organizations *models.OrganizationSelector
+	// Maximum processing duration of an event, 0 for no deadline
+	eventTimeout time.Duration
+	// Lanes processed concurrently with their own concurrency budget, in their matching order
+	lanes []*processingLane
 }
 
+// ErrEventDeadlineExceeded is the cause of the cancellation of an event processed for longer than the event timeout
+var ErrEventDeadlineExceeded = errors.New("event processing deadline exceeded")
+
 func NewEventProcessor(enrichmentService *EventEnrichmentService, producerService *EventProducerService, refreshService *SubscriptionRefreshService, cacheService *CacheService) *EventProcessor {
 	return &EventProcessor{
 		EnrichmentService: enrichmentService,
 		ProducerService:   producerService,
 		RefreshService:    refreshService,
 		CacheService:      cacheService,
+		Metrics:           NewDefaultProcessorMetrics(),
 	}
 }
 
+// SetExpandedInAdvanceOrganizations enables the expanded charged in advance records for the given organizations,
+// ALL_ORGANIZATIONS enables them for every organization
+func (processor *EventProcessor) SetExpandedInAdvanceOrganizations(organizationIDs []string) {
+	processor.expandedInAdvanceOrganizations = newOrganizationSet(organizationIDs)
+}
+
+// SetConcurrency limits the number of events of a batch processed concurrently,
+// the events are then started in a round robin across organizations
+func (processor *EventProcessor) SetConcurrency(concurrency int) {
+	processor.concurrency = concurrency
+}
+
+// SetEventTimeout bounds the processing of each event, including its Redis and Kafka calls.
+// Events exceeding it are not committed, to be processed again.
+func (processor *EventProcessor) SetEventTimeout(timeout time.Duration) {
+	processor.eventTimeout = timeout
+}
+
+// SetOrganizationSelector restricts the instance to the selected organizations,
+// the events of the other organizations are committed without being processed
+func (processor *EventProcessor) SetOrganizationSelector(selector *models.OrganizationSelector) {
+	processor.organizations = selector
+}
+
+// ProcessEvents processes the records of the raw events topic, classified in lanes
 func (processor *EventProcessor) ProcessEvents(ctx context.Context, records []*kgo.Record) []*kgo.Record {
+	return processor.processEvents(ctx, records, nil)
+}
+
+// ProcessLaneEvents processes the records of the topic of a lane, they all belong to the lane
+func (processor *EventProcessor) ProcessLaneEvents(ctx context.Context, laneName string, records []*kgo.Record) []*kgo.Record {
+	lane, found := processor.lane(laneName)
+	if !found {
+		slog.Error("Unknown lane, processing its events in the default lane", slog.String("lane", laneName))
+		lane = processor.defaultLane()
+	}
+
+	return processor.processEvents(ctx, records, lane)
+}
+
+// processEvents processes a batch of records, in the given lane or in the lanes they match when it is nil
+func (processor *EventProcessor) processEvents(ctx context.Context, records []*kgo.Record, lane *processingLane) []*kgo.Record {
 	span := tracing.StartSpan(ctx, "PostProcess.ProcessEvents")
 	defer span.End()
 
 	span.SetAttribute("records.length", len(records))
 
-	g := errgroup.Group{}
-
 	var mu sync.Mutex
 	processedRecords := make([]*kgo.Record, 0)
 
+	events := make([]*scheduledEvent, 0, len(records))
 	for _, record := range records {
+		event := models.Event{}
+		err := json.Unmarshal(record.Value, &event)
+		if err != nil {
+			slog.Error("Error unmarshalling message", slog.String("error", err.Error()))
+			utils.CaptureError(err)
+
+			// If we fail to unmarshal the record, we should commit it as it will failed forever
+			processedRecords = append(processedRecords, record)
+			continue
+		}
+
+		if !processor.organizations.Selects(event.OrganizationID) {
+			// Events of the organizations handled by other instances are committed as is
+			processedRecords = append(processedRecords, record)
+			continue
+		}
+
+		if processor.FreezeService != nil && processor.FreezeService.IsFrozen(ctx, event.OrganizationID) {
+			// Held events are committed once they are in the hold topic
+			if processor.ProducerService.ProduceHeldEvent(ctx, &event, record) {
+				processedRecords = append(processedRecords, record)
+			}
+			continue
+		}
+
+		events = append(events, &scheduledEvent{record: record, event: event})
+	}
+
+	lanes := []*laneEvents{{lane: lane, events: events}}
+	if lane == nil {
+		lanes = processor.splitByLane(events)
+	}
+
+	// Lanes are processed concurrently, so the events of a lane don't wait behind the bulk traffic
+	g := errgroup.Group{}
+	for _, le := range lanes {
 		g.Go(func() error {
-			func(record *kgo.Record) {
-				sp := tracing.StartSpan(ctx, "PostProcess.ProcessOneEvent")
-				defer sp.End()
+			processed := processor.processLane(ctx, le.lane, le.events)
+
+			mu.Lock()
+			processedRecords = append(processedRecords, processed...)
+			mu.Unlock()
+			return nil
+		})
+	}
+	g.Wait()
+
+	return processedRecords
+}
+
+// processLane processes the events of a lane within its concurrency budget, and returns the records to commit
+func (processor *EventProcessor) processLane(ctx context.Context, lane *processingLane, events []*scheduledEvent) []*kgo.Record {
+	var mu sync.Mutex
+	processedRecords := make([]*kgo.Record, 0, len(events))
+
+	prioritized, deprioritized := events, []*scheduledEvent{}
+	if processor.RateLimitService != nil {
+		var overflowed []*scheduledEvent
+		prioritized, deprioritized, overflowed = processor.RateLimitService.Schedule(ctx, events)
+
+		for _, ev := range overflowed {
+			if processor.ProducerService.ProduceRateLimitedEvent(ctx, &ev.event, ev.record) {
+				processedRecords = append(processedRecords, ev.record)
+				continue
+			}
 
-				event := models.Event{}
-				err := json.Unmarshal(record.Value, &event)
-				if err != nil {
-					slog.Error("Error unmarshalling message", slog.String("error", err.Error()))
-					utils.CaptureError(err)
+			// Events that can't be delayed are processed at lower priority
+			deprioritized = append(deprioritized, ev)
+		}
+	}
+
+	// Deprioritized events are only processed once the other ones are done,
+	// organizations are interleaved so a single organization doesn't hold the processing slots
+	for _, scheduled := range [][]*scheduledEvent{prioritized, deprioritized} {
+		g := errgroup.Group{}
+		if lane.concurrency > 0 {
+			g.SetLimit(lane.concurrency)
+		}
 
+		for _, ev := range interleaveByOrganization(scheduled) {
+			g.Go(func() error {
+				if processor.processRecord(ctx, ev) {
+					// Track processed records
 					mu.Lock()
-					// If we fail to unmarshal the record, we should commit it as it will failed forever
-					processedRecords = append(processedRecords, record)
+					processedRecords = append(processedRecords, ev.record)
 					mu.Unlock()
-					return
 				}
 
-				result := processor.processEvent(ctx, &event)
-				if result.Failure() {
-					slog.Error(
-						result.ErrorMessage(),
-						slog.String("error_code", result.ErrorCode()),
-						slog.String("error", result.ErrorMsg()),
-					)
+				return nil
+			})
+		}
 
-					if result.IsCapturable() {
-						utils.CaptureErrorResultWithExtra(result, "event", event)
-					}
+		g.Wait()
+	}
 
-					if result.IsRetryable() && time.Since(event.IngestedAt.Time()) < 12*time.Hour {
-						// For retryable errors, we should avoid commiting the record,
-						// It will be consumed again and reprocessed
-						// Events older than 12 hours should also be pushed dead letter queue
-						return
-					}
+	return processedRecords
+}
 
-					// Push failed records to the dead letter queue
-					processor.ProducerService.ProduceToDeadLetterQueue(ctx, event, result)
-				}
+// SkipRecord pushes a record skipped through the admin API to the dead letter queue without processing it
+func (processor *EventProcessor) SkipRecord(ctx context.Context, record *kgo.Record) {
+	event := models.Event{}
+	if err := json.Unmarshal(record.Value, &event); err != nil {
+		slog.Error("Error unmarshalling skipped message", slog.String("error", err.Error()))
+		utils.CaptureError(err)
+		return
+	}
 
-				// Track processed records
-				mu.Lock()
-				processedRecords = append(processedRecords, record)
-				mu.Unlock()
-			}(record)
+	processor.ProducerService.ProduceToDeadLetterQueue(
+		ctx,
+		event,
+		utils.FailedBoolResult(fmt.Errorf("record skipped at offset %d of partition %d", record.Offset, record.Partition)).
+			AddErrorDetails("skipped_record", "Record skipped through the admin API"),
+	)
+}
 
-			return nil
-		})
+// processRecord processes a decoded record, and returns false when it must not be committed to be consumed again
+func (processor *EventProcessor) processRecord(ctx context.Context, ev *scheduledEvent) (processed bool) {
+	sp := tracing.StartSpan(ctx, "PostProcess.ProcessOneEvent")
+	defer sp.End()
+
+	defer func() {
+		if value := recover(); value != nil {
+			processed = processor.recoverRecord(ctx, ev, newPanicError(value))
+		}
+	}()
+
+	eventCtx := ctx
+	if processor.eventTimeout > 0 {
+		var cancel context.CancelFunc
+		eventCtx, cancel = context.WithTimeoutCause(ctx, processor.eventTimeout, ErrEventDeadlineExceeded)
+		defer cancel()
 	}
 
-	g.Wait()
-	return processedRecords
+	event := ev.event
+	result := processor.processEvent(eventCtx, &event)
+	if errors.Is(eventCtx.Err(), context.DeadlineExceeded) {
+		// The producers only log their failures, so the event may be partially processed even when the result is a success
+		result = processor.timeoutResult(eventCtx, ev)
+	}
+
+	if result.Failure() {
+		slog.Error(
+			result.ErrorMessage(),
+			slog.String("error_code", result.ErrorCode()),
+			slog.String("error", result.ErrorMsg()),
+		)
+
+		if result.IsCapturable() {
+			utils.CaptureErrorResultWithExtra(result, "event", event)
+		}
+
+		if result.IsRetryable() && time.Since(event.IngestedAt.Time()) < 12*time.Hour {
+			// For retryable errors, we should avoid commiting the record,
+			// It will be consumed again and reprocessed
+			// Events older than 12 hours should also be pushed dead letter queue
+			return false
+		}
+
+		if ctx.Err() != nil {
+			// The batch deadline is exceeded, the record would be committed without reaching the dead letter queue
+			return false
+		}
+
+		// Push failed records to the dead letter queue
+		processor.ProducerService.ProduceToDeadLetterQueue(ctx, event, result)
+	}
+
+	return true
+}
+
+// timeoutResult is the failure of an event processed after its deadline, either the event or the batch one.
+// It is retryable and not captured, stuck partitions are reported by the consumer watchdog.
+func (processor *EventProcessor) timeoutResult(eventCtx context.Context, ev *scheduledEvent) utils.Result[*models.EnrichedEvent] {
+	processor.Metrics.RecordTimedOutEvent(eventCtx, ev.event.OrganizationID)
+
+	slog.Warn(
+		"Event processing deadline exceeded",
+		slog.String("organization_id", ev.event.OrganizationID),
+		slog.String("transaction_id", ev.event.TransactionID),
+		slog.Int("partition", int(ev.record.Partition)),
+		slog.Int64("offset", ev.record.Offset),
+		slog.String("cause", context.Cause(eventCtx).Error()),
+	)
+
+	return utils.FailedResult[*models.EnrichedEvent](context.Cause(eventCtx)).
+		AddErrorDetails("processing_timeout", "Event processing deadline exceeded").
+		NonCapturable()
+}
+
+// recoverRecord pushes a record whose processing panicked to the dead letter queue, as it would panic again
+func (processor *EventProcessor) recoverRecord(ctx context.Context, ev *scheduledEvent, panicErr *PanicError) bool {
+	result := utils.FailedBoolResult(panicErr).
+		AddErrorDetails("panic", "Panic while processing the event").
+		NonRetryable()
+
+	slog.Error(
+		result.ErrorMessage(),
+		slog.String("error_code", result.ErrorCode()),
+		slog.String("error", result.ErrorMsg()),
+		slog.String("organization_id", ev.event.OrganizationID),
+		slog.String("transaction_id", ev.event.TransactionID),
+		slog.String("stack_trace", string(panicErr.Stack)),
+	)
+	utils.CaptureErrorResultWithExtras(result, map[string]any{
+		"event":       ev.event,
+		"stack_trace": string(panicErr.Stack),
+	})
+	processor.Metrics.RecordPanickedEvent(ctx, ev.event.OrganizationID)
+
+	processor.ProducerService.ProduceToDeadLetterQueue(ctx, ev.event, result)
+
+	if processor.PanicCircuitBreaker != nil {
+		processor.PanicCircuitBreaker.RecordPanic(ev.record.Topic, ev.record.Partition)
+	}
+
+	return true
 }
 
 func (processor *EventProcessor) processEvent(ctx context.Context, event *models.Event) utils.Result[*models.EnrichedEvent] {
-	errgroup := errgroup.Group{}
+	// Panics of the goroutines are raised again in the processing goroutine, to be recovered with the record
+	errgroup := recoveredGroup{}
 	defer errgroup.Wait()
 
 	enrichedEventResult := processor.EnrichmentService.EnrichEvent(event)
@@ -110,61 +347,285 @@ func (processor *EventProcessor) processEvent(ctx context.Context, event *models
 	enrichedEvents := enrichedEventResult.Value()
 	enrichedEvent := enrichedEvents[0]
 
-	if event.IsReprocess() {
-		// When reprocessing events, we only need to produce new enriched expanded events
-		for _, ev := range enrichedEvents {
-			if ev.ChargeID != nil {
-				errgroup.Go(func() error {
-					processor.ProducerService.ProduceEnrichedExpandedEvent(ctx, ev)
-					return nil
-				})
-			}
+	if processor.CardinalityGuardService != nil {
+		guardResult := processor.CardinalityGuardService.GuardPricingGroups(ctx, enrichedEvents)
+		if guardResult.Failure() {
+			return failedResult(guardResult, guardResult.ErrorCode(), guardResult.ErrorMessage())
 		}
-		return utils.SuccessResult(enrichedEvent)
 	}
 
+	// Events sent with an external customer ID are fanned out to several subscriptions,
+	// each of them gets its own enriched event
+	subscriptionGroups := groupBySubscription(enrichedEvents)
+	processor.recordMissingEnrichments(ctx, subscriptionGroups)
+
+	subscriptionGroups, lateEvents := splitLateEvents(subscriptionGroups)
+
+	// Events routed by a timestamp policy are only produced to the late events topic
+	if len(lateEvents) > 0 {
+		errgroup.Go(func() error {
+			for _, ev := range lateEvents {
+				processor.ProducerService.ProduceLateEvent(ctx, ev)
+			}
+			return nil
+		})
+	}
+
+	// Expanded events are produced sequentially to keep their order stable in the topic
 	errgroup.Go(func() error {
-		processor.ProducerService.ProduceEnrichedEvent(ctx, enrichedEvent)
+		for _, subscriptionEvents := range subscriptionGroups {
+			for _, ev := range subscriptionEvents {
+				if ev.ChargeID != nil {
+					processor.ProducerService.ProduceEnrichedExpandedEvent(ctx, ev)
+				}
+			}
+		}
 		return nil
 	})
 
-	for _, ev := range enrichedEvents {
-		if ev.ChargeID != nil {
+	// The usage is aggregated before the fees are estimated, so they are priced on top of the previous usage
+	usages := make(map[*models.EnrichedEvent]*models.AggregatedUsage)
+	if processor.UsageAggregationService != nil {
+		subscriptionUsages := make([][]*models.AggregatedUsage, len(subscriptionGroups))
+		for i, subscriptionEvents := range subscriptionGroups {
+			subscriptionUsages[i] = processor.UsageAggregationService.AggregateUsage(ctx, subscriptionEvents)
+			for j, ev := range subscriptionEvents {
+				usages[ev] = subscriptionUsages[i][j]
+			}
+		}
+
+		if processor.UsageThresholdService != nil {
 			errgroup.Go(func() error {
-				processor.ProducerService.ProduceEnrichedExpandedEvent(ctx, ev)
+				for i, subscriptionEvents := range subscriptionGroups {
+					for _, crossedEvent := range processor.UsageThresholdService.TrackUsage(ctx, subscriptionEvents, subscriptionUsages[i]) {
+						processor.ProducerService.ProduceUsageThresholdCrossedEvent(ctx, crossedEvent)
+					}
+				}
 				return nil
 			})
 		}
 	}
 
-	if enrichedEvent.Subscription != nil && event.NotAPIPostProcessed() {
-		payInAdvance := false
-		for _, ev := range enrichedEvents {
-			if ev.FlatFilter != nil && ev.FlatFilter.PayInAdvance {
-				payInAdvance = true
-				break
+	if event.IsReprocess() {
+		// When reprocessing events, we only need to produce new enriched expanded events
+		return utils.SuccessResult(enrichedEvent)
+	}
+
+	errgroup.Go(func() error {
+		for _, subscriptionEvents := range subscriptionGroups {
+			processor.ProducerService.ProduceEnrichedEvent(ctx, subscriptionEvents[0])
+		}
+		return nil
+	})
+
+	var unbilledEvents []*models.EnrichedEvent
+	var unbilledReasons []UnbilledReason
+	for _, subscriptionEvents := range subscriptionGroups {
+		if reason, ok := unbilledReason(subscriptionEvents); ok {
+			processor.Metrics.RecordUnbilledEvent(ctx, subscriptionEvents[0], reason)
+			unbilledEvents = append(unbilledEvents, subscriptionEvents[0])
+			unbilledReasons = append(unbilledReasons, reason)
+		}
+	}
+
+	if len(unbilledEvents) > 0 {
+		errgroup.Go(func() error {
+			for i, ev := range unbilledEvents {
+				processor.ProducerService.ProduceUnbilledEvent(ctx, ev, unbilledReasons[i])
+			}
+			return nil
+		})
+	}
+
+	if processor.ProducerService.HasWalletDebitIntentsProducer() {
+		var debitIntents []*models.WalletDebitIntent
+		for _, subscriptionEvents := range subscriptionGroups {
+			for _, ev := range subscriptionEvents {
+				if ev.TargetWallet != nil && ev.ChargeID != nil {
+					debitIntents = append(debitIntents, models.NewWalletDebitIntent(ev, processor.estimateFee(ev, usages[ev])))
+				}
 			}
 		}
 
-		if payInAdvance {
+		if len(debitIntents) > 0 {
 			errgroup.Go(func() error {
-				processor.ProducerService.ProduceChargedInAdvanceEvent(ctx, enrichedEvent)
+				for _, intent := range debitIntents {
+					processor.ProducerService.ProduceWalletDebitIntent(ctx, intent)
+				}
 				return nil
 			})
 		}
+	}
+
+	if !event.NotAPIPostProcessed() {
+		return utils.SuccessResult(enrichedEvent)
+	}
+
+	expandedInAdvance := processor.expandedInAdvanceOrganizations.Contains(event.OrganizationID)
+
+	var inAdvanceEvents []*models.EnrichedEvent
+	for _, subscriptionEvents := range subscriptionGroups {
+		if !isChargedInAdvance(event, subscriptionEvents) {
+			continue
+		}
+
+		if expandedInAdvance {
+			for _, ev := range payInAdvanceEvents(subscriptionEvents) {
+				inAdvanceEvents = append(inAdvanceEvents, processor.withEstimatedFee(ev, ev, usages[ev]))
+			}
+		} else {
+			// The event is produced once for the subscription, with the fee of its first pay in advance charge
+			pricedEvent := payInAdvanceEvents(subscriptionEvents)[0]
+			inAdvanceEvents = append(inAdvanceEvents, processor.withEstimatedFee(subscriptionEvents[0], pricedEvent, usages[pricedEvent]))
+		}
+	}
+
+	if len(inAdvanceEvents) > 0 {
+		errgroup.Go(func() error {
+			for _, ev := range inAdvanceEvents {
+				if expandedInAdvance {
+					processor.ProducerService.ProduceChargedInAdvanceExpandedEvent(ctx, ev)
+				} else {
+					processor.ProducerService.ProduceChargedInAdvanceEvent(ctx, ev)
+				}
+			}
+			return nil
+		})
+	}
+
+	for _, subscriptionEvents := range subscriptionGroups {
+		if subscriptionEvents[0].Subscription == nil {
+			continue
+		}
 
-		flagResult := processor.RefreshService.FlagSubscriptionRefresh(enrichedEvent)
+		flagResult := processor.RefreshService.FlagSubscriptionRefresh(ctx, subscriptionEvents[0])
 		if flagResult.Failure() {
 			return failedResult(flagResult, "flag_subscription_refresh", "Error flagging subscription refresh")
 		}
 
 		// Expire cache at charge and charge filter level
-		processor.CacheService.ExpireCache(enrichedEvents)
+		processor.CacheService.ExpireCache(ctx, subscriptionEvents)
 	}
 
 	return utils.SuccessResult(enrichedEvent)
 }
 
+// estimateFee returns the estimated fee of the event, nil when the fee estimation is disabled.
+// The usage is the one aggregated before the event, nil when the event was not aggregated.
+func (processor *EventProcessor) estimateFee(event *models.EnrichedEvent, usage *models.AggregatedUsage) *models.FeeEstimate {
+	if processor.FeeEstimationService == nil {
+		return nil
+	}
+
+	return processor.FeeEstimationService.EstimateFee(event, usage)
+}
+
+// withEstimatedFee returns a copy of the event carrying the estimated fee of the pay in advance event priced,
+// the event itself is shared with the other producers
+func (processor *EventProcessor) withEstimatedFee(event *models.EnrichedEvent, pricedEvent *models.EnrichedEvent, usage *models.AggregatedUsage) *models.EnrichedEvent {
+	if processor.FeeEstimationService == nil {
+		return event
+	}
+
+	inAdvanceEvent := *event
+	inAdvanceEvent.EstimatedFee = processor.FeeEstimationService.EstimateFee(pricedEvent, usage)
+	return &inAdvanceEvent
+}
+
+// groupBySubscription splits the enriched events by subscription, keeping their order
+func groupBySubscription(enrichedEvents []*models.EnrichedEvent) [][]*models.EnrichedEvent {
+	var groups [][]*models.EnrichedEvent
+	indexes := make(map[string]int)
+
+	for _, ev := range enrichedEvents {
+		index, ok := indexes[ev.SubscriptionID]
+		if !ok {
+			index = len(groups)
+			indexes[ev.SubscriptionID] = index
+			groups = append(groups, nil)
+		}
+		groups[index] = append(groups[index], ev)
+	}
+
+	return groups
+}
+
+// splitLateEvents removes the subscription groups routed to the late events topic by a timestamp policy,
+// it returns the remaining groups and the enriched event of each routed group
+func splitLateEvents(groups [][]*models.EnrichedEvent) ([][]*models.EnrichedEvent, []*models.EnrichedEvent) {
+	var onTimeGroups [][]*models.EnrichedEvent
+	var lateEvents []*models.EnrichedEvent
+
+	for _, group := range groups {
+		policy := group[0].TimestampPolicy
+		if policy != nil && policy.Action == models.TimestampPolicyRoute {
+			lateEvents = append(lateEvents, group[0])
+			continue
+		}
+		onTimeGroups = append(onTimeGroups, group)
+	}
+
+	return onTimeGroups, lateEvents
+}
+
+// recordMissingEnrichments counts the subscriptions whose customer or plan is missing from the store (eg: not yet replicated),
+// their events are produced without the customer and plan metadata nor the billing period
+func (processor *EventProcessor) recordMissingEnrichments(ctx context.Context, subscriptionGroups [][]*models.EnrichedEvent) {
+	for _, subscriptionEvents := range subscriptionGroups {
+		ev := subscriptionEvents[0]
+		if ev.Subscription == nil {
+			continue
+		}
+
+		if ev.Customer == nil && ev.Subscription.CustomerID != "" {
+			processor.Metrics.RecordMissingEnrichment(ctx, ev, MissingEnrichmentCustomer)
+		}
+		if ev.Plan == nil {
+			processor.Metrics.RecordMissingEnrichment(ctx, ev, MissingEnrichmentPlan)
+		}
+	}
+}
+
+// unbilledReason returns why the events of a subscription group can't be billed,
+// either they have no subscription or the subscription's plan has no charge on the billable metric
+func unbilledReason(subscriptionEvents []*models.EnrichedEvent) (UnbilledReason, bool) {
+	// A customer event is only returned without subscription when none of the customer's subscriptions has a charge
+	if subscriptionEvents[0].SubscriptionsWithoutCharge {
+		return UnbilledReasonNoCharge, true
+	}
+
+	if subscriptionEvents[0].Subscription == nil {
+		return UnbilledReasonNoSubscription, true
+	}
+
+	if subscriptionEvents[0].ChargeID == nil {
+		return UnbilledReasonNoCharge, true
+	}
+
+	return "", false
+}
+
+// isChargedInAdvance returns true when the event must be produced to the charged in advance topic
+func isChargedInAdvance(event *models.Event, enrichedEvents []*models.EnrichedEvent) bool {
+	if enrichedEvents[0].Subscription == nil || !event.NotAPIPostProcessed() {
+		return false
+	}
+
+	return len(payInAdvanceEvents(enrichedEvents)) > 0
+}
+
+// payInAdvanceEvents returns the expanded events landing on a pay in advance charge or charge filter
+func payInAdvanceEvents(enrichedEvents []*models.EnrichedEvent) []*models.EnrichedEvent {
+	var events []*models.EnrichedEvent
+	for _, ev := range enrichedEvents {
+		if ev.FlatFilter != nil && ev.FlatFilter.PayInAdvance {
+			events = append(events, ev)
+		}
+	}
+
+	return events
+}
+
 func failedResult(r utils.AnyResult, code string, message string) utils.Result[*models.EnrichedEvent] {
 	result := utils.FailedResult[*models.EnrichedEvent](r.Error()).AddErrorDetails(code, message)
 	result.Retryable = r.IsRetryable()
@@ -2,6 +2,8 @@ package events_processor
 
 import (
 	"context"
+	"encoding/json"
+	"math/big"
 	"testing"
 	"time"
 
@@ -9,6 +11,9 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 	"gorm.io/gorm"
 
 	"github.com/getlago/lago/events-processor/cache"
@@ -23,6 +28,12 @@ type testProducerService struct {
 	enrichedExpandedProducer *tests.MockMessageProducer
 	inAdvanceProducer        *tests.MockMessageProducer
 	deadLetterProducer       *tests.MockMessageProducer
+	lateProducer             *tests.MockMessageProducer
+	unbilledProducer         *tests.MockMessageProducer
+	usageThresholdsProducer  *tests.MockMessageProducer
+	walletDebitProducer      *tests.MockMessageProducer
+	rateLimitedProducer      *tests.MockMessageProducer
+	holdProducer             *tests.MockMessageProducer
 	producerService          *EventProducerService
 }
 
@@ -31,6 +42,12 @@ func setupProducers() *testProducerService {
 	enrichedExpandedProducer := tests.MockMessageProducer{}
 	inAdvanceProducer := tests.MockMessageProducer{}
 	deadLetterProducer := tests.MockMessageProducer{}
+	lateProducer := tests.MockMessageProducer{}
+	unbilledProducer := tests.MockMessageProducer{}
+	usageThresholdsProducer := tests.MockMessageProducer{}
+	walletDebitProducer := tests.MockMessageProducer{}
+	rateLimitedProducer := tests.MockMessageProducer{}
+	holdProducer := tests.MockMessageProducer{}
 
 	producerService := NewEventProducerService(
 		&enrichedProducer,
@@ -38,12 +55,24 @@ func setupProducers() *testProducerService {
 		&inAdvanceProducer,
 		&deadLetterProducer,
 	)
+	producerService.SetLateEventsProducer(&lateProducer)
+	producerService.SetUnbilledEventsProducer(&unbilledProducer)
+	producerService.SetUsageThresholdsProducer(&usageThresholdsProducer)
+	producerService.SetWalletDebitIntentsProducer(&walletDebitProducer)
+	producerService.SetRateLimitedEventsProducer(&rateLimitedProducer)
+	producerService.SetHoldProducer(&holdProducer)
 
 	return &testProducerService{
 		enrichedProducer:         &enrichedProducer,
 		enrichedExpandedProducer: &enrichedExpandedProducer,
 		inAdvanceProducer:        &inAdvanceProducer,
 		deadLetterProducer:       &deadLetterProducer,
+		lateProducer:             &lateProducer,
+		unbilledProducer:         &unbilledProducer,
+		usageThresholdsProducer:  &usageThresholdsProducer,
+		walletDebitProducer:      &walletDebitProducer,
+		rateLimitedProducer:      &rateLimitedProducer,
+		holdProducer:             &holdProducer,
 		producerService:          producerService,
 	}
 }
@@ -52,11 +81,19 @@ func setupProducers() *testProducerService {
 type DataStore interface {
 	SetBillableMetric(bm *models.BillableMetric)
 	SetSubscription(sub *models.Subscription)
+	// SetCustomer, SetPlan, SetBillingEntity and SetOrganization must be called before SetSubscription
+	SetCustomer(customer *models.Customer)
+	SetPlan(plan *models.Plan)
+	SetBillingEntity(billingEntity *models.BillingEntity)
+	SetOrganization(organization *models.Organization)
 	SetCharge(charge *models.Charge)
 	SetFlatFilters(filters []*models.FlatFilter)
 	SetBillableMetricFilter(bmf *models.BillableMetricFilter)
 	SetChargeFilter(cf *models.ChargeFilter)
 	SetChargeFilterValue(cfv *models.ChargeFilterValue)
+	// SetWallet and ExpectWalletNotFound must be called after SetFlatFilters
+	SetWallet(wallet *models.Wallet)
+	ExpectWalletNotFound()
 	ExpectSubscriptionNotFound()
 	ExpectSubscriptionError()
 	ExpectBillableMetricNotFound()
@@ -78,6 +115,26 @@ func (s *CacheDataStore) SetSubscription(sub *models.Subscription) {
 	require.True(s.t, result.Success())
 }
 
+func (s *CacheDataStore) SetCustomer(customer *models.Customer) {
+	result := s.cache.SetCustomer(customer)
+	require.True(s.t, result.Success())
+}
+
+func (s *CacheDataStore) SetPlan(plan *models.Plan) {
+	result := s.cache.SetPlan(plan)
+	require.True(s.t, result.Success())
+}
+
+func (s *CacheDataStore) SetBillingEntity(billingEntity *models.BillingEntity) {
+	result := s.cache.SetBillingEntity(billingEntity)
+	require.True(s.t, result.Success())
+}
+
+func (s *CacheDataStore) SetOrganization(organization *models.Organization) {
+	result := s.cache.SetOrganization(organization)
+	require.True(s.t, result.Success())
+}
+
 func (s *CacheDataStore) SetCharge(charge *models.Charge) {
 	result := s.cache.SetCharge(charge)
 	require.True(s.t, result.Success())
@@ -98,6 +155,28 @@ func (s *CacheDataStore) SetChargeFilterValue(cfv *models.ChargeFilterValue) {
 	require.True(s.t, result.Success())
 }
 
+func (s *CacheDataStore) SetWallet(wallet *models.Wallet) {
+	result := s.cache.SetWallet(wallet)
+	require.True(s.t, result.Success())
+}
+
+func (s *CacheDataStore) ExpectWalletNotFound() {}
+
+func (s *CacheDataStore) SetUsageThreshold(ut *models.UsageThreshold) {
+	result := s.cache.SetUsageThreshold(ut)
+	require.True(s.t, result.Success())
+}
+
+func (s *CacheDataStore) SetUsageAlert(alert *models.UsageAlert) {
+	result := s.cache.SetUsageAlert(alert)
+	require.True(s.t, result.Success())
+}
+
+func (s *CacheDataStore) SetUsageAlertThreshold(threshold *models.UsageAlertThreshold) {
+	result := s.cache.SetUsageAlertThreshold(threshold)
+	require.True(s.t, result.Success())
+}
+
 func (s *CacheDataStore) SetFlatFilters(filters []*models.FlatFilter) {}
 func (s *CacheDataStore) ExpectSubscriptionNotFound()                 {}
 func (s *CacheDataStore) ExpectSubscriptionError()                    {}
@@ -105,8 +184,12 @@ func (s *CacheDataStore) ExpectBillableMetricNotFound()               {}
 
 // MockDataStore wraps SQL mock for test setup
 type MockDataStore struct {
-	mock *tests.MockedStore
-	t    *testing.T
+	mock          *tests.MockedStore
+	t             *testing.T
+	customer      *models.Customer
+	plan          *models.Plan
+	billingEntity *models.BillingEntity
+	organization  *models.Organization
 }
 
 func (s *MockDataStore) SetBillableMetric(bm *models.BillableMetric) {
@@ -117,10 +200,63 @@ func (s *MockDataStore) SetBillableMetric(bm *models.BillableMetric) {
 }
 
 func (s *MockDataStore) SetSubscription(sub *models.Subscription) {
-	columns := []string{"id", "external_id", "plan_id", "created_at", "updated_at", "terminated_at"}
+	columns := []string{"id", "external_id", "customer_id", "plan_id", "billing_time", "subscription_at", "created_at", "updated_at", "terminated_at"}
 	rows := sqlmock.NewRows(columns).
-		AddRow(sub.ID, sub.ExternalID, sub.PlanID, sub.CreatedAt, sub.UpdatedAt, sub.TerminatedAt)
+		AddRow(sub.ID, sub.ExternalID, sub.CustomerID, sub.PlanID, sub.BillingTime, sub.SubscriptionAt, sub.CreatedAt, sub.UpdatedAt, sub.TerminatedAt)
 	s.mock.SQLMock.ExpectQuery(".* FROM \"subscriptions\".*").WillReturnRows(rows)
+
+	// The customer and the plan are fetched right after the subscription
+	if sub.CustomerID != "" {
+		customerRows := sqlmock.NewRows([]string{"id", "organization_id", "external_id", "billing_entity_id", "timezone"})
+		if s.customer != nil {
+			customerRows.AddRow(s.customer.ID, s.customer.OrganizationID, s.customer.ExternalID, s.customer.BillingEntityID, s.customer.Timezone)
+		}
+		s.mock.SQLMock.ExpectQuery(".* FROM \"customers\".*").WillReturnRows(customerRows)
+	}
+
+	planRows := sqlmock.NewRows([]string{"id", "organization_id", "code", "amount_currency", "interval"})
+	if s.plan != nil {
+		planRows.AddRow(s.plan.ID, s.plan.OrganizationID, s.plan.Code, s.plan.AmountCurrency, s.plan.Interval)
+	}
+	s.mock.SQLMock.ExpectQuery(".* FROM \"plans\".*").WillReturnRows(planRows)
+
+	// The billing entity and the organization are then fetched when their timezone applies
+	if s.plan == nil || (s.customer != nil && s.customer.Timezone != nil && *s.customer.Timezone != "") {
+		return
+	}
+	if sub.CustomerID != "" && s.customer != nil && s.customer.BillingEntityID != nil {
+		billingEntityRows := sqlmock.NewRows([]string{"id", "organization_id", "timezone"})
+		if s.billingEntity != nil {
+			billingEntityRows.AddRow(s.billingEntity.ID, s.billingEntity.OrganizationID, s.billingEntity.Timezone)
+		}
+		s.mock.SQLMock.ExpectQuery(".* FROM \"billing_entities\".*").WillReturnRows(billingEntityRows)
+
+		if s.billingEntity != nil && s.billingEntity.Timezone != nil && *s.billingEntity.Timezone != "" {
+			return
+		}
+	}
+
+	organizationRows := sqlmock.NewRows([]string{"id", "timezone"})
+	if s.organization != nil {
+		organizationRows.AddRow(s.organization.ID, s.organization.Timezone)
+	}
+	s.mock.SQLMock.ExpectQuery(".* FROM \"organizations\".*").WillReturnRows(organizationRows)
+}
+
+func (s *MockDataStore) SetCustomer(customer *models.Customer) {
+	s.customer = customer
+}
+
+func (s *MockDataStore) SetPlan(plan *models.Plan) {
+	s.plan = plan
+}
+
+func (s *MockDataStore) SetBillingEntity(billingEntity *models.BillingEntity) {
+	s.billingEntity = billingEntity
+}
+
+func (s *MockDataStore) SetOrganization(organization *models.Organization) {
+	s.organization = organization
 }
 
 func (s *MockDataStore) SetFlatFilters(filters []*models.FlatFilter) {
@@ -140,6 +276,17 @@ func (s *MockDataStore) SetFlatFilters(filters []*models.FlatFilter) {
 	s.mock.SQLMock.ExpectQuery(".* FROM \"flat_filters\".*").WillReturnRows(rows)
 }
 
+func (s *MockDataStore) SetWallet(wallet *models.Wallet) {
+	columns := []string{"id", "organization_id", "customer_id", "code", "status", "balance_currency"}
+	rows := sqlmock.NewRows(columns).
+		AddRow(wallet.ID, wallet.OrganizationID, wallet.CustomerID, wallet.Code, wallet.Status, wallet.Currency)
+	s.mock.SQLMock.ExpectQuery(".* FROM \"wallets\".*").WillReturnRows(rows)
+}
+
+func (s *MockDataStore) ExpectWalletNotFound() {
+	s.mock.SQLMock.ExpectQuery(".* FROM \"wallets\".*").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+}
+
 func (s *MockDataStore) ExpectSubscriptionNotFound() {
 	s.mock.SQLMock.ExpectQuery(".* FROM \"subscriptions\"").WillReturnError(gorm.ErrRecordNotFound)
 }
@@ -750,3 +897,908 @@ func TestProcessEvent(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessCustomerEvent(t *testing.T) {
+	orgID := "1a901a90-1a90-1a90-1a90-1a901a901a90"
+
+	event := models.Event{
+		OrganizationID:     orgID,
+		ExternalCustomerID: "customer_external_id",
+		TransactionID:      "transaction_id",
+		Code:               "api_calls",
+		Timestamp:          1741007009,
+		Source:             "SQS",
+	}
+
+	setupCustomerTestEnv := func(t *testing.T) *ProcessorTestEnv {
+		testEnv := setupProcessorTestEnv(t, true)
+
+		testEnv.DataStore.SetBillableMetric(&models.BillableMetric{
+			ID:              "bm123",
+			OrganizationID:  orgID,
+			Code:            event.Code,
+			AggregationType: models.AggregationTypeCount,
+			CreatedAt:       utils.NowNullTime(),
+			UpdatedAt:       utils.NowNullTime(),
+		})
+		testEnv.DataStore.SetCustomer(&models.Customer{
+			ID:             "customer123",
+			OrganizationID: orgID,
+			ExternalID:     event.ExternalCustomerID,
+		})
+
+		return testEnv
+	}
+
+	setSubscription := func(testEnv *ProcessorTestEnv, ID string, externalID string, planID string, terminatedAt utils.NullTime) {
+		testEnv.DataStore.SetSubscription(&models.Subscription{
+			ID:             ID,
+			OrganizationID: &event.OrganizationID,
+			ExternalID:     externalID,
+			CustomerID:     "customer123",
+			PlanID:         planID,
+			StartedAt:      utils.NewNullTime(time.Unix(1700000000, 0)),
+			TerminatedAt:   terminatedAt,
+		})
+	}
+
+	setCharge := func(testEnv *ProcessorTestEnv, ID string, planID string, payInAdvance bool) {
+		testEnv.DataStore.SetCharge(&models.Charge{
+			ID:               ID,
+			OrganizationID:   orgID,
+			PlanID:           planID,
+			BillableMetricID: "bm123",
+			PayInAdvance:     payInAdvance,
+			UpdatedAt:        utils.NowNullTime(),
+		})
+	}
+
+	t.Run("With several subscriptions", func(t *testing.T) {
+		testEnv := setupCustomerTestEnv(t)
+		defer testEnv.Cleanup()
+
+		setSubscription(testEnv, "sub_a", "sub_external_a", "plan_a", utils.NullTime{})
+		setSubscription(testEnv, "sub_b", "sub_external_b", "plan_b", utils.NullTime{})
+		setSubscription(testEnv, "sub_c", "sub_external_c", "plan_c", utils.NullTime{})
+		// Terminated before the event
+		setSubscription(testEnv, "sub_d", "sub_external_d", "plan_a", utils.NewNullTime(time.Unix(1710000000, 0)))
+
+		setCharge(testEnv, "charge_a", "plan_a", false)
+		setCharge(testEnv, "charge_c", "plan_c", true)
+
+		result := testEnv.EventProcessor.processEvent(context.Background(), &event)
+		require.True(t, result.Success())
+
+		// Subscription B has no charge on the billable metric
+		assert.Equal(t, 2, testEnv.Producers.enrichedProducer.ExecutionCount)
+		assert.Equal(t, 2, testEnv.Producers.enrichedExpandedProducer.ExecutionCount)
+		assert.Equal(t, 1, testEnv.Producers.inAdvanceProducer.ExecutionCount)
+		assert.Equal(t, 2, testEnv.FlagStore.ExecutionCount)
+		assert.Equal(t, 2, testEnv.CacheStore.ExecutionCount)
+
+		enrichedEvents := testEnv.EventProcessor.EnrichmentService.EnrichEvent(&event).Value()
+		require.Equal(t, 2, len(enrichedEvents))
+
+		assert.Equal(t, "sub_a", enrichedEvents[0].SubscriptionID)
+		assert.Equal(t, "sub_external_a", enrichedEvents[0].ExternalSubscriptionID)
+		assert.Equal(t, "charge_a", *enrichedEvents[0].ChargeID)
+		assert.Equal(t, "customer123", *enrichedEvents[0].CustomerID)
+
+		assert.Equal(t, "sub_c", enrichedEvents[1].SubscriptionID)
+		assert.Equal(t, "sub_external_c", enrichedEvents[1].ExternalSubscriptionID)
+		assert.Equal(t, "charge_c", *enrichedEvents[1].ChargeID)
+
+		assert.NotEqual(t, enrichedEvents[0].EnrichedID(), enrichedEvents[1].EnrichedID())
+	})
+
+	t.Run("When the customer has no subscription with a charge on the billable metric", func(t *testing.T) {
+		testEnv := setupCustomerTestEnv(t)
+		defer testEnv.Cleanup()
+
+		setSubscription(testEnv, "sub_b", "sub_external_b", "plan_b", utils.NullTime{})
+
+		result := testEnv.EventProcessor.processEvent(context.Background(), &event)
+		require.True(t, result.Success())
+
+		assert.Equal(t, "", result.Value().SubscriptionID)
+		assert.Equal(t, "customer123", *result.Value().CustomerID)
+		assert.Equal(t, 1, testEnv.Producers.enrichedProducer.ExecutionCount)
+		assert.Equal(t, 0, testEnv.Producers.enrichedExpandedProducer.ExecutionCount)
+		assert.Equal(t, 0, testEnv.FlagStore.ExecutionCount)
+
+		// The event is unbilled because of the missing charge, not of a missing subscription
+		require.Equal(t, 1, testEnv.Producers.unbilledProducer.ExecutionCount)
+		unbilledEvent := models.EnrichedEvent{}
+		require.NoError(t, json.Unmarshal(testEnv.Producers.unbilledProducer.Value, &unbilledEvent))
+		assert.Equal(t, "no_charge", unbilledEvent.UnbilledReason)
+	})
+
+	t.Run("When the customer is not found", func(t *testing.T) {
+		testEnv := setupProcessorTestEnv(t, true)
+		defer testEnv.Cleanup()
+
+		testEnv.DataStore.SetBillableMetric(&models.BillableMetric{
+			ID:              "bm123",
+			OrganizationID:  orgID,
+			Code:            event.Code,
+			AggregationType: models.AggregationTypeCount,
+		})
+
+		result := testEnv.EventProcessor.processEvent(context.Background(), &event)
+		require.True(t, result.Success())
+
+		assert.Nil(t, result.Value().CustomerID)
+		assert.Equal(t, "customer_external_id", *result.Value().ExternalCustomerID)
+		assert.Equal(t, 1, testEnv.Producers.enrichedProducer.ExecutionCount)
+		assert.Equal(t, 0, testEnv.Producers.enrichedExpandedProducer.ExecutionCount)
+
+		require.Equal(t, 1, testEnv.Producers.unbilledProducer.ExecutionCount)
+		unbilledEvent := models.EnrichedEvent{}
+		require.NoError(t, json.Unmarshal(testEnv.Producers.unbilledProducer.Value, &unbilledEvent))
+		assert.Equal(t, "no_subscription", unbilledEvent.UnbilledReason)
+	})
+}
+
+func TestProcessEventWithTimestampPolicy(t *testing.T) {
+	orgID := "1a901a90-1a90-1a90-1a90-1a901a901a90"
+	ingestedAt := time.Date(2025, time.March, 15, 12, 0, 0, 0, time.UTC)
+
+	buildEvent := func(timestamp time.Time) *models.Event {
+		return &models.Event{
+			OrganizationID:         orgID,
+			ExternalSubscriptionID: "sub_id",
+			TransactionID:          "transaction_id",
+			Code:                   "api_calls",
+			Timestamp:              float64(timestamp.Unix()),
+			Source:                 "SQS",
+			IngestedAt:             utils.CustomTime(ingestedAt),
+		}
+	}
+
+	setupPolicyTestEnv := func(t *testing.T, policy *models.TimestampPolicy) *ProcessorTestEnv {
+		testEnv := setupProcessorTestEnv(t, true)
+		testEnv.EventProcessor.EnrichmentService.SetTimestampPolicies(map[string]*models.TimestampPolicy{
+			ALL_ORGANIZATIONS: policy,
+		})
+
+		testEnv.DataStore.SetBillableMetric(&models.BillableMetric{
+			ID:              "bm123",
+			OrganizationID:  orgID,
+			Code:            "api_calls",
+			AggregationType: models.AggregationTypeCount,
+			CreatedAt:       utils.NowNullTime(),
+			UpdatedAt:       utils.NowNullTime(),
+		})
+		testEnv.DataStore.SetPlan(&models.Plan{
+			ID:             "plan123",
+			OrganizationID: orgID,
+			Code:           "premium",
+			Interval:       models.PlanIntervalMonthly,
+		})
+		testEnv.DataStore.SetSubscription(&models.Subscription{
+			ID:             "sub123",
+			OrganizationID: &orgID,
+			ExternalID:     "sub_id",
+			PlanID:         "plan123",
+			StartedAt:      utils.NewNullTime(time.Unix(1700000000, 0)),
+		})
+		testEnv.DataStore.SetCharge(&models.Charge{
+			ID:               "charge123",
+			OrganizationID:   orgID,
+			PlanID:           "plan123",
+			BillableMetricID: "bm123",
+			PayInAdvance:     true,
+			UpdatedAt:        utils.NowNullTime(),
+		})
+
+		return testEnv
+	}
+
+	t.Run("With a future event sent to the dead letter queue", func(t *testing.T) {
+		testEnv := setupPolicyTestEnv(t, &models.TimestampPolicy{
+			MaxFutureSkew: &models.PolicyDuration{Duration: time.Hour},
+			FutureAction:  models.TimestampPolicyDeadLetter,
+		})
+		defer testEnv.Cleanup()
+
+		result := testEnv.EventProcessor.processEvent(context.Background(), buildEvent(ingestedAt.Add(2*time.Hour)))
+		require.True(t, result.Failure())
+		assert.Equal(t, "event_timestamp_in_future", result.ErrorCode())
+		assert.False(t, result.IsRetryable())
+		assert.False(t, result.IsCapturable())
+		assert.Equal(t, 0, testEnv.Producers.enrichedProducer.ExecutionCount)
+	})
+
+	t.Run("With a late event routed to the late events topic", func(t *testing.T) {
+		testEnv := setupPolicyTestEnv(t, &models.TimestampPolicy{
+			MaxLateness:       &models.PolicyDuration{Duration: 0},
+			LatenessReference: models.LatenessFromBillingPeriod,
+			LateAction:        models.TimestampPolicyRoute,
+		})
+		defer testEnv.Cleanup()
+
+		result := testEnv.EventProcessor.processEvent(context.Background(), buildEvent(ingestedAt.AddDate(0, -1, 0)))
+		require.True(t, result.Success())
+
+		assert.Equal(t, 1, testEnv.Producers.lateProducer.ExecutionCount)
+		assert.Equal(t, 0, testEnv.Producers.enrichedProducer.ExecutionCount)
+		assert.Equal(t, 0, testEnv.Producers.enrichedExpandedProducer.ExecutionCount)
+		assert.Equal(t, 0, testEnv.Producers.inAdvanceProducer.ExecutionCount)
+		assert.Equal(t, 0, testEnv.FlagStore.ExecutionCount)
+
+		lateEvent := models.EnrichedEvent{}
+		require.NoError(t, json.Unmarshal(testEnv.Producers.lateProducer.Value, &lateEvent))
+		assert.Equal(t, "sub123", lateEvent.SubscriptionID)
+		assert.Equal(t, models.TimestampViolationLate, lateEvent.TimestampPolicy.Violation)
+		assert.Equal(t, time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC), lateEvent.TimestampPolicy.Limit)
+	})
+
+	t.Run("With a late event clamped to the current billing period", func(t *testing.T) {
+		testEnv := setupPolicyTestEnv(t, &models.TimestampPolicy{
+			MaxLateness:       &models.PolicyDuration{Duration: 0},
+			LatenessReference: models.LatenessFromBillingPeriod,
+			LateAction:        models.TimestampPolicyClamp,
+		})
+		defer testEnv.Cleanup()
+
+		eventTime := ingestedAt.AddDate(0, -1, 0)
+		result := testEnv.EventProcessor.processEvent(context.Background(), buildEvent(eventTime))
+		require.True(t, result.Success())
+
+		assert.Equal(t, 0, testEnv.Producers.lateProducer.ExecutionCount)
+		assert.Equal(t, 1, testEnv.Producers.enrichedProducer.ExecutionCount)
+		assert.Equal(t, 1, testEnv.Producers.enrichedExpandedProducer.ExecutionCount)
+
+		enrichedEvent := models.EnrichedEvent{}
+		require.NoError(t, json.Unmarshal(testEnv.Producers.enrichedProducer.Value, &enrichedEvent))
+		assert.Equal(t, float64(time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC).Unix()), enrichedEvent.Timestamp)
+		assert.Equal(t, float64(eventTime.Unix()), enrichedEvent.TimestampPolicy.OriginalTimestamp)
+		assert.Equal(t, time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC), *enrichedEvent.BillingPeriodStart)
+		assert.Equal(t, time.Date(2025, time.April, 1, 0, 0, 0, 0, time.UTC), *enrichedEvent.BillingPeriodEnd)
+	})
+
+	t.Run("With an accepted late event", func(t *testing.T) {
+		testEnv := setupPolicyTestEnv(t, &models.TimestampPolicy{
+			MaxLateness:       &models.PolicyDuration{Duration: time.Hour},
+			LatenessReference: models.LatenessFromIngestedAt,
+			LateAction:        models.TimestampPolicyAccept,
+		})
+		defer testEnv.Cleanup()
+
+		result := testEnv.EventProcessor.processEvent(context.Background(), buildEvent(ingestedAt.AddDate(0, -1, 0)))
+		require.True(t, result.Success())
+
+		assert.Nil(t, result.Value().TimestampPolicy)
+		assert.Equal(t, 1, testEnv.Producers.enrichedProducer.ExecutionCount)
+	})
+}
+
+func TestProcessUnbilledEvent(t *testing.T) {
+	orgID := "1a901a90-1a90-1a90-1a90-1a901a901a90"
+
+	event := models.Event{
+		OrganizationID:         orgID,
+		ExternalSubscriptionID: "sub_id",
+		TransactionID:          "transaction_id",
+		Code:                   "api_calls",
+		Timestamp:              1741007009,
+		Source:                 "SQS",
+	}
+
+	setupUnbilledTestEnv := func(t *testing.T) (*ProcessorTestEnv, *sdkmetric.ManualReader) {
+		testEnv := setupProcessorTestEnv(t, true)
+
+		reader := sdkmetric.NewManualReader()
+		meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+		testEnv.EventProcessor.Metrics = NewProcessorMetrics(meterProvider.Meter(METER_NAME))
+
+		testEnv.DataStore.SetBillableMetric(&models.BillableMetric{
+			ID:              "bm123",
+			OrganizationID:  orgID,
+			Code:            event.Code,
+			AggregationType: models.AggregationTypeCount,
+			CreatedAt:       utils.NowNullTime(),
+			UpdatedAt:       utils.NowNullTime(),
+		})
+
+		return testEnv, reader
+	}
+
+	setSubscription := func(testEnv *ProcessorTestEnv) {
+		testEnv.DataStore.SetSubscription(&models.Subscription{
+			ID:             "sub123",
+			OrganizationID: &orgID,
+			ExternalID:     event.ExternalSubscriptionID,
+			PlanID:         "plan123",
+			StartedAt:      utils.NewNullTime(time.Unix(1700000000, 0)),
+		})
+	}
+
+	collectUnbilledEvents := func(t *testing.T, reader *sdkmetric.ManualReader) []metricdata.DataPoint[int64] {
+		rm := metricdata.ResourceMetrics{}
+		require.NoError(t, reader.Collect(context.Background(), &rm))
+
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if m.Name == "lago.events_processor.unbilled_events" {
+					return m.Data.(metricdata.Sum[int64]).DataPoints
+				}
+			}
+		}
+		return nil
+	}
+
+	t.Run("Without subscription", func(t *testing.T) {
+		testEnv, reader := setupUnbilledTestEnv(t)
+		defer testEnv.Cleanup()
+
+		result := testEnv.EventProcessor.processEvent(context.Background(), &event)
+		require.True(t, result.Success())
+
+		assert.Equal(t, 1, testEnv.Producers.enrichedProducer.ExecutionCount)
+		assert.Equal(t, 1, testEnv.Producers.unbilledProducer.ExecutionCount)
+
+		unbilledEvent := models.EnrichedEvent{}
+		require.NoError(t, json.Unmarshal(testEnv.Producers.unbilledProducer.Value, &unbilledEvent))
+		assert.Equal(t, "no_subscription", unbilledEvent.UnbilledReason)
+		assert.Equal(t, result.Value().EnrichedID(), unbilledEvent.ID)
+
+		dataPoints := collectUnbilledEvents(t, reader)
+		require.Len(t, dataPoints, 1)
+		assert.Equal(t, int64(1), dataPoints[0].Value)
+
+		reason, _ := dataPoints[0].Attributes.Value("reason")
+		assert.Equal(t, "no_subscription", reason.AsString())
+		code, _ := dataPoints[0].Attributes.Value("code")
+		assert.Equal(t, "api_calls", code.AsString())
+	})
+
+	t.Run("Without charge on the billable metric", func(t *testing.T) {
+		testEnv, reader := setupUnbilledTestEnv(t)
+		defer testEnv.Cleanup()
+
+		setSubscription(testEnv)
+
+		result := testEnv.EventProcessor.processEvent(context.Background(), &event)
+		require.True(t, result.Success())
+
+		assert.Equal(t, 1, testEnv.Producers.enrichedProducer.ExecutionCount)
+		assert.Equal(t, 1, testEnv.Producers.unbilledProducer.ExecutionCount)
+
+		unbilledEvent := models.EnrichedEvent{}
+		require.NoError(t, json.Unmarshal(testEnv.Producers.unbilledProducer.Value, &unbilledEvent))
+		assert.Equal(t, "no_charge", unbilledEvent.UnbilledReason)
+		assert.Equal(t, "sub123", unbilledEvent.SubscriptionID)
+
+		dataPoints := collectUnbilledEvents(t, reader)
+		require.Len(t, dataPoints, 1)
+
+		planID, _ := dataPoints[0].Attributes.Value("plan_id")
+		assert.Equal(t, "plan123", planID.AsString())
+		reason, _ := dataPoints[0].Attributes.Value("reason")
+		assert.Equal(t, "no_charge", reason.AsString())
+	})
+
+	t.Run("With a charge on the billable metric", func(t *testing.T) {
+		testEnv, reader := setupUnbilledTestEnv(t)
+		defer testEnv.Cleanup()
+
+		setSubscription(testEnv)
+		testEnv.DataStore.SetCharge(&models.Charge{
+			ID:               "charge123",
+			OrganizationID:   orgID,
+			PlanID:           "plan123",
+			BillableMetricID: "bm123",
+			UpdatedAt:        utils.NowNullTime(),
+		})
+
+		result := testEnv.EventProcessor.processEvent(context.Background(), &event)
+		require.True(t, result.Success())
+
+		assert.Equal(t, 0, testEnv.Producers.unbilledProducer.ExecutionCount)
+		assert.Empty(t, collectUnbilledEvents(t, reader))
+	})
+}
+
+func TestProcessEventWithMissingEnrichments(t *testing.T) {
+	orgID := "1a901a90-1a90-1a90-1a90-1a901a901a90"
+
+	event := models.Event{
+		OrganizationID:         orgID,
+		ExternalSubscriptionID: "sub_id",
+		TransactionID:          "transaction_id",
+		Code:                   "api_calls",
+		Timestamp:              1741007009,
+		Source:                 "SQS",
+	}
+
+	testEnv := setupProcessorTestEnv(t, true)
+	defer testEnv.Cleanup()
+
+	reader := sdkmetric.NewManualReader()
+	testEnv.EventProcessor.Metrics = NewProcessorMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter(METER_NAME))
+
+	testEnv.DataStore.SetBillableMetric(&models.BillableMetric{
+		ID:              "bm123",
+		OrganizationID:  orgID,
+		Code:            event.Code,
+		AggregationType: models.AggregationTypeCount,
+	})
+	testEnv.DataStore.SetPlan(&models.Plan{ID: "plan123", OrganizationID: orgID, Code: "premium"})
+	testEnv.DataStore.SetSubscription(&models.Subscription{
+		ID:             "sub123",
+		OrganizationID: &orgID,
+		ExternalID:     event.ExternalSubscriptionID,
+		CustomerID:     "customer123",
+		PlanID:         "plan123",
+		StartedAt:      utils.NewNullTime(time.Unix(1700000000, 0)),
+	})
+
+	result := testEnv.EventProcessor.processEvent(context.Background(), &event)
+	require.True(t, result.Success())
+	assert.Nil(t, result.Value().CustomerID)
+
+	rm := metricdata.ResourceMetrics{}
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	var dataPoints []metricdata.DataPoint[int64]
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == "lago.events_processor.missing_enrichments" {
+				dataPoints = m.Data.(metricdata.Sum[int64]).DataPoints
+			}
+		}
+	}
+
+	// Only the customer is missing
+	require.Len(t, dataPoints, 1)
+	missing, _ := dataPoints[0].Attributes.Value("missing")
+	assert.Equal(t, "customer", missing.AsString())
+}
+
+func TestProcessChargedInAdvanceEvent(t *testing.T) {
+	orgID := "1a901a90-1a90-1a90-1a90-1a901a901a90"
+
+	event := models.Event{
+		OrganizationID:         orgID,
+		ExternalSubscriptionID: "sub_id",
+		TransactionID:          "transaction_id",
+		Code:                   "api_calls",
+		Timestamp:              1741007009,
+		Source:                 "SQS",
+	}
+
+	setupInAdvanceTestEnv := func(t *testing.T) *ProcessorTestEnv {
+		testEnv := setupProcessorTestEnv(t, true)
+
+		testEnv.DataStore.SetBillableMetric(&models.BillableMetric{
+			ID:              "bm123",
+			OrganizationID:  orgID,
+			Code:            event.Code,
+			AggregationType: models.AggregationTypeCount,
+			CreatedAt:       utils.NowNullTime(),
+			UpdatedAt:       utils.NowNullTime(),
+		})
+		testEnv.DataStore.SetSubscription(&models.Subscription{
+			ID:             "sub123",
+			OrganizationID: &orgID,
+			ExternalID:     event.ExternalSubscriptionID,
+			PlanID:         "plan123",
+			StartedAt:      utils.NewNullTime(time.Unix(1700000000, 0)),
+		})
+
+		for _, charge := range []*models.Charge{
+			{ID: "charge_a", PayInAdvance: true},
+			{ID: "charge_b", PayInAdvance: false},
+			{ID: "charge_c", PayInAdvance: true},
+		} {
+			charge.OrganizationID = orgID
+			charge.PlanID = "plan123"
+			charge.BillableMetricID = "bm123"
+			charge.UpdatedAt = utils.NowNullTime()
+			testEnv.DataStore.SetCharge(charge)
+		}
+
+		return testEnv
+	}
+
+	t.Run("With the current format", func(t *testing.T) {
+		testEnv := setupInAdvanceTestEnv(t)
+		defer testEnv.Cleanup()
+
+		result := testEnv.EventProcessor.processEvent(context.Background(), &event)
+		require.True(t, result.Success())
+
+		assert.Equal(t, 3, testEnv.Producers.enrichedExpandedProducer.ExecutionCount)
+		assert.Equal(t, 1, testEnv.Producers.inAdvanceProducer.ExecutionCount)
+
+		inAdvanceEvent := models.EnrichedEvent{}
+		require.NoError(t, json.Unmarshal(testEnv.Producers.inAdvanceProducer.Value, &inAdvanceEvent))
+		assert.Equal(t, result.Value().EnrichedID(), inAdvanceEvent.ID)
+		assert.Equal(t, "charge_a", *inAdvanceEvent.ChargeID)
+	})
+
+	t.Run("With expanded records", func(t *testing.T) {
+		testEnv := setupInAdvanceTestEnv(t)
+		defer testEnv.Cleanup()
+
+		testEnv.EventProcessor.SetExpandedInAdvanceOrganizations([]string{orgID})
+
+		result := testEnv.EventProcessor.processEvent(context.Background(), &event)
+		require.True(t, result.Success())
+
+		assert.Equal(t, 3, testEnv.Producers.enrichedExpandedProducer.ExecutionCount)
+		assert.Equal(t, 2, testEnv.Producers.inAdvanceProducer.ExecutionCount)
+
+		// Records are produced in the charge order, the last one is for charge C
+		inAdvanceEvent := models.EnrichedEvent{}
+		require.NoError(t, json.Unmarshal(testEnv.Producers.inAdvanceProducer.Value, &inAdvanceEvent))
+		assert.Equal(t, "charge_c", *inAdvanceEvent.ChargeID)
+		assert.Nil(t, inAdvanceEvent.ChargeFilterID)
+		assert.Equal(t, map[string]string{}, inAdvanceEvent.GroupedBy)
+
+		enrichedEvents := testEnv.EventProcessor.EnrichmentService.EnrichEvent(&event).Value()
+		assert.Equal(t, enrichedEvents[2].ExpandedID(), inAdvanceEvent.ID)
+		assert.Equal(t, []kgo.RecordHeader{{Key: EVENT_ID_HEADER, Value: []byte(inAdvanceEvent.ID)}}, testEnv.Producers.inAdvanceProducer.Headers)
+	})
+
+	t.Run("With fee estimation", func(t *testing.T) {
+		testEnv := setupInAdvanceTestEnv(t)
+		defer testEnv.Cleanup()
+
+		testEnv.DataStore.SetCharge(&models.Charge{
+			ID:               "charge_a",
+			OrganizationID:   orgID,
+			PlanID:           "plan123",
+			BillableMetricID: "bm123",
+			PayInAdvance:     true,
+			ChargeModel:      models.ChargeModelStandard,
+			Properties:       models.ChargeProperties{"amount": "0.5"},
+			UpdatedAt:        utils.NowNullTime(),
+		})
+		testEnv.EventProcessor.FeeEstimationService = NewFeeEstimationService(nil, testEnv.DataStore.(*CacheDataStore).cache)
+
+		result := testEnv.EventProcessor.processEvent(context.Background(), &event)
+		require.True(t, result.Success())
+
+		inAdvanceEvent := models.EnrichedEvent{}
+		require.NoError(t, json.Unmarshal(testEnv.Producers.inAdvanceProducer.Value, &inAdvanceEvent))
+		require.NotNil(t, inAdvanceEvent.EstimatedFee)
+		assert.Equal(t, "50", inAdvanceEvent.EstimatedFee.PreciseAmountCents)
+		assert.Equal(t, "standard", inAdvanceEvent.EstimatedFee.ChargeModel)
+
+		// The estimation is only attached to the charged in advance record
+		expandedEvent := models.EnrichedEvent{}
+		require.NoError(t, json.Unmarshal(testEnv.Producers.enrichedExpandedProducer.Value, &expandedEvent))
+		assert.Nil(t, expandedEvent.EstimatedFee)
+	})
+
+	t.Run("With fee estimation and a first charge not paid in advance", func(t *testing.T) {
+		testEnv := setupInAdvanceTestEnv(t)
+		defer testEnv.Cleanup()
+
+		for _, charge := range []*models.Charge{
+			{ID: "charge_a", PayInAdvance: false, ChargeModel: models.ChargeModelStandard, Properties: models.ChargeProperties{"amount": "0.5"}},
+			{ID: "charge_c", PayInAdvance: true, ChargeModel: models.ChargeModelStandard, Properties: models.ChargeProperties{"amount": "2"}},
+		} {
+			charge.OrganizationID = orgID
+			charge.PlanID = "plan123"
+			charge.BillableMetricID = "bm123"
+			charge.UpdatedAt = utils.NowNullTime()
+			testEnv.DataStore.SetCharge(charge)
+		}
+		testEnv.EventProcessor.FeeEstimationService = NewFeeEstimationService(nil, testEnv.DataStore.(*CacheDataStore).cache)
+
+		result := testEnv.EventProcessor.processEvent(context.Background(), &event)
+		require.True(t, result.Success())
+
+		// The record is priced with the first pay in advance charge
+		inAdvanceEvent := models.EnrichedEvent{}
+		require.NoError(t, json.Unmarshal(testEnv.Producers.inAdvanceProducer.Value, &inAdvanceEvent))
+		require.NotNil(t, inAdvanceEvent.EstimatedFee)
+		assert.Equal(t, "200", inAdvanceEvent.EstimatedFee.PreciseAmountCents)
+	})
+
+	t.Run("With expanded records enabled for another organization", func(t *testing.T) {
+		testEnv := setupInAdvanceTestEnv(t)
+		defer testEnv.Cleanup()
+
+		testEnv.EventProcessor.SetExpandedInAdvanceOrganizations([]string{"other_org_id"})
+
+		result := testEnv.EventProcessor.processEvent(context.Background(), &event)
+		require.True(t, result.Success())
+
+		assert.Equal(t, 1, testEnv.Producers.inAdvanceProducer.ExecutionCount)
+	})
+}
+
+func TestProcessEventWithUsageAggregation(t *testing.T) {
+	orgID := "1a901a90-1a90-1a90-1a90-1a901a901a90"
+
+	event := models.Event{
+		OrganizationID:         orgID,
+		ExternalSubscriptionID: "sub_id",
+		TransactionID:          "transaction_id",
+		Code:                   "api_calls",
+		Timestamp:              1741007009,
+		Source:                 "SQS",
+	}
+
+	setupUsageTestEnv := func(t *testing.T) (*ProcessorTestEnv, *mockUsageStore) {
+		testEnv := setupProcessorTestEnv(t, true)
+
+		testEnv.DataStore.SetBillableMetric(&models.BillableMetric{
+			ID:              "bm123",
+			OrganizationID:  orgID,
+			Code:            event.Code,
+			AggregationType: models.AggregationTypeCount,
+			CreatedAt:       utils.NowNullTime(),
+			UpdatedAt:       utils.NowNullTime(),
+		})
+		testEnv.DataStore.SetPlan(&models.Plan{
+			ID:             "plan123",
+			OrganizationID: orgID,
+			Code:           "premium",
+			Interval:       models.PlanIntervalMonthly,
+		})
+		testEnv.DataStore.SetSubscription(&models.Subscription{
+			ID:             "sub123",
+			OrganizationID: &orgID,
+			ExternalID:     event.ExternalSubscriptionID,
+			PlanID:         "plan123",
+			StartedAt:      utils.NewNullTime(time.Unix(1700000000, 0)),
+		})
+		testEnv.DataStore.SetCharge(&models.Charge{
+			ID:               "charge123",
+			OrganizationID:   orgID,
+			PlanID:           "plan123",
+			BillableMetricID: "bm123",
+			UpdatedAt:        utils.NowNullTime(),
+		})
+
+		usageService, usageStore := setupUsageAggregationService([]string{orgID})
+		testEnv.EventProcessor.UsageAggregationService = usageService
+
+		return testEnv, usageStore
+	}
+
+	t.Run("With an event on a charge", func(t *testing.T) {
+		testEnv, usageStore := setupUsageTestEnv(t)
+		defer testEnv.Cleanup()
+
+		result := testEnv.EventProcessor.processEvent(context.Background(), &event)
+		require.True(t, result.Success())
+
+		require.Len(t, usageStore.increments, 1)
+		assert.Equal(t, "usage/1/{sub123}/charge123/2025-03-01T00:00:00Z", usageStore.increments[0].Key)
+	})
+
+	t.Run("With a reprocessed event", func(t *testing.T) {
+		testEnv, usageStore := setupUsageTestEnv(t)
+		defer testEnv.Cleanup()
+
+		reprocessedEvent := event
+		reprocessedEvent.Source = models.HTTP_RUBY
+		reprocessedEvent.SourceMetadata = &models.SourceMetadata{Reprocess: true}
+
+		result := testEnv.EventProcessor.processEvent(context.Background(), &reprocessedEvent)
+		require.True(t, result.Success())
+
+		// The store ignores the events that were already aggregated
+		assert.Len(t, usageStore.increments, 1)
+	})
+	t.Run("With a usage threshold crossed", func(t *testing.T) {
+		testEnv, _ := setupUsageTestEnv(t)
+		defer testEnv.Cleanup()
+
+		dataStore := testEnv.DataStore.(*CacheDataStore)
+		dataStore.SetCharge(&models.Charge{
+			ID:               "charge123",
+			OrganizationID:   orgID,
+			PlanID:           "plan123",
+			BillableMetricID: "bm123",
+			ChargeModel:      models.ChargeModelStandard,
+			Properties:       models.ChargeProperties{"amount": "1"},
+			UpdatedAt:        utils.NowNullTime(),
+		})
+		dataStore.SetUsageThreshold(&models.UsageThreshold{
+			ID:             "ut123",
+			OrganizationID: orgID,
+			PlanID:         utils.StringPtr("plan123"),
+			AmountCents:    100,
+		})
+
+		thresholdStore := &mockThresholdStore{totals: map[string]*big.Rat{}, crossed: map[string]bool{}}
+		testEnv.EventProcessor.UsageThresholdService = NewUsageThresholdService(
+			dataStore.cache,
+			NewFeeEstimationService(nil, dataStore.cache),
+			thresholdStore,
+			NewDefaultProcessorMetrics(),
+		)
+
+		result := testEnv.EventProcessor.processEvent(context.Background(), &event)
+		require.True(t, result.Success())
+		testEnv.EventProcessor.processEvent(context.Background(), &event)
+
+		assert.Equal(t, 1, testEnv.Producers.usageThresholdsProducer.ExecutionCount)
+
+		var crossedEvent models.UsageThresholdCrossedEvent
+		require.NoError(t, json.Unmarshal(testEnv.Producers.usageThresholdsProducer.Value, &crossedEvent))
+		assert.Equal(t, "ut123", crossedEvent.ThresholdID)
+		assert.Equal(t, "sub123", crossedEvent.SubscriptionID)
+		assert.Equal(t, "100", crossedEvent.CurrentValue)
+		assert.Equal(t, orgID+"-sub123", string(testEnv.Producers.usageThresholdsProducer.Key))
+	})
+}
+
+func TestProcessEventWithWalletDebitIntents(t *testing.T) {
+	orgID := "1a901a90-1a90-1a90-1a90-1a901a901a90"
+
+	buildEvent := func(walletCode any) *models.Event {
+		return &models.Event{
+			OrganizationID:         orgID,
+			ExternalSubscriptionID: "sub_id",
+			TransactionID:          "transaction_id",
+			Code:                   "api_calls",
+			Timestamp:              1741007009,
+			Properties:             map[string]any{models.TARGET_WALLET_CODE: walletCode},
+			Source:                 "SQS",
+		}
+	}
+
+	setupWalletTestEnv := func(t *testing.T) *ProcessorTestEnv {
+		testEnv := setupProcessorTestEnv(t, true)
+
+		testEnv.DataStore.SetBillableMetric(&models.BillableMetric{
+			ID:              "bm123",
+			OrganizationID:  orgID,
+			Code:            "api_calls",
+			AggregationType: models.AggregationTypeCount,
+			CreatedAt:       utils.NowNullTime(),
+			UpdatedAt:       utils.NowNullTime(),
+		})
+		testEnv.DataStore.SetCustomer(&models.Customer{
+			ID:             "cus123",
+			OrganizationID: orgID,
+			ExternalID:     "cus_external",
+		})
+		testEnv.DataStore.SetSubscription(&models.Subscription{
+			ID:             "sub123",
+			OrganizationID: &orgID,
+			ExternalID:     "sub_id",
+			CustomerID:     "cus123",
+			PlanID:         "plan123",
+			StartedAt:      utils.NewNullTime(time.Unix(1700000000, 0)),
+		})
+		testEnv.DataStore.SetCharge(&models.Charge{
+			ID:                  "charge123",
+			OrganizationID:      orgID,
+			PlanID:              "plan123",
+			BillableMetricID:    "bm123",
+			AcceptsTargetWallet: true,
+			UpdatedAt:           utils.NowNullTime(),
+		})
+		testEnv.DataStore.SetWallet(&models.Wallet{
+			ID:             "wallet123",
+			OrganizationID: orgID,
+			CustomerID:     "cus123",
+			Code:           utils.StringPtr("prepaid"),
+			Status:         models.WalletStatusActive,
+			Currency:       "EUR",
+		})
+
+		return testEnv
+	}
+
+	t.Run("With an event targeting a wallet", func(t *testing.T) {
+		testEnv := setupWalletTestEnv(t)
+		defer testEnv.Cleanup()
+
+		result := testEnv.EventProcessor.processEvent(context.Background(), buildEvent("prepaid"))
+		require.True(t, result.Success())
+
+		assert.Equal(t, 1, testEnv.Producers.walletDebitProducer.ExecutionCount)
+		assert.Equal(t, orgID+"-wallet123", string(testEnv.Producers.walletDebitProducer.Key))
+
+		var intent models.WalletDebitIntent
+		require.NoError(t, json.Unmarshal(testEnv.Producers.walletDebitProducer.Value, &intent))
+		assert.Equal(t, "wallet123", intent.WalletID)
+		assert.Equal(t, "prepaid", intent.WalletCode)
+		assert.Equal(t, "cus123", intent.CustomerID)
+		assert.Equal(t, "charge123", intent.ChargeID)
+		assert.Equal(t, "EUR", intent.Currency)
+		assert.Nil(t, intent.EstimatedFee)
+	})
+
+	t.Run("With an unknown wallet code", func(t *testing.T) {
+		testEnv := setupWalletTestEnv(t)
+		defer testEnv.Cleanup()
+
+		result := testEnv.EventProcessor.processEvent(context.Background(), buildEvent("unknown"))
+		assert.False(t, result.Success())
+		assert.Equal(t, "unknown_target_wallet", result.ErrorCode())
+		assert.Equal(t, 0, testEnv.Producers.walletDebitProducer.ExecutionCount)
+		assert.Equal(t, 0, testEnv.Producers.enrichedProducer.ExecutionCount)
+	})
+
+	t.Run("Without target wallet", func(t *testing.T) {
+		testEnv := setupWalletTestEnv(t)
+		defer testEnv.Cleanup()
+
+		result := testEnv.EventProcessor.processEvent(context.Background(), buildEvent(nil))
+		require.True(t, result.Success())
+		assert.Equal(t, 0, testEnv.Producers.walletDebitProducer.ExecutionCount)
+	})
+}
+
+func TestProcessEventsWithOrganizationSelector(t *testing.T) {
+	testEnv := setupProcessorTestEnv(t, true)
+	defer testEnv.Cleanup()
+
+	selector, err := models.NewOrganizationSelector(nil, []string{"foreign_org_id"}, "")
+	require.NoError(t, err)
+	testEnv.EventProcessor.SetOrganizationSelector(selector)
+
+	record := &kgo.Record{Value: []byte(`{"organization_id":"foreign_org_id","code":"api_calls","transaction_id":"tr_1"}`)}
+
+	// Events of foreign organizations are committed without being processed
+	processed := testEnv.EventProcessor.ProcessEvents(context.Background(), []*kgo.Record{record})
+	assert.Equal(t, []*kgo.Record{record}, processed)
+	assert.Equal(t, 0, testEnv.Producers.deadLetterProducer.ExecutionCount)
+	assert.Equal(t, 0, testEnv.Producers.enrichedProducer.ExecutionCount)
+}
+
+func TestProcessEventsWithEventTimeout(t *testing.T) {
+	testEnv := setupProcessorTestEnv(t, true)
+	defer testEnv.Cleanup()
+
+	testEnv.EventProcessor.SetEventTimeout(time.Nanosecond)
+
+	newRecord := func(ingestedAt time.Time) *kgo.Record {
+		value, err := json.Marshal(models.Event{
+			OrganizationID:         "org_id",
+			ExternalSubscriptionID: "sub_id",
+			Code:                   "api_calls",
+			TransactionID:          "tr_1",
+			Timestamp:              1741007009,
+			IngestedAt:             utils.CustomTime(ingestedAt),
+		})
+		require.NoError(t, err)
+		return &kgo.Record{Topic: "events_raw", Partition: 2, Value: value}
+	}
+
+	t.Run("With a recent event", func(t *testing.T) {
+		record := newRecord(time.Now())
+
+		// Timed out events are not committed, to be consumed again
+		processed := testEnv.EventProcessor.ProcessEvents(context.Background(), []*kgo.Record{record})
+		assert.Empty(t, processed)
+		assert.Equal(t, 0, testEnv.Producers.deadLetterProducer.ExecutionCount)
+	})
+
+	t.Run("With an event older than 12 hours", func(t *testing.T) {
+		record := newRecord(time.Now().Add(-13 * time.Hour))
+
+		processed := testEnv.EventProcessor.ProcessEvents(context.Background(), []*kgo.Record{record})
+		assert.Equal(t, []*kgo.Record{record}, processed)
+		require.Equal(t, 1, testEnv.Producers.deadLetterProducer.ExecutionCount)
+
+		failedEvent := models.FailedEvent{}
+		require.NoError(t, json.Unmarshal(testEnv.Producers.deadLetterProducer.Value, &failedEvent))
+		assert.Equal(t, "processing_timeout", failedEvent.ErrorCode)
+		assert.Equal(t, ErrEventDeadlineExceeded.Error(), failedEvent.InitialErrorMessage)
+	})
+
+	t.Run("With an expired batch", func(t *testing.T) {
+		testEnv.Producers.deadLetterProducer.ExecutionCount = 0
+		record := newRecord(time.Now().Add(-13 * time.Hour))
+
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+
+		// The record is consumed again rather than committed without reaching the dead letter queue
+		processed := testEnv.EventProcessor.ProcessEvents(ctx, []*kgo.Record{record})
+		assert.Empty(t, processed)
+		assert.Equal(t, 0, testEnv.Producers.deadLetterProducer.ExecutionCount)
+	})
+}
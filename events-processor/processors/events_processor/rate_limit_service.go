@@ -0,0 +1,339 @@
+package events_processor
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/server"
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+// Delay after which the rate limit policies set at runtime are read again from Redis,
+// a policy set on another instance is applied after at most this delay
+const RATE_LIMIT_POLICIES_REFRESH_INTERVAL = 5 * time.Second
+
+// RateLimitService limits the number of events processed per second for each organization,
+// so a single organization flooding the raw topic doesn't delay the billing of the others.
+// Policies are indexed by organization ID, ALL_ORGANIZATIONS being the default one.
+// The policies set at runtime are stored in Redis so all the instances agree, they take precedence
+// over the configured ones. The token buckets are kept in memory: the limit applies per instance.
+type RateLimitService struct {
+	// Set once by the constructor, it is read without the lock
+	store   models.RateLimitPolicyStorer
+	metrics *ProcessorMetrics
+	now     func() time.Time
+
+	mu          sync.Mutex
+	configured  map[string]*models.RateLimitPolicy
+	overrides   map[string]*models.RateLimitPolicy
+	buckets     map[string]*tokenBucket
+	refreshedAt time.Time
+	refreshing  bool
+	// Incremented by the policies set or deleted on this instance, a refresh reading Redis meanwhile is discarded
+	updates uint64
+}
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// NewRateLimitService limits the events with the configured policies.
+// The store shares the policies set at runtime between the instances,
+// without a store they only apply to the current instance.
+func NewRateLimitService(policies map[string]*models.RateLimitPolicy, store models.RateLimitPolicyStorer, metrics *ProcessorMetrics) *RateLimitService {
+	if policies == nil {
+		policies = make(map[string]*models.RateLimitPolicy)
+	}
+
+	return &RateLimitService{
+		store:      store,
+		configured: policies,
+		overrides:  make(map[string]*models.RateLimitPolicy),
+		buckets:    make(map[string]*tokenBucket),
+		metrics:    metrics,
+		now:        time.Now,
+	}
+}
+
+// Policies returns a copy of the current policies
+func (s *RateLimitService) Policies(ctx context.Context) map[string]*models.RateLimitPolicy {
+	s.refresh(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	policies := make(map[string]*models.RateLimitPolicy, len(s.configured)+len(s.overrides))
+	for _, source := range []map[string]*models.RateLimitPolicy{s.configured, s.overrides} {
+		for organizationID, policy := range source {
+			copied := *policy
+			policies[organizationID] = &copied
+		}
+	}
+
+	return policies
+}
+
+// SetPolicy replaces the policy of an organization, the buckets it applies to are refilled
+func (s *RateLimitService) SetPolicy(ctx context.Context, organizationID string, policy *models.RateLimitPolicy) utils.Result[bool] {
+	if s.store != nil {
+		if result := s.store.SetPolicy(ctx, organizationID, policy); result.Failure() {
+			return result
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.overrides[organizationID] = policy
+	s.resetBuckets(organizationID)
+	s.updates++
+
+	return utils.SuccessResult(true)
+}
+
+// DeletePolicy removes the policy set at runtime for an organization,
+// it falls back to the configured policy of the organization, then to the default policy if any
+func (s *RateLimitService) DeletePolicy(ctx context.Context, organizationID string) utils.Result[bool] {
+	if s.store != nil {
+		if result := s.store.DeletePolicy(ctx, organizationID); result.Failure() {
+			return result
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.overrides, organizationID)
+	s.resetBuckets(organizationID)
+	s.updates++
+
+	return utils.SuccessResult(true)
+}
+
+func (s *RateLimitService) resetBuckets(organizationID string) {
+	if organizationID == ALL_ORGANIZATIONS {
+		s.buckets = make(map[string]*tokenBucket)
+		return
+	}
+
+	delete(s.buckets, organizationID)
+}
+
+// refresh reads the policies set at runtime from Redis once per refresh interval,
+// the buckets of the organizations whose policy changed are refilled.
+// Redis is read outside the lock: the other callers keep using the last known policies during the read.
+// The last known policies are kept when Redis is unavailable.
+func (s *RateLimitService) refresh(ctx context.Context) {
+	s.mu.Lock()
+	now := s.now()
+	if s.store == nil || s.refreshing || (!s.refreshedAt.IsZero() && now.Sub(s.refreshedAt) < RATE_LIMIT_POLICIES_REFRESH_INTERVAL) {
+		s.mu.Unlock()
+		return
+	}
+	s.refreshing = true
+	updates := s.updates
+	s.mu.Unlock()
+
+	result := s.store.Policies(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refreshing = false
+	s.refreshedAt = now
+
+	if result.Failure() {
+		slog.Error("Error reading the rate limit policies", slog.String("error", result.ErrorMsg()))
+		utils.CaptureErrorResult(result)
+		return
+	}
+
+	// The read may miss a policy set or deleted on this instance, the policies are read again on the next call
+	if s.updates != updates {
+		s.refreshedAt = time.Time{}
+		return
+	}
+
+	policies := result.Value()
+	for _, organizationID := range slices.Collect(maps.Keys(s.overrides)) {
+		if _, found := policies[organizationID]; !found {
+			s.resetBuckets(organizationID)
+		}
+	}
+	for organizationID, policy := range policies {
+		if current := s.overrides[organizationID]; current == nil || *current != *policy {
+			s.resetBuckets(organizationID)
+		}
+	}
+	s.overrides = policies
+}
+
+func (s *RateLimitService) policy(organizationID string) *models.RateLimitPolicy {
+	for _, key := range []string{organizationID, ALL_ORGANIZATIONS} {
+		if policy := s.overrides[key]; policy != nil {
+			return policy
+		}
+		if policy := s.configured[key]; policy != nil {
+			return policy
+		}
+	}
+
+	return nil
+}
+
+// Allow takes a token from the bucket of the organization.
+// It returns false with the action of the policy when the bucket is empty.
+func (s *RateLimitService) Allow(ctx context.Context, organizationID string) (models.RateLimitAction, bool) {
+	s.refresh(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	policy := s.policy(organizationID)
+	if policy == nil {
+		return "", true
+	}
+
+	now := s.now()
+	bucket := s.buckets[organizationID]
+	if bucket == nil {
+		bucket = &tokenBucket{tokens: float64(policy.Burst), updatedAt: now}
+		s.buckets[organizationID] = bucket
+	}
+
+	elapsed := now.Sub(bucket.updatedAt).Seconds()
+	if elapsed > 0 {
+		bucket.tokens = math.Min(float64(policy.Burst), bucket.tokens+elapsed*policy.Rate)
+		bucket.updatedAt = now
+	}
+
+	if bucket.tokens < 1 {
+		return policy.Action, false
+	}
+
+	bucket.tokens--
+	return "", true
+}
+
+// scheduledEvent is a decoded record waiting to be processed
+type scheduledEvent struct {
+	record *kgo.Record
+	event  models.Event
+}
+
+// Schedule splits the events of a batch between the ones processed first, the deprioritized ones,
+// and the ones to produce to the rate limited events topic
+func (s *RateLimitService) Schedule(ctx context.Context, events []*scheduledEvent) (prioritized, deprioritized, overflowed []*scheduledEvent) {
+	for _, ev := range events {
+		action, allowed := s.Allow(ctx, ev.event.OrganizationID)
+		if allowed {
+			prioritized = append(prioritized, ev)
+			continue
+		}
+
+		s.metrics.RecordRateLimitedEvent(ctx, ev.event.OrganizationID, action)
+
+		if action == models.RateLimitOverflow {
+			overflowed = append(overflowed, ev)
+		} else {
+			deprioritized = append(deprioritized, ev)
+		}
+	}
+
+	return prioritized, deprioritized, overflowed
+}
+
+// interleaveByOrganization orders the events in a round robin across organizations,
+// keeping the order of the events of each organization
+func interleaveByOrganization(events []*scheduledEvent) []*scheduledEvent {
+	var organizationIDs []string
+	queues := make(map[string][]*scheduledEvent)
+	for _, ev := range events {
+		organizationID := ev.event.OrganizationID
+		if _, ok := queues[organizationID]; !ok {
+			organizationIDs = append(organizationIDs, organizationID)
+		}
+		queues[organizationID] = append(queues[organizationID], ev)
+	}
+
+	interleaved := make([]*scheduledEvent, 0, len(events))
+	for len(interleaved) < len(events) {
+		for _, organizationID := range organizationIDs {
+			if queue := queues[organizationID]; len(queue) > 0 {
+				interleaved = append(interleaved, queue[0])
+				queues[organizationID] = queue[1:]
+			}
+		}
+	}
+
+	return interleaved
+}
+
+// ServeHTTP lists the policies (GET), replaces the policy of an organization (PUT)
+// or removes it (DELETE), the organization ID being the `organization_id` path value
+func (s *RateLimitService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	organizationID := r.PathValue("organization_id")
+
+	switch r.Method {
+	case http.MethodGet:
+		server.WriteJSON(w, http.StatusOK, s.Policies(r.Context()))
+
+	case http.MethodPut:
+		policy := &models.RateLimitPolicy{}
+		if err := json.NewDecoder(r.Body).Decode(policy); err != nil {
+			server.WriteError(w, http.StatusBadRequest, server.ErrorResponse{
+				Error:     err.Error(),
+				ErrorCode: "invalid_rate_limit_policy",
+				Message:   "Error while decoding the rate limit policy",
+			})
+			return
+		}
+
+		if err := policy.Validate(); err != nil {
+			server.WriteError(w, http.StatusUnprocessableEntity, server.ErrorResponse{
+				Error:     err.Error(),
+				ErrorCode: "invalid_rate_limit_policy",
+				Message:   "Invalid rate limit policy",
+			})
+			return
+		}
+
+		if result := s.SetPolicy(r.Context(), organizationID, policy); result.Failure() {
+			writeRateLimitStoreError(w, result)
+			return
+		}
+
+		server.WriteJSON(w, http.StatusOK, policy)
+
+	case http.MethodDelete:
+		if result := s.DeletePolicy(r.Context(), organizationID); result.Failure() {
+			writeRateLimitStoreError(w, result)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		server.WriteError(w, http.StatusMethodNotAllowed, server.ErrorResponse{Error: "method not allowed"})
+	}
+}
+
+func writeRateLimitStoreError(w http.ResponseWriter, result utils.AnyResult) {
+	utils.CaptureErrorResult(result)
+	server.WriteError(w, http.StatusInternalServerError, server.ErrorResponse{
+		Error:     result.ErrorMsg(),
+		ErrorCode: "rate_limit_store_error",
+		Message:   "Error while updating the rate limit policies",
+	})
+}
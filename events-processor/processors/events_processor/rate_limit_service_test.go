@@ -0,0 +1,361 @@
+package events_processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+type mockRateLimitPolicyStore struct {
+	policies  map[string]*models.RateLimitPolicy
+	err       error
+	ReadCount int
+	// Optional, called once the policies are read, before they are returned
+	afterRead func()
+}
+
+func (m *mockRateLimitPolicyStore) Close() error { return nil }
+
+func (m *mockRateLimitPolicyStore) SetPolicy(ctx context.Context, organizationID string, policy *models.RateLimitPolicy) utils.Result[bool] {
+	if m.err != nil {
+		return utils.FailedBoolResult(m.err)
+	}
+	m.policies[organizationID] = policy
+	return utils.SuccessResult(true)
+}
+
+func (m *mockRateLimitPolicyStore) DeletePolicy(ctx context.Context, organizationID string) utils.Result[bool] {
+	if m.err != nil {
+		return utils.FailedBoolResult(m.err)
+	}
+	_, found := m.policies[organizationID]
+	delete(m.policies, organizationID)
+	return utils.SuccessResult(found)
+}
+
+func (m *mockRateLimitPolicyStore) Policies(ctx context.Context) utils.Result[map[string]*models.RateLimitPolicy] {
+	m.ReadCount++
+	if m.err != nil {
+		return utils.FailedResult[map[string]*models.RateLimitPolicy](m.err)
+	}
+
+	policies := make(map[string]*models.RateLimitPolicy, len(m.policies))
+	for organizationID, policy := range m.policies {
+		copied := *policy
+		policies[organizationID] = &copied
+	}
+	if m.afterRead != nil {
+		m.afterRead()
+	}
+	return utils.SuccessResult(policies)
+}
+
+func setupRateLimitService(policies map[string]*models.RateLimitPolicy, store models.RateLimitPolicyStorer) (*RateLimitService, *time.Time) {
+	now := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	service := NewRateLimitService(policies, store, NewDefaultProcessorMetrics())
+	service.now = func() time.Time { return now }
+
+	return service, &now
+}
+
+func buildScheduledEvents(organizationIDs ...string) []*scheduledEvent {
+	events := make([]*scheduledEvent, 0, len(organizationIDs))
+	for i, organizationID := range organizationIDs {
+		event := models.Event{OrganizationID: organizationID, TransactionID: string(rune('a' + i))}
+		value, _ := json.Marshal(event)
+		events = append(events, &scheduledEvent{record: &kgo.Record{Value: value}, event: event})
+	}
+
+	return events
+}
+
+func TestRateLimitAllow(t *testing.T) {
+	ctx := context.Background()
+	t.Run("With a token bucket", func(t *testing.T) {
+		service, now := setupRateLimitService(map[string]*models.RateLimitPolicy{
+			"org_id": {Rate: 2, Burst: 2, Action: models.RateLimitOverflow},
+		}, nil)
+
+		for range 2 {
+			_, allowed := service.Allow(ctx, "org_id")
+			assert.True(t, allowed)
+		}
+
+		action, allowed := service.Allow(ctx, "org_id")
+		assert.False(t, allowed)
+		assert.Equal(t, models.RateLimitOverflow, action)
+
+		// The bucket is refilled with the rate of the policy
+		*now = now.Add(500 * time.Millisecond)
+		_, allowed = service.Allow(ctx, "org_id")
+		assert.True(t, allowed)
+		_, allowed = service.Allow(ctx, "org_id")
+		assert.False(t, allowed)
+	})
+
+	t.Run("With the default policy", func(t *testing.T) {
+		service, _ := setupRateLimitService(map[string]*models.RateLimitPolicy{
+			ALL_ORGANIZATIONS: {Rate: 1, Burst: 1, Action: models.RateLimitDeprioritize},
+		}, nil)
+
+		// Each organization has its own bucket
+		_, allowed := service.Allow(ctx, "org_1")
+		assert.True(t, allowed)
+		_, allowed = service.Allow(ctx, "org_2")
+		assert.True(t, allowed)
+
+		action, allowed := service.Allow(ctx, "org_1")
+		assert.False(t, allowed)
+		assert.Equal(t, models.RateLimitDeprioritize, action)
+	})
+
+	t.Run("Without policy", func(t *testing.T) {
+		service, _ := setupRateLimitService(nil, nil)
+
+		for range 10 {
+			_, allowed := service.Allow(ctx, "org_id")
+			assert.True(t, allowed)
+		}
+	})
+
+	t.Run("With a policy changed at runtime", func(t *testing.T) {
+		service, _ := setupRateLimitService(nil, nil)
+
+		service.SetPolicy(ctx, "org_id", &models.RateLimitPolicy{Rate: 1, Burst: 1, Action: models.RateLimitDeprioritize})
+		_, allowed := service.Allow(ctx, "org_id")
+		assert.True(t, allowed)
+		_, allowed = service.Allow(ctx, "org_id")
+		assert.False(t, allowed)
+
+		service.DeletePolicy(ctx, "org_id")
+		_, allowed = service.Allow(ctx, "org_id")
+		assert.True(t, allowed)
+	})
+}
+
+func TestRateLimitStoredPolicies(t *testing.T) {
+	ctx := context.Background()
+	t.Run("With a policy set on another instance", func(t *testing.T) {
+		store := &mockRateLimitPolicyStore{policies: make(map[string]*models.RateLimitPolicy)}
+		service, now := setupRateLimitService(nil, store)
+
+		_, allowed := service.Allow(ctx, "org_id")
+		assert.True(t, allowed)
+
+		store.policies["org_id"] = &models.RateLimitPolicy{Rate: 1, Burst: 1, Action: models.RateLimitOverflow}
+
+		// The policies are only read again after the refresh interval
+		_, allowed = service.Allow(ctx, "org_id")
+		assert.True(t, allowed)
+		assert.Equal(t, 1, store.ReadCount)
+
+		*now = now.Add(RATE_LIMIT_POLICIES_REFRESH_INTERVAL)
+		_, allowed = service.Allow(ctx, "org_id")
+		assert.True(t, allowed)
+		action, allowed := service.Allow(ctx, "org_id")
+		assert.False(t, allowed)
+		assert.Equal(t, models.RateLimitOverflow, action)
+		assert.Equal(t, 2, store.ReadCount)
+
+		// Removing the policy on another instance lifts the limit
+		delete(store.policies, "org_id")
+		*now = now.Add(RATE_LIMIT_POLICIES_REFRESH_INTERVAL)
+		_, allowed = service.Allow(ctx, "org_id")
+		assert.True(t, allowed)
+	})
+
+	t.Run("With a stored policy overriding a configured one", func(t *testing.T) {
+		configured := &models.RateLimitPolicy{Rate: 1, Burst: 1, Action: models.RateLimitDeprioritize}
+		store := &mockRateLimitPolicyStore{policies: make(map[string]*models.RateLimitPolicy)}
+		service, _ := setupRateLimitService(map[string]*models.RateLimitPolicy{"org_id": configured}, store)
+
+		override := &models.RateLimitPolicy{Rate: 10, Burst: 10, Action: models.RateLimitOverflow}
+		require.True(t, service.SetPolicy(ctx, "org_id", override).Success())
+		assert.Equal(t, override, store.policies["org_id"])
+		assert.Equal(t, override, service.Policies(ctx)["org_id"])
+
+		// Deleting the stored policy restores the configured one
+		require.True(t, service.DeletePolicy(ctx, "org_id").Success())
+		assert.Empty(t, store.policies)
+		assert.Equal(t, configured, service.Policies(ctx)["org_id"])
+	})
+
+	t.Run("With a store error", func(t *testing.T) {
+		store := &mockRateLimitPolicyStore{policies: make(map[string]*models.RateLimitPolicy)}
+		service, now := setupRateLimitService(nil, store)
+		require.True(t, service.SetPolicy(ctx, "org_id", &models.RateLimitPolicy{Rate: 1, Burst: 1}).Success())
+
+		store.err = errors.New("redis is down")
+		*now = now.Add(RATE_LIMIT_POLICIES_REFRESH_INTERVAL)
+
+		assert.False(t, service.SetPolicy(ctx, "org_id", &models.RateLimitPolicy{Rate: 5, Burst: 5}).Success())
+		assert.False(t, service.DeletePolicy(ctx, "org_id").Success())
+
+		// The last known policies are kept
+		_, allowed := service.Allow(ctx, "org_id")
+		assert.True(t, allowed)
+		_, allowed = service.Allow(ctx, "org_id")
+		assert.False(t, allowed)
+	})
+
+	t.Run("With a refresh in progress", func(t *testing.T) {
+		store := &mockRateLimitPolicyStore{policies: make(map[string]*models.RateLimitPolicy)}
+		service, _ := setupRateLimitService(nil, store)
+		require.True(t, service.SetPolicy(ctx, "org_id", &models.RateLimitPolicy{Rate: 1, Burst: 1}).Success())
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		store.afterRead = func() {
+			close(started)
+			<-release
+		}
+
+		refreshed := make(chan bool)
+		go func() {
+			_, allowed := service.Allow(ctx, "other_org")
+			refreshed <- allowed
+		}()
+		<-started
+
+		// The other callers are not blocked by the read, they use the last known policies
+		checked := make(chan bool)
+		go func() {
+			_, allowed := service.Allow(ctx, "org_id")
+			checked <- allowed
+		}()
+		select {
+		case allowed := <-checked:
+			assert.True(t, allowed)
+		case <-time.After(time.Second):
+			t.Fatal("Allow blocked by the refresh in progress")
+		}
+
+		// The policy is deleted during the read, the stale policies are discarded
+		store.afterRead = nil
+		require.True(t, service.DeletePolicy(ctx, "org_id").Success())
+		close(release)
+
+		assert.True(t, <-refreshed)
+		assert.NotContains(t, service.Policies(ctx), "org_id")
+		assert.Equal(t, 2, store.ReadCount)
+	})
+}
+
+func TestRateLimitSchedule(t *testing.T) {
+	service, _ := setupRateLimitService(map[string]*models.RateLimitPolicy{
+		"noisy_org":   {Rate: 1, Burst: 2, Action: models.RateLimitDeprioritize},
+		"overflowing": {Rate: 1, Burst: 1, Action: models.RateLimitOverflow},
+	}, nil)
+
+	events := buildScheduledEvents("noisy_org", "noisy_org", "noisy_org", "overflowing", "overflowing", "org_id")
+	prioritized, deprioritized, overflowed := service.Schedule(context.Background(), events)
+
+	assert.Equal(t, []*scheduledEvent{events[0], events[1], events[3], events[5]}, prioritized)
+	assert.Equal(t, []*scheduledEvent{events[2]}, deprioritized)
+	assert.Equal(t, []*scheduledEvent{events[4]}, overflowed)
+}
+
+func TestInterleaveByOrganization(t *testing.T) {
+	events := buildScheduledEvents("org_1", "org_1", "org_1", "org_2", "org_3", "org_2")
+
+	interleaved := interleaveByOrganization(events)
+	assert.Equal(t, []*scheduledEvent{events[0], events[3], events[4], events[1], events[5], events[2]}, interleaved)
+	assert.Empty(t, interleaveByOrganization(nil))
+}
+
+func TestRateLimitServeHTTP(t *testing.T) {
+	ctx := context.Background()
+	service, _ := setupRateLimitService(map[string]*models.RateLimitPolicy{
+		ALL_ORGANIZATIONS: {Rate: 10, Burst: 10, Action: models.RateLimitDeprioritize},
+	}, nil)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /rate_limits", service)
+	mux.Handle("PUT /rate_limits/{organization_id}", service)
+	mux.Handle("DELETE /rate_limits/{organization_id}", service)
+
+	serve := func(method string, path string, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return recorder
+	}
+
+	t.Run("With a policy set for an organization", func(t *testing.T) {
+		response := serve(http.MethodPut, "/rate_limits/org_id", `{"rate": 5, "action": "overflow"}`)
+		require.Equal(t, http.StatusOK, response.Code)
+
+		response = serve(http.MethodGet, "/rate_limits", "")
+		require.Equal(t, http.StatusOK, response.Code)
+
+		policies := map[string]*models.RateLimitPolicy{}
+		require.NoError(t, json.Unmarshal(response.Body.Bytes(), &policies))
+		assert.Equal(t, &models.RateLimitPolicy{Rate: 5, Burst: 5, Action: models.RateLimitOverflow}, policies["org_id"])
+		assert.Len(t, policies, 2)
+	})
+
+	t.Run("With a policy removed", func(t *testing.T) {
+		response := serve(http.MethodDelete, "/rate_limits/org_id", "")
+		assert.Equal(t, http.StatusNoContent, response.Code)
+		assert.NotContains(t, service.Policies(ctx), "org_id")
+	})
+
+	t.Run("With an invalid policy", func(t *testing.T) {
+		response := serve(http.MethodPut, "/rate_limits/org_id", `{"rate": -1}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+		assert.Contains(t, response.Body.String(), "invalid_rate_limit_policy")
+
+		response = serve(http.MethodPut, "/rate_limits/org_id", `{"rate":`)
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+
+	t.Run("With a store error", func(t *testing.T) {
+		failing, _ := setupRateLimitService(nil, &mockRateLimitPolicyStore{err: errors.New("redis is down")})
+
+		failingMux := http.NewServeMux()
+		failingMux.Handle("PUT /rate_limits/{organization_id}", failing)
+		failingMux.Handle("DELETE /rate_limits/{organization_id}", failing)
+
+		response := httptest.NewRecorder()
+		failingMux.ServeHTTP(response, httptest.NewRequest(http.MethodPut, "/rate_limits/org_id", strings.NewReader(`{"rate": 5}`)))
+		assert.Equal(t, http.StatusInternalServerError, response.Code)
+		assert.Contains(t, response.Body.String(), "rate_limit_store_error")
+
+		response = httptest.NewRecorder()
+		failingMux.ServeHTTP(response, httptest.NewRequest(http.MethodDelete, "/rate_limits/org_id", nil))
+		assert.Equal(t, http.StatusInternalServerError, response.Code)
+	})
+}
+
+func TestProcessEventsWithRateLimit(t *testing.T) {
+	testEnv := setupProcessorTestEnv(t, true)
+	defer testEnv.Cleanup()
+
+	testEnv.EventProcessor.RateLimitService = NewRateLimitService(map[string]*models.RateLimitPolicy{
+		"org_id": {Rate: 1, Burst: 1, Action: models.RateLimitOverflow},
+	}, nil, NewDefaultProcessorMetrics())
+	testEnv.EventProcessor.SetConcurrency(1)
+
+	events := buildScheduledEvents("org_id", "org_id", "org_id")
+	records := []*kgo.Record{events[0].record, events[1].record, events[2].record, {Value: []byte("invalid")}}
+
+	processed := testEnv.EventProcessor.ProcessEvents(context.Background(), records)
+
+	// Events over the limit are produced to the rate limited events topic and committed
+	assert.Equal(t, 2, testEnv.Producers.rateLimitedProducer.ExecutionCount)
+	assert.Equal(t, []byte("org_id"), testEnv.Producers.rateLimitedProducer.Key)
+	assert.Contains(t, processed, records[1])
+	assert.Contains(t, processed, records[2])
+	assert.Contains(t, processed, records[3])
+}
@@ -0,0 +1,53 @@
+package events_processor
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+// UsageAggregationService maintains the running usage of the subscriptions in Redis,
+// so the current usage can be read without querying ClickHouse
+type UsageAggregationService struct {
+	usageCache    *models.UsageCache
+	organizations organizationSet
+}
+
+func NewUsageAggregationService(usageCache *models.UsageCache, organizationIDs []string) *UsageAggregationService {
+	return &UsageAggregationService{
+		usageCache:    usageCache,
+		organizations: newOrganizationSet(organizationIDs),
+	}
+}
+
+// AggregateUsage adds the expanded events to the usage of their charge, charge filter and grouped_by values.
+// Aggregation is best effort: failures are reported but don't fail the event processing.
+// It returns the usage of the charges before each event, nil for the events that were not aggregated.
+func (s *UsageAggregationService) AggregateUsage(ctx context.Context, events []*models.EnrichedEvent) []*models.AggregatedUsage {
+	usages := make([]*models.AggregatedUsage, len(events))
+
+	for i, event := range events {
+		if event.ChargeID == nil || !s.organizations.Contains(event.OrganizationID) {
+			continue
+		}
+
+		aggregateResult := s.usageCache.Aggregate(ctx, event)
+		if aggregateResult.Failure() {
+			slog.Error(
+				"Error aggregating usage",
+				slog.String("organization_id", event.OrganizationID),
+				slog.String("subscription_id", event.SubscriptionID),
+				slog.String("charge_id", *event.ChargeID),
+				slog.String("error", aggregateResult.ErrorMsg()),
+			)
+			utils.CaptureError(aggregateResult.Error())
+			continue
+		}
+
+		usages[i] = aggregateResult.Value()
+	}
+
+	return usages
+}
@@ -0,0 +1,102 @@
+package events_processor
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+type mockUsageStore struct {
+	increments     []*models.UsageIncrement
+	returnedResult utils.Result[*models.UsageIncrementResult]
+}
+
+func (m *mockUsageStore) Close() error {
+	return nil
+}
+
+func (m *mockUsageStore) Increment(ctx context.Context, increment *models.UsageIncrement) utils.Result[*models.UsageIncrementResult] {
+	m.increments = append(m.increments, increment)
+	return m.returnedResult
+}
+
+func setupUsageAggregationService(organizationIDs []string) (*UsageAggregationService, *mockUsageStore) {
+	store := &mockUsageStore{returnedResult: utils.SuccessResult(&models.UsageIncrementResult{Aggregated: true, PreviousEvents: 2})}
+	return NewUsageAggregationService(models.NewUsageCache(store), organizationIDs), store
+}
+
+func TestAggregateUsage(t *testing.T) {
+	periodStart := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	periodEnd := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	buildEvent := func(chargeID *string) *models.EnrichedEvent {
+		return &models.EnrichedEvent{
+			OrganizationID:     "org_id",
+			SubscriptionID:     "sub_id",
+			TransactionID:      "tr_1",
+			ChargeID:           chargeID,
+			BillingPeriodStart: &periodStart,
+			BillingPeriodEnd:   &periodEnd,
+			Value:              utils.StringPtr("1"),
+			BillableMetric:     &models.BillableMetric{AggregationType: models.AggregationTypeCount},
+		}
+	}
+
+	t.Run("With events on charges", func(t *testing.T) {
+		service, store := setupUsageAggregationService([]string{"org_id"})
+
+		usages := service.AggregateUsage(context.Background(), []*models.EnrichedEvent{
+			buildEvent(utils.StringPtr("charge_a")),
+			buildEvent(nil),
+			buildEvent(utils.StringPtr("charge_b")),
+		})
+
+		require.Len(t, usages, 3)
+		require.NotNil(t, usages[0])
+		assert.Equal(t, big.NewRat(2, 1), usages[0].Previous.Units)
+		assert.Nil(t, usages[1])
+		assert.NotNil(t, usages[2])
+
+		require.Len(t, store.increments, 2)
+		assert.Equal(t, "usage/1/{sub_id}/charge_a/2025-03-01T00:00:00Z", store.increments[0].Key)
+		assert.Equal(t, "usage/1/{sub_id}/charge_b/2025-03-01T00:00:00Z", store.increments[1].Key)
+	})
+
+	t.Run("With all organizations", func(t *testing.T) {
+		service, store := setupUsageAggregationService([]string{ALL_ORGANIZATIONS})
+
+		service.AggregateUsage(context.Background(), []*models.EnrichedEvent{buildEvent(utils.StringPtr("charge_a"))})
+
+		assert.Len(t, store.increments, 1)
+	})
+
+	t.Run("With another organization", func(t *testing.T) {
+		service, store := setupUsageAggregationService([]string{"other_org_id"})
+
+		service.AggregateUsage(context.Background(), []*models.EnrichedEvent{buildEvent(utils.StringPtr("charge_a"))})
+
+		assert.Empty(t, store.increments)
+	})
+
+	t.Run("With a store error", func(t *testing.T) {
+		service, store := setupUsageAggregationService([]string{"org_id"})
+		store.returnedResult = utils.FailedResult[*models.UsageIncrementResult](errors.New("connection refused"))
+
+		usages := service.AggregateUsage(context.Background(), []*models.EnrichedEvent{
+			buildEvent(utils.StringPtr("charge_a")),
+			buildEvent(utils.StringPtr("charge_b")),
+		})
+
+		// Errors don't stop the aggregation of the other events
+		assert.Len(t, store.increments, 2)
+		assert.Equal(t, []*models.AggregatedUsage{nil, nil}, usages)
+	})
+}
@@ -0,0 +1,225 @@
+package events_processor
+
+import (
+	"context"
+	"log/slog"
+	"math/big"
+
+	"github.com/getlago/lago/events-processor/cache"
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+const (
+	thresholdTotalAmountCents = "amount_cents"
+	thresholdTotalUnits       = "units"
+)
+
+// UsageThresholdService tracks the usage amount of the subscriptions during their billing period,
+// and detects the usage thresholds and usage alert thresholds crossed by the aggregated events.
+// It relies on the memory cache for the thresholds and on the usage aggregation for the previous usage of the charges.
+// The events whose fee can't be estimated (eg: custom or graduated percentage charges) are missing from the amount,
+// they are counted by the unestimated fees metric.
+type UsageThresholdService struct {
+	memCache             *cache.Cache
+	feeEstimationService *FeeEstimationService
+	thresholdStore       models.ThresholdTracker
+	metrics              *ProcessorMetrics
+}
+
+func NewUsageThresholdService(memCache *cache.Cache, feeEstimationService *FeeEstimationService, thresholdStore models.ThresholdTracker, metrics *ProcessorMetrics) *UsageThresholdService {
+	return &UsageThresholdService{
+		memCache:             memCache,
+		feeEstimationService: feeEstimationService,
+		thresholdStore:       thresholdStore,
+		metrics:              metrics,
+	}
+}
+
+// TrackUsage adds the usage of the aggregated events of a subscription to its totals,
+// and returns the thresholds crossed for the first time in the billing period.
+// Usages are the ones returned by the usage aggregation for the same events.
+func (s *UsageThresholdService) TrackUsage(ctx context.Context, events []*models.EnrichedEvent, usages []*models.AggregatedUsage) []*models.UsageThresholdCrossedEvent {
+	var event *models.EnrichedEvent
+	increments := make(map[string]*big.Rat)
+
+	for i, ev := range events {
+		usage := usages[i]
+		if usage == nil || usage.Units == nil || usage.Units.Sign() <= 0 {
+			continue
+		}
+		if event == nil {
+			event = ev
+		}
+
+		// All the charges of a metric receive the same units, they are only counted once
+		unitsField := models.ThresholdTotalField(ev.BillableMetric.ID, thresholdTotalUnits)
+		if increments[unitsField] == nil {
+			increments[unitsField] = usage.Units
+		}
+
+		estimate := s.feeEstimationService.estimateFee(ev, &usage.Previous)
+		if estimate == nil {
+			s.metrics.RecordUnestimatedFee(ctx, ev)
+			continue
+		}
+
+		amountCents, ok := new(big.Rat).SetString(estimate.PreciseAmountCents)
+		if !ok || amountCents.Sign() <= 0 {
+			continue
+		}
+
+		addIncrement(increments, models.THRESHOLD_TOTAL_AMOUNT_CENTS, amountCents)
+		addIncrement(increments, models.ThresholdTotalField(ev.BillableMetric.ID, thresholdTotalAmountCents), amountCents)
+	}
+
+	if event == nil {
+		return nil
+	}
+
+	totalsKey := models.BuildThresholdTotalsKey(event)
+	expireAt := event.BillingPeriodEnd.Add(models.USAGE_RETENTION)
+
+	totalsResult := s.thresholdStore.IncrementTotals(ctx, totalsKey, expireAt, increments)
+	if totalsResult.Failure() {
+		logThresholdFailure(event, totalsResult)
+		return nil
+	}
+	totals := totalsResult.Value()
+
+	var crossedEvents []*models.UsageThresholdCrossedEvent
+	markCrossed := func(crossed models.CrossedThreshold) bool {
+		markResult := s.thresholdStore.MarkCrossed(ctx, models.BuildThresholdCrossedKey(totalsKey, crossed), expireAt)
+		if markResult.Failure() {
+			logThresholdFailure(event, markResult)
+			return false
+		}
+		return markResult.Value()
+	}
+
+	if total := totals[models.THRESHOLD_TOTAL_AMOUNT_CENTS]; total != nil {
+		previous := new(big.Rat).Sub(total, increments[models.THRESHOLD_TOTAL_AMOUNT_CENTS])
+
+		for _, crossed := range models.CrossedThresholds(s.usageThresholds(event), previous, total) {
+			if markCrossed(crossed) {
+				crossedEvents = append(crossedEvents, models.NewUsageThresholdCrossedEvent(event, models.ThresholdTypeUsageThreshold, crossed, total))
+			}
+		}
+	}
+
+	alertsResult := s.memCache.SearchUsageAlerts(event.OrganizationID, event.ExternalSubscriptionID)
+	if alertsResult.Failure() {
+		logThresholdFailure(event, alertsResult)
+		return crossedEvents
+	}
+
+	for _, alert := range alertsResult.Value() {
+		field, ok := alertTotalField(alert)
+		if !ok || totals[field] == nil {
+			continue
+		}
+
+		total := totals[field]
+		previous := new(big.Rat).Sub(total, increments[field])
+
+		for _, crossed := range models.CrossedThresholds(s.alertThresholds(event, alert), previous, total) {
+			if !markCrossed(crossed) {
+				continue
+			}
+
+			crossedEvent := models.NewUsageThresholdCrossedEvent(event, models.ThresholdTypeUsageAlert, crossed, total)
+			crossedEvent.AlertID = &alert.ID
+			crossedEvent.AlertType = &alert.AlertType
+			crossedEvent.AlertCode = alert.Code
+			crossedEvent.BillableMetricID = alert.BillableMetricID
+			crossedEvents = append(crossedEvents, crossedEvent)
+		}
+	}
+
+	return crossedEvents
+}
+
+// usageThresholds returns the thresholds of the subscription, or the ones of its plan when it has none
+func (s *UsageThresholdService) usageThresholds(event *models.EnrichedEvent) []models.Threshold {
+	thresholdsResult := s.memCache.SearchSubscriptionUsageThresholds(event.OrganizationID, event.SubscriptionID)
+	if thresholdsResult.Success() && len(thresholdsResult.Value()) == 0 {
+		thresholdsResult = s.memCache.SearchPlanUsageThresholds(event.OrganizationID, event.PlanID)
+	}
+
+	if thresholdsResult.Failure() {
+		logThresholdFailure(event, thresholdsResult)
+		return nil
+	}
+
+	thresholds := make([]models.Threshold, 0, len(thresholdsResult.Value()))
+	for _, ut := range thresholdsResult.Value() {
+		thresholds = append(thresholds, models.Threshold{
+			ID:        ut.ID,
+			Value:     big.NewRat(ut.AmountCents, 1),
+			Recurring: ut.Recurring,
+		})
+	}
+
+	return thresholds
+}
+
+func (s *UsageThresholdService) alertThresholds(event *models.EnrichedEvent, alert *models.UsageAlert) []models.Threshold {
+	thresholdsResult := s.memCache.SearchUsageAlertThresholds(event.OrganizationID, alert.ID)
+	if thresholdsResult.Failure() {
+		logThresholdFailure(event, thresholdsResult)
+		return nil
+	}
+
+	thresholds := make([]models.Threshold, 0, len(thresholdsResult.Value()))
+	for _, threshold := range thresholdsResult.Value() {
+		value, ok := new(big.Rat).SetString(threshold.Value)
+		if !ok {
+			continue
+		}
+
+		thresholds = append(thresholds, models.Threshold{
+			ID:        threshold.ID,
+			Value:     value,
+			Recurring: threshold.Recurring,
+		})
+	}
+
+	return thresholds
+}
+
+// alertTotalField returns the field of the subscription totals monitored by the alert
+func alertTotalField(alert *models.UsageAlert) (string, bool) {
+	switch alert.AlertType {
+	case models.UsageAlertTypeCurrentUsageAmount:
+		return models.THRESHOLD_TOTAL_AMOUNT_CENTS, true
+	case models.UsageAlertTypeBillableMetricCurrentUsageAmount, models.UsageAlertTypeBillableMetricCurrentUsageUnits:
+		if alert.BillableMetricID == nil {
+			return "", false
+		}
+
+		total := thresholdTotalAmountCents
+		if alert.AlertType == models.UsageAlertTypeBillableMetricCurrentUsageUnits {
+			total = thresholdTotalUnits
+		}
+		return models.ThresholdTotalField(*alert.BillableMetricID, total), true
+	}
+
+	return "", false
+}
+
+func addIncrement(increments map[string]*big.Rat, field string, value *big.Rat) {
+	if increments[field] == nil {
+		increments[field] = new(big.Rat)
+	}
+	increments[field].Add(increments[field], value)
+}
+
+func logThresholdFailure(event *models.EnrichedEvent, result utils.AnyResult) {
+	slog.Error(
+		"Error tracking usage thresholds",
+		slog.String("organization_id", event.OrganizationID),
+		slog.String("subscription_id", event.SubscriptionID),
+		slog.String("error", result.ErrorMsg()),
+	)
+	utils.CaptureErrorResult(result)
+}
@@ -0,0 +1,269 @@
+package events_processor
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/getlago/lago/events-processor/cache"
+	"github.com/getlago/lago/events-processor/models"
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+type mockThresholdStore struct {
+	totals  map[string]*big.Rat
+	crossed map[string]bool
+	err     error
+}
+
+func (m *mockThresholdStore) Close() error {
+	return nil
+}
+
+func (m *mockThresholdStore) IncrementTotals(ctx context.Context, key string, expireAt time.Time, increments map[string]*big.Rat) utils.Result[map[string]*big.Rat] {
+	if m.err != nil {
+		return utils.FailedResult[map[string]*big.Rat](m.err)
+	}
+
+	totals := make(map[string]*big.Rat, len(increments))
+	for field, increment := range increments {
+		if m.totals[field] == nil {
+			m.totals[field] = new(big.Rat)
+		}
+		m.totals[field] = new(big.Rat).Add(m.totals[field], increment)
+		totals[field] = m.totals[field]
+	}
+
+	return utils.SuccessResult(totals)
+}
+
+func (m *mockThresholdStore) MarkCrossed(ctx context.Context, key string, expireAt time.Time) utils.Result[bool] {
+	if m.crossed[key] {
+		return utils.SuccessResult(false)
+	}
+
+	m.crossed[key] = true
+	return utils.SuccessResult(true)
+}
+
+func setupUsageThresholdService(t *testing.T) (*UsageThresholdService, *CacheDataStore, *mockThresholdStore, func()) {
+	memCache, err := cache.NewCache(cache.CacheConfig{
+		Context: context.Background(),
+	})
+	require.NoError(t, err)
+
+	store := &mockThresholdStore{totals: map[string]*big.Rat{}, crossed: map[string]bool{}}
+	service := NewUsageThresholdService(memCache, NewFeeEstimationService(nil, memCache), store, NewDefaultProcessorMetrics())
+
+	return service, &CacheDataStore{cache: memCache, t: t}, store, func() { memCache.Close() }
+}
+
+func TestTrackUsage(t *testing.T) {
+	periodStart := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	periodEnd := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	totalsKey := "thresholds/1/{sub_id}/2025-03-01T00:00:00Z"
+
+	buildEvent := func() *models.EnrichedEvent {
+		return &models.EnrichedEvent{
+			OrganizationID:         "org_id",
+			SubscriptionID:         "sub_id",
+			ExternalSubscriptionID: "external_sub_id",
+			PlanID:                 "plan_id",
+			TransactionID:          "tr_1",
+			ChargeID:               utils.StringPtr("charge_id"),
+			BillingPeriodStart:     &periodStart,
+			BillingPeriodEnd:       &periodEnd,
+			BillableMetric:         &models.BillableMetric{ID: "bm_id", AggregationType: models.AggregationTypeCount},
+		}
+	}
+
+	aggregatedUsage := func(previousUnits int64) *models.AggregatedUsage {
+		return &models.AggregatedUsage{
+			Previous: models.ChargeUsage{Units: big.NewRat(previousUnits, 1), Events: previousUnits},
+			Units:    big.NewRat(1, 1),
+		}
+	}
+
+	setupCharge := func(dataStore *CacheDataStore) {
+		dataStore.SetCharge(&models.Charge{
+			ID:               "charge_id",
+			OrganizationID:   "org_id",
+			PlanID:           "plan_id",
+			BillableMetricID: "bm_id",
+			ChargeModel:      models.ChargeModelStandard,
+			Properties:       models.ChargeProperties{"amount": "1"},
+			UpdatedAt:        utils.NowNullTime(),
+		})
+	}
+
+	t.Run("With a plan usage threshold crossed", func(t *testing.T) {
+		service, dataStore, store, cleanup := setupUsageThresholdService(t)
+		defer cleanup()
+
+		setupCharge(dataStore)
+		dataStore.SetUsageThreshold(&models.UsageThreshold{
+			ID:             "ut_plan",
+			OrganizationID: "org_id",
+			PlanID:         utils.StringPtr("plan_id"),
+			AmountCents:    200,
+		})
+		store.totals[models.THRESHOLD_TOTAL_AMOUNT_CENTS] = big.NewRat(150, 1)
+
+		crossed := service.TrackUsage(context.Background(), []*models.EnrichedEvent{buildEvent()}, []*models.AggregatedUsage{aggregatedUsage(1)})
+
+		require.Len(t, crossed, 1)
+		assert.Equal(t, models.ThresholdTypeUsageThreshold, crossed[0].ThresholdType)
+		assert.Equal(t, "ut_plan", crossed[0].ThresholdID)
+		assert.Equal(t, "200", crossed[0].ThresholdValue)
+		assert.Equal(t, "250", crossed[0].CurrentValue)
+		assert.Equal(t, "external_sub_id", crossed[0].ExternalSubscriptionID)
+		assert.Equal(t, periodEnd, crossed[0].BillingPeriodEnd)
+		assert.Nil(t, crossed[0].AlertID)
+		assert.True(t, store.crossed[totalsKey+"/crossed/ut_plan/0"])
+
+		// A threshold is only crossed once per billing period
+		store.totals[models.THRESHOLD_TOTAL_AMOUNT_CENTS] = big.NewRat(150, 1)
+		assert.Empty(t, service.TrackUsage(context.Background(), []*models.EnrichedEvent{buildEvent()}, []*models.AggregatedUsage{aggregatedUsage(1)}))
+	})
+
+	t.Run("With subscription usage thresholds", func(t *testing.T) {
+		service, dataStore, store, cleanup := setupUsageThresholdService(t)
+		defer cleanup()
+
+		setupCharge(dataStore)
+		dataStore.SetUsageThreshold(&models.UsageThreshold{
+			ID:             "ut_plan",
+			OrganizationID: "org_id",
+			PlanID:         utils.StringPtr("plan_id"),
+			AmountCents:    100,
+		})
+		dataStore.SetUsageThreshold(&models.UsageThreshold{
+			ID:             "ut_sub",
+			OrganizationID: "org_id",
+			SubscriptionID: utils.StringPtr("sub_id"),
+			AmountCents:    50,
+			Recurring:      true,
+		})
+		store.totals[models.THRESHOLD_TOTAL_AMOUNT_CENTS] = big.NewRat(40, 1)
+
+		crossed := service.TrackUsage(context.Background(), []*models.EnrichedEvent{buildEvent()}, []*models.AggregatedUsage{aggregatedUsage(0)})
+
+		// The subscription thresholds override the plan ones
+		require.Len(t, crossed, 1)
+		assert.Equal(t, "ut_sub", crossed[0].ThresholdID)
+		assert.Equal(t, "100", crossed[0].ThresholdValue)
+		assert.Equal(t, int64(2), crossed[0].Occurrence)
+		assert.True(t, crossed[0].Recurring)
+	})
+
+	t.Run("With usage alerts", func(t *testing.T) {
+		service, dataStore, store, cleanup := setupUsageThresholdService(t)
+		defer cleanup()
+
+		setupCharge(dataStore)
+		for _, alert := range []*models.UsageAlert{
+			{ID: "alert_amount", AlertType: models.UsageAlertTypeCurrentUsageAmount},
+			{ID: "alert_bm_units", AlertType: models.UsageAlertTypeBillableMetricCurrentUsageUnits, BillableMetricID: utils.StringPtr("bm_id"), Code: utils.StringPtr("units")},
+			{ID: "alert_other_bm", AlertType: models.UsageAlertTypeBillableMetricCurrentUsageAmount, BillableMetricID: utils.StringPtr("other_bm_id")},
+		} {
+			alert.OrganizationID = "org_id"
+			alert.SubscriptionExternalID = "external_sub_id"
+			dataStore.SetUsageAlert(alert)
+
+			dataStore.SetUsageAlertThreshold(&models.UsageAlertThreshold{
+				ID:             "threshold_" + alert.ID,
+				OrganizationID: "org_id",
+				UsageAlertID:   alert.ID,
+				Value:          "2.0",
+			})
+		}
+		store.totals[models.ThresholdTotalField("bm_id", "units")] = big.NewRat(1, 1)
+
+		// Both charges of the metric receive the event, its units are counted once
+		otherChargeEvent := buildEvent()
+		otherChargeEvent.ChargeID = utils.StringPtr("other_charge_id")
+
+		crossed := service.TrackUsage(
+			context.Background(),
+			[]*models.EnrichedEvent{buildEvent(), otherChargeEvent},
+			[]*models.AggregatedUsage{aggregatedUsage(1), aggregatedUsage(1)},
+		)
+
+		require.Len(t, crossed, 2)
+		byAlert := map[string]*models.UsageThresholdCrossedEvent{}
+		for _, crossedEvent := range crossed {
+			require.NotNil(t, crossedEvent.AlertID)
+			byAlert[*crossedEvent.AlertID] = crossedEvent
+		}
+
+		assert.Equal(t, "100", byAlert["alert_amount"].CurrentValue)
+		assert.Equal(t, models.ThresholdTypeUsageAlert, byAlert["alert_amount"].ThresholdType)
+		assert.Equal(t, "2", byAlert["alert_bm_units"].CurrentValue)
+		assert.Equal(t, "units", *byAlert["alert_bm_units"].AlertCode)
+		assert.Equal(t, "bm_id", *byAlert["alert_bm_units"].BillableMetricID)
+		assert.Equal(t, models.UsageAlertTypeBillableMetricCurrentUsageUnits, *byAlert["alert_bm_units"].AlertType)
+	})
+
+	t.Run("Without aggregated usage", func(t *testing.T) {
+		service, _, store, cleanup := setupUsageThresholdService(t)
+		defer cleanup()
+
+		withoutUnits := &models.AggregatedUsage{Units: new(big.Rat)}
+		assert.Empty(t, service.TrackUsage(context.Background(), []*models.EnrichedEvent{buildEvent(), buildEvent()}, []*models.AggregatedUsage{nil, withoutUnits}))
+		assert.Empty(t, store.totals)
+	})
+
+	t.Run("With a charge whose fee can't be estimated", func(t *testing.T) {
+		service, dataStore, store, cleanup := setupUsageThresholdService(t)
+		defer cleanup()
+
+		reader := sdkmetric.NewManualReader()
+		service.metrics = NewProcessorMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter(METER_NAME))
+
+		dataStore.SetCharge(&models.Charge{
+			ID:               "charge_id",
+			OrganizationID:   "org_id",
+			PlanID:           "plan_id",
+			BillableMetricID: "bm_id",
+			ChargeModel:      models.ChargeModelCustom,
+			UpdatedAt:        utils.NowNullTime(),
+		})
+
+		assert.Empty(t, service.TrackUsage(context.Background(), []*models.EnrichedEvent{buildEvent()}, []*models.AggregatedUsage{aggregatedUsage(0)}))
+
+		// The units are tracked, the missing amount is counted
+		assert.Equal(t, big.NewRat(1, 1), store.totals[models.ThresholdTotalField("bm_id", "units")])
+		assert.Nil(t, store.totals[models.THRESHOLD_TOTAL_AMOUNT_CENTS])
+
+		var rm metricdata.ResourceMetrics
+		require.NoError(t, reader.Collect(context.Background(), &rm))
+		require.Len(t, rm.ScopeMetrics, 1)
+		assert.Equal(t, "lago.events_processor.unestimated_fees", rm.ScopeMetrics[0].Metrics[0].Name)
+		points := rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Sum[int64]).DataPoints
+		require.Len(t, points, 1)
+		assert.Equal(t, int64(1), points[0].Value)
+	})
+
+	t.Run("With a store error", func(t *testing.T) {
+		service, dataStore, store, cleanup := setupUsageThresholdService(t)
+		defer cleanup()
+
+		setupCharge(dataStore)
+		dataStore.SetUsageThreshold(&models.UsageThreshold{
+			ID:             "ut_plan",
+			OrganizationID: "org_id",
+			PlanID:         utils.StringPtr("plan_id"),
+			AmountCents:    1,
+		})
+		store.err = errors.New("connection refused")
+
+		assert.Empty(t, service.TrackUsage(context.Background(), []*models.EnrichedEvent{buildEvent()}, []*models.AggregatedUsage{aggregatedUsage(0)}))
+	})
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/twmb/franz-go/pkg/kgo"
 
@@ -15,6 +17,7 @@ import (
 	"github.com/getlago/lago/events-processor/config/tracing"
 	"github.com/getlago/lago/events-processor/models"
 	"github.com/getlago/lago/events-processor/processors/events_processor"
+	"github.com/getlago/lago/events-processor/server"
 	"github.com/getlago/lago/events-processor/utils"
 )
 
@@ -27,18 +30,42 @@ var (
 
 const (
 	envEnv                                       = "ENV"
+	envLagoEventsProcessorBatchTimeoutSeconds    = "LAGO_EVENTS_PROCESSOR_BATCH_TIMEOUT_SECONDS"
+	envLagoEventsProcessorConcurrency            = "LAGO_EVENTS_PROCESSOR_CONCURRENCY"
 	envLagoEventsProcessorDatabaseMaxConnections = "LAGO_EVENTS_PROCESSOR_DATABASE_MAX_CONNECTIONS"
+	envLagoEventsProcessorEventTimeoutSeconds    = "LAGO_EVENTS_PROCESSOR_EVENT_TIMEOUT_SECONDS"
+	envLagoEventsProcessorHTTPAddress            = "LAGO_EVENTS_PROCESSOR_HTTP_ADDRESS"
+	envLagoEventsProcessorHTTPAuthToken          = "LAGO_EVENTS_PROCESSOR_HTTP_AUTH_TOKEN"
+	envLagoEventsProcessorLanes                  = "LAGO_EVENTS_PROCESSOR_LANES"
+	envLagoEventsProcessorPanicThreshold         = "LAGO_EVENTS_PROCESSOR_PANIC_THRESHOLD"
+	envLagoEventsProcessorPanicWindowSeconds     = "LAGO_EVENTS_PROCESSOR_PANIC_WINDOW_SECONDS"
+	envLagoEventsProcessorStuckBatchSeconds      = "LAGO_EVENTS_PROCESSOR_STUCK_BATCH_SECONDS"
+	envLagoEventsProcessorTargetBatchLatencyMs   = "LAGO_EVENTS_PROCESSOR_TARGET_BATCH_LATENCY_MS"
+	envLagoEventsRateLimitPolicies               = "LAGO_EVENTS_RATE_LIMIT_POLICIES"
+	envLagoEventsTimestampPolicies               = "LAGO_EVENTS_TIMESTAMP_POLICIES"
+	envLagoExpandedInAdvanceOrganizationIDs      = "LAGO_EXPANDED_CHARGED_IN_ADVANCE_ORGANIZATION_IDS"
+	envLagoExplainFilterMatchOrganizationIDs     = "LAGO_EXPLAIN_FILTER_MATCH_ORGANIZATION_IDS"
 	envLagoKafkaBootstrapServers                 = "LAGO_KAFKA_BOOTSTRAP_SERVERS"
 	envLagoKafkaConsumerGroup                    = "LAGO_KAFKA_CONSUMER_GROUP"
 	envLagoKafkaEnrichedEventsExpandedTopic      = "LAGO_KAFKA_ENRICHED_EVENTS_EXPANDED_TOPIC"
 	envLagoKafkaEnrichedEventsTopic              = "LAGO_KAFKA_ENRICHED_EVENTS_TOPIC"
 	envLagoKafkaEventsChargedInAdvanceTopic      = "LAGO_KAFKA_EVENTS_CHARGED_IN_ADVANCE_TOPIC"
 	envLagoKafkaEventsDeadLetterTopic            = "LAGO_KAFKA_EVENTS_DEAD_LETTER_TOPIC"
+	envLagoKafkaFetchErrorTimeoutSeconds         = "LAGO_KAFKA_FETCH_ERROR_TIMEOUT_SECONDS"
+	envLagoKafkaHoldEventsTopic                  = "LAGO_KAFKA_HOLD_EVENTS_TOPIC"
+	envLagoKafkaLateEventsTopic                  = "LAGO_KAFKA_LATE_EVENTS_TOPIC"
+	envLagoKafkaMaxPollRecords                   = "LAGO_KAFKA_MAX_POLL_RECORDS"
+	envLagoKafkaPartitionQueueSize               = "LAGO_KAFKA_PARTITION_QUEUE_SIZE"
+	envLagoKafkaUnbilledEventsTopic              = "LAGO_KAFKA_UNBILLED_EVENTS_TOPIC"
 	envLagoKafkaPassword                         = "LAGO_KAFKA_PASSWORD"
+	envLagoKafkaRateLimitedEventsTopic           = "LAGO_KAFKA_RATE_LIMITED_EVENTS_TOPIC"
 	envLagoKafkaRawEventsTopic                   = "LAGO_KAFKA_RAW_EVENTS_TOPIC"
 	envLagoKafkaScramAlgorithm                   = "LAGO_KAFKA_SCRAM_ALGORITHM"
 	envLagoKafkaTLS                              = "LAGO_KAFKA_TLS"
+	envLagoKafkaUsageThresholdsTopic             = "LAGO_KAFKA_USAGE_THRESHOLDS_TOPIC"
 	envLagoKafkaUsername                         = "LAGO_KAFKA_USERNAME"
+	envLagoKafkaWalletDebitIntentsTopic          = "LAGO_KAFKA_WALLET_DEBIT_INTENTS_TOPIC"
+	envLagoPricingGroupCardinalityPolicies       = "LAGO_PRICING_GROUP_CARDINALITY_POLICIES"
 	envLagoRedisCacheDB                          = "LAGO_REDIS_CACHE_DB"
 	envLagoRedisCachePassword                    = "LAGO_REDIS_CACHE_PASSWORD"
 	envLagoRedisCacheURL                         = "LAGO_REDIS_CACHE_URL"
@@ -47,11 +74,14 @@ const (
 	envLagoRedisStorePassword                    = "LAGO_REDIS_STORE_PASSWORD"
 	envLagoRedisStoreURL                         = "LAGO_REDIS_STORE_URL"
 	envLagoRedisStoreTLS                         = "LAGO_REDIS_STORE_TLS"
+	envLagoUsageAggregationOrganizationIDs       = "LAGO_USAGE_AGGREGATION_ORGANIZATION_IDS"
 )
 
 type Config struct {
 	TracerProvider tracing.TracerProvider
 	Cache          *cache.Cache
+	// Optional, restricts the instance to a subset of the organizations
+	OrganizationSelector *models.OrganizationSelector
 }
 
 func initProducer(ctx context.Context, topicEnv string) (*kafka.Producer, error) {
@@ -78,6 +108,17 @@ func initProducer(ctx context.Context, topicEnv string) (*kafka.Producer, error)
 }
 
 func initFlagStore(ctx context.Context, name string) (*models.FlagStore, error) {
+	db, err := initRedisStoreDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.NewFlagStore(db, name), nil
+}
+
+// initRedisStoreDB connects to the Redis store database,
+// holding the subscriptions to refresh, the frozen organizations and the rate limit policies
+func initRedisStoreDB(ctx context.Context) (*redis.RedisDB, error) {
 	redisDb, err := utils.GetEnvAsInt(envLagoRedisStoreDB, 0)
 	if err != nil {
 		return nil, err
@@ -93,12 +134,7 @@ func initFlagStore(ctx context.Context, name string) (*models.FlagStore, error)
 		UseTLS:   utils.GetEnvAsBool(envLagoRedisStoreTLS, legacyTLS),
 	}
 
-	db, err := redis.NewRedisDB(ctx, redisConfig)
-	if err != nil {
-		return nil, err
-	}
-
-	return models.NewFlagStore(ctx, db, name), nil
+	return redis.NewRedisDB(ctx, redisConfig)
 }
 
 func initChargeCacheStore(ctx context.Context) (*models.ChargeCache, error) {
@@ -119,13 +155,31 @@ func initChargeCacheStore(ctx context.Context) (*models.ChargeCache, error) {
 		return nil, err
 	}
 
-	cacheStore := models.NewCacheStore(ctx, db)
+	cacheStore := models.NewCacheStore(db)
 	var store models.Cacher = cacheStore
 	chargeStore := models.NewChargeCache(&store)
 
 	return chargeStore, nil
 }
 
+// initRedisCacheDB connects to the Redis cache database,
+// holding the usage aggregates, the usage thresholds totals and the pricing groups
+func initRedisCacheDB(ctx context.Context) (*redis.RedisDB, error) {
+	redisDb, err := utils.GetEnvAsInt(envLagoRedisCacheDB, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	redisConfig := redis.RedisConfig{
+		Address:  os.Getenv(envLagoRedisCacheURL),
+		Password: os.Getenv(envLagoRedisCachePassword),
+		DB:       redisDb,
+		UseTLS:   utils.GetEnvAsBool(envLagoRedisCacheTLS, false),
+	}
+
+	return redis.NewRedisDB(ctx, redisConfig)
+}
+
 func StartProcessingEvents(ctx context.Context, config *Config) {
 	serverBrokers := utils.ParseBrokersEnv(os.Getenv(envLagoKafkaBootstrapServers))
 	if len(serverBrokers) == 0 {
@@ -162,6 +216,139 @@ func StartProcessingEvents(ctx context.Context, config *Config) {
 		utils.LogAndPanic(err, "failed to initialize events dead letter queue producer")
 	}
 
+	timestampPolicies, err := models.ParseTimestampPolicies(os.Getenv(envLagoEventsTimestampPolicies))
+	if err != nil {
+		utils.LogAndPanic(err, "Error parsing the events timestamp policies")
+	}
+
+	cardinalityPolicies, err := models.ParseCardinalityPolicies(os.Getenv(envLagoPricingGroupCardinalityPolicies))
+	if err != nil {
+		utils.LogAndPanic(err, "Error parsing the pricing group cardinality policies")
+	}
+
+	lanes, err := models.ParseLanes(os.Getenv(envLagoEventsProcessorLanes))
+	if err != nil {
+		utils.LogAndPanic(err, "Error parsing the lanes")
+	}
+	for _, lane := range lanes {
+		if lane.Topic == os.Getenv(envLagoKafkaRawEventsTopic) {
+			utils.LogAndPanic(fmt.Errorf("lane %s consumes the raw events topic", lane.Name), "Error parsing the lanes")
+		}
+	}
+
+	rateLimitPolicies, err := models.ParseRateLimitPolicies(os.Getenv(envLagoEventsRateLimitPolicies))
+	if err != nil {
+		utils.LogAndPanic(err, "Error parsing the events rate limit policies")
+	}
+
+	concurrency, err := utils.GetEnvAsInt(envLagoEventsProcessorConcurrency, 0)
+	if err != nil {
+		utils.LogAndPanic(err, "Error converting concurrency into integer")
+	}
+
+	panicThreshold, err := utils.GetEnvAsInt(envLagoEventsProcessorPanicThreshold, 10)
+	if err != nil {
+		utils.LogAndPanic(err, "Error converting panic threshold into integer")
+	}
+
+	panicWindowSeconds, err := utils.GetEnvAsInt(envLagoEventsProcessorPanicWindowSeconds, 60)
+	if err != nil {
+		utils.LogAndPanic(err, "Error converting panic window into integer")
+	}
+
+	fetchErrorTimeoutSeconds, err := utils.GetEnvAsInt(envLagoKafkaFetchErrorTimeoutSeconds, 300)
+	if err != nil {
+		utils.LogAndPanic(err, "Error converting fetch error timeout into integer")
+	}
+
+	maxPollRecords, err := utils.GetEnvAsInt(envLagoKafkaMaxPollRecords, kafka.DEFAULT_MAX_POLL_RECORDS)
+	if err != nil {
+		utils.LogAndPanic(err, "Error converting max poll records into integer")
+	}
+
+	partitionQueueSize, err := utils.GetEnvAsInt(envLagoKafkaPartitionQueueSize, kafka.DEFAULT_PARTITION_QUEUE_SIZE)
+	if err != nil {
+		utils.LogAndPanic(err, "Error converting partition queue size into integer")
+	}
+
+	targetBatchLatencyMs, err := utils.GetEnvAsInt(envLagoEventsProcessorTargetBatchLatencyMs, int(kafka.DEFAULT_TARGET_BATCH_LATENCY.Milliseconds()))
+	if err != nil {
+		utils.LogAndPanic(err, "Error converting target batch latency into integer")
+	}
+
+	batchTimeoutSeconds, err := utils.GetEnvAsInt(envLagoEventsProcessorBatchTimeoutSeconds, 60)
+	if err != nil {
+		utils.LogAndPanic(err, "Error converting batch timeout into integer")
+	}
+
+	eventTimeoutSeconds, err := utils.GetEnvAsInt(envLagoEventsProcessorEventTimeoutSeconds, 10)
+	if err != nil {
+		utils.LogAndPanic(err, "Error converting event timeout into integer")
+	}
+
+	stuckBatchSeconds, err := utils.GetEnvAsInt(envLagoEventsProcessorStuckBatchSeconds, 120)
+	if err != nil {
+		utils.LogAndPanic(err, "Error converting stuck batch threshold into integer")
+	}
+
+	var lateEventsProducer *kafka.Producer
+	if os.Getenv(envLagoKafkaLateEventsTopic) != "" {
+		lateEventsProducer, err = initProducer(ctx, envLagoKafkaLateEventsTopic)
+		if err != nil {
+			utils.LogAndPanic(err, "failed to initialize late events producer")
+		}
+	} else {
+		for organizationID, policy := range timestampPolicies {
+			if policy.Routes() {
+				utils.LogAndPanic(
+					fmt.Errorf("%s variable is required", envLagoKafkaLateEventsTopic),
+					fmt.Sprintf("timestamp policy of organization %s routes events to the late events topic", organizationID),
+				)
+			}
+		}
+	}
+
+	var unbilledEventsProducer *kafka.Producer
+	if os.Getenv(envLagoKafkaUnbilledEventsTopic) != "" {
+		unbilledEventsProducer, err = initProducer(ctx, envLagoKafkaUnbilledEventsTopic)
+		if err != nil {
+			utils.LogAndPanic(err, "failed to initialize unbilled events producer")
+		}
+	}
+
+	var rateLimitedEventsProducer *kafka.Producer
+	if os.Getenv(envLagoKafkaRateLimitedEventsTopic) != "" {
+		rateLimitedEventsProducer, err = initProducer(ctx, envLagoKafkaRateLimitedEventsTopic)
+		if err != nil {
+			utils.LogAndPanic(err, "failed to initialize rate limited events producer")
+		}
+	} else {
+		for organizationID, policy := range rateLimitPolicies {
+			if policy.Action == models.RateLimitOverflow {
+				utils.LogAndPanic(
+					fmt.Errorf("%s variable is required", envLagoKafkaRateLimitedEventsTopic),
+					fmt.Sprintf("rate limit policy of organization %s overflows events to the rate limited events topic", organizationID),
+				)
+			}
+		}
+	}
+
+	var holdEventsProducer *kafka.Producer
+	if os.Getenv(envLagoKafkaHoldEventsTopic) != "" {
+		holdEventsProducer, err = initProducer(ctx, envLagoKafkaHoldEventsTopic)
+		if err != nil {
+			utils.LogAndPanic(err, "failed to initialize hold events producer")
+		}
+	}
+
+	var walletDebitIntentsProducer *kafka.Producer
+	if os.Getenv(envLagoKafkaWalletDebitIntentsTopic) != "" {
+		walletDebitIntentsProducer, err = initProducer(ctx, envLagoKafkaWalletDebitIntentsTopic)
+		if err != nil {
+			utils.LogAndPanic(err, "failed to initialize wallet debit intents producer")
+		}
+	}
+
 	if config.Cache == nil {
 		maxConns, err := utils.GetEnvAsInt(envLagoEventsProcessorDatabaseMaxConnections, 200)
 		if err != nil {
@@ -194,32 +381,254 @@ func StartProcessingEvents(ctx context.Context, config *Config) {
 	chargeCacheStore = cacher
 	defer chargeCacheStore.CacheStore.Close()
 
+	enrichmentService := events_processor.NewEventEnrichmentService(apiStore, config.Cache)
+	enrichmentService.SetExplainOrganizations(utils.GetEnvAsList(envLagoExplainFilterMatchOrganizationIDs))
+	enrichmentService.SetTimestampPolicies(timestampPolicies)
+
+	producerService := events_processor.NewEventProducerService(
+		eventsEnrichedProducer,
+		eventsEnrichedExpandedProducer,
+		eventsInAdvanceProducer,
+		eventsDeadLetterQueue,
+	)
+	if lateEventsProducer != nil {
+		producerService.SetLateEventsProducer(lateEventsProducer)
+	}
+	if unbilledEventsProducer != nil {
+		producerService.SetUnbilledEventsProducer(unbilledEventsProducer)
+	}
+	if walletDebitIntentsProducer != nil {
+		producerService.SetWalletDebitIntentsProducer(walletDebitIntentsProducer)
+	}
+	if rateLimitedEventsProducer != nil {
+		producerService.SetRateLimitedEventsProducer(rateLimitedEventsProducer)
+	}
+	if holdEventsProducer != nil {
+		producerService.SetHoldProducer(holdEventsProducer)
+	}
+
 	processor = events_processor.NewEventProcessor(
-		events_processor.NewEventEnrichmentService(apiStore, config.Cache),
-		events_processor.NewEventProducerService(
-			eventsEnrichedProducer,
-			eventsEnrichedExpandedProducer,
-			eventsInAdvanceProducer,
-			eventsDeadLetterQueue,
-		),
+		enrichmentService,
+		producerService,
 		events_processor.NewSubscriptionRefreshService(flagger),
 		events_processor.NewCacheService(chargeCacheStore),
 	)
+	processor.SetExpandedInAdvanceOrganizations(utils.GetEnvAsList(envLagoExpandedInAdvanceOrganizationIDs))
+	processor.FeeEstimationService = events_processor.NewFeeEstimationService(apiStore, config.Cache)
+	processor.SetConcurrency(concurrency)
+	processor.SetEventTimeout(time.Duration(eventTimeoutSeconds) * time.Second)
+	processor.SetLanes(lanes)
+	processor.SetOrganizationSelector(config.OrganizationSelector)
+
+	// Always enabled so the policies can be set at runtime with the HTTP API
+	rateLimitDB, err := initRedisStoreDB(ctx)
+	if err != nil {
+		utils.LogAndPanic(err, "Error connecting to the rate limit policies store")
+	}
+	rateLimitPolicyStore := models.NewRateLimitPolicyStore(rateLimitDB)
+	defer rateLimitPolicyStore.Close()
+	processor.RateLimitService = events_processor.NewRateLimitService(rateLimitPolicies, rateLimitPolicyStore, processor.Metrics)
 
-	cg, err := kafka.NewConsumerGroup(
-		kafkaConfig,
-		&kafka.ConsumerGroupConfig{
-			Topic:         os.Getenv(envLagoKafkaRawEventsTopic),
-			ConsumerGroup: os.Getenv(envLagoKafkaConsumerGroup),
-			ProcessRecords: func(ctx context.Context, records []*kgo.Record) []*kgo.Record {
-				return processor.ProcessEvents(ctx, records)
-			},
-		})
+	if len(cardinalityPolicies) > 0 {
+		cardinalityDB, err := initRedisCacheDB(ctx)
+		if err != nil {
+			utils.LogAndPanic(err, "Error connecting to the pricing groups cardinality store")
+		}
+		cardinalityStore := models.NewCardinalityStore(cardinalityDB)
+		defer cardinalityStore.Close()
+
+		processor.CardinalityGuardService = events_processor.NewCardinalityGuardService(cardinalityStore, cardinalityPolicies, processor.Metrics)
+	}
+
+	if usageOrganizationIDs := utils.GetEnvAsList(envLagoUsageAggregationOrganizationIDs); len(usageOrganizationIDs) > 0 {
+		usageDB, err := initRedisCacheDB(ctx)
+		if err != nil {
+			utils.LogAndPanic(err, "Error connecting to the usage cache store")
+		}
+		usageCache := models.NewUsageCache(models.NewUsageStore(usageDB))
+		defer usageCache.UsageStore.Close()
+
+		processor.UsageAggregationService = events_processor.NewUsageAggregationService(usageCache, usageOrganizationIDs)
+
+		// Thresholds are read from the memory cache and rely on the aggregated usage
+		if os.Getenv(envLagoKafkaUsageThresholdsTopic) != "" {
+			if config.Cache == nil {
+				utils.LogAndPanic(
+					fmt.Errorf("memory cache is required"),
+					fmt.Sprintf("%s is set but the memory cache is disabled", envLagoKafkaUsageThresholdsTopic),
+				)
+			}
+
+			usageThresholdsProducer, err := initProducer(ctx, envLagoKafkaUsageThresholdsTopic)
+			if err != nil {
+				utils.LogAndPanic(err, "failed to initialize usage thresholds producer")
+			}
+			producerService.SetUsageThresholdsProducer(usageThresholdsProducer)
+
+			processor.UsageThresholdService = events_processor.NewUsageThresholdService(
+				config.Cache,
+				processor.FeeEstimationService,
+				models.NewThresholdStore(usageDB),
+				processor.Metrics,
+			)
+		}
+	} else if os.Getenv(envLagoKafkaUsageThresholdsTopic) != "" {
+		slog.Warn(
+			"Usage thresholds are disabled, they require the usage aggregation",
+			slog.String("variable", envLagoUsageAggregationOrganizationIDs),
+		)
+	}
+
+	newConsumerGroup := func(topic string, processRecords func(context.Context, []*kgo.Record) []*kgo.Record) (*kafka.ConsumerGroup, error) {
+		return kafka.NewConsumerGroup(
+			kafkaConfig,
+			&kafka.ConsumerGroupConfig{
+				Topic:               topic,
+				ConsumerGroup:       os.Getenv(envLagoKafkaConsumerGroup),
+				ProcessRecords:      processRecords,
+				SkipRecord:          processor.SkipRecord,
+				FetchErrorTimeout:   time.Duration(fetchErrorTimeoutSeconds) * time.Second,
+				MaxPollRecords:      maxPollRecords,
+				PartitionQueueSize:  partitionQueueSize,
+				TargetBatchLatency:  time.Duration(targetBatchLatencyMs) * time.Millisecond,
+				BatchTimeout:        time.Duration(batchTimeoutSeconds) * time.Second,
+				StuckBatchThreshold: time.Duration(stuckBatchSeconds) * time.Second,
+			})
+	}
+
+	cg, err := newConsumerGroup(os.Getenv(envLagoKafkaRawEventsTopic), processor.ProcessEvents)
 	if err != nil {
 		utils.LogAndPanic(err, "Error starting the event consumer")
 	}
 
-	slog.Info("Starting event consumer")
+	// Lanes with their own topic are consumed by independent consumer groups
+	consumerGroups := map[string]*kafka.ConsumerGroup{os.Getenv(envLagoKafkaRawEventsTopic): cg}
+	healthService := events_processor.NewHealthService(cg)
+	consumerAdminService := events_processor.NewConsumerAdminService(cg)
+	laneConsumerGroups := make([]*kafka.ConsumerGroup, 0)
+	for _, lane := range lanes {
+		if lane.Topic == "" {
+			continue
+		}
+
+		laneCG, err := newConsumerGroup(lane.Topic, func(ctx context.Context, records []*kgo.Record) []*kgo.Record {
+			return processor.ProcessLaneEvents(ctx, lane.Name, records)
+		})
+		if err != nil {
+			utils.LogAndPanic(err, fmt.Sprintf("Error starting the %s lane consumer", lane.Name))
+		}
+
+		consumerGroups[lane.Topic] = laneCG
+		laneConsumerGroups = append(laneConsumerGroups, laneCG)
+		healthService.AddLane(lane.Name, laneCG)
+		consumerAdminService.AddLane(lane.Name, laneCG)
+	}
+
+	if panicThreshold > 0 {
+		processor.PanicCircuitBreaker = events_processor.NewPanicCircuitBreaker(
+			panicThreshold,
+			time.Duration(panicWindowSeconds)*time.Second,
+			func(topic string, partition int32) error {
+				topicCG, found := consumerGroups[topic]
+				if !found {
+					return fmt.Errorf("no consumer group for topic %s", topic)
+				}
+				return topicCG.StopPartition(topic, partition)
+			},
+		)
+	}
+
+	if holdEventsProducer != nil {
+		freezeDB, err := initRedisStoreDB(ctx)
+		if err != nil {
+			utils.LogAndPanic(err, "Error connecting to the freeze store")
+		}
+		freezeStore := models.NewFreezeStore(freezeDB)
+		defer freezeStore.Close()
+
+		processor.FreezeService = events_processor.NewFreezeService(freezeStore)
+
+		holdTopic := os.Getenv(envLagoKafkaHoldEventsTopic)
+		holdClient, err := kafka.NewKafkaClient(kafkaConfig, []kgo.Opt{
+			kgo.ConsumerGroup(fmt.Sprintf("%s_%s", os.Getenv(envLagoKafkaConsumerGroup), holdTopic)),
+			kgo.ConsumeTopics(holdTopic),
+			kgo.DisableAutoCommit(),
+			kgo.BlockRebalanceOnPoll(),
+		})
+		if err != nil {
+			utils.LogAndPanic(err, "Error starting the hold events consumer")
+		}
+
+		go events_processor.NewHoldService(holdClient, holdTopic, processor, processor.FreezeService).Start(ctx)
+	}
+
+	if address := os.Getenv(envLagoEventsProcessorHTTPAddress); address != "" {
+		httpServer := server.NewServer(server.ServerConfig{
+			Address:   address,
+			AuthToken: os.Getenv(envLagoEventsProcessorHTTPAuthToken),
+		})
+		httpServer.HandlePublic("GET /health", healthService)
+		if os.Getenv(envLagoEventsProcessorHTTPAuthToken) != "" {
+			dryRunService := events_processor.NewDryRunService(enrichmentService)
+			dryRunService.SetExpandedInAdvanceOrganizations(utils.GetEnvAsList(envLagoExpandedInAdvanceOrganizationIDs))
+			httpServer.Handle("POST /dry_run/enrich", dryRunService)
+		} else {
+			slog.Warn(
+				"The dry run API is disabled, it requires an HTTP auth token",
+				slog.String("variable", envLagoEventsProcessorHTTPAuthToken),
+			)
+		}
+		if os.Getenv(envLagoEventsProcessorHTTPAuthToken) != "" {
+			httpServer.Handle("GET /rate_limits", processor.RateLimitService)
+			httpServer.Handle("PUT /rate_limits/{organization_id}", processor.RateLimitService)
+			httpServer.Handle("DELETE /rate_limits/{organization_id}", processor.RateLimitService)
+		} else {
+			slog.Warn(
+				"The rate limits API is disabled, it requires an HTTP auth token",
+				slog.String("variable", envLagoEventsProcessorHTTPAuthToken),
+			)
+		}
+		if processor.FreezeService != nil {
+			if os.Getenv(envLagoEventsProcessorHTTPAuthToken) != "" {
+				httpServer.Handle("GET /frozen_organizations", processor.FreezeService)
+				httpServer.Handle("PUT /frozen_organizations/{organization_id}", processor.FreezeService)
+				httpServer.Handle("DELETE /frozen_organizations/{organization_id}", processor.FreezeService)
+			} else {
+				slog.Warn(
+					"The frozen organizations API is disabled, it requires an HTTP auth token",
+					slog.String("variable", envLagoEventsProcessorHTTPAuthToken),
+				)
+			}
+		}
+		if os.Getenv(envLagoEventsProcessorHTTPAuthToken) != "" {
+			httpServer.Handle("GET /consumer_groups/{consumer_group}/partitions", consumerAdminService)
+			httpServer.Handle("POST /consumer_groups/{consumer_group}/partitions/{partition}/{action}", consumerAdminService)
+		} else {
+			slog.Warn(
+				"The consumer group admin API is disabled, it requires an HTTP auth token",
+				slog.String("variable", envLagoEventsProcessorHTTPAuthToken),
+			)
+		}
+
+		go httpServer.Start(ctx)
+	}
+
+	var laneConsumers sync.WaitGroup
+	for _, laneCG := range laneConsumerGroups {
+		laneConsumers.Go(func() {
+			laneCG.Start(ctx)
+			if err := laneCG.Err(); err != nil {
+				utils.LogAndPanic(err, "Lane consumer stopped on an unrecoverable fetch error")
+			}
+		})
+	}
+
+	slog.Info("Starting event consumer", slog.Int("lane_consumers", len(laneConsumerGroups)))
 	cg.Start(ctx)
+	if err := cg.Err(); err != nil {
+		utils.LogAndPanic(err, "Event consumer stopped on an unrecoverable fetch error")
+	}
+
+	laneConsumers.Wait()
 	slog.Info("Event processor stopped")
 }
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/getlago/lago/events-processor/utils"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+type ServerConfig struct {
+	// Address to listen on (eg: `:8080`)
+	Address string
+
+	// When set, every request must be authenticated with an `Authorization: Bearer <token>` header
+	AuthToken string
+}
+
+// Server exposes the internal HTTP endpoints of the events processor
+type Server struct {
+	config ServerConfig
+	mux    *http.ServeMux
+	logger *slog.Logger
+}
+
+type ErrorResponse struct {
+	Error     string `json:"error"`
+	ErrorCode string `json:"error_code,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+func NewServer(config ServerConfig) *Server {
+	return &Server{
+		config: config,
+		mux:    http.NewServeMux(),
+		logger: slog.Default().With("component", "http-server"),
+	}
+}
+
+// Handle registers an authenticated handler for the given pattern
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, s.authenticate(handler))
+}
+
+// HandlePublic registers a handler served without authentication, for the endpoints polled by the orchestrators
+func (s *Server) HandlePublic(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// HandleFunc registers an authenticated handler function for the given pattern
+func (s *Server) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	s.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// Handler returns the root handler of the server
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Start serves requests until the context is canceled
+func (s *Server) Start(ctx context.Context) {
+	httpServer := &http.Server{
+		Addr:              s.config.Address,
+		Handler:           s.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			s.logger.Error("Error shutting down HTTP server", slog.String("error", err.Error()))
+		}
+	}()
+
+	s.logger.Info("Starting HTTP server", slog.String("address", s.config.Address))
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.logger.Error("HTTP server error", slog.String("error", err.Error()))
+		utils.CaptureError(err)
+	}
+	s.logger.Info("HTTP server stopped")
+}
+
+func (s *Server) authenticate(handler http.Handler) http.Handler {
+	if s.config.AuthToken == "" {
+		return handler
+	}
+
+	expected := []byte(s.config.AuthToken)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), expected) != 1 {
+			WriteError(w, http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// WriteJSON writes the value as a JSON response with the given status
+func WriteJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		slog.Error("Error encoding HTTP response", slog.String("error", err.Error()))
+	}
+}
+
+// WriteError writes an error as a JSON response with the given status
+func WriteError(w http.ResponseWriter, status int, response ErrorResponse) {
+	WriteJSON(w, status, response)
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerAuthentication(t *testing.T) {
+	okHandler := func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+
+	t.Run("Without auth token", func(t *testing.T) {
+		server := NewServer(ServerConfig{})
+		server.HandleFunc("GET /status", okHandler)
+
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"status":"ok"}`, rec.Body.String())
+	})
+
+	t.Run("With auth token", func(t *testing.T) {
+		server := NewServer(ServerConfig{AuthToken: "secret"})
+		server.HandleFunc("GET /status", okHandler)
+
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		req := httptest.NewRequest(http.MethodGet, "/status", nil)
+		req.Header.Set("Authorization", "Bearer invalid")
+		rec = httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		req = httptest.NewRequest(http.MethodGet, "/status", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec = httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("With a public handler", func(t *testing.T) {
+		server := NewServer(ServerConfig{AuthToken: "secret"})
+		server.HandlePublic("GET /health", http.HandlerFunc(okHandler))
+
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
@@ -1,12 +1,14 @@
 package tests
 
+import "context"
+
 type MockFlagStore struct {
 	Key            string
 	ExecutionCount int
 	ReturnedError  error
 }
 
-func (mfs *MockFlagStore) Flag(key string) error {
+func (mfs *MockFlagStore) Flag(ctx context.Context, key string) error {
 	mfs.ExecutionCount++
 	mfs.Key = key
 
@@ -2,19 +2,30 @@ package tests
 
 import (
 	"context"
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kgo"
 
 	"github.com/getlago/lago/events-processor/config/kafka"
 )
 
+// MockMessageProducer records the last produced message, it can be shared by concurrent producers
 type MockMessageProducer struct {
+	mu sync.Mutex
+
 	Key            []byte
 	Value          []byte
+	Headers        []kgo.RecordHeader
 	ExecutionCount int
 }
 
 func (mp *MockMessageProducer) Produce(ctx context.Context, msg *kafka.ProducerMessage) bool {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
 	mp.Key = msg.Key
 	mp.Value = msg.Value
+	mp.Headers = msg.Headers
 	mp.ExecutionCount++
 
 	return true
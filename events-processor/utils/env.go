@@ -32,6 +32,19 @@ func ParseBrokersEnv(brokersStr string) []string {
 	return brokers
 }
 
+// GetEnvAsList parses a comma-separated environment variable, blank items are ignored
+func GetEnvAsList(key string) []string {
+	values := []string{}
+	for value := range strings.SplitSeq(os.Getenv(key), ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
 func GetEnvAsBool(key string, defaultValue bool) bool {
 	value := os.Getenv(key)
 	boolValue, err := strconv.ParseBool(value)
@@ -48,6 +48,19 @@ func TestParseBrokersEnv(t *testing.T) {
 	})
 }
 
+func TestGetEnvAsList(t *testing.T) {
+	t.Run("should parse comma-separated values", func(t *testing.T) {
+		t.Setenv("TEST_LIST_ENV", "org1, org2,,org3 ")
+		value := GetEnvAsList("TEST_LIST_ENV")
+		assert.Equal(t, []string{"org1", "org2", "org3"}, value)
+	})
+
+	t.Run("should return empty slice when environment variable is not set", func(t *testing.T) {
+		value := GetEnvAsList("NON_EXISTENT_LIST_ENV")
+		assert.Equal(t, []string{}, value)
+	})
+}
+
 func TestGetEnvAsBool(t *testing.T) {
 	t.Run("should return true when environment variable is set to 'true'", func(t *testing.T) {
 		t.Setenv("TEST_BOOL_ENV", "true")
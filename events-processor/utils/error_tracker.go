@@ -11,13 +11,19 @@ func CaptureErrorResult(errResult AnyResult) {
 }
 
 func CaptureErrorResultWithExtra(errResult AnyResult, extraKey string, extraValue any) {
+	extras := map[string]any{}
+	if extraKey != "" {
+		extras[extraKey] = extraValue
+	}
+
+	CaptureErrorResultWithExtras(errResult, extras)
+}
+
+func CaptureErrorResultWithExtras(errResult AnyResult, extras map[string]any) {
 	sentry.WithScope(func(scope *sentry.Scope) {
 		scope.SetExtra("error_code", errResult.ErrorCode())
 		scope.SetExtra("error_message", errResult.ErrorMessage())
-
-		if extraKey != "" {
-			scope.SetExtra(extraKey, extraValue)
-		}
+		scope.SetExtras(extras)
 
 		sentry.CaptureException(errResult.Error())
 	})